@@ -0,0 +1,162 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// addr returns the address of the first byte of mmap, or zero if it's empty.
+func (mmap MMap) addr() uintptr {
+	if len(mmap) == 0 {
+		return 0
+	}
+	return uintptr(unsafe.Pointer(unsafe.SliceData(mmap)))
+}
+
+// sliceAt returns the length bytes of memory starting at addr, as returned by
+// a system call, as an MMap. The address the system hands back has to be
+// turned into a pointer at some point; it's done by setting the Data field of
+// a real slice header, the one form of it package unsafe allows, and is sound
+// because mapped memory isn't managed by the garbage collector, which neither
+// moves nor frees it. Memory that is already held as a pointer, like that of
+// a mapHandle, doesn't need to go through here.
+func sliceAt(addr uintptr, length int) MMap {
+	mmap := MMap{}
+	if length == 0 {
+		return mmap
+	}
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&mmap))
+	h.Data, h.Len, h.Cap = addr, length, length
+	return mmap
+}
+
+// pageAligned widens b to cover every page it touches, so it can be handed to
+// system calls that require a page-aligned address. Memory is mapped in whole
+// pages, so the extra bytes are always valid.
+func pageAligned(b []byte) MMap {
+	if len(b) == 0 {
+		return nil
+	}
+	p := unsafe.Pointer(&b[0])
+	extra := int(uintptr(p) & uintptr(os.Getpagesize()-1))
+	return unsafe.Slice((*byte)(unsafe.Add(p, -extra)), extra+len(b))
+}
+
+// inBounds reports whether n bytes starting at off fit within mmap.
+func (mmap MMap) inBounds(off, n int) bool {
+	return off >= 0 && off <= len(mmap)-n
+}
+
+// Uint16At decodes the uint16 stored at off using the given byte order.
+func (mmap MMap) Uint16At(off int, order binary.ByteOrder) (uint16, error) {
+	if !mmap.inBounds(off, 2) {
+		return 0, ErrOutOfBounds
+	}
+	return order.Uint16(mmap[off:]), nil
+}
+
+// Uint32At decodes the uint32 stored at off using the given byte order.
+func (mmap MMap) Uint32At(off int, order binary.ByteOrder) (uint32, error) {
+	if !mmap.inBounds(off, 4) {
+		return 0, ErrOutOfBounds
+	}
+	return order.Uint32(mmap[off:]), nil
+}
+
+// Uint64At decodes the uint64 stored at off using the given byte order.
+func (mmap MMap) Uint64At(off int, order binary.ByteOrder) (uint64, error) {
+	if !mmap.inBounds(off, 8) {
+		return 0, ErrOutOfBounds
+	}
+	return order.Uint64(mmap[off:]), nil
+}
+
+// PutUint16At encodes v at off using the given byte order.
+func (mmap MMap) PutUint16At(off int, v uint16, order binary.ByteOrder) error {
+	if !mmap.inBounds(off, 2) {
+		return ErrOutOfBounds
+	}
+	order.PutUint16(mmap[off:], v)
+	return nil
+}
+
+// PutUint32At encodes v at off using the given byte order.
+func (mmap MMap) PutUint32At(off int, v uint32, order binary.ByteOrder) error {
+	if !mmap.inBounds(off, 4) {
+		return ErrOutOfBounds
+	}
+	order.PutUint32(mmap[off:], v)
+	return nil
+}
+
+// PutUint64At encodes v at off using the given byte order.
+func (mmap MMap) PutUint64At(off int, v uint64, order binary.ByteOrder) error {
+	if !mmap.inBounds(off, 8) {
+		return ErrOutOfBounds
+	}
+	order.PutUint64(mmap[off:], v)
+	return nil
+}
+
+// StringAt returns the n bytes at off as a string, without copying them.
+// The string points straight into the mapping, so it must not be used once
+// the mapping is unmapped, and it changes whenever the mapped bytes do,
+// breaking the rule that Go strings are immutable. Strings that outlive the
+// mapping, or serve as map keys while the mapping is written to, should be
+// obtained with CopyStringAt instead.
+func (mmap MMap) StringAt(off, n int) (string, error) {
+	if n < 0 || !mmap.inBounds(off, n) {
+		return "", ErrOutOfBounds
+	}
+	if n == 0 {
+		return "", nil
+	}
+	return unsafe.String(&mmap[off], n), nil
+}
+
+// CopyStringAt returns a copy of the n bytes at off as a string, which stays
+// valid after the mapping is unmapped.
+func (mmap MMap) CopyStringAt(off, n int) (string, error) {
+	if n < 0 || !mmap.inBounds(off, n) {
+		return "", ErrOutOfBounds
+	}
+	return string(mmap[off : off+n]), nil
+}
+
+// AlignedAt returns the n bytes at off, without copying them, after checking
+// that they lie within the mapping and start at an address that is a
+// multiple of align, which must be a power of two. It is meant for handing
+// a serialized message to a zero-copy reader, such as those of FlatBuffers
+// or Cap'n Proto, which load fields in place and would take misaligned
+// loads, or fault on strict-alignment architectures, if the message
+// weren't aligned. It returns ErrOutOfBounds or ErrUnaligned otherwise.
+func (mmap MMap) AlignedAt(off, n, align int) ([]byte, error) {
+	checkAlign(int64(align))
+	if n < 0 || !mmap.inBounds(off, n) {
+		return nil, ErrOutOfBounds
+	}
+	if n > 0 && mmap[off:].addr()&uintptr(align-1) != 0 {
+		return nil, ErrUnaligned
+	}
+	return mmap[off : off+n : off+n], nil
+}
+
+// CopyIfUnaligned is like AlignedAt, but when the bytes aren't aligned it
+// returns a copy of them in memory allocated with the alignment, reporting
+// that it did so. Messages written at aligned offsets of page-aligned
+// mappings are then read in place, and others still safely.
+func (mmap MMap) CopyIfUnaligned(off, n, align int) ([]byte, bool, error) {
+	b, err := mmap.AlignedAt(off, n, align)
+	if err != ErrUnaligned {
+		return b, false, err
+	}
+	// The garbage collector doesn't move allocations, so the copy keeps
+	// the alignment it is carved at.
+	buf := make([]byte, n+align-1)
+	skip := int(-uintptr(unsafe.Pointer(&buf[0])) & uintptr(align-1))
+	b = buf[skip : skip+n : skip+n]
+	copy(b, mmap[off:])
+	return b, true, nil
+}
@@ -0,0 +1,61 @@
+package gommap
+
+import (
+	"os"
+	"unsafe"
+)
+
+// checkAlign panics if size isn't a power of two, which every page size is.
+func checkAlign(size int64) {
+	if size <= 0 || size&(size-1) != 0 {
+		panic("gommap: alignment must be a power of two")
+	}
+}
+
+// AlignDown rounds off down to a multiple of size, which must be a power of
+// two such as the size of a huge page.
+func AlignDown(off, size int64) int64 {
+	checkAlign(size)
+	return off &^ (size - 1)
+}
+
+// AlignUp rounds off up to a multiple of size, which must be a power of two
+// such as the size of a huge page.
+func AlignUp(off, size int64) int64 {
+	checkAlign(size)
+	return (off + size - 1) &^ (size - 1)
+}
+
+// PageAlignDown rounds off down to a multiple of the page size.
+func PageAlignDown(off int64) int64 {
+	return AlignDown(off, int64(os.Getpagesize()))
+}
+
+// PageAlignUp rounds off up to a multiple of the page size.
+func PageAlignUp(off int64) int64 {
+	return AlignUp(off, int64(os.Getpagesize()))
+}
+
+// AlignedRange widens the range of n bytes starting at off to whole pages of
+// size bytes, and returns the start and length of the widened range. This is
+// what the offset and length given to mmap of a part of a file must be.
+func AlignedRange(off, n, size int64) (start, length int64) {
+	start = AlignDown(off, size)
+	return start, AlignUp(off+n, size) - start
+}
+
+// AlignedSlice widens b to cover every page of size bytes it touches, so it
+// can be handed to system calls requiring an aligned address and length,
+// such as msync and madvise. The widened slice spans memory outside of b,
+// which is only valid if the pages around b are mapped: b must be part of a
+// mapping backed by pages of that size, or size must be the base page size.
+func AlignedSlice(b []byte, size int) MMap {
+	checkAlign(int64(size))
+	if len(b) == 0 {
+		return nil
+	}
+	p := unsafe.Pointer(&b[0])
+	extra := int(uintptr(p) & uintptr(size-1))
+	length := (extra + len(b) + size - 1) &^ (size - 1)
+	return unsafe.Slice((*byte)(unsafe.Add(p, -extra)), length)
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "os"
+
+// AllocAligned returns a zeroed buffer of size bytes starting at an address
+// that is a multiple of align, carved from an anonymous mapping, as needed
+// for I/O on files opened with O_DIRECT. align must be a power of two; any
+// value up to the page size yields a page-aligned buffer. The buffer is
+// invisible to the garbage collector and must be released with
+// ReleaseAligned.
+//
+// For alignments above the page size, a larger range is mapped and its
+// unaligned ends unmapped right away, so no memory is wasted.
+func AllocAligned(size, align int) (MMap, error) {
+	checkAlign(int64(align))
+	if size <= 0 {
+		return nil, ErrSize
+	}
+	pageSize := os.Getpagesize()
+	if align <= pageSize {
+		return MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	}
+	length := int(AlignUp(int64(size), int64(pageSize)))
+	mmap, err := MapAnonymous(int64(length+align-pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	head := int(uintptr(align) - mmap.addr()&uintptr(align-1))
+	if head == align {
+		head = 0
+	}
+	if head > 0 {
+		mmap[:head].UnsafeUnmap()
+	}
+	if tail := mmap[head+length:]; len(tail) > 0 {
+		tail.UnsafeUnmap()
+	}
+	return mmap[head : head+size : head+size], nil
+}
+
+// ReleaseAligned unmaps a buffer returned by AllocAligned. The buffer must
+// not be used afterwards.
+func ReleaseAligned(buf MMap) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	return buf[:cap(buf)].UnsafeUnmap()
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "syscall"
+
+// processAlive reports whether the process with the given PID exists. A
+// process that exited but wasn't reaped yet still counts as alive.
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
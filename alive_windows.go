@@ -0,0 +1,25 @@
+package gommap
+
+import "syscall"
+
+const (
+	_PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+	_STILL_ACTIVE                      = 259
+	_ERROR_INVALID_PARAMETER           = syscall.Errno(87)
+)
+
+// processAlive reports whether the process with the given PID is running.
+// If it can't be opened for any reason other than not existing, it is
+// assumed to be alive.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(_PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err != _ERROR_INVALID_PARAMETER
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == _STILL_ACTIVE
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// arenaAlign is the alignment of every allocation made from an Arena.
+const arenaAlign = 8
+
+// The Arena type hands out byte slices carved from a single large anonymous
+// mapping by bumping a cursor. The memory is invisible to the garbage
+// collector, so it costs nothing to scan, and Reset returns it to the
+// operating system in one call instead of waiting for a collection.
+//
+// Slices returned by Alloc must not be used after Reset or Close, and must
+// not be used to hold pointers to Go memory. An Arena is not safe for
+// concurrent use.
+type Arena struct {
+	mmap MMap
+	off  int
+}
+
+// NewArena reserves size bytes of address space for a new arena. Pages are
+// only backed by memory once they are used.
+func NewArena(size int) (*Arena, error) {
+	mmap, err := MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_NORESERVE)
+	if err != nil {
+		return nil, err
+	}
+	return &Arena{mmap: mmap}, nil
+}
+
+// Alloc returns a zeroed slice of n bytes, aligned to 8 bytes. It returns
+// ErrFull if the arena doesn't have n bytes left.
+func (a *Arena) Alloc(n int) ([]byte, error) {
+	start := (a.off + arenaAlign - 1) &^ (arenaAlign - 1)
+	if n < 0 || start > len(a.mmap) || n > len(a.mmap)-start {
+		return nil, ErrFull
+	}
+	a.off = start + n
+	return a.mmap[start:a.off:a.off], nil
+}
+
+// Used returns the number of bytes allocated since the arena was created or
+// last reset.
+func (a *Arena) Used() int {
+	return a.off
+}
+
+// Cap returns the size of the arena.
+func (a *Arena) Cap() int {
+	return len(a.mmap)
+}
+
+// Reset releases every allocation at once. The pages used so far are
+// returned to the operating system with MADV_DONTNEED, and read back as
+// zeros when allocated again.
+func (a *Arena) Reset() error {
+	if a.off == 0 {
+		return nil
+	}
+	if err := pageAligned(a.mmap[:a.off]).Advise(MADV_DONTNEED); err != nil {
+		return err
+	}
+	a.off = 0
+	return nil
+}
+
+// Close unmaps the arena.
+func (a *Arena) Close() error {
+	return a.mmap.UnsafeUnmap()
+}
@@ -0,0 +1,77 @@
+package gommap
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// uint64Ptr returns a pointer to the 64-bit word at off, verifying that it is
+// inside the mapping and naturally aligned, as sync/atomic requires.
+func (mmap MMap) uint64Ptr(off int) (*uint64, error) {
+	if !mmap.inBounds(off, 8) {
+		return nil, ErrOutOfBounds
+	}
+	p := unsafe.Pointer(&mmap[off])
+	if uintptr(p)%8 != 0 {
+		return nil, ErrUnaligned
+	}
+	return (*uint64)(p), nil
+}
+
+// uint32Ptr is like uint64Ptr, for 32-bit words.
+func (mmap MMap) uint32Ptr(off int) (*uint32, error) {
+	if !mmap.inBounds(off, 4) {
+		return nil, ErrOutOfBounds
+	}
+	p := unsafe.Pointer(&mmap[off])
+	if uintptr(p)%4 != 0 {
+		return nil, ErrUnaligned
+	}
+	return (*uint32)(p), nil
+}
+
+// AtomicUint64At atomically loads the uint64 stored at off. The offset must
+// be 8-byte aligned in memory.
+//
+// Atomic operations on a MAP_SHARED mapping are visible to every process
+// mapping the same file, which makes them suitable for lock-free counters
+// shared between processes. Values are stored in native byte order.
+func (mmap MMap) AtomicUint64At(off int) (uint64, error) {
+	p, err := mmap.uint64Ptr(off)
+	if err != nil {
+		return 0, err
+	}
+	return atomic.LoadUint64(p), nil
+}
+
+// AtomicStoreUint64At atomically stores v at off. The offset must be 8-byte
+// aligned in memory.
+func (mmap MMap) AtomicStoreUint64At(off int, v uint64) error {
+	p, err := mmap.uint64Ptr(off)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(p, v)
+	return nil
+}
+
+// AtomicAddUint64At atomically adds delta to the uint64 stored at off and
+// returns the new value. The offset must be 8-byte aligned in memory.
+func (mmap MMap) AtomicAddUint64At(off int, delta uint64) (uint64, error) {
+	p, err := mmap.uint64Ptr(off)
+	if err != nil {
+		return 0, err
+	}
+	return atomic.AddUint64(p, delta), nil
+}
+
+// CompareAndSwapUint64At atomically replaces the uint64 stored at off with
+// new if it currently holds old, and reports whether the swap happened. The
+// offset must be 8-byte aligned in memory.
+func (mmap MMap) CompareAndSwapUint64At(off int, old, new uint64) (bool, error) {
+	p, err := mmap.uint64Ptr(off)
+	if err != nil {
+		return false, err
+	}
+	return atomic.CompareAndSwapUint64(p, old, new), nil
+}
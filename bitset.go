@@ -0,0 +1,96 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The Bitset type is a set of bits stored in a mapping, with bit i held in
+// bit i%8 of byte i/8. Backed by a file mapped with MAP_SHARED, it persists
+// across restarts, which makes it a good fit for free-space maps and
+// tombstone tracking.
+//
+// A Bitset is not safe for concurrent use.
+type Bitset struct {
+	mmap MMap
+}
+
+// NewBitset returns a Bitset using the memory in mmap, holding 8*len(mmap)
+// bits.
+func NewBitset(mmap MMap) *Bitset {
+	return &Bitset{mmap: mmap}
+}
+
+// Len returns the number of bits in the set.
+func (b *Bitset) Len() uint64 {
+	return uint64(len(b.mmap)) * 8
+}
+
+// Set sets bit i. It panics if i is out of range.
+func (b *Bitset) Set(i uint64) {
+	b.mmap[i/8] |= 1 << (i % 8)
+}
+
+// Clear clears bit i. It panics if i is out of range.
+func (b *Bitset) Clear(i uint64) {
+	b.mmap[i/8] &^= 1 << (i % 8)
+}
+
+// Test reports whether bit i is set. It panics if i is out of range.
+func (b *Bitset) Test(i uint64) bool {
+	return b.mmap[i/8]&(1<<(i%8)) != 0
+}
+
+// Count returns the number of bits set.
+func (b *Bitset) Count() uint64 {
+	var n int
+	m := b.mmap
+	for ; len(m) >= 8; m = m[8:] {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(m))
+	}
+	for _, c := range m {
+		n += bits.OnesCount8(c)
+	}
+	return uint64(n)
+}
+
+// next returns the first bit at or after i whose value is set, xoring each
+// byte with flip first so the same loop can look for clear bits.
+func (b *Bitset) next(i uint64, flip byte) (uint64, bool) {
+	for n := b.Len(); i < n; {
+		c := (b.mmap[i/8] ^ flip) >> (i % 8)
+		if c != 0 {
+			return i + uint64(bits.TrailingZeros8(c)), true
+		}
+		i = (i/8 + 1) * 8
+	}
+	return 0, false
+}
+
+// NextSet returns the first set bit at or after i, and false if there's
+// none.
+func (b *Bitset) NextSet(i uint64) (uint64, bool) {
+	return b.next(i, 0)
+}
+
+// NextClear returns the first clear bit at or after i, and false if there's
+// none.
+func (b *Bitset) NextClear(i uint64) (uint64, bool) {
+	return b.next(i, 0xff)
+}
+
+// Range calls fn for each set bit in [from, to), in increasing order, until
+// fn returns false.
+func (b *Bitset) Range(from, to uint64, fn func(i uint64) bool) {
+	for i, ok := b.NextSet(from); ok && i < to; i, ok = b.NextSet(i + 1) {
+		if !fn(i) {
+			return
+		}
+	}
+}
+
+// Sync flushes the set to the backing file. See MMap.Sync. The set needn't
+// start on a page boundary, as the pages it lies in are flushed whole.
+func (b *Bitset) Sync(flags SyncFlags) error {
+	return pageAligned(b.mmap).Sync(flags)
+}
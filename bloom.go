@@ -0,0 +1,136 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+)
+
+// Layout of the header of a Bloom filter stored in a mapping. The checksum
+// covers the bytes before it.
+const (
+	bloomMagic       = 0x4d4c4247 // "GBLM"
+	bloomMagicOff    = 0
+	bloomKOff        = 4
+	bloomMOff        = 8
+	bloomChecksumOff = 16
+	bloomHeaderSize  = 32
+)
+
+// The Bloom type is a Bloom filter stored in a mapping: a small header with
+// the filter parameters and their checksum, followed by the bit array. Other
+// processes can map the same file and query the filter with no
+// deserialization step.
+//
+// A Bloom filter is not safe for concurrent use while being written.
+type Bloom struct {
+	bits *Bitset
+	m    uint64
+	k    uint32
+}
+
+// BloomSize returns the number of bytes needed to store a filter of m bits.
+func BloomSize(m uint64) int {
+	return bloomHeaderSize + int((m+7)/8)
+}
+
+// OptimalBloomParams returns the number of bits and of hash functions that
+// minimize the size of a filter meant to hold n elements with a false
+// positive rate of p.
+func OptimalBloomParams(n int, p float64) (m uint64, k int) {
+	fm := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	fk := math.Round(fm / float64(n) * math.Ln2)
+	if fk < 1 {
+		fk = 1
+	}
+	return uint64(fm), int(fk)
+}
+
+// NewBloom initializes an empty filter of m bits using k hash functions at
+// the start of mmap, which must be at least BloomSize(m) bytes long.
+func NewBloom(mmap MMap, m uint64, k int) (*Bloom, error) {
+	if m == 0 || k <= 0 || int64(k) > math.MaxUint32 || uint64(len(mmap)) < bloomHeaderSize+(m+7)/8 {
+		return nil, ErrSize
+	}
+	for i := range mmap[:BloomSize(m)] {
+		mmap[i] = 0
+	}
+	binary.LittleEndian.PutUint32(mmap[bloomMagicOff:], bloomMagic)
+	binary.LittleEndian.PutUint32(mmap[bloomKOff:], uint32(k))
+	binary.LittleEndian.PutUint64(mmap[bloomMOff:], m)
+	binary.LittleEndian.PutUint32(mmap[bloomChecksumOff:], crc32.ChecksumIEEE(mmap[:bloomChecksumOff]))
+	return newBloom(mmap, m, uint32(k)), nil
+}
+
+// OpenBloom returns the filter previously initialized with NewBloom at the
+// start of mmap. It returns ErrCorrupt if the header is invalid.
+func OpenBloom(mmap MMap) (*Bloom, error) {
+	if len(mmap) < bloomHeaderSize ||
+		binary.LittleEndian.Uint32(mmap[bloomMagicOff:]) != bloomMagic ||
+		binary.LittleEndian.Uint32(mmap[bloomChecksumOff:]) != crc32.ChecksumIEEE(mmap[:bloomChecksumOff]) {
+		return nil, ErrCorrupt
+	}
+	k := binary.LittleEndian.Uint32(mmap[bloomKOff:])
+	m := binary.LittleEndian.Uint64(mmap[bloomMOff:])
+	if k == 0 || m == 0 || (m+7)/8 > uint64(len(mmap)-bloomHeaderSize) {
+		return nil, ErrCorrupt
+	}
+	return newBloom(mmap, m, k), nil
+}
+
+func newBloom(mmap MMap, m uint64, k uint32) *Bloom {
+	end := bloomHeaderSize + (m+7)/8
+	return &Bloom{bits: NewBitset(mmap[bloomHeaderSize:end]), m: m, k: k}
+}
+
+// fnv64a returns the 64-bit FNV-1a hash of data.
+func fnv64a(data []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// bloomHash returns the two halves of the 64-bit FNV-1a hash of data, which are
+// combined to derive the k probe positions.
+func bloomHash(data []byte) (uint64, uint64) {
+	h := fnv64a(data)
+	return h & 0xffffffff, h >> 32
+}
+
+// Add adds data to the filter.
+func (b *Bloom) Add(data []byte) {
+	h1, h2 := bloomHash(data)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		b.bits.Set((h1 + i*h2) % b.m)
+	}
+}
+
+// Test reports whether data may have been added to the filter. False
+// positives are possible, false negatives are not.
+func (b *Bloom) Test(data []byte) bool {
+	h1, h2 := bloomHash(data)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !b.bits.Test((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// M returns the number of bits in the filter.
+func (b *Bloom) M() uint64 {
+	return b.m
+}
+
+// K returns the number of hash functions used by the filter.
+func (b *Bloom) K() int {
+	return int(b.k)
+}
+
+// Sync flushes the filter to the backing file. See MMap.Sync.
+func (b *Bloom) Sync(flags SyncFlags) error {
+	return b.bits.Sync(flags)
+}
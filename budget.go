@@ -0,0 +1,72 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// The MemoryBudget type guards Lock and Prefault requests against taking
+// more of the memory of the cgroup of the process than a given share of its
+// limit, so that a containerized service locking or faulting in a big
+// mapping fails cleanly rather than being killed for lack of memory.
+//
+// A request is over budget when the current usage of the cgroup plus the
+// pages of the mapping not resident yet exceed Fraction of the limit. The
+// usage includes the page cache charged to the cgroup, some of which could
+// be reclaimed, so the check errs on the side of caution. Requests are
+// always allowed when the process has no cgroup memory limit, including on
+// platforms other than Linux.
+type MemoryBudget struct {
+	// Fraction is the share of the cgroup memory limit requests may take
+	// the usage up to, between 0 and 1.
+	Fraction float64
+	// OnExceed, if set, is called for requests over budget, which then
+	// proceed, instead of failing with ErrBudget. It is given the bytes
+	// the request needs and those left within the budget.
+	OnExceed func(needed, available int64)
+}
+
+// Check returns ErrBudget if faulting in all of mmap would exceed the
+// budget, unless OnExceed is set, in which case it is called instead.
+func (b MemoryBudget) Check(mmap MMap) error {
+	mem, err := ReadCgroupMemory()
+	if err == ErrUnsupported || err == nil && mem.Limit == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resident, err := mmap.ResidentBytes()
+	if err != nil {
+		return err
+	}
+	needed := int64(len(mmap)) - resident
+	available := int64(b.Fraction*float64(mem.Limit)) - mem.Usage
+	if needed <= available {
+		return nil
+	}
+	if available < 0 {
+		available = 0
+	}
+	if b.OnExceed != nil {
+		b.OnExceed(needed, available)
+		return nil
+	}
+	return ErrBudget
+}
+
+// Lock locks mmap in memory, like MMap.Lock, if that fits in the budget.
+func (b MemoryBudget) Lock(mmap MMap) error {
+	if err := b.Check(mmap); err != nil {
+		return err
+	}
+	return mmap.Lock()
+}
+
+// Prefault touches every page of mmap, like MMap.Prefault, if that fits in
+// the budget.
+func (b MemoryBudget) Prefault(mmap MMap) error {
+	if err := b.Check(mmap); err != nil {
+		return err
+	}
+	mmap.Prefault()
+	return nil
+}
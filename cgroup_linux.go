@@ -0,0 +1,111 @@
+package gommap
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is where the cgroup file systems are conventionally mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupUnlimited is the threshold above which a cgroup v1 limit, which is
+// a huge number rather than "max" when unset, means no limit.
+const cgroupUnlimited = 1 << 62
+
+// The CgroupMemory type holds the memory limit of the cgroup of the process
+// and its current usage, which includes the page cache charged to it.
+type CgroupMemory struct {
+	// Limit is zero if the cgroup has no memory limit.
+	Limit int64
+	Usage int64
+}
+
+// ReadCgroupMemory returns the memory limit and usage of the cgroup the
+// process belongs to, under cgroup v2 or, failing that, under the memory
+// controller of cgroup v1. When the cgroup of the process isn't visible,
+// as in containers without a cgroup namespace, the root of the hierarchy is
+// used, which is the container's own cgroup. It returns ErrUnsupported if
+// neither hierarchy is available.
+func ReadCgroupMemory() (CgroupMemory, error) {
+	v2, v1, err := cgroupPaths()
+	if err != nil {
+		return CgroupMemory{}, err
+	}
+	for _, dir := range cgroupDirs(v2, cgroupRoot, filepath.Join(cgroupRoot, "unified")) {
+		if mem, err := readCgroupMemory(dir, "memory.max", "memory.current"); err == nil {
+			return mem, nil
+		}
+	}
+	for _, dir := range cgroupDirs(v1, filepath.Join(cgroupRoot, "memory")) {
+		if mem, err := readCgroupMemory(dir, "memory.limit_in_bytes", "memory.usage_in_bytes"); err == nil {
+			return mem, nil
+		}
+	}
+	return CgroupMemory{}, ErrUnsupported
+}
+
+// cgroupPaths returns the path of the cgroup of the process in the v2
+// hierarchy and in the v1 memory hierarchy, as listed in /proc/self/cgroup.
+func cgroupPaths() (v2, v1 string, err error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if os.IsNotExist(err) {
+		return "", "", ErrUnsupported
+	}
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2 = fields[2]
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == "memory" {
+				v1 = fields[2]
+			}
+		}
+	}
+	return v2, v1, s.Err()
+}
+
+// cgroupDirs returns the directories of the cgroup at path under each of
+// the given mount points, followed by the mount points themselves.
+func cgroupDirs(path string, mounts ...string) []string {
+	var dirs []string
+	if path != "" && path != "/" {
+		for _, m := range mounts {
+			dirs = append(dirs, filepath.Join(m, path))
+		}
+	}
+	return append(dirs, mounts...)
+}
+
+func readCgroupMemory(dir, limitName, usageName string) (CgroupMemory, error) {
+	var mem CgroupMemory
+	limit, err := os.ReadFile(filepath.Join(dir, limitName))
+	if err != nil {
+		return mem, err
+	}
+	if s := strings.TrimSpace(string(limit)); s != "max" {
+		if mem.Limit, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return mem, err
+		}
+		if mem.Limit >= cgroupUnlimited {
+			mem.Limit = 0
+		}
+	}
+	usage, err := os.ReadFile(filepath.Join(dir, usageName))
+	if err != nil {
+		return mem, err
+	}
+	mem.Usage, err = strconv.ParseInt(strings.TrimSpace(string(usage)), 10, 64)
+	return mem, err
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package gommap
+
+// The CgroupMemory type holds the memory limit of the cgroup of the process
+// and its current usage. Cgroups only exist on Linux.
+type CgroupMemory struct {
+	Limit int64
+	Usage int64
+}
+
+// ReadCgroupMemory returns ErrUnsupported.
+func ReadCgroupMemory() (CgroupMemory, error) {
+	return CgroupMemory{}, ErrUnsupported
+}
@@ -0,0 +1,101 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// ChecksumTrailerSize is the size of the trailer added by AppendChecksum.
+const ChecksumTrailerSize = 16
+
+// checksumMagic marks a checksum trailer: "gmck" in little-endian order.
+const checksumMagic = 0x6b636d67
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the CRC-32C of mmap. The pages are read in order, so the
+// kernel is advised to read ahead aggressively meanwhile.
+func checksum(mmap MMap) uint32 {
+	aligned := pageAligned(mmap)
+	aligned.Advise(MADV_SEQUENTIAL)
+	defer aligned.Advise(MADV_NORMAL)
+	return crc32.Checksum(mmap, castagnoli)
+}
+
+// AppendChecksum appends to f a trailer holding the CRC-32C of its current
+// contents, to be checked by VerifyChecksum or WithChecksum when the file is
+// mapped later on.
+func AppendChecksum(f *os.File) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	h := crc32.New(castagnoli)
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return err
+	}
+	var trailer [ChecksumTrailerSize]byte
+	binary.LittleEndian.PutUint32(trailer[0:], checksumMagic)
+	binary.LittleEndian.PutUint32(trailer[4:], h.Sum32())
+	binary.LittleEndian.PutUint64(trailer[8:], uint64(size))
+	_, err = f.WriteAt(trailer[:], size)
+	return err
+}
+
+// VerifyChecksum checks the trailer written by AppendChecksum at the end of
+// mmap, which must hold the whole file, against the data preceding it. It
+// returns the length of that data, or ErrCorrupt if the trailer is missing
+// or doesn't match.
+func VerifyChecksum(mmap MMap) (int, error) {
+	n := len(mmap) - ChecksumTrailerSize
+	if n < 0 {
+		return 0, ErrCorrupt
+	}
+	trailer := mmap[n:]
+	if binary.LittleEndian.Uint32(trailer[0:]) != checksumMagic ||
+		binary.LittleEndian.Uint64(trailer[8:]) != uint64(n) ||
+		binary.LittleEndian.Uint32(trailer[4:]) != checksum(mmap[:n]) {
+		return 0, ErrCorrupt
+	}
+	return n, nil
+}
+
+// WithChecksum returns an option verifying the whole file against the
+// trailer written by AppendChecksum before the mapping is handed out, which
+// fails with ErrCorrupt if it doesn't match. The mapping must cover the
+// whole file.
+func WithChecksum() MappingOption {
+	return func(m *Mapping) error {
+		if m.offset != 0 {
+			return ErrCorrupt
+		}
+		_, err := VerifyChecksum(m.mmap)
+		return err
+	}
+}
+
+// WithRegionChecksum returns an option verifying, before the mapping is
+// handed out, that the length bytes of the mapping starting at offset have
+// the CRC-32C stored in little-endian order at sumOffset, as found in the
+// header of many file formats. Offsets are relative to the mapping. The
+// mapping fails with ErrCorrupt if the checksum doesn't match.
+func WithRegionChecksum(sumOffset, offset, length int) MappingOption {
+	return func(m *Mapping) error {
+		sum, err := m.mmap.Uint32At(sumOffset, binary.LittleEndian)
+		if err != nil {
+			return err
+		}
+		if length < 0 || !m.mmap.inBounds(offset, length) {
+			return ErrOutOfBounds
+		}
+		if sum != checksum(m.mmap[offset:offset+length]) {
+			return ErrCorrupt
+		}
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+)
+
+// Equal reports whether mmap and other hold the same bytes. See FirstDiff.
+func (mmap MMap) Equal(other MMap) bool {
+	return len(mmap) == len(other) && mmap.FirstDiff(other) < 0
+}
+
+// FirstDiff returns the offset of the first byte that differs between mmap
+// and other, or -1 if they are equal. If one is a prefix of the other, the
+// length of the shorter one is returned.
+//
+// The mappings are compared page by page, telling the kernel they are read
+// sequentially, and a page is only examined byte by byte once it is known to
+// differ. Pages sitting at the same address in both, as when comparing a
+// mapping with part of itself, are skipped without being read.
+func (mmap MMap) FirstDiff(other MMap) int {
+	n := len(mmap)
+	if len(other) < n {
+		n = len(other)
+	}
+	a, b := mmap[:n], other[:n]
+	if n > 0 && &a[0] != &b[0] {
+		// Advice is only a hint, so failures are not worth reporting.
+		pageAligned(a).Advise(MADV_SEQUENTIAL)
+		pageAligned(b).Advise(MADV_SEQUENTIAL)
+		pageSize := os.Getpagesize()
+		for off := 0; off < n; off += pageSize {
+			end := off + pageSize
+			if end > n {
+				end = n
+			}
+			if !bytes.Equal(a[off:end], b[off:end]) {
+				return off + firstDiff(a[off:end], b[off:end])
+			}
+		}
+	}
+	if len(mmap) != len(other) {
+		return n
+	}
+	return -1
+}
+
+// firstDiff returns the offset of the first byte differing between a and b,
+// which have the same length and are known to differ, comparing eight bytes
+// at a time until the differing word is found.
+func firstDiff(a, b []byte) int {
+	i := 0
+	for ; i+8 <= len(a); i += 8 {
+		if binary.LittleEndian.Uint64(a[i:]) != binary.LittleEndian.Uint64(b[i:]) {
+			break
+		}
+	}
+	for ; i < len(a); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
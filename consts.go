@@ -18,11 +18,9 @@ const (
 	MAP_SHARED    MapFlags = 0x1
 	MAP_PRIVATE   MapFlags = 0x2
 	MAP_FIXED     MapFlags = 0x10
-	MAP_ANONYMOUS MapFlags = 0x20
 	MAP_GROWSDOWN MapFlags = 0x100
 	MAP_LOCKED    MapFlags = 0x2000
 	MAP_NONBLOCK  MapFlags = 0x10000
-	MAP_NORESERVE MapFlags = 0x4000
 	MAP_POPULATE  MapFlags = 0x8000
 )
 
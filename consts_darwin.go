@@ -0,0 +1,22 @@
+package gommap
+
+// Advice only supported on darwin.
+//
+// MADV_FREE_REUSABLE tells the kernel the pages can be reclaimed and takes
+// them out of the memory footprint of the process, as reported by Activity
+// Monitor, right away, which MADV_FREE and MADV_DONTNEED don't. Their content
+// becomes undefined. MADV_FREE_REUSE must be issued on pages marked reusable
+// before using them again, so that they are accounted for once more.
+const (
+	MADV_FREE          AdviseFlags = 0x5
+	MADV_FREE_REUSABLE AdviseFlags = 0x7
+	MADV_FREE_REUSE    AdviseFlags = 0x8
+)
+
+// Mapping flags whose values differ between systems. MAP_ANONYMOUS is
+// another name for MAP_ANON.
+const (
+	MAP_ANON      MapFlags = 0x1000
+	MAP_ANONYMOUS MapFlags = MAP_ANON
+	MAP_NORESERVE MapFlags = 0x40
+)
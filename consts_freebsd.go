@@ -0,0 +1,9 @@
+package gommap
+
+// Mapping flags whose values differ between systems. MAP_ANONYMOUS is
+// another name for MAP_ANON. MAP_NORESERVE is accepted but ignored.
+const (
+	MAP_ANON      MapFlags = 0x1000
+	MAP_ANONYMOUS MapFlags = MAP_ANON
+	MAP_NORESERVE MapFlags = 0x40
+)
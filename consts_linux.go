@@ -0,0 +1,37 @@
+package gommap
+
+// Advice only supported on Linux.
+const (
+	MADV_DONTDUMP   AdviseFlags = 0x10
+	MADV_DODUMP     AdviseFlags = 0x11
+	MADV_WIPEONFORK AdviseFlags = 0x12
+	MADV_KEEPONFORK AdviseFlags = 0x13
+	MADV_HUGEPAGE   AdviseFlags = 0xe
+	MADV_NOHUGEPAGE AdviseFlags = 0xf
+	MADV_COLD       AdviseFlags = 0x14
+	MADV_PAGEOUT    AdviseFlags = 0x15
+
+	MADV_POPULATE_READ  AdviseFlags = 0x16
+	MADV_POPULATE_WRITE AdviseFlags = 0x17
+)
+
+// Mapping flags whose values differ between systems. MAP_ANONYMOUS is
+// another name for MAP_ANON.
+const (
+	MAP_ANON      MapFlags = 0x20
+	MAP_ANONYMOUS MapFlags = MAP_ANON
+	MAP_NORESERVE MapFlags = 0x4000
+)
+
+// Mapping flags only supported on Linux.
+const (
+	MAP_HUGETLB MapFlags = 0x40000
+	MAP_STACK   MapFlags = 0x20000
+	// MAP_SHARED_VALIDATE is MAP_SHARED, failing on unknown flags instead
+	// of ignoring them. MAP_SYNC requires it.
+	MAP_SHARED_VALIDATE MapFlags = 0x3
+	// MAP_SYNC makes writes through the mapping of a file on a DAX file
+	// system durable without msync, once flushed from the CPU caches. See
+	// FSInfo.DAX.
+	MAP_SYNC MapFlags = 0x80000
+)
@@ -0,0 +1,11 @@
+package gommap
+
+// Mapping flags only supported on Linux for x86-64.
+const (
+	// MAP_32BIT places the mapping in the first 2 GB of the address space,
+	// within reach of 32-bit relative branches from code mapped there.
+	MAP_32BIT MapFlags = 0x40
+)
+
+// map32Bit is the flag asking the kernel for an address in the first 2 GB.
+const map32Bit = MAP_32BIT
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package gommap
+
+import "syscall"
+
+// Mapping flags whose values differ between systems. MAP_ANONYMOUS is
+// another name for MAP_ANON. MAP_NORESERVE isn't supported, and is zero.
+const (
+	MAP_ANON      MapFlags = syscall.MAP_ANON
+	MAP_ANONYMOUS MapFlags = MAP_ANON
+	MAP_NORESERVE MapFlags = 0
+)
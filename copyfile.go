@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "os"
+
+// copyChunk is the size of the writes done by CopyToFile when the data is
+// copied through memory.
+const copyChunk = 1 << 20
+
+// CopyToFile writes the content of mmap to a new file at path, replacing any
+// file by that name. The mapping is read in order, so the kernel is advised
+// to read ahead aggressively meanwhile.
+func (mmap MMap) CopyToFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err := mmap.writeTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (mmap MMap) writeTo(f *os.File) error {
+	if len(mmap) == 0 {
+		return nil
+	}
+	aligned := pageAligned(mmap)
+	aligned.Advise(MADV_SEQUENTIAL)
+	defer aligned.Advise(MADV_NORMAL)
+	for b := []byte(mmap); len(b) > 0; {
+		n := len(b)
+		if n > copyChunk {
+			n = copyChunk
+		}
+		if _, err := f.Write(b[:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// CopyToFile writes the content of the mapping to a new file at path,
+// replacing any file by that name. The content of shared mappings being
+// that of the file, the copy is made by the kernel when possible, without
+// going through the mapping: on Linux, by cloning the file's blocks on
+// filesystems supporting it, or with copy_file_range or sendfile otherwise.
+// Private mappings are copied from memory, so that their changes are kept.
+func (m *Mapping) CopyToFile(path string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	done := false
+	if m.flags&MAP_SHARED != 0 {
+		done, err = kernelCopy(f, m.fd, m.offset, int64(len(m.mmap)))
+	}
+	if err == nil && !done {
+		err = m.mmap.writeTo(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,82 @@
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const _FICLONERANGE = 0x4020940d
+
+// fileCloneRange is struct file_clone_range from linux/fs.h.
+type fileCloneRange struct {
+	srcFd     int64
+	srcOffset uint64
+	srcLength uint64
+	dstOffset uint64
+}
+
+// unsupported reports whether err means that a way of copying files doesn't
+// apply to the files at hand, so another one should be tried.
+func unsupported(err error) bool {
+	switch err {
+	case syscall.ENOSYS, syscall.EXDEV, syscall.EINVAL, syscall.EOPNOTSUPP, syscall.ENOTTY, syscall.EBADF:
+		return true
+	}
+	return false
+}
+
+// kernelCopy copies length bytes of the file at src starting at offset into
+// the empty file dst without going through user space. It returns false if
+// no way of doing so is available for these files.
+func kernelCopy(dst *os.File, src uintptr, offset, length int64) (bool, error) {
+	// Cloning shares the blocks of the source, which requires a block
+	// aligned range apart from the end of the file.
+	fcr := fileCloneRange{srcFd: int64(src), srcOffset: uint64(offset), srcLength: uint64(length)}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), _FICLONERANGE, uintptr(unsafe.Pointer(&fcr)))
+	if errno == 0 {
+		return true, nil
+	}
+
+	done, err := copyLoop(length, func(n int64) (int64, error) {
+		r, _, errno := syscall.Syscall6(_SYS_COPY_FILE_RANGE, src, uintptr(unsafe.Pointer(&offset)), dst.Fd(), 0, uintptr(n), 0)
+		if errno != 0 {
+			return 0, errno
+		}
+		return int64(r), nil
+	})
+	if done || err != nil {
+		return done, err
+	}
+	return copyLoop(length, func(n int64) (int64, error) {
+		r, err := syscall.Sendfile(int(dst.Fd()), int(src), &offset, int(n))
+		return int64(r), err
+	})
+}
+
+// copyLoop calls copy until length bytes were copied. It returns false
+// without an error if the first call reports the method isn't supported.
+func copyLoop(length int64, copy func(n int64) (int64, error)) (bool, error) {
+	for copied := int64(0); copied < length; {
+		n := length - copied
+		if n > 1<<30 {
+			n = 1 << 30
+		}
+		r, err := copy(n)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			if copied == 0 && unsupported(err) {
+				return false, nil
+			}
+			return true, err
+		}
+		if r == 0 {
+			// The file was truncated under the mapping.
+			return true, ErrFileTruncated
+		}
+		copied += r
+	}
+	return true, nil
+}
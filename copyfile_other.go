@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import "os"
+
+// kernelCopy reports that there's no way of copying files without going
+// through user space available.
+func kernelCopy(dst *os.File, src uintptr, offset, length int64) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,117 @@
+//go:build gommapdebug && !windows
+// +build gommapdebug,!windows
+
+// Building with the gommapdebug tag turns on use-after-unmap detection.
+// UnsafeUnmap then doesn't release the memory right away: it makes the region
+// inaccessible with PROT_NONE and keeps it reserved for a while, so a stray
+// access faults immediately instead of silently reading whatever got mapped
+// at the same address next. The stacks of the calls that created and
+// unmapped each region are recorded, and DescribeFault reports them given
+// the faulting address, for instance from a panic raised by the runtime
+// after debug.SetPanicOnFault(true).
+
+package gommap
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DebugQuarantineBytes is the amount of unmapped address space kept reserved
+// before the oldest quarantined regions are actually released.
+var DebugQuarantineBytes = 1 << 30
+
+type debugRecord struct {
+	addr       uintptr
+	length     int
+	mapStack   []byte
+	unmapStack []byte
+	unmapped   time.Time
+}
+
+var debugState struct {
+	sync.Mutex
+	live       map[uintptr]*debugRecord
+	quarantine []*debugRecord
+	held       int
+}
+
+func debugMapped(mmap MMap) {
+	if len(mmap) == 0 {
+		return
+	}
+	debugState.Lock()
+	defer debugState.Unlock()
+	if debugState.live == nil {
+		debugState.live = make(map[uintptr]*debugRecord)
+	}
+	debugState.live[mmap.addr()] = &debugRecord{
+		addr:     mmap.addr(),
+		length:   len(mmap),
+		mapStack: debug.Stack(),
+	}
+}
+
+func debugRemapped(old, mmap MMap) {
+	debugState.Lock()
+	defer debugState.Unlock()
+	rec, ok := debugState.live[old.addr()]
+	if !ok {
+		rec = &debugRecord{mapStack: debug.Stack()}
+	}
+	delete(debugState.live, old.addr())
+	if len(mmap) == 0 {
+		return
+	}
+	if debugState.live == nil {
+		debugState.live = make(map[uintptr]*debugRecord)
+	}
+	rec.addr, rec.length = mmap.addr(), len(mmap)
+	debugState.live[rec.addr] = rec
+}
+
+func debugUnmap(mmap MMap) bool {
+	if len(mmap) == 0 || mmap.Protect(PROT_NONE) != nil {
+		return false
+	}
+	debugState.Lock()
+	defer debugState.Unlock()
+	rec, ok := debugState.live[mmap.addr()]
+	if !ok {
+		rec = &debugRecord{addr: mmap.addr()}
+	}
+	delete(debugState.live, rec.addr)
+	rec.length = len(mmap)
+	rec.unmapStack = debug.Stack()
+	rec.unmapped = time.Now()
+	debugState.quarantine = append(debugState.quarantine, rec)
+	debugState.held += rec.length
+	for debugState.held > DebugQuarantineBytes && len(debugState.quarantine) > 0 {
+		old := debugState.quarantine[0]
+		debugState.quarantine = debugState.quarantine[1:]
+		debugState.held -= old.length
+		syscall.Syscall(syscall.SYS_MUNMAP, old.addr, uintptr(old.length), 0)
+	}
+	return true
+}
+
+func DescribeFault(addr uintptr) (string, bool) {
+	debugState.Lock()
+	defer debugState.Unlock()
+	for _, rec := range debugState.quarantine {
+		if addr >= rec.addr && addr < rec.addr+uintptr(rec.length) {
+			return fmt.Sprintf("gommap: access to %#x, offset %d of a %d byte mapping unmapped at %s\n\nmapped at:\n%s\nunmapped at:\n%s",
+				addr, addr-rec.addr, rec.length, rec.unmapped.Format(time.RFC3339Nano), rec.mapStack, rec.unmapStack), true
+		}
+	}
+	for _, rec := range debugState.live {
+		if addr >= rec.addr && addr < rec.addr+uintptr(rec.length) {
+			return fmt.Sprintf("gommap: access to %#x, offset %d of a live %d byte mapping\n\nmapped at:\n%s",
+				addr, addr-rec.addr, rec.length, rec.mapStack), true
+		}
+	}
+	return "", false
+}
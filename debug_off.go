@@ -0,0 +1,24 @@
+//go:build !gommapdebug || windows
+// +build !gommapdebug windows
+
+package gommap
+
+// debugMapped records a new mapping when built with the gommapdebug tag.
+func debugMapped(mmap MMap) {}
+
+// debugRemapped moves the record of a mapping resized, and maybe moved, by
+// mremap when built with the gommapdebug tag.
+func debugRemapped(old, mmap MMap) {}
+
+// debugUnmap quarantines a mapping being unmapped when built with the
+// gommapdebug tag, and reports whether it did so.
+func debugUnmap(mmap MMap) bool {
+	return false
+}
+
+// DescribeFault returns the recorded history of the mapping containing addr.
+// It only has something to report in binaries built with the gommapdebug
+// tag; see debug.go.
+func DescribeFault(addr uintptr) (string, bool) {
+	return "", false
+}
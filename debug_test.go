@@ -0,0 +1,28 @@
+//go:build gommapdebug && !windows
+// +build gommapdebug,!windows
+
+package gommap
+
+import (
+	"runtime/debug"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestDebugUseAfterUnmap(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		r := recover()
+		fault, ok := r.(interface{ Addr() uintptr })
+		c.Assert(ok, Equals, true, Commentf("%v", r))
+		desc, ok := DescribeFault(fault.Addr())
+		c.Assert(ok, Equals, true)
+		c.Assert(desc, Matches, "(?s).*unmapped at.*TestDebugUseAfterUnmap.*")
+	}()
+	v := mmap[3]
+	c.Fatalf("access to unmapped memory didn't fault, read %d", v)
+}
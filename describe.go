@@ -0,0 +1,45 @@
+package gommap
+
+// The RegionInfo type describes an area of the address space of the process
+// covered by a mapping, as the system sees it. A mapping whose protection
+// was changed on part of it, with Protect for instance, is made of several
+// areas.
+type RegionInfo struct {
+	Addr uintptr
+	Len  int64
+	// Perms holds the access rights of the area in the format of
+	// /proc/self/maps: "r", "w" and "x" for readable, writable and
+	// executable, each replaced by "-" if missing, followed by "s" for a
+	// shared mapping or "p" for a private one.
+	Perms string
+	// Offset is where the area starts in the backing file.
+	Offset int64
+	// Path is the backing file, empty for anonymous memory. On Windows, it
+	// is given as a device path, such as \Device\HarddiskVolume1\data.
+	Path string
+}
+
+func (r RegionInfo) perm(i int, c byte) bool {
+	return len(r.Perms) > i && r.Perms[i] == c
+}
+
+// Readable reports whether the area can be read.
+func (r RegionInfo) Readable() bool {
+	return r.perm(0, 'r')
+}
+
+// Writable reports whether the area can be written to.
+func (r RegionInfo) Writable() bool {
+	return r.perm(1, 'w')
+}
+
+// Executable reports whether code in the area can be run.
+func (r RegionInfo) Executable() bool {
+	return r.perm(2, 'x')
+}
+
+// Shared reports whether writes to the area are visible to other mappings
+// of the same file, rather than copied on write.
+func (r RegionInfo) Shared() bool {
+	return r.perm(3, 's')
+}
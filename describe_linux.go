@@ -0,0 +1,25 @@
+package gommap
+
+// Describe returns the areas of the process covering mmap, as listed in
+// /proc/self/maps, each clipped to the part within mmap. It returns
+// ErrNotMapped if mmap isn't mapped.
+func (mmap MMap) Describe() ([]RegionInfo, error) {
+	start, end := mmap.addr(), mmap.addr()+uintptr(len(mmap))
+	var regions []RegionInfo
+	err := overlappingVMAs("/proc/self/maps", mmap, func(v *vma) {
+		r := RegionInfo{Addr: v.start, Perms: v.perms, Offset: v.offset, Path: v.path}
+		if r.Addr < start {
+			if v.inode != 0 {
+				r.Offset += int64(start - r.Addr)
+			}
+			r.Addr = start
+		}
+		last := v.end
+		if last > end {
+			last = end
+		}
+		r.Len = int64(last - r.Addr)
+		regions = append(regions, r)
+	})
+	return regions, err
+}
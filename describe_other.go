@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// Describe returns ErrUnsupported, as the areas of the process can only be
+// listed on Linux and Windows.
+func (mmap MMap) Describe() ([]RegionInfo, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,96 @@
+package gommap
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procVirtualQuery          = modkernel32.NewProc("VirtualQuery")
+	procK32GetMappedFileNameW = modkernel32.NewProc("K32GetMappedFileNameW")
+)
+
+// Definitions from winnt.h.
+const (
+	_MEM_COMMIT = 0x1000
+	_MEM_MAPPED = 0x40000
+
+	_PAGE_EXECUTE = 0x10
+	// Modifiers that may be combined with the other page protections.
+	_PAGE_MODIFIERS = 0x100 | 0x200 | 0x400
+)
+
+type memoryBasicInformation struct {
+	BaseAddress       uintptr
+	AllocationBase    uintptr
+	AllocationProtect uint32
+	PartitionId       uint16
+	RegionSize        uintptr
+	State             uint32
+	Protect           uint32
+	Type              uint32
+}
+
+// windowsPerms converts page protection constants to the format of
+// RegionInfo.Perms.
+func windowsPerms(protect, typ uint32) string {
+	perms := []byte("---p")
+	switch protect &^ _PAGE_MODIFIERS {
+	case syscall.PAGE_READONLY:
+		perms[0] = 'r'
+	case syscall.PAGE_READWRITE:
+		perms[0], perms[1] = 'r', 'w'
+	case syscall.PAGE_WRITECOPY:
+		perms[0], perms[1] = 'r', 'w'
+		typ = 0
+	case _PAGE_EXECUTE:
+		perms[2] = 'x'
+	case syscall.PAGE_EXECUTE_READ:
+		perms[0], perms[2] = 'r', 'x'
+	case syscall.PAGE_EXECUTE_READWRITE:
+		perms[0], perms[1], perms[2] = 'r', 'w', 'x'
+	case syscall.PAGE_EXECUTE_WRITECOPY:
+		perms[0], perms[1], perms[2] = 'r', 'w', 'x'
+		typ = 0
+	}
+	if typ == _MEM_MAPPED {
+		perms[3] = 's'
+	}
+	return string(perms)
+}
+
+// Describe returns the areas of the process covering mmap, as reported by
+// VirtualQuery, each clipped to the part within mmap. Offsets in the backing
+// file aren't known and reported as 0. It returns ErrNotMapped if mmap isn't
+// mapped.
+func (mmap MMap) Describe() ([]RegionInfo, error) {
+	if len(mmap) == 0 {
+		return nil, ErrNotMapped
+	}
+	start := uintptr(unsafe.Pointer(&mmap[0]))
+	end := start + uintptr(len(mmap))
+	var regions []RegionInfo
+	for addr := start; addr < end; {
+		var info memoryBasicInformation
+		r, _, errno := procVirtualQuery.Call(addr, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+		if r == 0 {
+			return nil, errno
+		}
+		if info.State != _MEM_COMMIT && len(regions) == 0 {
+			return nil, ErrNotMapped
+		}
+		last := info.BaseAddress + info.RegionSize
+		if last > end {
+			last = end
+		}
+		region := RegionInfo{Addr: addr, Len: int64(last - addr), Perms: windowsPerms(info.Protect, info.Type)}
+		if info.Type == _MEM_MAPPED {
+			var buf [syscall.MAX_PATH]uint16
+			n, _, _ := procK32GetMappedFileNameW.Call(uintptr(^uintptr(0)), addr, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+			region.Path = syscall.UTF16ToString(buf[:n])
+		}
+		regions = append(regions, region)
+		addr = last
+	}
+	return regions, nil
+}
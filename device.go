@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+)
+
+// MapDevice maps length bytes of the device at fd starting at offset, such
+// as physical memory through /dev/mem, a UIO region through /dev/uio*, or a
+// PCI BAR through its sysfs resource file. The size of such devices can't
+// be discovered with fstat, so length must be given explicitly, and offset
+// must be page aligned as it usually addresses registers or physical pages.
+// When fd is a regular file, as with sysfs resource files, the region must
+// lie within it.
+//
+// Device memory is always mapped with MAP_SHARED: a private copy of device
+// registers is meaningless, and writes to it would silently never reach
+// the hardware.
+func MapDevice(fd uintptr, offset, length int64, prot ProtFlags) (MMap, error) {
+	if length <= 0 {
+		return nil, ErrSize
+	}
+	if offset < 0 || offset%int64(os.Getpagesize()) != 0 {
+		return nil, ErrUnaligned
+	}
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &stat); err != nil {
+		return nil, err
+	}
+	if stat.Mode&syscall.S_IFMT == syscall.S_IFREG && (offset > stat.Size || length > stat.Size-offset) {
+		return nil, ErrOutOfBounds
+	}
+	return MapRegion(fd, offset, length, prot, MAP_SHARED)
+}
+
+// MapDevicePath opens the device at path and maps it with MapDevice. It is
+// opened with O_SYNC, which makes /dev/mem map the memory uncached. The
+// device is closed once mapped, as the mapping keeps it open on its own.
+func MapDevicePath(path string, offset, length int64, prot ProtFlags) (MMap, error) {
+	mode := os.O_RDONLY
+	if prot&PROT_WRITE != 0 {
+		mode = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, mode|os.O_SYNC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return MapDevice(f.Fd(), offset, length, prot)
+}
@@ -0,0 +1,151 @@
+package gommap
+
+import (
+	"bytes"
+	"os"
+	"sync"
+)
+
+// diffWindow is how many pages Diff looks up in the page map at once.
+const diffWindow = 4096
+
+// The Baseline type remembers the contents of a shared mapping at a point in
+// time, so the byte ranges written since can be listed by Diff, for instance
+// to replicate a mapped file incrementally.
+//
+// The contents are kept in a Snapshot, and the pages written through the
+// mapping are told apart through the kernel's soft-dirty bits, so only those
+// are compared with the snapshot. Writes made through other mappings of the
+// file don't mark the pages of this one; they are only found when soft-dirty
+// tracking is unavailable and every page is compared.
+type Baseline struct {
+	live    MMap
+	snap    MMap
+	tracked bool
+}
+
+// NewBaseline records the current contents of live, a shared mapping of the
+// file at fd starting at offset.
+//
+// Soft-dirty bits are cleared for the whole process, so a Baseline confuses
+// other users of them, such as checkpointing tools, and taking a new Baseline
+// makes the pages written before it look clean to existing ones.
+func NewBaseline(live MMap, fd uintptr, offset int64) (*Baseline, error) {
+	// Clearing first makes writes racing with the snapshot show up as
+	// dirty; they are then simply found equal if the snapshot has them.
+	tracked := softDirtyAvailable() && clearSoftDirty() == nil
+	snap, err := Snapshot(fd, offset, int64(len(live)))
+	if err != nil {
+		return nil, err
+	}
+	return &Baseline{live: live, snap: snap, tracked: tracked}, nil
+}
+
+var (
+	softDirtyOnce  sync.Once
+	softDirtyProbe bool
+)
+
+// softDirtyAvailable reports whether the kernel tracks soft-dirty bits. When
+// it doesn't, the bits read as clear even for pages just written, so a fresh
+// page is written and checked.
+func softDirtyAvailable() bool {
+	softDirtyOnce.Do(func() {
+		mmap, err := MapAnonymous(int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+		if err != nil {
+			return
+		}
+		defer mmap.UnsafeUnmap()
+		mmap[0] = 1
+		pages, err := mmap.PageFlags(0, 1)
+		softDirtyProbe = err == nil && pages[0].SoftDirty
+	})
+	return softDirtyProbe
+}
+
+func clearSoftDirty() error {
+	f, err := os.OpenFile("/proc/self/clear_refs", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write([]byte("4"))
+	return err
+}
+
+// Diff calls fn for each maximal range of bytes of the mapping that differ
+// from the baseline, in order, as an offset and length within the mapping.
+// Iteration stops if fn returns false.
+func (b *Baseline) Diff(fn func(offset, length int) bool) error {
+	pageSize := os.Getpagesize()
+	runStart, runEnd := -1, -1
+	emit := func(start, end int) bool {
+		if start == runEnd {
+			runEnd = end
+			return true
+		}
+		if runStart >= 0 && !fn(runStart, runEnd-runStart) {
+			return false
+		}
+		runStart, runEnd = start, end
+		return true
+	}
+	for off := 0; off < len(b.live); off += diffWindow * pageSize {
+		end := off + diffWindow*pageSize
+		if end > len(b.live) {
+			end = len(b.live)
+		}
+		var pages []PageInfo
+		if b.tracked {
+			var err error
+			if pages, err = b.live.PageFlags(off, end-off); err != nil {
+				return err
+			}
+		}
+		for i := 0; off+i*pageSize < end; i++ {
+			if pages != nil && !pages[i].SoftDirty {
+				continue
+			}
+			start := off + i*pageSize
+			stop := start + pageSize
+			if stop > end {
+				stop = end
+			}
+			if !diffRanges(b.live[start:stop], b.snap[start:stop], start, emit) {
+				return nil
+			}
+		}
+	}
+	if runStart >= 0 {
+		fn(runStart, runEnd-runStart)
+	}
+	return nil
+}
+
+// diffRanges calls emit with the start and end of each range of bytes that
+// differ between a and b, relative to base, stopping when it returns false.
+func diffRanges(a, b []byte, base int, emit func(start, end int) bool) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	for i := 0; i < len(a); {
+		if a[i] == b[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(a) && a[j] != b[j] {
+			j++
+		}
+		if !emit(base+i, base+j) {
+			return false
+		}
+		i = j
+	}
+	return true
+}
+
+// Close releases the snapshot held by the baseline.
+func (b *Baseline) Close() error {
+	return b.snap.UnsafeUnmap()
+}
@@ -0,0 +1,100 @@
+package gommap
+
+import (
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+// _DMA_BUF_IOCTL_SYNC is _IOW('b', 0, struct dma_buf_sync).
+const _DMA_BUF_IOCTL_SYNC = 0x40086200
+
+// The DMABufSyncFlags type tells which accesses of the CPU to a dma-buf are
+// bracketed by DMABuf.BeginAccess and DMABuf.EndAccess.
+type DMABufSyncFlags uint64
+
+const (
+	// DMA_BUF_SYNC_READ brackets reads of the buffer.
+	DMA_BUF_SYNC_READ DMABufSyncFlags = 0x1
+	// DMA_BUF_SYNC_WRITE brackets writes to the buffer.
+	DMA_BUF_SYNC_WRITE DMABufSyncFlags = 0x2
+	// DMA_BUF_SYNC_RW brackets both.
+	DMA_BUF_SYNC_RW = DMA_BUF_SYNC_READ | DMA_BUF_SYNC_WRITE
+
+	dmaBufSyncEnd = 0x4
+)
+
+// The DMABuf type is a mapped dma-buf, a buffer shared between devices and
+// exported as a file descriptor by drivers such as V4L2 for camera frames
+// and DRM for GPU buffers. Its contents are read and written in place, with
+// no copy, but as devices access it behind the back of the CPU caches,
+// every access from the CPU must be bracketed by BeginAccess and EndAccess,
+// which flush and invalidate the caches as the buffer requires.
+type DMABuf struct {
+	fd   uintptr
+	mmap MMap
+}
+
+// MapDMABuf maps the whole dma-buf fd, whose size is found by seeking to its
+// end as dma-bufs don't report it through fstat on older kernels. The buffer
+// is mapped shared, with prot, which must match how fd was exported. The
+// descriptor must stay open for as long as the buffer is accessed.
+func MapDMABuf(fd uintptr, prot ProtFlags) (*DMABuf, error) {
+	size, err := syscall.Seek(int(fd), 0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, ErrSize
+	}
+	mmap, err := MapRegion(fd, 0, size, prot, MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &DMABuf{fd: fd, mmap: mmap}, nil
+}
+
+// Bytes returns the mapped buffer.
+func (b *DMABuf) Bytes() MMap {
+	return b.mmap
+}
+
+func (b *DMABuf) sync(flags DMABufSyncFlags) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, b.fd, _DMA_BUF_IOCTL_SYNC, uintptr(unsafe.Pointer(&flags)))
+		if errno == syscall.EINTR || errno == syscall.EAGAIN {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+// BeginAccess waits for the devices to be done with the buffer and makes
+// their writes visible to the CPU, before it reads or writes the buffer as
+// flags says. It returns ENOTTY if fd isn't a dma-buf.
+func (b *DMABuf) BeginAccess(flags DMABufSyncFlags) error {
+	return b.sync(flags)
+}
+
+// EndAccess ends the access started by BeginAccess with the same flags,
+// making the writes of the CPU visible to the devices.
+func (b *DMABuf) EndAccess(flags DMABufSyncFlags) error {
+	return b.sync(flags | dmaBufSyncEnd)
+}
+
+// Access runs fn on the buffer between BeginAccess and EndAccess.
+func (b *DMABuf) Access(flags DMABufSyncFlags, fn func(MMap)) error {
+	if err := b.BeginAccess(flags); err != nil {
+		return err
+	}
+	fn(b.mmap)
+	return b.EndAccess(flags)
+}
+
+// Unmap unmaps the buffer. The file descriptor is left open.
+func (b *DMABuf) Unmap() error {
+	return b.mmap.UnsafeUnmap()
+}
@@ -0,0 +1,34 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+var fifoSeq uint32
+
+// newDoorbellFd returns a FIFO opened for both reading and writing, and
+// already removed from the file system, which behaves like a pipe held in a
+// single file descriptor. Each ring writes a few bytes to it.
+func newDoorbellFd() (int, error) {
+	for {
+		seq := atomic.AddUint32(&fifoSeq, 1)
+		name := filepath.Join(os.TempDir(), "gommap-doorbell-"+strconv.Itoa(os.Getpid())+"-"+strconv.Itoa(int(seq)))
+		err := syscall.Mkfifo(name, 0600)
+		if err == syscall.EEXIST {
+			continue
+		}
+		if err != nil {
+			return -1, err
+		}
+		fd, err := syscall.Open(name, syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+		syscall.Unlink(name)
+		return fd, err
+	}
+}
@@ -0,0 +1,19 @@
+package gommap
+
+import "syscall"
+
+// Flags for eventfd2, from linux/eventfd.h.
+const (
+	_EFD_CLOEXEC  = 0x80000
+	_EFD_NONBLOCK = 0x800
+)
+
+// newDoorbellFd returns an eventfd. Reading it returns the number of rings
+// and resets it.
+func newDoorbellFd() (int, error) {
+	fd, _, errno := syscall.Syscall(syscall.SYS_EVENTFD2, 0, _EFD_CLOEXEC|_EFD_NONBLOCK, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
@@ -0,0 +1,102 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The Doorbell type is a notification channel a producer rings after adding
+// data to a shared-memory queue, so consumers can sleep in poll, select or
+// epoll, alongside their other file descriptors, instead of polling the
+// mapping. Rings that happen before the consumer waits are coalesced into a
+// single wake-up, so consumers must drain the queue each time they wake.
+//
+// A doorbell is a single file descriptor, readable whenever the doorbell
+// was rung: an eventfd on Linux, and an anonymous FIFO elsewhere. It is
+// shared with other processes like any file, by passing File in
+// exec.Cmd.ExtraFiles or over a Unix socket, and wrapped on the other side
+// with DoorbellFile.
+type Doorbell struct {
+	f *os.File
+}
+
+// NewDoorbell creates a doorbell that hasn't been rung.
+func NewDoorbell() (*Doorbell, error) {
+	fd, err := newDoorbellFd()
+	if err != nil {
+		return nil, err
+	}
+	return &Doorbell{f: os.NewFile(uintptr(fd), "doorbell")}, nil
+}
+
+// DoorbellFile returns the doorbell whose file descriptor, created by
+// NewDoorbell possibly in another process, is f. The doorbell takes
+// ownership of f.
+func DoorbellFile(f *os.File) *Doorbell {
+	return &Doorbell{f: f}
+}
+
+// File returns the file holding the doorbell, to be handed to other
+// processes. It remains owned by the doorbell.
+func (d *Doorbell) File() *os.File {
+	return d.f
+}
+
+// Fd returns the file descriptor of the doorbell, which polls readable while
+// the doorbell is rung.
+func (d *Doorbell) Fd() uintptr {
+	return d.f.Fd()
+}
+
+// Ring rings the doorbell, waking up a consumer waiting on it. It never
+// blocks.
+func (d *Doorbell) Ring() error {
+	rc, err := d.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	one := uint64(1)
+	buf := (*[8]byte)(unsafe.Pointer(&one))[:]
+	var werr error
+	err = rc.Write(func(fd uintptr) bool {
+		_, werr = syscall.Write(int(fd), buf)
+		return true
+	})
+	if werr == syscall.EAGAIN {
+		// The doorbell is rung so many times already that the consumer
+		// can't miss it.
+		werr = nil
+	}
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+// Wait blocks until the doorbell is rung, unless it was already, and resets
+// it. Closing the doorbell makes pending and later calls return an error.
+func (d *Doorbell) Wait() error {
+	rc, err := d.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var buf [512]byte
+	var rerr error
+	err = rc.Read(func(fd uintptr) bool {
+		_, rerr = syscall.Read(int(fd), buf[:])
+		return rerr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return rerr
+}
+
+// Close releases the doorbell.
+func (d *Doorbell) Close() error {
+	return d.f.Close()
+}
@@ -0,0 +1,81 @@
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procCreateEventW = modkernel32.NewProc("CreateEventW")
+	procSetEvent     = modkernel32.NewProc("SetEvent")
+)
+
+// The Doorbell type is a notification channel a producer rings after adding
+// data to a shared-memory queue, so consumers can sleep in
+// WaitForMultipleObjects, alongside their other handles, instead of polling
+// the mapping. Rings that happen before the consumer waits are coalesced
+// into a single wake-up, so consumers must drain the queue each time they
+// wake.
+//
+// On Windows a doorbell is an auto-reset event. Processes share it by name,
+// with NamedDoorbell, or by inheriting the handle.
+type Doorbell struct {
+	h syscall.Handle
+}
+
+func createEvent(name *uint16) (*Doorbell, error) {
+	h, _, err := procCreateEventW.Call(0, 0, 0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return nil, os.NewSyscallError("CreateEvent", err)
+	}
+	return &Doorbell{h: syscall.Handle(h)}, nil
+}
+
+// NewDoorbell creates an unnamed doorbell that hasn't been rung.
+func NewDoorbell() (*Doorbell, error) {
+	return createEvent(nil)
+}
+
+// NamedDoorbell opens the doorbell with the given name, creating it if no
+// process did yet.
+func NamedDoorbell(name string) (*Doorbell, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	return createEvent(p)
+}
+
+// Fd returns the handle of the event, which is signaled while the doorbell
+// is rung.
+func (d *Doorbell) Fd() uintptr {
+	return uintptr(d.h)
+}
+
+// Ring rings the doorbell, waking up a consumer waiting on it. It never
+// blocks.
+func (d *Doorbell) Ring() error {
+	if r, _, err := procSetEvent.Call(uintptr(d.h)); r == 0 {
+		return os.NewSyscallError("SetEvent", err)
+	}
+	return nil
+}
+
+// Wait blocks until the doorbell is rung, unless it was already, and resets
+// it.
+func (d *Doorbell) Wait() error {
+	ev, err := syscall.WaitForSingleObject(d.h, syscall.INFINITE)
+	if err != nil {
+		return os.NewSyscallError("WaitForSingleObject", err)
+	}
+	if ev != syscall.WAIT_OBJECT_0 {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close releases the doorbell.
+func (d *Doorbell) Close() error {
+	return syscall.CloseHandle(d.h)
+}
@@ -0,0 +1,347 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Layout of the control file of a DurableQueue, which records the committed
+// offset of each consumer in a table of fixed-size entries.
+const (
+	dqControlName  = "consumers.ctl"
+	dqControlSize  = 4096
+	dqMagic        = 0x51444d47 // "GMDQ"
+	dqMagicOff     = 0
+	dqCountOff     = 4
+	dqEntriesOff   = 64
+	dqEntryWidth   = 64
+	dqNameLen      = 56
+	dqOffsetOff    = 56
+	dqMaxConsumers = (dqControlSize - dqEntriesOff) / dqEntryWidth
+)
+
+// The DurableQueue type is a persistent queue with any number of named
+// consumers, each reading every record at its own pace. Records are
+// appended to the files of a SegmentSet, framed like WAL records, and never
+// span two segments. The offset each consumer has acknowledged is kept in a
+// mapped control file next to the segments, so consumers resume where they
+// left off after a restart, receiving again the records they hadn't
+// acknowledged. Segments whose records every consumer has acknowledged are
+// deleted when the queue rolls over to a new segment.
+//
+// Records are durable once Sync returns. On a crash, records appended after
+// the last Sync may be lost, and not necessarily the latest ones first.
+// When the queue is opened, the last segment is scanned up to the last
+// record whose checksum is valid.
+//
+// A DurableQueue is safe for concurrent use within one process. Only one
+// process may open a queue at a time.
+type DurableQueue struct {
+	mu        sync.Mutex
+	segs      *SegmentSet
+	ctlFile   *os.File
+	control   MMap
+	end       int64
+	consumers map[string]*QueueConsumer
+	closed    bool
+}
+
+// The QueueConsumer type reads the records of a DurableQueue on behalf of
+// one named consumer.
+type QueueConsumer struct {
+	q         *DurableQueue
+	name      string
+	committed *uint64
+	cursor    int64
+}
+
+// OpenDurableQueue opens or creates the queue stored in dir, with segments
+// of segmentSize bytes, which must be a multiple of the page size. Records
+// can be at most segmentSize-8 bytes long.
+func OpenDurableQueue(dir string, segmentSize int64) (*DurableQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	segs, err := OpenSegmentSet(dir, segmentSize)
+	if err != nil {
+		return nil, err
+	}
+	q := &DurableQueue{segs: segs, consumers: make(map[string]*QueueConsumer)}
+	q.end = q.recover()
+	if err := q.openControl(filepath.Join(dir, dqControlName)); err != nil {
+		segs.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// openControl maps the control file at path, initializing it if it's new,
+// and loads the consumers it lists.
+func (q *DurableQueue) openControl(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(dqControlSize); err != nil {
+		file.Close()
+		return err
+	}
+	control, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	q.ctlFile, q.control = file, control
+	switch binary.LittleEndian.Uint32(control[dqMagicOff:]) {
+	case 0:
+		binary.LittleEndian.PutUint32(control[dqMagicOff:], dqMagic)
+	case dqMagic:
+	default:
+		q.closeControl()
+		return ErrCorrupt
+	}
+	n := int(binary.LittleEndian.Uint32(control[dqCountOff:]))
+	if n > dqMaxConsumers {
+		q.closeControl()
+		return ErrCorrupt
+	}
+	for i := 0; i < n; i++ {
+		q.loadConsumer(i)
+	}
+	return nil
+}
+
+func (q *DurableQueue) closeControl() error {
+	err := q.control.UnsafeUnmap()
+	if cerr := q.ctlFile.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// loadConsumer adds the consumer at entry i of the control file to the
+// queue. An acknowledgement past the end of the queue, of records lost in a
+// crash, is moved back so that the records appended next are delivered.
+func (q *DurableQueue) loadConsumer(i int) *QueueConsumer {
+	e := q.control[dqEntriesOff+i*dqEntryWidth : dqEntriesOff+(i+1)*dqEntryWidth]
+	committed, _ := q.control.uint64Ptr(dqEntriesOff + i*dqEntryWidth + dqOffsetOff)
+	if int64(atomic.LoadUint64(committed)) > q.end {
+		atomic.StoreUint64(committed, uint64(q.end))
+	}
+	name := string(entryName(e[:dqNameLen]))
+	c := &QueueConsumer{q: q, name: name, committed: committed, cursor: int64(atomic.LoadUint64(committed))}
+	q.consumers[name] = c
+	return c
+}
+
+// recover returns the end of the last valid record. Records never span
+// segments, so only the last one needs to be scanned.
+func (q *DurableQueue) recover() int64 {
+	last := q.segs.Last()
+	mmap := q.segs.Segment(last)
+	var pos int64
+	for {
+		p, ok := walFrame(mmap, pos)
+		if !ok {
+			break
+		}
+		pos += walFrameHeader + int64(len(p))
+	}
+	return last*q.segs.SegmentSize() + pos
+}
+
+// readAt returns the first record at or after the global offset pos, along
+// with its position, or ErrEmpty if there's none before the end of the
+// queue. An invalid frame before the last segment ends its records, either
+// because the rest of the segment was too short for the next record or
+// because a crash lost it.
+func (q *DurableQueue) readAt(pos int64) (int64, []byte, error) {
+	size := q.segs.SegmentSize()
+	if pos < q.segs.Start() {
+		pos = q.segs.Start()
+	}
+	for pos < q.end {
+		seg, off, err := q.segs.Translate(pos)
+		if err != nil {
+			return 0, nil, err
+		}
+		if p, ok := walFrame(q.segs.Segment(seg), int64(off)); ok {
+			return pos, p, nil
+		}
+		pos = (seg + 1) * size
+	}
+	return 0, nil, ErrEmpty
+}
+
+// Append copies p into the queue as a new record and returns its position.
+// The record isn't durable until Sync returns. It returns ErrSize if p is
+// empty or longer than a segment can hold.
+func (q *DurableQueue) Append(p []byte) (int64, error) {
+	size := q.segs.SegmentSize()
+	if len(p) == 0 || int64(len(p)) > size-walFrameHeader || uint64(len(p)) > 1<<32-1 {
+		return 0, ErrSize
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrClosed
+	}
+	pos := q.end
+	if pos == q.segs.End() || pos%size+walFrameHeader+int64(len(p)) > size {
+		// The rest of the segment is left as is: it holds the terminator
+		// written after the last record, if there's room for one.
+		if err := q.roll(); err != nil {
+			return 0, err
+		}
+		pos = q.segs.Last() * size
+	}
+	seg, off, err := q.segs.Translate(pos)
+	if err != nil {
+		return 0, err
+	}
+	mmap := q.segs.Segment(seg)
+	end := off + walFrameHeader + len(p)
+	copy(mmap[off+walFrameHeader:], p)
+	if end+walFrameHeader <= len(mmap) {
+		binary.LittleEndian.PutUint32(mmap[end:], 0)
+	}
+	binary.LittleEndian.PutUint32(mmap[off:], uint32(len(p)))
+	binary.LittleEndian.PutUint32(mmap[off+4:], walChecksum(mmap[off:off+4], p))
+	q.end = pos + int64(end-off)
+	return pos, nil
+}
+
+// roll adds a segment to the queue, and deletes the segments every consumer
+// is done with.
+func (q *DurableQueue) roll() error {
+	if _, err := q.segs.Roll(); err != nil {
+		return err
+	}
+	if len(q.consumers) == 0 {
+		return nil
+	}
+	low := q.end
+	for _, c := range q.consumers {
+		if off := int64(atomic.LoadUint64(c.committed)); off < low {
+			low = off
+		}
+	}
+	_, err := q.segs.Retire(low)
+	return err
+}
+
+// Consumer returns the consumer named name, registering it if needed. A new
+// consumer starts with the oldest record still in the queue. Names are at
+// most 56 bytes long, and a queue can have up to 63 consumers, after which
+// ErrFull is returned.
+func (q *DurableQueue) Consumer(name string) (*QueueConsumer, error) {
+	if len(name) == 0 || len(name) > dqNameLen {
+		return nil, ErrSize
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if c, ok := q.consumers[name]; ok {
+		return c, nil
+	}
+	n := len(q.consumers)
+	if n == dqMaxConsumers {
+		return nil, ErrFull
+	}
+	off := dqEntriesOff + n*dqEntryWidth
+	copy(q.control[off:off+dqNameLen], name)
+	binary.LittleEndian.PutUint64(q.control[off+dqOffsetOff:], uint64(q.segs.Start()))
+	binary.LittleEndian.PutUint32(q.control[dqCountOff:], uint32(n+1))
+	return q.loadConsumer(n), nil
+}
+
+// Next returns the next record for the consumer, along with its position,
+// or ErrEmpty if it has read every record appended so far. The record
+// points into the mapping, and is only valid until the consumer acknowledges
+// it or the queue is closed.
+func (c *QueueConsumer) Next() (int64, []byte, error) {
+	c.q.mu.Lock()
+	defer c.q.mu.Unlock()
+	if c.q.closed {
+		return 0, nil, ErrClosed
+	}
+	pos, p, err := c.q.readAt(c.cursor)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.cursor = pos + walFrameHeader + int64(len(p))
+	return pos, p, nil
+}
+
+// Ack acknowledges every record returned by Next so far, so that they are
+// not delivered again after a restart or Rewind. The acknowledgement is
+// durable once the queue is synced.
+func (c *QueueConsumer) Ack() {
+	c.q.mu.Lock()
+	defer c.q.mu.Unlock()
+	atomic.StoreUint64(c.committed, uint64(c.cursor))
+}
+
+// Rewind makes Next return again the records not acknowledged yet.
+func (c *QueueConsumer) Rewind() {
+	c.q.mu.Lock()
+	defer c.q.mu.Unlock()
+	c.cursor = int64(atomic.LoadUint64(c.committed))
+}
+
+// Committed returns the offset up to which the consumer has acknowledged
+// the records of the queue.
+func (c *QueueConsumer) Committed() int64 {
+	return int64(atomic.LoadUint64(c.committed))
+}
+
+// Name returns the name of the consumer.
+func (c *QueueConsumer) Name() string {
+	return c.name
+}
+
+// End returns the offset just past the last record of the queue. A
+// consumer whose committed offset is End has acknowledged every record.
+func (q *DurableQueue) End() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.end
+}
+
+// Sync makes the records appended and the acknowledgements made so far
+// durable.
+func (q *DurableQueue) Sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if err := q.segs.Sync(MS_SYNC); err != nil {
+		return err
+	}
+	return q.control.Sync(MS_SYNC)
+}
+
+// Close syncs the queue, and unmaps and closes its files.
+func (q *DurableQueue) Close() error {
+	err := q.Sync()
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	err = q.segs.Close()
+	if cerr := q.closeControl(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,267 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// Layout of an encrypted file: a header followed by one record per page of
+// plaintext. Each record holds the nonce the page was sealed with, then the
+// ciphertext and its authentication tag. Every page is sealed when the file
+// is created, so no record is ever left blank.
+const (
+	encMagic      = 0x4e454d47 // "GMEN"
+	encMagicOff   = 0
+	encPageOff    = 4
+	encPagesOff   = 8
+	encHeaderSize = 32
+	encNonceSize  = 12
+	encTagSize    = 16
+)
+
+// The EncryptedMapping type keeps data encrypted at rest in a file, while
+// exposing it as plaintext in an anonymous mapping that never reaches the
+// disk. Pages are decrypted into the plaintext mapping the first time they
+// are accessed through Bytes or WriteAt, and pages modified since are sealed
+// again into the file on Sync. Each page is sealed with AES-GCM under a fresh
+// random nonce and bound to its position, so pages tampered with, or moved
+// around, fail to decrypt with ErrCorrupt.
+//
+// The plaintext may still be swapped out unless Lock is called. Writes made
+// straight to slices returned by Bytes must be reported with MarkDirty. An
+// EncryptedMapping is not safe for concurrent use.
+type EncryptedMapping struct {
+	file     *os.File
+	store    MMap
+	plain    MMap
+	aead     cipher.AEAD
+	pageSize int
+	record   int
+	loaded   *Bitset
+	dirty    *Bitset
+}
+
+// OpenEncrypted opens the encrypted file at path using key, which must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. If the file
+// doesn't exist, it is created to hold size bytes of zeroes, rounded up to a
+// whole number of pages; size is ignored otherwise.
+func OpenEncrypted(path string, key []byte, size int) (*EncryptedMapping, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	pageSize := os.Getpagesize()
+	record := encNonceSize + pageSize + encTagSize
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	created := fi.Size() == 0
+	if created {
+		if size <= 0 {
+			file.Close()
+			return nil, ErrSize
+		}
+		pages := (size + pageSize - 1) / pageSize
+		if err := file.Truncate(int64(encHeaderSize + pages*record)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	store, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if created {
+		binary.LittleEndian.PutUint32(store[encPageOff:], uint32(pageSize))
+		binary.LittleEndian.PutUint64(store[encPagesOff:], uint64((len(store)-encHeaderSize)/record))
+	}
+	pages := (len(store) - encHeaderSize) / record
+	if len(store) < encHeaderSize ||
+		(!created && binary.LittleEndian.Uint32(store[encMagicOff:]) != encMagic) ||
+		binary.LittleEndian.Uint32(store[encPageOff:]) != uint32(pageSize) ||
+		binary.LittleEndian.Uint64(store[encPagesOff:]) != uint64(pages) ||
+		pages == 0 {
+		store.UnsafeUnmap()
+		file.Close()
+		return nil, ErrCorrupt
+	}
+	plain, err := MapAnonymous(int64(pages*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	if err != nil {
+		store.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	e := &EncryptedMapping{
+		file:     file,
+		store:    store,
+		plain:    plain,
+		aead:     aead,
+		pageSize: pageSize,
+		record:   record,
+		loaded:   NewBitset(make(MMap, (pages+7)/8)),
+		dirty:    NewBitset(make(MMap, (pages+7)/8)),
+	}
+	if created {
+		// Sealing the zeroes of every page up front makes a record wiped
+		// to zeroes fail to open like any other tampered with. The magic
+		// goes last, so that a file whose creation was cut short doesn't
+		// open.
+		for i := 0; i < pages; i++ {
+			if err := e.seal(i); err != nil {
+				e.Close()
+				return nil, err
+			}
+		}
+		binary.LittleEndian.PutUint32(store[encMagicOff:], encMagic)
+	}
+	return e, nil
+}
+
+// Len returns the size of the plaintext in bytes.
+func (e *EncryptedMapping) Len() int {
+	return len(e.plain)
+}
+
+func (e *EncryptedMapping) page(i int) []byte {
+	return e.plain[i*e.pageSize : (i+1)*e.pageSize]
+}
+
+func (e *EncryptedMapping) rec(i int) []byte {
+	off := encHeaderSize + i*e.record
+	return e.store[off : off+e.record]
+}
+
+// aad returns the additional data sealed along with page i, which ties the
+// ciphertext to its position in the file and to the geometry recorded in the
+// header.
+func (e *EncryptedMapping) aad(i int) []byte {
+	var b [24]byte
+	binary.LittleEndian.PutUint32(b[0:], encMagic)
+	binary.LittleEndian.PutUint32(b[4:], uint32(e.pageSize))
+	binary.LittleEndian.PutUint64(b[8:], uint64(len(e.plain)/e.pageSize))
+	binary.LittleEndian.PutUint64(b[16:], uint64(i))
+	return b[:]
+}
+
+// seal encrypts page i into its record under a fresh nonce.
+func (e *EncryptedMapping) seal(i int) error {
+	rec := e.rec(i)
+	nonce := rec[:encNonceSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	e.aead.Seal(rec[encNonceSize:encNonceSize], nonce, e.page(i), e.aad(i))
+	return nil
+}
+
+// load decrypts page i into the plaintext mapping unless it already is.
+func (e *EncryptedMapping) load(i int) error {
+	if e.loaded.Test(uint64(i)) {
+		return nil
+	}
+	rec := e.rec(i)
+	if _, err := e.aead.Open(e.page(i)[:0], rec[:encNonceSize], rec[encNonceSize:], e.aad(i)); err != nil {
+		return ErrCorrupt
+	}
+	e.loaded.Set(uint64(i))
+	return nil
+}
+
+// pages decrypts the pages covering n bytes of plaintext at off, and returns
+// their range.
+func (e *EncryptedMapping) pages(off, n int) (first, last int, err error) {
+	if n < 0 || !e.plain.inBounds(off, n) {
+		return 0, 0, ErrOutOfBounds
+	}
+	if n == 0 {
+		return 0, -1, nil
+	}
+	first, last = off/e.pageSize, (off+n-1)/e.pageSize
+	for i := first; i <= last; i++ {
+		if err := e.load(i); err != nil {
+			return 0, 0, err
+		}
+	}
+	return first, last, nil
+}
+
+// Bytes returns the n bytes of plaintext at off, decrypting the pages they
+// lie in first if needed. It returns ErrCorrupt if a page fails to decrypt.
+func (e *EncryptedMapping) Bytes(off, n int) ([]byte, error) {
+	if _, _, err := e.pages(off, n); err != nil {
+		return nil, err
+	}
+	return e.plain[off : off+n], nil
+}
+
+// MarkDirty records that the n bytes of plaintext at off were modified, so
+// that their pages get sealed again on the next Sync.
+func (e *EncryptedMapping) MarkDirty(off, n int) error {
+	first, last, err := e.pages(off, n)
+	if err != nil {
+		return err
+	}
+	for i := first; i <= last; i++ {
+		e.dirty.Set(uint64(i))
+	}
+	return nil
+}
+
+// WriteAt copies p into the plaintext at off and marks the pages written to
+// as dirty. Writes past the end fail with ErrOutOfBounds.
+func (e *EncryptedMapping) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(e.plain)) {
+		return 0, ErrOutOfBounds
+	}
+	if err := e.MarkDirty(int(off), len(p)); err != nil {
+		return 0, err
+	}
+	return copy(e.plain[off:], p), nil
+}
+
+// Sync seals the pages modified since the last Sync into the file and
+// flushes it. See MMap.Sync for the meaning of flags.
+func (e *EncryptedMapping) Sync(flags SyncFlags) error {
+	for i, ok := e.dirty.NextSet(0); ok; i, ok = e.dirty.NextSet(i + 1) {
+		if err := e.seal(int(i)); err != nil {
+			return err
+		}
+		e.dirty.Clear(i)
+	}
+	return e.store.Sync(flags)
+}
+
+// Lock locks the plaintext in memory, so that it is never written to swap.
+func (e *EncryptedMapping) Lock() error {
+	return e.plain.Lock()
+}
+
+// Close unmaps the plaintext and the file and closes the file. Pages
+// modified since the last Sync are lost.
+func (e *EncryptedMapping) Close() error {
+	if err := e.plain.UnsafeUnmap(); err != nil {
+		return err
+	}
+	if err := e.store.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
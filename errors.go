@@ -0,0 +1,77 @@
+package gommap
+
+import "errors"
+
+var (
+	// ErrUnaligned is returned when a memory address or offset doesn't meet
+	// the alignment required by the requested operation.
+	ErrUnaligned = errors.New("gommap: unaligned access")
+
+	// ErrSize is returned when the length of a mapping or region is not
+	// compatible with the requested operation.
+	ErrSize = errors.New("gommap: invalid size")
+
+	// ErrClosed is returned when using a mapping that was already closed.
+	ErrClosed = errors.New("gommap: mapping closed")
+
+	// ErrFileTruncated is returned when reading a part of a mapping that
+	// lies past the end of its backing file, which was truncated after
+	// the mapping was created.
+	ErrFileTruncated = errors.New("gommap: backing file truncated")
+
+	// ErrLocked is returned when a non-blocking file lock can't be taken
+	// because a conflicting lock is held.
+	ErrLocked = errors.New("gommap: file is locked")
+
+	// ErrNotMapped is returned when a region can't be found among the
+	// mappings of the process.
+	ErrNotMapped = errors.New("gommap: region not found in process mappings")
+
+	// ErrOutOfBounds is returned when an offset or range falls outside of
+	// the mapping it refers to.
+	ErrOutOfBounds = errors.New("gommap: access out of bounds")
+
+	// ErrReadOnly is returned when writing to a mapping that wasn't
+	// created writable.
+	ErrReadOnly = errors.New("gommap: mapping is read-only")
+
+	// ErrCorrupt is returned when data stored in a mapping fails validation.
+	ErrCorrupt = errors.New("gommap: corrupt data")
+
+	// ErrFull is returned by non-blocking writes to a full queue or buffer.
+	ErrFull = errors.New("gommap: full")
+
+	// ErrEmpty is returned by non-blocking reads from an empty queue or
+	// buffer.
+	ErrEmpty = errors.New("gommap: empty")
+
+	// ErrUnsupported is returned when a capability isn't available on the
+	// running platform.
+	ErrUnsupported = errors.New("gommap: not supported on this platform")
+
+	// ErrIncoherent is returned when mapping a file shared on a file system
+	// that doesn't keep shared mappings coherent across clients or layers.
+	ErrIncoherent = errors.New("gommap: file system does not keep shared mappings coherent")
+
+	// ErrLayout is returned when a type can't be laid over mapped memory
+	// because it contains pointers or has a platform-dependent size.
+	ErrLayout = errors.New("gommap: type does not have a fixed layout")
+
+	// ErrStatKind is returned when registering a statistic under a name
+	// already used by a statistic of another kind.
+	ErrStatKind = errors.New("gommap: statistic registered with another kind")
+
+	// ErrOwnerDead is returned when acquiring a RobustMutex whose previous
+	// owner died while holding it, so the data it protects may be
+	// inconsistent.
+	ErrOwnerDead = errors.New("gommap: lock owner died")
+
+	// ErrBudget is returned when locking or faulting in a mapping would
+	// take more memory than a MemoryBudget allows.
+	ErrBudget = errors.New("gommap: memory budget exceeded")
+
+	// ErrLengthRequired is returned when mapping a device to its end, as
+	// the size fstat reports for devices is meaningless and the length must
+	// be given explicitly.
+	ErrLengthRequired = errors.New("gommap: length required to map a device")
+)
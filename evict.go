@@ -0,0 +1,185 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultEvictRegion is the granularity at which an Evictor tracks accesses
+// when the policy doesn't set one.
+const defaultEvictRegion = 2 << 20
+
+// The EvictionPolicy type configures an Evictor.
+type EvictionPolicy struct {
+	// RegionSize is the granularity at which accesses are tracked and
+	// pages evicted, rounded up to a multiple of the page size. It
+	// defaults to 2 MiB.
+	RegionSize int
+	// IdleAfter is how long a region must go unused before it is evicted.
+	IdleAfter time.Duration
+	// Interval is how often the mapping is scanned. It defaults to a
+	// quarter of IdleAfter.
+	Interval time.Duration
+	// Advice is given to the pages of idle regions. It defaults to
+	// MADV_DONTNEED, which takes them out of the resident set of the
+	// process at once. For a shared or file mapping their contents are
+	// kept, in the file or page cache, but for private mappings the
+	// changes are lost; MADV_COLD, on Linux, merely makes the pages the
+	// first to be reclaimed under memory pressure.
+	Advice AdviseFlags
+}
+
+// The Evictor type keeps the resident set of a giant mapping bounded, by
+// giving up the pages of regions that weren't used for a while. Accesses
+// are noticed when a scan finds more pages of a region mapped in than the
+// previous one did, which catches a region being touched again after its
+// pages were dropped, and can be reported explicitly with Touch, which also
+// catches accesses to pages that are already mapped in. A region in
+// continuous use whose accesses aren't reported is dropped once per
+// IdleAfter, costing one minor fault per page to map it in again.
+//
+// A region is mapped in when the page tables of the process hold its pages
+// on Linux, and when mincore reports them resident elsewhere.
+type Evictor struct {
+	mmap       MMap
+	policy     EvictionPolicy
+	regionSize int
+	lastUse    []int64
+	mapped     []int
+	evicted    int64
+
+	mu       sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEvictor starts evicting the idle regions of mmap, which must be page
+// aligned, according to policy. The evictor must be stopped before mmap
+// is unmapped. Every region counts as used when the evictor starts.
+func NewEvictor(mmap MMap, policy EvictionPolicy) (*Evictor, error) {
+	if policy.IdleAfter <= 0 || policy.RegionSize < 0 || policy.Interval < 0 {
+		return nil, ErrSize
+	}
+	if mmap.addr()%uintptr(os.Getpagesize()) != 0 {
+		return nil, ErrUnaligned
+	}
+	if policy.RegionSize == 0 {
+		policy.RegionSize = defaultEvictRegion
+	}
+	if policy.Interval == 0 {
+		policy.Interval = policy.IdleAfter / 4
+		if policy.Interval == 0 {
+			policy.Interval = policy.IdleAfter
+		}
+	}
+	if policy.Advice == MADV_NORMAL {
+		policy.Advice = MADV_DONTNEED
+	}
+	regionSize := int(PageAlignUp(int64(policy.RegionSize)))
+	n := (len(mmap) + regionSize - 1) / regionSize
+	e := &Evictor{
+		mmap:       mmap,
+		policy:     policy,
+		regionSize: regionSize,
+		lastUse:    make([]int64, n),
+		mapped:     make([]int, n),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	now := time.Now().UnixNano()
+	for i := range e.lastUse {
+		e.lastUse[i] = now
+	}
+	go e.run()
+	return e, nil
+}
+
+func (e *Evictor) run() {
+	defer close(e.done)
+	t := time.NewTicker(e.policy.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// A failed scan is retried at the next tick; the evictor
+			// has no one to report errors to.
+			e.Scan()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *Evictor) region(i int) MMap {
+	end := (i + 1) * e.regionSize
+	if end > len(e.mmap) {
+		end = len(e.mmap)
+	}
+	return e.mmap[i*e.regionSize : end]
+}
+
+// Touch records that the n bytes of the mapping starting at off are being
+// used. It is cheap enough to call on every access.
+func (e *Evictor) Touch(off, n int) {
+	if off < 0 || n <= 0 || off >= len(e.mmap) {
+		return
+	}
+	if n > len(e.mmap)-off {
+		n = len(e.mmap) - off
+	}
+	now := time.Now().UnixNano()
+	for i := off / e.regionSize; i <= (off+n-1)/e.regionSize; i++ {
+		atomic.StoreInt64(&e.lastUse[i], now)
+	}
+}
+
+// Scan checks every region for accesses and evicts those idle for longer
+// than the policy allows, without waiting for the next periodic scan. It
+// returns the number of regions evicted.
+func (e *Evictor) Scan() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	idleSince := now.Add(-e.policy.IdleAfter).UnixNano()
+	evicted := 0
+	for i := range e.mapped {
+		region := e.region(i)
+		n, err := mappedPages(region)
+		if err != nil {
+			return evicted, err
+		}
+		if n > e.mapped[i] {
+			atomic.StoreInt64(&e.lastUse[i], now.UnixNano())
+		}
+		e.mapped[i] = n
+		if n == 0 || atomic.LoadInt64(&e.lastUse[i]) > idleSince {
+			continue
+		}
+		if err := region.Advise(e.policy.Advice); err != nil {
+			return evicted, err
+		}
+		if e.mapped[i], err = mappedPages(region); err != nil {
+			return evicted, err
+		}
+		atomic.AddInt64(&e.evicted, int64(len(region)))
+		evicted++
+	}
+	return evicted, nil
+}
+
+// Evicted returns how many bytes of idle regions have been advised so far.
+func (e *Evictor) Evicted() int64 {
+	return atomic.LoadInt64(&e.evicted)
+}
+
+// Stop stops the evictor, waiting for a scan in progress to end.
+func (e *Evictor) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.done
+}
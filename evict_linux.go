@@ -0,0 +1,35 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// mappedPages returns how many pages of mmap, which is page aligned, are
+// mapped in the page tables of the process. Unlike mincore, which reports
+// pages of files cached anywhere in the system, this tells whether the
+// process touched a page since it was last dropped with MADV_DONTNEED, and
+// needs no privilege.
+func mappedPages(mmap MMap) (int, error) {
+	if len(mmap) == 0 {
+		return 0, nil
+	}
+	pageSize := os.Getpagesize()
+	n := (len(mmap) + pageSize - 1) / pageSize
+	f, err := os.Open("/proc/self/pagemap")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, n*pagemapEntryLen)
+	if _, err := f.ReadAt(buf, int64(mmap.addr()/uintptr(pageSize))*pagemapEntryLen); err != nil {
+		return 0, err
+	}
+	mapped := 0
+	for i := 0; i < n; i++ {
+		if binary.LittleEndian.Uint64(buf[i*pagemapEntryLen:])&pmPresent != 0 {
+			mapped++
+		}
+	}
+	return mapped, nil
+}
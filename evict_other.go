@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// mappedPages returns how many pages of mmap, which is page aligned, are
+// resident according to mincore.
+func mappedPages(mmap MMap) (int, error) {
+	mapped := 0
+	err := mmap.scanResidency(0, func(offset int, vec []byte) bool {
+		for _, v := range vec {
+			mapped += int(v & 1)
+		}
+		return true
+	})
+	return mapped, err
+}
@@ -0,0 +1,158 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"syscall"
+)
+
+// noFile stands for the descriptor of a range that isn't backed by a file,
+// as for MapAnonymous.
+const noFile = ^uintptr(0)
+
+// The FaultError type reports an access to mapped memory that faulted, which
+// would otherwise have killed the process with SIGBUS or SIGSEGV.
+type FaultError struct {
+	// Region is the mapped range the faulting address belongs to.
+	Region MMap
+	// Offset is the offset of the faulting address in Region.
+	Offset int
+	// Addr is the faulting address.
+	Addr uintptr
+	// Cause is ErrFileTruncated when the backing file no longer covers the
+	// faulting page, and syscall.EIO otherwise, as when the device failed
+	// to return the page.
+	Cause error
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("gommap: fault at offset %d of mapping at %#x: %v", e.Offset, e.Region.addr(), e.Cause)
+}
+
+// Unwrap returns the cause of the fault.
+func (e *FaultError) Unwrap() error {
+	return e.Cause
+}
+
+// catchFault runs fn, and returns the runtime error raised by the fault it
+// took, if any, along with the faulting address. The Go runtime only turns
+// faults into panics for the goroutine that asked for it with
+// debug.SetPanicOnFault, and for accesses made by Go code, so faults taken
+// in system calls or C code still aren't caught.
+func catchFault(fn func()) (fault runtime.Error, addr uintptr) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(interface {
+				runtime.Error
+				Addr() uintptr
+			})
+			if !ok {
+				panic(r)
+			}
+			fault, addr = f, f.Addr()
+		}
+	}()
+	fn()
+	return nil, 0
+}
+
+// A faultRange is a mapped range registered with RegisterFaultRange.
+type faultRange struct {
+	mmap   MMap
+	fd     uintptr
+	offset int64
+}
+
+var faultRanges struct {
+	sync.RWMutex
+	ranges map[*faultRange]struct{}
+}
+
+// RegisterFaultRange registers mmap, the mapping of the file at fd starting
+// at offset, so that faults in it taken within GuardFaults are returned as
+// FaultError values. For memory not backed by a file, fd is ^uintptr(0).
+// The returned function unregisters the range, and must be called before
+// mmap is unmapped.
+func RegisterFaultRange(mmap MMap, fd uintptr, offset int64) (unregister func()) {
+	r := &faultRange{mmap: mmap, fd: fd, offset: offset}
+	faultRanges.Lock()
+	defer faultRanges.Unlock()
+	if faultRanges.ranges == nil {
+		faultRanges.ranges = make(map[*faultRange]struct{})
+	}
+	faultRanges.ranges[r] = struct{}{}
+	return func() {
+		faultRanges.Lock()
+		delete(faultRanges.ranges, r)
+		faultRanges.Unlock()
+	}
+}
+
+// lookupFault returns the registered range holding addr.
+func lookupFault(addr uintptr) (*faultRange, bool) {
+	faultRanges.RLock()
+	defer faultRanges.RUnlock()
+	for r := range faultRanges.ranges {
+		if start := r.mmap.addr(); addr >= start && addr-start < uintptr(len(r.mmap)) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// faultError describes a fault at addr in the mapping of the file at fd
+// starting at offset.
+func faultError(mmap MMap, fd uintptr, offset int64, addr uintptr) *FaultError {
+	e := &FaultError{Region: mmap, Offset: int(addr - mmap.addr()), Addr: addr, Cause: syscall.EIO}
+	if fd != noFile {
+		if size, regular, err := fileSize(fd); err == nil && regular && size <= offset+int64(e.Offset) {
+			e.Cause = ErrFileTruncated
+		}
+	}
+	return e
+}
+
+// GuardFaults runs fn, and returns a *FaultError if it faulted accessing a
+// range registered with RegisterFaultRange, instead of letting the fault
+// kill the process. The accesses of fn after the fault are abandoned, so it
+// should leave no state half updated. Faults outside of registered ranges
+// are raised again, as the runtime error reporting them; faults taken by
+// other goroutines, within system calls or in C code aren't caught.
+func GuardFaults(fn func()) error {
+	fault, addr := catchFault(fn)
+	if fault == nil {
+		return nil
+	}
+	r, ok := lookupFault(addr)
+	if !ok {
+		panic(fault)
+	}
+	return faultError(r.mmap, r.fd, r.offset, addr)
+}
+
+// Guard runs fn on the mapped memory, and returns a *FaultError if it
+// faulted accessing it, as GuardFaults does, without the mapping having to
+// be registered. It returns ErrClosed if the mapping is closed, and the
+// mapping can't be closed while fn runs.
+func (m *Mapping) Guard(fn func(mmap MMap)) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	mmap := m.mmap
+	fault, addr := catchFault(func() { fn(mmap) })
+	if fault == nil {
+		return nil
+	}
+	if start := mmap.addr(); addr < start || addr-start >= uintptr(len(mmap)) {
+		panic(fault)
+	}
+	return faultError(mmap, m.fd, m.offset, addr)
+}
@@ -0,0 +1,85 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"runtime"
+	"sync/atomic"
+)
+
+// prefaultSink keeps the reads done by Prefault from being optimized away.
+var prefaultSink byte
+
+// Prefault touches every page of mmap so that later accesses don't take
+// page faults. Pages are read, not written, so private mappings are not
+// copied.
+func (mmap MMap) Prefault() {
+	var sum byte
+	pageSize := os.Getpagesize()
+	for i := 0; i < len(mmap); i += pageSize {
+		sum += mmap[i]
+	}
+	prefaultSink = sum
+}
+
+// The MappingStats type holds the page faults attributed to a Mapping.
+type MappingStats struct {
+	MinorFaults int64
+	MajorFaults int64
+}
+
+// The faultCounters type holds the counters behind MappingStats. It is
+// allocated on its own so that its fields, used with sync/atomic, are
+// 64-bit aligned on 32-bit platforms.
+type faultCounters struct {
+	minor, major int64
+}
+
+// measure runs fn on a thread of its own and attributes the page faults it
+// takes to the mapping. On Linux faults are counted per thread; elsewhere
+// faults taken concurrently by other threads are counted as well.
+func (m *Mapping) measure(fn func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	minor, major := threadFaults()
+	fn()
+	minor2, major2 := threadFaults()
+	atomic.AddInt64(&m.faults.minor, minor2-minor)
+	atomic.AddInt64(&m.faults.major, major2-major)
+}
+
+// MeasureFaults runs fn and attributes the page faults taken meanwhile by
+// the calling goroutine to the mapping, so the paging cost of a code path
+// accessing the mapping shows up in Stats.
+func (m *Mapping) MeasureFaults(fn func()) {
+	m.measure(fn)
+}
+
+// Prefault touches every page of the mapping, recording the faults it took
+// to do so. The major faults reported by Stats afterwards say how much of the
+// mapping had to be read from the device.
+func (m *Mapping) Prefault() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	m.measure(func() {
+		m.mmap.inChunks(m.progress, func(chunk MMap) error {
+			chunk.Prefault()
+			return nil
+		})
+	})
+	return nil
+}
+
+// Stats returns the page faults attributed to the mapping so far by
+// Prefault and MeasureFaults.
+func (m *Mapping) Stats() MappingStats {
+	return MappingStats{
+		MinorFaults: atomic.LoadInt64(&m.faults.minor),
+		MajorFaults: atomic.LoadInt64(&m.faults.major),
+	}
+}
@@ -0,0 +1,11 @@
+package gommap
+
+import (
+	"os"
+	"strconv"
+)
+
+// fdPath returns the path of the file open as fd.
+func fdPath(fd uintptr) (string, error) {
+	return os.Readlink("/proc/self/fd/" + strconv.Itoa(int(fd)))
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// fdPath returns ErrUnsupported, as the path of an open file can only be
+// found out through /proc on Linux.
+func fdPath(fd uintptr) (string, error) {
+	return "", ErrUnsupported
+}
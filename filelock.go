@@ -0,0 +1,40 @@
+package gommap
+
+// LockMode selects the kind of advisory lock taken by LockFile.
+type LockMode uint
+
+const (
+	// LockShared takes a lock that can be held by several readers.
+	LockShared LockMode = 1 << iota
+	// LockExclusive takes a lock excluding every other lock.
+	LockExclusive
+	// LockNonBlock makes LockFile fail with ErrLocked instead of waiting
+	// for conflicting locks to be released.
+	LockNonBlock
+)
+
+// The FileLock type is an advisory lock held on a range of a file.
+type FileLock struct {
+	fd     uintptr
+	offset int64
+	length int64
+}
+
+// LockFile takes an advisory lock on length bytes of the file at fd starting
+// at offset. Locks belong to the open file, not to the process, so the same
+// file opened twice within a process can't be locked twice either.
+//
+// On Linux, the range is locked using open file description locks, and on
+// Windows using LockFileEx. Other systems only support locking whole files
+// with flock, and ignore the range.
+func LockFile(fd uintptr, offset, length int64, mode LockMode) (*FileLock, error) {
+	if err := lockFile(fd, offset, length, mode); err != nil {
+		return nil, err
+	}
+	return &FileLock{fd: fd, offset: offset, length: length}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	return unlockFile(l.fd, l.offset, l.length)
+}
@@ -0,0 +1,38 @@
+package gommap
+
+import "syscall"
+
+const (
+	_F_OFD_SETLK  = 37
+	_F_OFD_SETLKW = 38
+)
+
+func ofdLock(fd uintptr, offset, length int64, typ int16, wait bool) error {
+	cmd := _F_OFD_SETLK
+	if wait {
+		cmd = _F_OFD_SETLKW
+	}
+	lk := syscall.Flock_t{Type: typ, Whence: 0, Start: offset, Len: length}
+	for {
+		err := syscall.FcntlFlock(fd, cmd, &lk)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN || err == syscall.EACCES {
+			return ErrLocked
+		}
+		return err
+	}
+}
+
+func lockFile(fd uintptr, offset, length int64, mode LockMode) error {
+	typ := int16(syscall.F_RDLCK)
+	if mode&LockExclusive != 0 {
+		typ = syscall.F_WRLCK
+	}
+	return ofdLock(fd, offset, length, typ, mode&LockNonBlock == 0)
+}
+
+func unlockFile(fd uintptr, offset, length int64) error {
+	return ofdLock(fd, offset, length, syscall.F_UNLCK, false)
+}
@@ -0,0 +1,34 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import "syscall"
+
+// Without open file description locks, flock is the only lock that isn't
+// dropped when any descriptor of the file is closed by the process. It locks
+// whole files only.
+
+func lockFile(fd uintptr, offset, length int64, mode LockMode) error {
+	how := syscall.LOCK_SH
+	if mode&LockExclusive != 0 {
+		how = syscall.LOCK_EX
+	}
+	if mode&LockNonBlock != 0 {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(fd), how)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EWOULDBLOCK {
+			return ErrLocked
+		}
+		return err
+	}
+}
+
+func unlockFile(fd uintptr, offset, length int64) error {
+	return syscall.Flock(int(fd), syscall.LOCK_UN)
+}
@@ -0,0 +1,46 @@
+package gommap
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	_LOCKFILE_FAIL_IMMEDIATELY = 0x1
+	_LOCKFILE_EXCLUSIVE_LOCK   = 0x2
+	_ERROR_LOCK_VIOLATION      = syscall.Errno(33)
+)
+
+func lockFile(fd uintptr, offset, length int64, mode LockMode) error {
+	var flags uintptr
+	if mode&LockExclusive != 0 {
+		flags |= _LOCKFILE_EXCLUSIVE_LOCK
+	}
+	if mode&LockNonBlock != 0 {
+		flags |= _LOCKFILE_FAIL_IMMEDIATELY
+	}
+	ol := syscall.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	r, _, err := procLockFileEx.Call(fd, flags, 0, uintptr(uint32(length)), uintptr(uint32(length>>32)), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		if err == _ERROR_LOCK_VIOLATION {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+func unlockFile(fd uintptr, offset, length int64) error {
+	ol := syscall.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	r, _, err := procUnlockFileEx.Call(fd, 0, uintptr(uint32(length)), uintptr(uint32(length>>32)), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"context"
+	"sync"
+)
+
+// syncChunkSize is how many bytes SyncContext flushes between checks of its
+// context. It is a multiple of every page size in use.
+const syncChunkSize = 64 << 20
+
+// SyncAsync flushes the mapping back to the device from a goroutine of its
+// own, like Sync would, and returns a channel receiving the outcome once the
+// flush completes. The channel is buffered, so it may be ignored. The region
+// must stay mapped until the outcome is received.
+func (mmap MMap) SyncAsync(flags SyncFlags) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- mmap.Sync(flags)
+	}()
+	return done
+}
+
+// SyncAsync flushes the mapping back to the device in the background. See
+// MMap.SyncAsync. The mapping is held open while the flush is in progress,
+// so Close waits for it to complete.
+func (m *Mapping) SyncAsync(flags SyncFlags) <-chan error {
+	done := make(chan error, 1)
+	m.mu.RLock()
+	if err := m.check(); err != nil {
+		m.mu.RUnlock()
+		done <- err
+		return done
+	}
+	go func() {
+		defer m.mu.RUnlock()
+		done <- m.mmap.Sync(flags)
+	}()
+	return done
+}
+
+// SyncContext flushes the mapping back to the device like Sync does, in
+// chunks of 64 MiB, checking ctx between chunks. If ctx is done before the
+// whole mapping is flushed, SyncContext stops and returns ctx.Err(); the
+// chunks already flushed stay flushed.
+func (mmap MMap) SyncContext(ctx context.Context, flags SyncFlags) error {
+	return mmap.syncChunks(ctx, flags, nil)
+}
+
+// inChunks calls fn on consecutive chunks of mmap, widened to page
+// boundaries, and then reports the progress made, if progress isn't nil. It
+// stops at the first error fn returns.
+func (mmap MMap) inChunks(progress ProgressFunc, fn func(chunk MMap) error) error {
+	aligned := pageAligned(mmap)
+	extra := len(aligned) - len(mmap)
+	for off := 0; off < len(aligned); off += syncChunkSize {
+		end := off + syncChunkSize
+		if end > len(aligned) {
+			end = len(aligned)
+		}
+		if err := fn(aligned[off:end]); err != nil {
+			return err
+		}
+		if progress != nil {
+			done := end - extra
+			if done < 0 {
+				done = 0
+			}
+			progress(int64(done), int64(len(mmap)))
+		}
+	}
+	return nil
+}
+
+func (mmap MMap) syncChunks(ctx context.Context, flags SyncFlags, progress ProgressFunc) error {
+	return mmap.inChunks(progress, func(chunk MMap) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return chunk.Sync(flags)
+	})
+}
+
+// SyncContext flushes the mapping back to the device, giving up between
+// chunks once ctx is done. See MMap.SyncContext.
+func (m *Mapping) SyncContext(ctx context.Context, flags SyncFlags) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	return m.mmap.syncChunks(ctx, flags, m.progress)
+}
+
+// SyncParallel flushes the mapping back to the device like Sync does, with
+// up to workers goroutines flushing disjoint chunks of 64 MiB concurrently,
+// so that devices able to serve many requests at once, such as NVMe arrays,
+// are kept busy while checkpointing a huge mapping. It returns the first
+// error met, once every worker is done. A single worker flushes the chunks
+// in order, like SyncContext.
+func (mmap MMap) SyncParallel(flags SyncFlags, workers int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	chunks := make(chan MMap)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				if err := chunk.Sync(flags); err != nil {
+					once.Do(func() { first = err })
+				}
+			}
+		}()
+	}
+	mmap.inChunks(nil, func(chunk MMap) error {
+		chunks <- chunk
+		return nil
+	})
+	close(chunks)
+	wg.Wait()
+	return first
+}
+
+// SyncParallel flushes the mapping back to the device with several
+// goroutines. See MMap.SyncParallel.
+func (m *Mapping) SyncParallel(flags SyncFlags, workers int) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	return m.mmap.SyncParallel(flags, workers)
+}
+
+// A ProgressFunc is told how many of the total bytes of a mapping a long
+// operation went through so far.
+type ProgressFunc func(done, total int64)
+
+// WithProgress makes SyncContext and Prefault call fn each time they are
+// done with a chunk of the mapping, so long operations over huge mappings
+// can report how far along they are. fn is called from the goroutine doing
+// the operation.
+func WithProgress(fn ProgressFunc) MappingOption {
+	return func(m *Mapping) error {
+		m.progress = fn
+		return nil
+	}
+}
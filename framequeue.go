@@ -0,0 +1,221 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Layout of the header of a frame queue stored in a mapping.
+const (
+	fqMagic       = 0x514d4647 // "GFMQ"
+	fqMagicOff    = 0
+	fqCapOff      = 8
+	fqNotEmpty    = 16
+	fqNotFull     = 24
+	fqSendMutex   = 32
+	fqRecvMutex   = 36
+	fqTailOff     = 64
+	fqHeadOff     = 128
+	fqHeaderSize  = 192
+	fqFrameHeader = 4
+	fqMaxCapacity = 1 << 31
+)
+
+// The FrameQueue type is a queue of variable-length messages stored inside a
+// mapping. Each message is written as a frame made of a 32-bit length
+// followed by the payload, into a circular data area following the header.
+// When the mapping is MAP_SHARED, processes mapping the same file can use
+// the queue as an IPC transport.
+//
+// The header carries doorbells that senders and receivers ring after making
+// progress, so Send and Receive sleep instead of spinning when the queue is
+// full or empty. On Linux these are futexes. Senders are serialized with one
+// ProcessMutex and receivers with another, so any number of both may share a
+// queue.
+type FrameQueue struct {
+	mmap     MMap
+	data     MMap
+	mask     uint64
+	tail     *uint64
+	head     *uint64
+	notEmpty waitQueue
+	notFull  waitQueue
+	sendMu   *ProcessMutex
+	recvMu   *ProcessMutex
+	doorbell *Doorbell
+}
+
+// FrameQueueSize returns the number of bytes needed to store a frame queue
+// whose data area is capacity bytes long.
+func FrameQueueSize(capacity int) int {
+	return fqHeaderSize + capacity
+}
+
+// NewFrameQueue initializes an empty frame queue with a data area of capacity
+// bytes at the start of mmap, which must be 8-byte aligned and at least
+// FrameQueueSize(capacity) bytes long. Capacity must be a power of two no
+// larger than 2 GB; each frame takes 4 bytes in addition to its payload.
+//
+// Only the process creating the queue calls NewFrameQueue; everyone else
+// attaches to it with OpenFrameQueue.
+func NewFrameQueue(mmap MMap, capacity int) (*FrameQueue, error) {
+	if capacity <= fqFrameHeader || capacity&(capacity-1) != 0 || int64(capacity) > fqMaxCapacity ||
+		len(mmap) < FrameQueueSize(capacity) {
+		return nil, ErrSize
+	}
+	if uintptr(unsafe.Pointer(&mmap[0]))%8 != 0 {
+		return nil, ErrUnaligned
+	}
+	for i := range mmap[:fqHeaderSize] {
+		mmap[i] = 0
+	}
+	binary.LittleEndian.PutUint64(mmap[fqCapOff:], uint64(capacity))
+	p, _ := mmap.uint32Ptr(fqMagicOff)
+	atomic.StoreUint32(p, fqMagic)
+	return newFrameQueue(mmap, capacity), nil
+}
+
+// OpenFrameQueue attaches to a frame queue previously initialized with
+// NewFrameQueue at the start of mmap. It returns ErrCorrupt if mmap doesn't
+// hold a valid queue.
+func OpenFrameQueue(mmap MMap) (*FrameQueue, error) {
+	if len(mmap) < fqHeaderSize {
+		return nil, ErrCorrupt
+	}
+	p, err := mmap.uint32Ptr(fqMagicOff)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadUint32(p) != fqMagic {
+		return nil, ErrCorrupt
+	}
+	capacity := binary.LittleEndian.Uint64(mmap[fqCapOff:])
+	if capacity <= fqFrameHeader || capacity&(capacity-1) != 0 || capacity > fqMaxCapacity ||
+		capacity > uint64(len(mmap)-fqHeaderSize) {
+		return nil, ErrCorrupt
+	}
+	return newFrameQueue(mmap, int(capacity)), nil
+}
+
+func newFrameQueue(mmap MMap, capacity int) *FrameQueue {
+	tail, _ := mmap.uint64Ptr(fqTailOff)
+	head, _ := mmap.uint64Ptr(fqHeadOff)
+	sendMu, _ := NewProcessMutex(mmap, fqSendMutex)
+	recvMu, _ := NewProcessMutex(mmap, fqRecvMutex)
+	return &FrameQueue{
+		mmap:     mmap,
+		data:     mmap[fqHeaderSize : fqHeaderSize+capacity],
+		mask:     uint64(capacity - 1),
+		tail:     tail,
+		head:     head,
+		notEmpty: newWaitQueue(mmap, fqNotEmpty),
+		notFull:  newWaitQueue(mmap, fqNotFull),
+		sendMu:   sendMu,
+		recvMu:   recvMu,
+	}
+}
+
+// Cap returns the size of the data area of the queue.
+func (q *FrameQueue) Cap() int {
+	return len(q.data)
+}
+
+// MaxFrameSize returns the largest payload the queue can ever hold.
+func (q *FrameQueue) MaxFrameSize() int {
+	return len(q.data) - fqFrameHeader
+}
+
+// put copies p into the data area at pos, wrapping around its end.
+func (q *FrameQueue) put(pos uint64, p []byte) {
+	n := copy(q.data[pos&q.mask:], p)
+	copy(q.data, p[n:])
+}
+
+// get fills p from the data area at pos, wrapping around its end.
+func (q *FrameQueue) get(pos uint64, p []byte) {
+	n := copy(p, q.data[pos&q.mask:])
+	copy(p[n:], q.data)
+}
+
+// SetDoorbell makes this process ring d after each frame it sends. See
+// Ring.SetDoorbell.
+func (q *FrameQueue) SetDoorbell(d *Doorbell) {
+	q.doorbell = d
+}
+
+// TrySend queues p as a single frame without blocking. It returns ErrFull if
+// there's not enough room right now, and ErrSize if p could never fit.
+func (q *FrameQueue) TrySend(p []byte) error {
+	if len(p) > q.MaxFrameSize() {
+		return ErrSize
+	}
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+	tail := atomic.LoadUint64(q.tail)
+	free := uint64(len(q.data)) - (tail - atomic.LoadUint64(q.head))
+	if uint64(fqFrameHeader+len(p)) > free {
+		return ErrFull
+	}
+	var hdr [fqFrameHeader]byte
+	binary.LittleEndian.PutUint32(hdr[:], uint32(len(p)))
+	q.put(tail, hdr[:])
+	q.put(tail+fqFrameHeader, p)
+	atomic.StoreUint64(q.tail, tail+fqFrameHeader+uint64(len(p)))
+	q.notEmpty.wake()
+	if q.doorbell != nil {
+		q.doorbell.Ring()
+	}
+	return nil
+}
+
+// Send queues p as a single frame, blocking until there's room for it.
+func (q *FrameQueue) Send(p []byte) error {
+	for {
+		e := q.notFull.seq()
+		err := q.TrySend(p)
+		if err != ErrFull {
+			return err
+		}
+		q.notFull.wait(e)
+	}
+}
+
+// TryReceive copies the payload of the oldest frame into buf without
+// blocking and returns its length. It returns ErrEmpty if there's no frame,
+// and ErrSize, leaving the frame queued, if buf is too short for it.
+func (q *FrameQueue) TryReceive(buf []byte) (int, error) {
+	q.recvMu.Lock()
+	defer q.recvMu.Unlock()
+	head := atomic.LoadUint64(q.head)
+	used := atomic.LoadUint64(q.tail) - head
+	if used == 0 {
+		return 0, ErrEmpty
+	}
+	var hdr [fqFrameHeader]byte
+	q.get(head, hdr[:])
+	n := uint64(binary.LittleEndian.Uint32(hdr[:]))
+	if used < fqFrameHeader+n {
+		return 0, ErrCorrupt
+	}
+	if uint64(len(buf)) < n {
+		return 0, ErrSize
+	}
+	q.get(head+fqFrameHeader, buf[:n])
+	atomic.StoreUint64(q.head, head+fqFrameHeader+n)
+	q.notFull.wake()
+	return int(n), nil
+}
+
+// Receive copies the payload of the oldest frame into buf and returns its
+// length, blocking until a frame is available.
+func (q *FrameQueue) Receive(buf []byte) (int, error) {
+	for {
+		e := q.notEmpty.seq()
+		n, err := q.TryReceive(buf)
+		if err != ErrEmpty {
+			return n, err
+		}
+		q.notEmpty.wait(e)
+	}
+}
@@ -0,0 +1,112 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+// File system types reported by statfs, from linux/magic.h.
+var fsNames = map[uint32]string{
+	0xef53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x01021994: "tmpfs",
+	0x958458f6: "hugetlbfs",
+	0x6969:     "nfs",
+	0x65735546: "fuse",
+	0x794c7630: "overlayfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x00c36400: "ceph",
+}
+
+// incoherentFS lists the file systems on which a shared mapping may not see
+// the writes made by other clients or through other layers: network file
+// systems only revalidate cached pages now and then, and overlayfs copies a
+// file up to a new inode on its first write, away from the mappings of the
+// lower one.
+var incoherentFS = map[string]bool{
+	"nfs":       true,
+	"fuse":      true,
+	"overlayfs": true,
+	"cifs":      true,
+	"smb2":      true,
+	"9p":        true,
+	"ceph":      true,
+}
+
+// Definitions from linux/fs.h and linux/stat.h.
+const (
+	_FS_DAX_FL       = 0x02000000
+	_STATX_ATTR_DAX  = 0x00200000
+	_AT_EMPTY_PATH   = 0x1000
+	_statxSize       = 256
+	_statxAttributes = 8
+)
+
+// _FS_IOC_GETFLAGS is _IOR('f', 1, long).
+const _FS_IOC_GETFLAGS = 2<<30 | unsafe.Sizeof(uintptr(0))<<16 | 'f'<<8 | 1
+
+// The FSInfo type describes the file system holding a file, as far as
+// mapping it is concerned.
+type FSInfo struct {
+	// Type is the name of the file system, or empty if unknown; Magic is
+	// the type number reported by statfs.
+	Type  string
+	Magic uint32
+	// Coherent is false on file systems where a shared mapping may not
+	// see the writes made through other clients or layers, such as NFS
+	// and overlayfs.
+	Coherent bool
+	// DAX is set when the file is accessed directly on persistent memory,
+	// bypassing the page cache, so it can be mapped with MAP_SYNC.
+	DAX bool
+	// Flags holds the inode flags of the file, as returned by
+	// FS_IOC_GETFLAGS, or 0 if the file system doesn't support them.
+	Flags uint32
+}
+
+// ProbeFS describes the file system holding the file at fd.
+func ProbeFS(fd uintptr) (FSInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(fd), &st); err != nil {
+		return FSInfo{}, err
+	}
+	info := FSInfo{Magic: uint32(st.Type)}
+	info.Type = fsNames[info.Magic]
+	info.Coherent = !incoherentFS[info.Type]
+	var flags uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, _FS_IOC_GETFLAGS, uintptr(unsafe.Pointer(&flags))); errno == 0 {
+		info.Flags = flags
+	}
+	info.DAX = info.Flags&_FS_DAX_FL != 0
+	var stx [_statxSize]byte
+	empty := [1]byte{}
+	_, _, errno := syscall.Syscall6(_SYS_STATX, fd, uintptr(unsafe.Pointer(&empty[0])), _AT_EMPTY_PATH, 0, uintptr(unsafe.Pointer(&stx[0])), 0)
+	if errno == 0 && binary.LittleEndian.Uint64(stx[_statxAttributes:])&_STATX_ATTR_DAX != 0 {
+		info.DAX = true
+	}
+	return info, nil
+}
+
+// WithCoherentFS makes NewMapping fail with ErrIncoherent when a shared
+// mapping is created of a file on a file system that doesn't keep shared
+// mappings coherent, such as NFS or overlayfs, where processes on other
+// clients or layers could silently see stale data.
+func WithCoherentFS() MappingOption {
+	return func(m *Mapping) error {
+		if m.flags&MAP_SHARED == 0 {
+			return nil
+		}
+		info, err := ProbeFS(m.fd)
+		if err != nil {
+			return err
+		}
+		if !info.Coherent {
+			return ErrIncoherent
+		}
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package gommap
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The futex operations are issued without FUTEX_PRIVATE_FLAG, since the
+// words being waited on live in mappings shared with other processes.
+const (
+	_FUTEX_WAIT = 0
+	_FUTEX_WAKE = 1
+)
+
+// futexWait blocks while *addr holds val, until woken by futexWake from this
+// or any other process sharing the word. It may return spuriously, so callers
+// must re-check the condition they are waiting for.
+func futexWait(addr *uint32, val uint32) {
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), _FUTEX_WAIT, uintptr(val), 0, 0, 0)
+}
+
+// futexWaitTimeout is like futexWait, but also returns once d has elapsed.
+func futexWaitTimeout(addr *uint32, val uint32, d time.Duration) {
+	ts := syscall.NsecToTimespec(int64(d))
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), _FUTEX_WAIT, uintptr(val), uintptr(unsafe.Pointer(&ts)), 0, 0)
+}
+
+// futexWake wakes up to n waiters blocked on addr.
+func futexWake(addr *uint32, n int) {
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), _FUTEX_WAKE, uintptr(n), 0, 0, 0)
+}
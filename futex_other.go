@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package gommap
+
+import "time"
+
+// Outside of Linux there's no portable way to sleep on a word shared between
+// processes: WaitOnAddress on Windows and __ulock_wait on darwin only work
+// within a single process. Waiters fall back to polling instead.
+
+// futexWait sleeps briefly and returns, leaving it to the caller to re-check
+// the condition it is waiting for.
+func futexWait(addr *uint32, val uint32) {
+	time.Sleep(50 * time.Microsecond)
+}
+
+// futexWaitTimeout is like futexWait; polling already bounds the wait.
+func futexWaitTimeout(addr *uint32, val uint32, d time.Duration) {
+	futexWait(addr, val)
+}
+
+// futexWake is a no-op, since waiters poll.
+func futexWake(addr *uint32, n int) {}
@@ -1,6 +1,6 @@
 module github.com/tysonmote/gommap
 
-go 1.17
+go 1.20
 
 require gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c
 
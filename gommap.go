@@ -13,8 +13,8 @@ package gommap
 
 import (
 	"os"
-	"reflect"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -27,7 +27,8 @@ type MMap []byte
 
 // Map creates a new mapping in the virtual address space of the calling process.
 // This function will attempt to map the entire file by using the fstat system
-// call with the provided file descriptor to discover its length.
+// call with the provided file descriptor to discover its length. An empty
+// file yields an empty MMap, and a device returns ErrLengthRequired.
 func Map(fd uintptr, prot ProtFlags, flags MapFlags) (MMap, error) {
 	mmap, err := MapAt(0, fd, 0, -1, prot, flags)
 	return mmap, err
@@ -37,7 +38,8 @@ func Map(fd uintptr, prot ProtFlags, flags MapFlags) (MMap, error) {
 // process, using the specified region of the provided file or device. If -1 is
 // provided as length, this function will attempt to map until the end of the
 // provided file descriptor by using the fstat system call to discover its
-// length.
+// length. Devices, such as framebuffers, have no meaningful size, so they
+// must be mapped with an explicit length; -1 returns ErrLengthRequired.
 func MapRegion(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (MMap, error) {
 	mmap, err := MapAt(0, fd, offset, length, prot, flags)
 	return mmap, err
@@ -55,31 +57,100 @@ func MapAt(addr uintptr, fd uintptr, offset, length int64, prot ProtFlags, flags
 		if err := syscall.Fstat(int(fd), &stat); err != nil {
 			return nil, err
 		}
+		if mode := stat.Mode & syscall.S_IFMT; mode == syscall.S_IFCHR || mode == syscall.S_IFBLK {
+			// The size of a device is usually zero, which would map
+			// nothing without telling.
+			return nil, ErrLengthRequired
+		}
 		length = stat.Size
 	}
+	if length < 0 || uint64(length) > uint64(maxInt) {
+		// A slice can't cover more than maxInt bytes, which is 2 GB on
+		// 32-bit platforms.
+		return nil, ErrSize
+	}
+	if length == 0 {
+		// The kernel refuses empty mappings with EINVAL, but mapping an
+		// empty file is legitimate, so it yields an empty MMap that all
+		// methods, UnsafeUnmap included, accept.
+		return MMap{}, nil
+	}
 	addr, err := mmap_syscall(addr, uintptr(length), uintptr(prot), uintptr(flags), fd, offset)
 	if err != syscall.Errno(0) {
 		return nil, err
 	}
-	mmap := MMap{}
+	mmap := sliceAt(addr, int(length))
+	debugMapped(mmap)
+	metricsMapped(mmap)
+	return mmap, nil
+}
 
-	dh := (*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	dh.Data = addr
-	dh.Len = int(length) // Hmmm.. truncating here feels like trouble.
-	dh.Cap = dh.Len
+// MapAnonymous creates a new mapping of length bytes that is not backed by
+// any file, with its contents initialized to zero. MAP_ANON is added to
+// the provided flags, which must include one of MAP_SHARED or MAP_PRIVATE.
+// The options are applied in order before the mapping is returned; if one
+// fails, the mapping is unmapped and its error returned.
+func MapAnonymous(length int64, prot ProtFlags, flags MapFlags, opts ...MapOption) (MMap, error) {
+	mmap, err := MapAt(0, ^uintptr(0), 0, length, prot, flags|MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(mmap); err != nil {
+			mmap.UnsafeUnmap()
+			return nil, err
+		}
+	}
 	return mmap, nil
 }
 
+// A MapOption adjusts a mapping right after it is created, before any of its
+// pages are touched.
+type MapOption func(mmap MMap) error
+
+// maxInt is the largest length a slice can have.
+const maxInt = int(^uint(0) >> 1)
+
+// maxRangeLen bounds the length of the memory range handed to a single
+// system call, so that size_t arguments never overflow on 32-bit platforms
+// and a huge range doesn't hold the kernel's locks for one long call.
+const maxRangeLen = 1 << 30
+
+// rangeSyscall calls trap on the memory of mmap with arg as its third
+// argument, splitting the range at maxRangeLen boundaries, which are page
+// aligned. It stops at the first error.
+func (mmap MMap) rangeSyscall(trap uintptr, arg uintptr) error {
+	start := mmap.addr()
+	end := start + uintptr(len(mmap))
+	for start < end {
+		next := start&^(maxRangeLen-1) + maxRangeLen
+		if next > end || next < start {
+			next = end
+		}
+		_, _, err := syscall.Syscall(trap, start, next-start, arg)
+		if err != 0 {
+			return err
+		}
+		start = next
+	}
+	return nil
+}
+
 // UnsafeUnmap deletes the memory mapped region defined by the mmap slice. This
 // will also flush any remaining changes, if necessary.  Using mmap or any
 // other slices based on it after this method has been called will crash the
 // application.
 func (mmap MMap) UnsafeUnmap() error {
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	_, _, err := syscall.Syscall(syscall.SYS_MUNMAP, uintptr(rh.Data), uintptr(rh.Len), 0)
-	if err != 0 {
-		return err
+	if len(mmap) == 0 {
+		return nil
+	}
+	if !debugUnmap(mmap) {
+		_, _, err := syscall.Syscall(syscall.SYS_MUNMAP, mmap.addr(), uintptr(len(mmap)), 0)
+		if err != 0 {
+			return err
+		}
 	}
+	metricsUnmapped(mmap)
 	return nil
 }
 
@@ -90,44 +161,31 @@ func (mmap MMap) UnsafeUnmap() error {
 // (before the method returns) with MS_SYNC, or asynchronously (flushing is just
 // scheduled) with MS_ASYNC.
 func (mmap MMap) Sync(flags SyncFlags) error {
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	_, _, err := syscall.Syscall(syscall.SYS_MSYNC, uintptr(rh.Data), uintptr(rh.Len), uintptr(flags))
-	if err != 0 {
-		return err
-	}
-	return nil
+	start := time.Now()
+	err := mmap.rangeSyscall(syscall.SYS_MSYNC, uintptr(flags))
+	metricsSynced(time.Since(start), err != nil)
+	return err
 }
 
 // Advise advises the kernel about how to handle the mapped memory
 // region in terms of input/output paging within the memory region
 // defined by the mmap slice.
 func (mmap MMap) Advise(advice AdviseFlags) error {
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	_, _, err := syscall.Syscall(syscall.SYS_MADVISE, uintptr(rh.Data), uintptr(rh.Len), uintptr(advice))
-	if err != 0 {
-		return err
-	}
-	return nil
+	return mmap.rangeSyscall(syscall.SYS_MADVISE, uintptr(advice))
 }
 
 // Protect changes the protection flags for the memory mapped region
 // defined by the mmap slice.
 func (mmap MMap) Protect(prot ProtFlags) error {
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	_, _, err := syscall.Syscall(syscall.SYS_MPROTECT, uintptr(rh.Data), uintptr(rh.Len), uintptr(prot))
-	if err != 0 {
-		return err
-	}
-	return nil
+	return mmap.rangeSyscall(syscall.SYS_MPROTECT, uintptr(prot))
 }
 
 // Lock locks the mapped region defined by the mmap slice,
-// preventing it from being swapped out.
+// preventing it from being swapped out. When the kernel refuses, the error
+// is a *MemlockError telling which limit was hit.
 func (mmap MMap) Lock() error {
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	_, _, err := syscall.Syscall(syscall.SYS_MLOCK, uintptr(rh.Data), uintptr(rh.Len), 0)
-	if err != 0 {
-		return err
+	if err := mmap.rangeSyscall(syscall.SYS_MLOCK, 0); err != nil {
+		return memlockError(err, len(mmap))
 	}
 	return nil
 }
@@ -135,12 +193,7 @@ func (mmap MMap) Lock() error {
 // Unlock unlocks the mapped region defined by the mmap slice,
 // allowing it to swap out again.
 func (mmap MMap) Unlock() error {
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	_, _, err := syscall.Syscall(syscall.SYS_MUNLOCK, uintptr(rh.Data), uintptr(rh.Len), 0)
-	if err != 0 {
-		return err
-	}
-	return nil
+	return mmap.rangeSyscall(syscall.SYS_MUNLOCK, 0)
 }
 
 // IsResident returns a slice of booleans informing whether the respective
@@ -148,14 +201,20 @@ func (mmap MMap) Unlock() error {
 func (mmap MMap) IsResident() ([]bool, error) {
 	pageSize := os.Getpagesize()
 	result := make([]bool, (len(mmap)+pageSize-1)/pageSize)
-	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-	resulth := *(*reflect.SliceHeader)(unsafe.Pointer(&result))
-	_, _, err := syscall.Syscall(syscall.SYS_MINCORE, uintptr(rh.Data), uintptr(rh.Len), uintptr(resulth.Data))
+	for off := 0; off < len(mmap); off += maxRangeLen {
+		end := off + maxRangeLen
+		if end > len(mmap) {
+			end = len(mmap)
+		}
+		chunk := mmap[off:end]
+		vec := result[off/pageSize:]
+		_, _, err := syscall.Syscall(syscall.SYS_MINCORE, chunk.addr(), uintptr(len(chunk)), uintptr(unsafe.Pointer(&vec[0])))
+		if err != 0 {
+			return nil, err
+		}
+	}
 	for i := range result {
 		*(*uint8)(unsafe.Pointer(&result[i])) &= 1
 	}
-	if err != 0 {
-		return nil, err
-	}
 	return result, nil
 }
@@ -0,0 +1,20 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package gommap
+
+import (
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestInherit(c *C) {
+	mmap, err := MapAnonymous(int64(2*os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	c.Assert(mmap.Inherit(INHERIT_NONE), IsNil)
+	c.Assert(mmap[1:10].Inherit(INHERIT_COPY), IsNil)
+	c.Assert(mmap.Inherit(INHERIT_SHARE), IsNil)
+}
@@ -0,0 +1,19 @@
+package gommap
+
+import (
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestAdviseReusable(c *C) {
+	mmap, err := MapAnonymous(int64(4*os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[0] = 1
+	c.Assert(mmap.Advise(MADV_FREE_REUSABLE), IsNil)
+	c.Assert(mmap.Advise(MADV_FREE_REUSE), IsNil)
+	mmap[0] = 2
+	c.Assert(mmap[0], Equals, byte(2))
+}
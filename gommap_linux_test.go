@@ -0,0 +1,739 @@
+package gommap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestRemap(c *C) {
+	size := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*size)), IsNil)
+	mmap, err := MapRegion(s.file.Fd(), 0, int64(size), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+
+	before := Metrics()
+	mmap, err = mmap.Remap(2*size, MREMAP_MAYMOVE)
+	c.Assert(err, IsNil)
+	c.Assert(mmap, HasLen, 2*size)
+	c.Assert(string(mmap[:4]), Equals, "0123")
+	mmap[2*size-1] = 'x'
+	after := Metrics()
+	c.Assert(after.LiveMappings, Equals, before.LiveMappings)
+	c.Assert(after.MappedBytes-before.MappedBytes, Equals, int64(size))
+
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+	c.Assert(Metrics().MappedBytes, Equals, before.MappedBytes-int64(size))
+}
+
+func (s *S) TestSmapsInfo(c *C) {
+	size := 4 * os.Getpagesize()
+	mmap, err := MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[0] = 1
+	mmap[size-1] = 1
+	info, err := mmap.SmapsInfo()
+	c.Assert(err, IsNil)
+	c.Assert(info.Areas >= 1, Equals, true)
+	c.Assert(info.Size >= int64(size), Equals, true)
+	c.Assert(info.PrivateDirty >= int64(2*os.Getpagesize()), Equals, true)
+
+	_, err = MMap(make([]byte, 1)).SmapsInfo()
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestPageFlags(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(3*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[0] = 1
+	mmap[2*pageSize] = 1
+	pages, err := mmap.PageFlags(0, len(mmap))
+	c.Assert(err, IsNil)
+	c.Assert(pages, HasLen, 3)
+	c.Assert(pages[0].Present, Equals, true)
+	c.Assert(pages[1].Present, Equals, false)
+	c.Assert(pages[2].Present, Equals, true)
+	c.Assert(pages[0].Swapped, Equals, false)
+
+	pages, err = mmap.PageFlags(pageSize-1, 2)
+	c.Assert(err, IsNil)
+	c.Assert(pages, HasLen, 2)
+
+	_, err = mmap.PageFlags(pageSize, len(mmap))
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestBindNUMA(c *C) {
+	mmap, err := MapAnonymous(int64(2*os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	err = mmap.BindNUMA([]int{0}, MPOL_BIND)
+	if err == syscall.ENOSYS {
+		c.Skip("kernel without NUMA support")
+	}
+	c.Assert(err, IsNil)
+	mmap[0] = 1
+	policy, nodes, err := mmap.NUMAPolicy()
+	c.Assert(err, IsNil)
+	c.Assert(policy, Equals, MPOL_BIND)
+	c.Assert(nodes, DeepEquals, []int{0})
+
+	c.Assert(mmap.BindNUMA(nil, MPOL_DEFAULT), IsNil)
+	policy, _, err = mmap.NUMAPolicy()
+	c.Assert(err, IsNil)
+	c.Assert(policy, Equals, MPOL_DEFAULT)
+
+	c.Assert(mmap.BindNUMA([]int{maxNUMANodes}, MPOL_BIND), Equals, syscall.EINVAL)
+}
+
+func (s *S) TestMigratePages(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(3*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[0] = 1
+	mmap[pageSize] = 1
+	report, err := mmap.MigratePages(0, len(mmap), 0)
+	if err == syscall.ENOSYS {
+		c.Skip("kernel without NUMA support")
+	}
+	c.Assert(err, IsNil)
+	c.Assert(report.Pages, Equals, 3)
+	c.Assert(report.NotPresent, Equals, 1)
+	c.Assert(report.Moved+report.AlreadyThere+report.Failed, Equals, 2)
+
+	_, err = mmap.MigratePages(pageSize, len(mmap), 0)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestWithInterleave(c *C) {
+	mmap, err := MapAnonymous(int64(4*os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_SHARED, WithInterleave([]int{0}))
+	if err == syscall.ENOSYS {
+		c.Skip("kernel without NUMA support")
+	}
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	policy, nodes, err := mmap.NUMAPolicy()
+	c.Assert(err, IsNil)
+	c.Assert(policy, Equals, MPOL_INTERLEAVE)
+	c.Assert(nodes, DeepEquals, []int{0})
+
+	_, err = MapAnonymous(int64(os.Getpagesize()), PROT_READ, MAP_PRIVATE, WithInterleave([]int{-1}))
+	c.Assert(err, Equals, syscall.EINVAL)
+}
+
+func (s *S) TestAliasAt(c *C) {
+	size := 2 * os.Getpagesize()
+	mmap, err := MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	alias, err := mmap.AliasAt(0)
+	c.Assert(err, IsNil)
+	c.Assert(alias, HasLen, size)
+	c.Assert(&alias[0] != &mmap[0], Equals, true)
+	mmap[10] = 'a'
+	alias[size-1] = 'b'
+	c.Assert(alias[10], Equals, byte('a'))
+	c.Assert(mmap[size-1], Equals, byte('b'))
+	c.Assert(alias.UnsafeUnmap(), IsNil)
+	c.Assert(mmap[10], Equals, byte('a'))
+
+	private, err := MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer private.UnsafeUnmap()
+	_, err = private.AliasAt(0)
+	c.Assert(err, Equals, syscall.EINVAL)
+}
+
+func (s *S) TestKernelCopy(c *C) {
+	dst, err := os.Create(s.file.Name() + ".copy")
+	c.Assert(err, IsNil)
+	defer dst.Close()
+	done, err := kernelCopy(dst, s.file.Fd(), 4, 8)
+	c.Assert(err, IsNil)
+	c.Assert(done, Equals, true)
+	data, err := os.ReadFile(dst.Name())
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "456789AB")
+}
+
+func (s *S) TestIOUring(c *C) {
+	r, err := NewIOUring(2)
+	if err == syscall.ENOSYS || err == syscall.EPERM {
+		c.Skip("io_uring not available")
+	}
+	c.Assert(err, IsNil)
+
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	m.Bytes()[0] = 'x'
+	c.Assert(r.Sync(m, 0, 4, 1), IsNil)
+	c.Assert(r.Readahead(m.MMap(), 2), IsNil)
+	// The third request doesn't fit, so the first two get submitted.
+	c.Assert(r.Fsync(s.file.Fd(), true, 3), IsNil)
+	n, err := r.Submit()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	tags := map[uint64]bool{}
+	for i := 0; i < 3; i++ {
+		comp := <-r.Completions()
+		c.Assert(comp.Err, IsNil)
+		tags[comp.Tag] = true
+	}
+	c.Assert(tags, DeepEquals, map[uint64]bool{1: true, 2: true, 3: true})
+
+	c.Assert(r.Fsync(^uintptr(0), false, 4), IsNil)
+	_, err = r.Submit()
+	c.Assert(err, IsNil)
+	comp := <-r.Completions()
+	c.Assert(comp.Tag, Equals, uint64(4))
+	c.Assert(comp.Err, Equals, syscall.EBADF)
+
+	c.Assert(r.Readahead(m.MMap(), 5), IsNil)
+	c.Assert(r.Close(), IsNil)
+	_, ok := <-r.Completions()
+	c.Assert(ok, Equals, false)
+	c.Assert(r.Close(), Equals, ErrClosed)
+	c.Assert(r.Sync(m, 0, 4, 6), Equals, ErrClosed)
+}
+
+func (s *S) TestBaselineDiff(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(3*pageSize)), IsNil)
+	live, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer live.UnsafeUnmap()
+	b, err := NewBaseline(live, s.file.Fd(), 0)
+	c.Assert(err, IsNil)
+	defer b.Close()
+
+	copy(live[pageSize-2:], "abcd")
+	live[2*pageSize+7] = 'x'
+	live[2*pageSize+9] += 0 // Dirty, but unchanged.
+	type run struct{ off, n int }
+	var runs []run
+	c.Assert(b.Diff(func(off, n int) bool {
+		runs = append(runs, run{off, n})
+		return true
+	}), IsNil)
+	c.Assert(runs, DeepEquals, []run{{pageSize - 2, 4}, {2*pageSize + 7, 1}})
+
+	runs = nil
+	c.Assert(b.Diff(func(off, n int) bool {
+		runs = append(runs, run{off, n})
+		return false
+	}), IsNil)
+	c.Assert(runs, DeepEquals, []run{{pageSize - 2, 4}})
+}
+
+func (s *S) TestAdvisedView(c *C) {
+	c.Assert(s.file.Truncate(int64(4*os.Getpagesize())), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	hasFlag := func(flag string) bool {
+		found := false
+		err := overlappingVMAs("/proc/self/smaps", mmap.View(os.Getpagesize(), 1).aligned(), func(v *vma) {
+			for _, f := range v.flags {
+				found = found || f == flag
+			}
+		})
+		c.Assert(err, IsNil)
+		return found
+	}
+
+	v, err := mmap.View(os.Getpagesize()+1, 10).SequentialReader()
+	c.Assert(err, IsNil)
+	c.Assert(hasFlag("sr"), Equals, true)
+	c.Assert(v.Close(), IsNil)
+	c.Assert(hasFlag("sr"), Equals, false)
+	c.Assert(v.Close(), Equals, ErrClosed)
+
+	v, err = mmap.View(os.Getpagesize(), 10).RandomAccessor()
+	c.Assert(err, IsNil)
+	c.Assert(hasFlag("rr"), Equals, true)
+	c.Assert(v.Close(), IsNil)
+	c.Assert(hasFlag("rr"), Equals, false)
+}
+
+func (s *S) TestHugePages(c *C) {
+	support, err := ProbeHugePages()
+	c.Assert(err, IsNil)
+	for _, pool := range support.Pools {
+		c.Assert(pool.PageSize > int64(os.Getpagesize()), Equals, true)
+		c.Assert(pool.Free <= pool.Total, Equals, true)
+	}
+
+	// Regular files can't be mapped with hugetlb pages.
+	mmap, err := MapWith(s.file.Fd(), MapOptions{HugePages: true})
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	backing, err := mmap.Backing()
+	c.Assert(err, IsNil)
+	c.Assert(backing, Equals, NormalPages)
+
+	anon, err := MapWith(^uintptr(0), MapOptions{
+		Prot:      PROT_READ | PROT_WRITE,
+		Flags:     MAP_PRIVATE | MAP_ANONYMOUS,
+		Length:    4 << 20,
+		HugePages: true,
+	})
+	c.Assert(err, IsNil)
+	defer anon.UnsafeUnmap()
+	backing, err = anon.Backing()
+	c.Assert(err, IsNil)
+	free := 0
+	for _, pool := range support.Pools {
+		free += pool.Free
+	}
+	if free == 0 {
+		c.Assert(backing, Not(Equals), HugeTLBPages)
+	}
+	c.Assert(backing.String(), Not(Equals), "")
+}
+
+func (s *S) TestHugeFile(c *C) {
+	_, err := OpenHugeFile(s.file.Name(), 1)
+	c.Assert(err, Equals, ErrUnsupported)
+
+	mounts, err := HugeTLBFSMounts()
+	c.Assert(err, IsNil)
+	if len(mounts) == 0 {
+		c.Skip("no hugetlbfs mount")
+	}
+	name := path.Join(mounts[0], fmt.Sprintf("gommap-test-%d", os.Getpid()))
+	h, err := OpenHugeFile(name, 1)
+	if err == syscall.EACCES || err == syscall.ENOMEM {
+		c.Skip(err.Error())
+	}
+	c.Assert(err, IsNil)
+	defer os.Remove(name)
+	defer h.Close()
+	c.Assert(int64(h.Len()), Equals, h.PageSize())
+	h.Bytes()[0] = 1
+	n, err := h.Allocated()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, h.PageSize())
+}
+
+func (s *S) TestMemfdSeal(c *C) {
+	m, err := MapMemfd("gommap-test", 4096, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	copy(m.Bytes(), "sealed")
+	seals, err := m.GetSeals()
+	c.Assert(err, IsNil)
+	c.Assert(seals, Equals, SealFlags(0))
+
+	c.Assert(m.Seal(F_SEAL_WRITE|F_SEAL_SHRINK|F_SEAL_GROW), IsNil)
+	seals, err = m.GetSeals()
+	c.Assert(err, IsNil)
+	c.Assert(seals, Equals, F_SEAL_WRITE|F_SEAL_SHRINK|F_SEAL_GROW)
+	c.Assert(string(m.Bytes()[:6]), Equals, "sealed")
+
+	_, err = syscall.Write(int(m.Fd()), []byte("x"))
+	c.Assert(err, Equals, syscall.EPERM)
+	c.Assert(syscall.Ftruncate(int(m.Fd()), 0), Equals, syscall.EPERM)
+	_, err = MapRegion(m.Fd(), 0, 4096, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, Equals, syscall.EPERM)
+}
+
+func (s *S) TestMapRemoteFd(c *C) {
+	mmap, err := MapRemoteFd(os.Getpid(), int(s.file.Fd()), 0, -1, PROT_READ, MAP_SHARED)
+	if err == syscall.ENOSYS || err == syscall.EPERM {
+		c.Skip(err.Error())
+	}
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert([]byte(mmap), DeepEquals, testData)
+}
+
+func (s *S) TestRemoteReader(c *C) {
+	mmap, err := MapAnonymous(int64(2*os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	copy(mmap[os.Getpagesize()-4:], "remote")
+	addr := int64(mmap.addr()) + int64(os.Getpagesize()-4)
+
+	r := NewRemoteReader(os.Getpid())
+	defer r.Close()
+	buf := make([]byte, 6)
+	n, err := r.ReadAt(buf, addr)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "remote")
+
+	r.noVM = true
+	buf = make([]byte, 6)
+	n, err = r.ReadAt(buf, addr)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "remote")
+
+	// The second page is no longer mapped.
+	_, _, errno := syscall.Syscall(syscall.SYS_MUNMAP, mmap[os.Getpagesize():].addr(), uintptr(os.Getpagesize()), 0)
+	c.Assert(errno, Equals, syscall.Errno(0))
+	r.noVM = false
+	n, err = r.ReadAt(buf, addr)
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(n, Equals, 4)
+	r.noVM = true
+	n, err = r.ReadAt(buf, addr)
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(n, Equals, 4)
+	c.Assert(mmap[:os.Getpagesize()].UnsafeUnmap(), IsNil)
+}
+
+func (s *S) TestRemoteWriter(c *C) {
+	mmap, err := MapAnonymous(int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	addr := int64(mmap.addr())
+
+	w, err := NewRemoteWriter(os.Getpid(), addr+8, 8)
+	c.Assert(err, IsNil)
+	defer w.Close()
+	_, err = w.WriteAt([]byte("x"), addr)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	_, err = w.WriteAt([]byte("123456789"), addr+8)
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	n, err := w.WriteAt([]byte("vm"), addr+8)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	w.noVM = true
+	n, err = w.WriteAt([]byte("mem"), addr+10)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(string(mmap[8:13]), Equals, "vmmem")
+}
+
+func (s *S) TestMapGrowsDown(c *C) {
+	mmap, err := MapGrowsDown(int64(os.Getpagesize()))
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mmap[len(mmap)-1] = 1
+	mmap[0] = 1
+}
+
+func (s *S) TestMapSparse(c *C) {
+	mode, err := OvercommitPolicy()
+	c.Assert(err, IsNil)
+	if mode == OvercommitNever {
+		c.Skip("strict overcommit")
+	}
+	mmap, err := MapSparse(1<<40, PROT_READ|PROT_WRITE)
+	if err == ErrSize {
+		c.Skip("32-bit address space")
+	}
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mmap[len(mmap)-1] = 1
+	c.Assert(mmap[0], Equals, byte(0))
+}
+
+func (s *S) TestMapWithLocked(c *C) {
+	c.Assert(s.file.Truncate(int64(os.Getpagesize())), IsNil)
+	mmap, err := MapWith(s.file.Fd(), MapOptions{Mode: ReadWrite, Locked: true})
+	if err == syscall.ENOMEM || err == syscall.EPERM {
+		c.Skip("can't lock memory: " + err.Error())
+	}
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	locked := false
+	err = overlappingVMAs("/proc/self/smaps", mmap, func(v *vma) {
+		for _, f := range v.flags {
+			locked = locked || f == "lo"
+		}
+	})
+	c.Assert(err, IsNil)
+	c.Assert(locked, Equals, true)
+	resident, err := mmap.IsResident()
+	c.Assert(err, IsNil)
+	c.Assert(resident, DeepEquals, []bool{true})
+}
+
+func (s *S) TestProtectionKey(c *C) {
+	key, err := NewProtectionKey()
+	if err == ErrUnsupported {
+		c.Skip("protection keys not supported")
+	}
+	c.Assert(err, IsNil)
+	defer key.Free()
+	mmap, err := MapAnonymous(int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap.ProtectKey(PROT_READ|PROT_WRITE, key), IsNil)
+	WithAccess(key, func() {
+		copy(mmap, "secret")
+	})
+	var read string
+	WithAccess(key, func() {
+		read = string(mmap[:6])
+	})
+	c.Assert(read, Equals, "secret")
+	_, err = safeCopy(make([]byte, 6), mmap)
+	c.Assert(err, NotNil)
+	c.Assert(mmap.ProtectKey(PROT_READ|PROT_WRITE, 0), IsNil)
+}
+
+func (s *S) TestDescribe(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(3*pageSize)), IsNil)
+	mmap, err := MapRegion(s.file.Fd(), int64(pageSize), int64(2*pageSize), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap[pageSize:].Protect(PROT_READ), IsNil)
+
+	regions, err := mmap[1:].Describe()
+	c.Assert(err, IsNil)
+	c.Assert(regions, DeepEquals, []RegionInfo{
+		{Addr: mmap.addr() + 1, Len: int64(pageSize - 1), Perms: "rw-s", Offset: int64(pageSize + 1), Path: s.file.Name()},
+		{Addr: mmap.addr() + uintptr(pageSize), Len: int64(pageSize), Perms: "r--s", Offset: int64(2 * pageSize), Path: s.file.Name()},
+	})
+	c.Assert(regions[0].Writable(), Equals, true)
+	c.Assert(regions[1].Writable(), Equals, false)
+	c.Assert(regions[1].Shared(), Equals, true)
+}
+
+func (s *S) TestProbeFS(c *C) {
+	info, err := ProbeFS(s.file.Fd())
+	c.Assert(err, IsNil)
+	c.Assert(info.Magic, Not(Equals), uint32(0))
+	c.Assert(info.Coherent, Equals, !incoherentFS[info.Type])
+
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithCoherentFS())
+	if !info.Coherent {
+		c.Assert(err, Equals, ErrIncoherent)
+		return
+	}
+	c.Assert(err, IsNil)
+	c.Assert(m.Close(), IsNil)
+}
+
+func (s *S) TestSpliceTo(c *C) {
+	size := 64 * os.Getpagesize()
+	mmap, err := MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := range mmap {
+		mmap[i] = byte(i)
+	}
+	r, w, err := os.Pipe()
+	c.Assert(err, IsNil)
+	defer r.Close()
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	n, err := mmap.SpliceTo(w, false)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, size)
+	c.Assert(w.Close(), IsNil)
+	c.Assert(<-done, DeepEquals, []byte(mmap))
+}
+
+func (s *S) TestRemoveRange(c *C) {
+	pageSize := os.Getpagesize()
+	m, err := MapMemfd("gommap-test", int64(3*pageSize), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	mmap := m.MMap()
+	for i := range mmap {
+		mmap[i] = 1
+	}
+	n, err := mmap.RemoveRange(1, 2*pageSize)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, pageSize)
+	var st syscall.Stat_t
+	c.Assert(syscall.Fstat(int(m.Fd()), &st), IsNil)
+	c.Assert(st.Blocks*512, Equals, int64(2*pageSize))
+	c.Assert(mmap[pageSize-1], Equals, byte(1))
+	c.Assert(mmap[pageSize], Equals, byte(0))
+	c.Assert(mmap[2*pageSize], Equals, byte(1))
+	_, err = mmap.RemoveRange(0, 4*pageSize)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestPressureMonitor(c *C) {
+	stats, err := ReadMemoryPressure()
+	if err == ErrUnsupported {
+		c.Skip("no pressure stall information")
+	}
+	c.Assert(err, IsNil)
+	c.Assert(stats.Some.Avg10 >= 0 && stats.Some.Avg10 <= 100, Equals, true)
+
+	p, err := NewPressureMonitor(DefaultPressureTrigger)
+	if err == syscall.EPERM || err == syscall.EACCES {
+		c.Skip("pressure triggers not allowed")
+	}
+	c.Assert(err, IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mmap[0] = 'x'
+	remove := p.Relieve(mmap)
+	calls := 0
+	p.Handle(func() { calls++ })
+
+	// Real pressure can't be caused reliably, so the handlers are run as
+	// if the kernel had reported some.
+	p.fire()
+	c.Assert(calls, Equals, 1)
+	remove()
+	p.fire()
+	c.Assert(calls, Equals, 2)
+	buf := make([]byte, 1)
+	_, err = s.file.ReadAt(buf, 0)
+	c.Assert(err, IsNil)
+	c.Assert(buf[0], Equals, byte('x'))
+	c.Assert(p.Close(), IsNil)
+	c.Assert(p.Close(), Equals, ErrClosed)
+}
+
+func (s *S) TestAdviseProcess(c *C) {
+	pidfd, _, errno := syscall.Syscall(_SYS_PIDFD_OPEN, uintptr(os.Getpid()), 0, 0)
+	if errno == syscall.ENOSYS {
+		c.Skip("pidfd_open not supported")
+	}
+	c.Assert(errno, Equals, syscall.Errno(0))
+	defer syscall.Close(int(pidfd))
+
+	size := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(2*size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mmap[0], mmap[size] = 'a', 'b'
+
+	ranges := []Range{{int(mmap.addr()), size}, {int(mmap.addr()) + size, size}}
+	err = AdviseProcess(pidfd, ranges, MADV_COLD)
+	if err == syscall.ENOSYS {
+		c.Skip("process_madvise not supported")
+	}
+	c.Assert(err, IsNil)
+	c.Assert(AdviseProcess(pidfd, ranges, MADV_PAGEOUT), IsNil)
+	c.Assert(string([]byte{mmap[0], mmap[size]}), Equals, "ab")
+
+	c.Assert(AdviseProcess(pidfd, ranges, 9999), Equals, syscall.EINVAL)
+	c.Assert(AdviseProcess(pidfd, []Range{{int(mmap.addr()), -1}}, MADV_COLD), Equals, ErrSize)
+}
+
+func (s *S) TestPopulate(c *C) {
+	size := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(4*size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	n, err := mappedPages(mmap)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	err = mmap[:2*size].PopulateWrite()
+	if err == ErrUnsupported {
+		c.Skip("MADV_POPULATE_WRITE not supported")
+	}
+	c.Assert(err, IsNil)
+	n, err = mappedPages(mmap)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(mmap.PopulateRead(), IsNil)
+	n, err = mappedPages(mmap)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 4)
+
+	// Past the end of the file, populating fails instead of faulting.
+	c.Assert(s.file.Truncate(int64(size)), IsNil)
+	fmap, err := MapRegion(s.file.Fd(), 0, int64(2*size), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer fmap.UnsafeUnmap()
+	c.Assert(fmap[:size].PopulateRead(), IsNil)
+	c.Assert(fmap.PopulateRead(), Equals, syscall.EFAULT)
+}
+
+func (s *S) TestMapDeviceLength(c *C) {
+	f, err := os.OpenFile("/dev/zero", os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	_, err = Map(f.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, Equals, ErrLengthRequired)
+	_, err = MapRegion(f.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, Equals, ErrLengthRequired)
+
+	mmap, err := MapRegion(f.Fd(), 0, int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap, HasLen, os.Getpagesize())
+	mmap[0] = 1
+}
+
+func (s *S) TestUIO(c *C) {
+	// A fake device: sysfs attributes, and a regular file for the registers.
+	pageSize := os.Getpagesize()
+	dir := c.MkDir()
+	attrs := map[string]string{
+		"name":             "fake\n",
+		"maps/map0/addr":   "0xfe000000\n",
+		"maps/map0/size":   "0x100\n",
+		"maps/map1/addr":   "0xfe001010\n",
+		"maps/map1/size":   "0x20\n",
+		"maps/map1/offset": "0x10\n",
+		"maps/map1/name":   "doorbells\n",
+	}
+	for name, value := range attrs {
+		c.Assert(os.MkdirAll(path.Dir(path.Join(dir, name)), 0755), IsNil)
+		c.Assert(os.WriteFile(path.Join(dir, name), []byte(value), 0644), IsNil)
+	}
+	dev := path.Join(dir, "uio0")
+	c.Assert(os.WriteFile(dev, make([]byte, 2*pageSize), 0644), IsNil)
+
+	d, err := openUIO(dir, dev)
+	c.Assert(err, IsNil)
+	c.Assert(d.Name, Equals, "fake")
+	c.Assert(d.Maps, DeepEquals, []UIOMap{
+		{Addr: 0xfe000000, Size: 0x100},
+		{Name: "doorbells", Addr: 0xfe001010, Size: 0x20, Offset: 0x10},
+	})
+
+	regs, err := d.Map(1)
+	c.Assert(err, IsNil)
+	c.Assert(regs.Len(), Equals, 0x20)
+	c.Assert(regs.Write32(4, 0xdeadbeef), IsNil)
+	c.Assert(regs.Write64(8, 42), IsNil)
+	v, err := regs.Read32(4)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, uint32(0xdeadbeef))
+	_, err = regs.Read32(2)
+	c.Assert(err, Equals, ErrUnaligned)
+	_, err = regs.Read64(0x20)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(regs.Unmap(), IsNil)
+
+	data, err := os.ReadFile(dev)
+	c.Assert(err, IsNil)
+	c.Assert(data[pageSize+0x14:pageSize+0x18], DeepEquals, []byte{0xef, 0xbe, 0xad, 0xde})
+	c.Assert(data[pageSize+0x18], Equals, byte(42))
+
+	_, err = d.Map(2)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestDMABuf(c *C) {
+	// Without a dma-buf exporter at hand, map a regular file, which
+	// dma-buf ioctls don't apply to.
+	buf, err := MapDMABuf(s.file.Fd(), PROT_READ)
+	c.Assert(err, IsNil)
+	defer buf.Unmap()
+	c.Assert([]byte(buf.Bytes()), DeepEquals, testData)
+	c.Assert(buf.BeginAccess(DMA_BUF_SYNC_READ), Equals, syscall.ENOTTY)
+	c.Assert(buf.Access(DMA_BUF_SYNC_READ, func(MMap) { c.Fatal("access allowed") }), Equals, syscall.ENOTTY)
+}
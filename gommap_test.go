@@ -3,11 +3,19 @@
 package gommap
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"syscall"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -110,6 +118,34 @@ func (s *S) TestAdvise(c *C) {
 	c.Assert(err, ErrorMatches, "invalid argument")
 }
 
+func (s *S) TestAdviseRanges(c *C) {
+	// More ranges than fit in a single process_madvise call.
+	pageSize := os.Getpagesize()
+	n := 2100
+	mmap, err := MapAnonymous(int64(n*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := range mmap {
+		mmap[i] = 1
+	}
+	var ranges []Range
+	for i := 0; i < n; i += 2 {
+		ranges = append(ranges, Range{i * pageSize, pageSize})
+	}
+	c.Assert(mmap.AdviseRanges(ranges, MADV_DONTNEED), IsNil)
+	for i := 0; i < n; i++ {
+		want := byte(1)
+		if i%2 == 0 {
+			want = 0
+		}
+		c.Assert(mmap[i*pageSize], Equals, want)
+	}
+
+	c.Assert(mmap.AdviseRanges(ranges, 9999), ErrorMatches, "invalid argument")
+	c.Assert(mmap.AdviseRanges([]Range{{pageSize, pageSize}, {n * pageSize, 1}}, MADV_DONTNEED), Equals, ErrOutOfBounds)
+	c.Assert(mmap[pageSize], Equals, byte(1))
+}
+
 func (s *S) TestProtect(c *C) {
 	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
 	c.Assert(err, IsNil)
@@ -123,6 +159,43 @@ func (s *S) TestProtect(c *C) {
 	mmap[9] = 'X'
 }
 
+func (s *S) TestMapEmptyFile(c *C) {
+	c.Assert(s.file.Truncate(0), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	c.Assert(mmap, NotNil)
+	c.Assert(mmap, HasLen, 0)
+	c.Assert(mmap.Sync(MS_SYNC), IsNil)
+	c.Assert(mmap.Advise(MADV_SEQUENTIAL), IsNil)
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	mmap, err = MapRegion(s.file.Fd(), 0, 0, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	c.Assert(mmap, HasLen, 0)
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+}
+
+func (s *S) TestMapHandle(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+
+	h := handleOf(mmap)
+	c.Assert(h.base, Equals, &mmap[0])
+	c.Assert(h.length, Equals, len(testData))
+	b := h.bytes()
+	c.Assert(b.addr(), Equals, mmap.addr())
+	c.Assert(b, HasLen, len(mmap))
+	b[1] = 'x'
+	c.Assert(string(mmap[:3]), Equals, "0x2")
+	c.Assert(sliceAt(mmap.addr()+2, 3), DeepEquals, MMap("234"))
+
+	c.Assert(MMap{}.addr(), Equals, uintptr(0))
+	c.Assert(mmap[4:4].addr(), Equals, uintptr(0))
+	c.Assert(sliceAt(mmap.addr(), 0), HasLen, 0)
+	c.Assert(mapHandle{}.bytes(), HasLen, 0)
+	c.Assert(h.unmap(), IsNil)
+}
+
 func (s *S) TestLock(c *C) {
 	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_PRIVATE)
 	c.Assert(err, IsNil)
@@ -151,3 +224,1207 @@ func (s *S) TestIsResidentUnderOnePage(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(mapped, DeepEquals, []bool{true})
 }
+
+func (s *S) TestView(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	view := mmap.View(4, 8)
+	c.Assert(view.Offset(), Equals, 4)
+	c.Assert(view.Len(), Equals, 8)
+	c.Assert(view.Bytes(), DeepEquals, []byte("456789AB"))
+
+	sub := view.View(5, 3)
+	c.Assert(sub.Offset(), Equals, 9)
+	c.Assert(sub.Bytes(), DeepEquals, []byte("9AB"))
+
+	sub.Bytes()[0] = 'X'
+	c.Assert(sub.Sync(MS_SYNC), IsNil)
+	c.Assert(sub.Advise(MADV_SEQUENTIAL), IsNil)
+
+	fileData, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(fileData, DeepEquals, []byte("012345678XABCDEF"))
+
+	c.Assert(func() { view.View(6, 3) }, PanicMatches, "gommap: view out of range")
+}
+
+func (s *S) TestLines(c *C) {
+	s.file.Truncate(0)
+	s.file.WriteAt([]byte("one\ntwo\r\n\nthree"), 0)
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	var lines []string
+	var offsets []int
+	it := mmap.Lines()
+	it.SetReadahead(4096)
+	for it.Next() {
+		lines = append(lines, string(it.Bytes()))
+		offsets = append(offsets, it.Offset())
+	}
+	c.Assert(lines, DeepEquals, []string{"one", "two", "", "three"})
+	c.Assert(offsets, DeepEquals, []int{0, 4, 9, 10})
+}
+
+func (s *S) TestChunks(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	var chunks []string
+	it := mmap.Chunks(6)
+	for it.Next() {
+		chunks = append(chunks, string(it.Bytes()))
+	}
+	c.Assert(chunks, DeepEquals, []string{"012345", "6789AB", "CDEF"})
+}
+
+func (s *S) TestRecords(c *C) {
+	mmap, err := MapAnonymous(64, PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	records := func(off int, format RecordFormat) ([]string, int, error) {
+		var got []string
+		it := mmap.Records(off, format)
+		for it.Next() {
+			got = append(got, string(it.Bytes()))
+		}
+		return got, it.End(), it.Err()
+	}
+	copy(mmap, "\x03abc\x01d")
+	got, end, err := records(0, PrefixUvarint)
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, []string{"abc", "d"})
+	c.Assert(end, Equals, 6)
+
+	mmap[6] = 100
+	got, _, err = records(0, PrefixUvarint)
+	c.Assert(err, Equals, ErrCorrupt)
+	c.Assert(got, DeepEquals, []string{"abc", "d"})
+
+	copy(mmap[32:], "\x02\x00\x00\x00xy")
+	got, end, err = records(32, PrefixUint32)
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, []string{"xy"})
+	c.Assert(end, Equals, 38)
+	mmap[38] = 200
+	_, _, err = records(32, PrefixUint32)
+	c.Assert(err, Equals, ErrCorrupt)
+	_, _, err = records(61, PrefixUint32)
+	c.Assert(err, IsNil)
+	mmap[62] = 1
+	_, _, err = records(61, PrefixUint32)
+	c.Assert(err, Equals, ErrCorrupt)
+	_, _, err = records(65, PrefixUint32)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestViewAs(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	words, err := ViewAs[uint32](mmap)
+	c.Assert(err, IsNil)
+	c.Assert(words, HasLen, 4)
+	words[0] = 0x41414141
+	c.Assert(string(mmap[:4]), Equals, "AAAA")
+
+	_, err = ViewAs[uint64](mmap[:12])
+	c.Assert(err, Equals, ErrSize)
+	_, err = ViewAs[uint32](mmap[1:13])
+	c.Assert(err, Equals, ErrUnaligned)
+}
+
+type testHeader struct {
+	Magic   [4]byte
+	Version uint32
+	Count   uint64
+}
+
+func (s *S) TestMapStruct(c *C) {
+	hdr, mmap, err := MapStruct[testHeader](s.file.Fd(), 0, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(string(hdr.Magic[:]), Equals, "0123")
+
+	hdr.Magic = [4]byte{'G', 'O', 'M', 'M'}
+	c.Assert(string(mmap[:4]), Equals, "GOMM")
+
+	_, err = StructAt[testHeader](mmap, 4)
+	c.Assert(err, Equals, ErrSize)
+	_, err = StructAt[struct{ P *int }](mmap, 0)
+	c.Assert(errors.Is(err, ErrLayout), Equals, true)
+	_, err = StructAt[struct{ N int }](mmap, 0)
+	c.Assert(errors.Is(err, ErrLayout), Equals, true)
+	_, err = StructAt[error](mmap, 0)
+	c.Assert(errors.Is(err, ErrLayout), Equals, true)
+	// The padding before B, and after B in the second one, is only there
+	// on 64-bit platforms.
+	_, err = StructAt[struct {
+		A uint32
+		B uint64
+	}](mmap, 0)
+	c.Assert(errors.Is(err, ErrLayout), Equals, true)
+	_, err = StructAt[struct {
+		B uint64
+		A uint32
+	}](mmap, 0)
+	c.Assert(errors.Is(err, ErrLayout), Equals, true)
+	_, err = StructAt[struct {
+		A uint32
+		_ [4]byte
+		B uint64
+	}](mmap, 0)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestFixedOffsetAccessors(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	c.Assert(mmap.PutUint64At(8, 0x0102030405060708, binary.BigEndian), IsNil)
+	c.Assert([]byte(mmap[8:]), DeepEquals, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	v64, err := mmap.Uint64At(8, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Assert(v64, Equals, uint64(0x0807060504030201))
+
+	c.Assert(mmap.PutUint32At(0, 0xdeadbeef, binary.LittleEndian), IsNil)
+	v32, err := mmap.Uint32At(0, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Assert(v32, Equals, uint32(0xdeadbeef))
+
+	c.Assert(mmap.PutUint16At(14, 0xabcd, binary.BigEndian), IsNil)
+	v16, err := mmap.Uint16At(14, binary.BigEndian)
+	c.Assert(err, IsNil)
+	c.Assert(v16, Equals, uint16(0xabcd))
+
+	_, err = mmap.Uint64At(9, binary.BigEndian)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	_, err = mmap.Uint16At(-1, binary.BigEndian)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(mmap.PutUint32At(13, 0, binary.BigEndian), Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestReadOnlyMMap(c *C) {
+	m, err := MapReadOnly(s.file.Fd(), MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.UnsafeUnmap()
+	c.Assert(m.Len(), Equals, len(testData))
+	b, err := m.ByteAt(10)
+	c.Assert(err, IsNil)
+	c.Assert(b, Equals, byte('A'))
+	_, err = m.ByteAt(16)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	str, err := m.StringAt(4, 3)
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "456")
+
+	p := make([]byte, 4)
+	n, err := m.ReadAt(p, 14)
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(string(p[:n]), Equals, "EF")
+	n, err = m.ReadAt(p, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(p[:n]), Equals, "0123")
+	c.Assert(m.Advise(MADV_RANDOM), IsNil)
+
+	region, err := MapRegionReadOnly(s.file.Fd(), 0, 8, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer region.UnsafeUnmap()
+	v, err := region.Uint32At(0, binary.BigEndian)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, uint32(0x30313233))
+}
+
+func (s *S) TestAlignedAt(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	b, err := mmap.AlignedAt(8, 8, 8)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "89ABCDEF")
+	c.Assert(cap(b), Equals, 8)
+	_, err = mmap.AlignedAt(4, 8, 8)
+	c.Assert(err, Equals, ErrUnaligned)
+	_, err = mmap.AlignedAt(12, 8, 4)
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	b, copied, err := mmap.CopyIfUnaligned(8, 8, 8)
+	c.Assert(err, IsNil)
+	c.Assert(copied, Equals, false)
+	c.Assert(&b[0], Equals, &mmap[8])
+	b, copied, err = mmap.CopyIfUnaligned(3, 6, 64)
+	c.Assert(err, IsNil)
+	c.Assert(copied, Equals, true)
+	c.Assert(string(b), Equals, "345678")
+	c.Assert(MMap(b).addr()%64, Equals, uintptr(0))
+	_, _, err = mmap.CopyIfUnaligned(12, 8, 4)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestStringAt(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	str, err := mmap.StringAt(10, 3)
+	c.Assert(err, IsNil)
+	copied, err := mmap.CopyStringAt(10, 3)
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "ABC")
+	mmap[10] = 'X'
+	c.Assert(str, Equals, "XBC")
+	c.Assert(copied, Equals, "ABC")
+
+	str, err = mmap.StringAt(16, 0)
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "")
+	_, err = mmap.StringAt(15, 2)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	_, err = mmap.CopyStringAt(0, -1)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestAtomicAccessors(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	c.Assert(mmap.AtomicStoreUint64At(8, 40), IsNil)
+	n, err := mmap.AtomicAddUint64At(8, 2)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(42))
+
+	swapped, err := mmap.CompareAndSwapUint64At(8, 41, 0)
+	c.Assert(err, IsNil)
+	c.Assert(swapped, Equals, false)
+	swapped, err = mmap.CompareAndSwapUint64At(8, 42, 7)
+	c.Assert(err, IsNil)
+	c.Assert(swapped, Equals, true)
+
+	n, err = mmap.AtomicUint64At(8)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(7))
+
+	_, err = mmap.AtomicUint64At(4)
+	c.Assert(err, Equals, ErrUnaligned)
+	_, err = mmap.AtomicUint64At(16)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestBitset(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := range mmap {
+		mmap[i] = 0
+	}
+
+	b := NewBitset(mmap)
+	c.Assert(b.Len(), Equals, uint64(128))
+	for _, i := range []uint64{0, 7, 8, 63, 64, 127} {
+		b.Set(i)
+	}
+	b.Clear(8)
+	c.Assert(b.Test(7), Equals, true)
+	c.Assert(b.Test(8), Equals, false)
+	c.Assert(b.Count(), Equals, uint64(5))
+
+	var set []uint64
+	b.Range(1, 127, func(i uint64) bool {
+		set = append(set, i)
+		return true
+	})
+	c.Assert(set, DeepEquals, []uint64{7, 63, 64})
+
+	i, ok := b.NextClear(0)
+	c.Assert(ok, Equals, true)
+	c.Assert(i, Equals, uint64(1))
+	_, ok = b.NextSet(128)
+	c.Assert(ok, Equals, false)
+	c.Assert(b.Sync(MS_SYNC), IsNil)
+}
+
+func (s *S) TestBloom(c *C) {
+	m, k := OptimalBloomParams(100, 0.01)
+	c.Assert(k, Equals, 7)
+	c.Assert(s.file.Truncate(int64(BloomSize(m))), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	_, err = OpenBloom(mmap)
+	c.Assert(err, Equals, ErrCorrupt)
+
+	b, err := NewBloom(mmap, m, k)
+	c.Assert(err, IsNil)
+	for i := 0; i < 100; i++ {
+		b.Add([]byte(fmt.Sprint("key", i)))
+	}
+
+	reader, err := OpenBloom(mmap)
+	c.Assert(err, IsNil)
+	c.Assert(reader.M(), Equals, m)
+	c.Assert(reader.K(), Equals, k)
+	for i := 0; i < 100; i++ {
+		c.Assert(reader.Test([]byte(fmt.Sprint("key", i))), Equals, true)
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if reader.Test([]byte(fmt.Sprint("other", i))) {
+			falsePositives++
+		}
+	}
+	c.Assert(falsePositives < 50, Equals, true)
+	c.Assert(b.Sync(MS_SYNC), IsNil)
+
+	mmap[bloomKOff]++
+	_, err = OpenBloom(mmap)
+	c.Assert(err, Equals, ErrCorrupt)
+}
+
+func (s *S) TestArena(c *C) {
+	a, err := NewArena(1 << 20)
+	c.Assert(err, IsNil)
+	defer a.Close()
+
+	b1, err := a.Alloc(3)
+	c.Assert(err, IsNil)
+	b2, err := a.Alloc(16)
+	c.Assert(err, IsNil)
+	c.Assert(b2, HasLen, 16)
+	c.Assert(a.Used(), Equals, 24)
+	copy(b1, "abc")
+	b2[0] = 'x'
+
+	_, err = a.Alloc(1 << 20)
+	c.Assert(err, Equals, ErrFull)
+
+	c.Assert(a.Reset(), IsNil)
+	c.Assert(a.Used(), Equals, 0)
+	b1, err = a.Alloc(3)
+	c.Assert(err, IsNil)
+	c.Assert(b1, DeepEquals, []byte{0, 0, 0})
+}
+
+func (s *S) TestSlab(c *C) {
+	c.Assert(s.file.Truncate(256), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	slab, err := NewSlab(mmap, []int{64, 10})
+	c.Assert(err, IsNil)
+	a, err := slab.Alloc(10)
+	c.Assert(err, IsNil)
+	c.Assert(a, Equals, uint64(SlabHeaderSize(2)))
+	copy(slab.Bytes(a, 10), "0123456789")
+	b, err := slab.Alloc(40)
+	c.Assert(err, IsNil)
+	c.Assert(b, Equals, a+16)
+	_, err = slab.Alloc(65)
+	c.Assert(err, Equals, ErrSize)
+
+	c.Assert(slab.Free(a, 10), IsNil)
+	reopened, err := OpenSlab(mmap)
+	c.Assert(err, IsNil)
+	again, err := reopened.Alloc(16)
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, a)
+	c.Assert(reopened.Bytes(again, 10), DeepEquals, make([]byte, 10))
+
+	for err == nil {
+		_, err = reopened.Alloc(64)
+	}
+	c.Assert(err, Equals, ErrFull)
+
+	// Sizes rounding up to the same class make one class.
+	slab, err = NewSlab(mmap, []int{5, 8, 3})
+	c.Assert(err, IsNil)
+	first, err := slab.Alloc(5)
+	c.Assert(err, IsNil)
+	c.Assert(first, Equals, uint64(SlabHeaderSize(1)))
+	reopened, err = OpenSlab(mmap)
+	c.Assert(err, IsNil)
+	next, err := reopened.Alloc(8)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, first+8)
+}
+
+func (s *S) TestSnapshot(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	snap, err := Snapshot(s.file.Fd(), 0, -1)
+	c.Assert(err, IsNil)
+	defer snap.UnsafeUnmap()
+
+	mmap[0] = 'X'
+	_, err = s.file.WriteAt([]byte("Y"), 1)
+	c.Assert(err, IsNil)
+	c.Assert([]byte(snap), DeepEquals, testData)
+}
+
+func (s *S) TestSnapshotSmall(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	// Shorter than a word.
+	snap, err := Snapshot(s.file.Fd(), 0, 3)
+	c.Assert(err, IsNil)
+	defer snap.UnsafeUnmap()
+
+	mmap[0] = 'X'
+	_, err = s.file.WriteAt([]byte("Y"), 1)
+	c.Assert(err, IsNil)
+	c.Assert(string(snap), Equals, "012")
+}
+
+func (s *S) TestManager(c *C) {
+	var m Manager
+	m1, err := m.Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	m2, err := m.MapRegion(s.file.Fd(), 0, 8, PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+
+	infos := m.Mappings()
+	c.Assert(infos, HasLen, 2)
+	for _, info := range infos {
+		c.Assert(info.Fd, Equals, s.file.Fd())
+		switch info.Addr {
+		case m1.addr():
+			c.Assert(info.Len, Equals, 16)
+			c.Assert(info.Prot, Equals, PROT_READ)
+		case m2.addr():
+			c.Assert(info.Len, Equals, 8)
+			c.Assert(info.Flags, Equals, MAP_PRIVATE)
+		default:
+			c.Fatalf("unexpected mapping %#x", info.Addr)
+		}
+	}
+
+	c.Assert(m.Unmap(m1), IsNil)
+	c.Assert(m.Len(), Equals, 1)
+	c.Assert(m.CloseAll(), IsNil)
+	c.Assert(m.Len(), Equals, 0)
+}
+
+func (s *S) TestMetrics(c *C) {
+	before := Metrics()
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	during := Metrics()
+	c.Assert(during.LiveMappings-before.LiveMappings, Equals, int64(1))
+	c.Assert(during.MappedBytes-before.MappedBytes, Equals, int64(len(testData)))
+
+	c.Assert(mmap.Sync(MS_SYNC), IsNil)
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+	after := Metrics()
+	c.Assert(after.LiveMappings, Equals, before.LiveMappings)
+	c.Assert(after.Maps-before.Maps, Equals, uint64(1))
+	c.Assert(after.Unmaps-before.Unmaps, Equals, uint64(1))
+	c.Assert(after.SyncCalls-before.SyncCalls, Equals, uint64(1))
+	c.Assert(after.MinorFaults >= before.MinorFaults, Equals, true)
+
+	PublishMetrics("gommap_test")
+	c.Assert(expvar.Get("gommap_test").String(), Matches, `\{.*"LiveMappings".*\}`)
+}
+
+func (s *S) TestMetricsPartialUnmap(c *C) {
+	pageSize := os.Getpagesize()
+	before := Metrics()
+	mmap, err := MapAnonymous(int64(3*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	c.Assert(mmap[:pageSize].UnsafeUnmap(), IsNil)
+	during := Metrics()
+	c.Assert(during.LiveMappings-before.LiveMappings, Equals, int64(1))
+	c.Assert(during.MappedBytes-before.MappedBytes, Equals, int64(2*pageSize))
+	c.Assert(mmap[pageSize:].UnsafeUnmap(), IsNil)
+	after := Metrics()
+	c.Assert(after.LiveMappings, Equals, before.LiveMappings)
+	c.Assert(after.MappedBytes, Equals, before.MappedBytes)
+	c.Assert(after.Maps-before.Maps, Equals, uint64(1))
+	c.Assert(after.Unmaps-before.Unmaps, Equals, uint64(2))
+
+	// The halves MapMirror maps over its reservation aren't mappings of
+	// their own.
+	before = Metrics()
+	mirror, err := MapMirror(pageSize)
+	c.Assert(err, IsNil)
+	during = Metrics()
+	c.Assert(during.LiveMappings-before.LiveMappings, Equals, int64(1))
+	c.Assert(during.MappedBytes-before.MappedBytes, Equals, int64(2*pageSize))
+	c.Assert(during.Maps-before.Maps, Equals, uint64(1))
+	c.Assert(mirror.UnsafeUnmap(), IsNil)
+	after = Metrics()
+	c.Assert(after.LiveMappings, Equals, before.LiveMappings)
+	c.Assert(after.MappedBytes, Equals, before.MappedBytes)
+}
+
+func (s *S) TestIsResidentChunked(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(5*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[0] = 1
+	mmap[3*pageSize] = 1
+	var offsets []int
+	var resident []bool
+	err = mmap.IsResidentChunked(2*pageSize, func(offset int, r []bool) bool {
+		offsets = append(offsets, offset)
+		resident = append(resident, r...)
+		return true
+	})
+	c.Assert(err, IsNil)
+	c.Assert(offsets, DeepEquals, []int{0, 2 * pageSize, 4 * pageSize})
+	c.Assert(resident, DeepEquals, []bool{true, false, false, true, false})
+
+	calls := 0
+	err = mmap.IsResidentChunked(pageSize, func(int, []bool) bool {
+		calls++
+		return false
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 1)
+}
+
+func (s *S) TestResidentBytes(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(4*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	n, err := mmap.ResidentBytes()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(0))
+
+	mmap[pageSize] = 1
+	n, err = mmap.ResidentBytes()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(pageSize))
+	ratio, err := mmap.ResidentRatio()
+	c.Assert(err, IsNil)
+	c.Assert(ratio, Equals, 0.25)
+
+	n, err = mmap[pageSize+10 : 2*pageSize+10].ResidentBytes()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(pageSize-10))
+}
+
+func (s *S) TestForEachResidentRun(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(6*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[2*pageSize] = 1
+	mmap[3*pageSize] = 1
+	mmap[5*pageSize] = 1
+	type run struct {
+		offset, length int
+		resident       bool
+	}
+	var runs []run
+	err = mmap.ForEachResidentRun(func(offset, length int, resident bool) bool {
+		runs = append(runs, run{offset, length, resident})
+		return true
+	})
+	c.Assert(err, IsNil)
+	c.Assert(runs, DeepEquals, []run{
+		{0, 2 * pageSize, false},
+		{2 * pageSize, 2 * pageSize, true},
+		{4 * pageSize, pageSize, false},
+		{5 * pageSize, pageSize, true},
+	})
+
+	runs = nil
+	err = mmap[pageSize+1 : 3*pageSize-1].ForEachResidentRun(func(offset, length int, resident bool) bool {
+		runs = append(runs, run{offset, length, resident})
+		return true
+	})
+	c.Assert(err, IsNil)
+	c.Assert(runs, DeepEquals, []run{
+		{0, pageSize - 1, false},
+		{pageSize - 1, pageSize - 1, true},
+	})
+
+	calls := 0
+	err = mmap.ForEachResidentRun(func(int, int, bool) bool {
+		calls++
+		return false
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 1)
+}
+
+func (s *S) TestSecure(c *C) {
+	sec, err := NewSecure(100)
+	c.Assert(err, IsNil)
+	c.Assert(sec.Len(), Equals, 100)
+	b := sec.Bytes()
+	copy(b, "secret")
+
+	wipe(b[:3])
+	c.Assert(string(b[:6]), Equals, "\x00\x00\x00ret")
+	c.Assert(sec.Close(), IsNil)
+	c.Assert(sec.Bytes(), IsNil)
+	c.Assert(sec.Close(), Equals, ErrClosed)
+
+	_, err = NewSecure(0)
+	c.Assert(err, Equals, ErrSize)
+}
+
+func (s *S) TestSecureUnmap(c *C) {
+	mmap, err := MapAnonymous(int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	copy(mmap, "password")
+	c.Assert(mmap.Protect(PROT_READ), IsNil)
+	c.Assert(mmap.SecureUnmap(), IsNil)
+
+	c.Assert(s.file.Truncate(int64(os.Getpagesize())), IsNil)
+	mmap, err = Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	c.Assert(mmap[:4].SecureUnmap(), IsNil)
+	data, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(string(data[:6]), Equals, "\x00\x00\x00\x0045")
+}
+
+func (s *S) TestSyncContext(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mmap[0] = 'x'
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Assert(mmap.SyncContext(ctx, MS_SYNC), IsNil)
+	buf := make([]byte, 1)
+	_, err = s.file.ReadAt(buf, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "x")
+
+	cancel()
+	c.Assert(mmap.SyncContext(ctx, MS_SYNC), Equals, context.Canceled)
+}
+
+func (s *S) TestHugeRange(c *C) {
+	if uint64(maxInt) < 3<<30 {
+		c.Skip("address space too small")
+	}
+	// The mapping is never touched, so reserving it costs no memory.
+	mmap, err := MapAnonymous(3<<30+int64(os.Getpagesize()), PROT_NONE, MAP_PRIVATE|MAP_NORESERVE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap.Protect(PROT_READ), IsNil)
+	c.Assert(mmap.Advise(MADV_DONTNEED), IsNil)
+	c.Assert(mmap.Sync(MS_ASYNC), IsNil)
+	resident, err := mmap.IsResident()
+	c.Assert(err, IsNil)
+	c.Assert(int64(len(resident)), Equals, 3<<30/int64(os.Getpagesize())+1)
+	c.Assert(resident[len(resident)-1], Equals, false)
+
+	_, err = MapRegion(s.file.Fd(), 0, -2, PROT_READ, MAP_SHARED)
+	c.Assert(err, Equals, ErrSize)
+}
+
+func (s *S) TestMapMode(c *C) {
+	mmap, err := MapMode(s.file.Fd(), ReadWrite)
+	c.Assert(err, IsNil)
+	mmap[0] = 'X'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	mmap, err = MapRegionMode(s.file.Fd(), 0, 4, CopyOnWrite)
+	c.Assert(err, IsNil)
+	c.Assert(len(mmap), Equals, 4)
+	mmap[1] = 'Y'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	fileData, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(fileData, DeepEquals, []byte("X123456789ABCDEF"))
+}
+
+func (s *S) TestMapWith(c *C) {
+	mmap, err := MapWith(s.file.Fd(), MapOptions{})
+	c.Assert(err, IsNil)
+	c.Assert([]byte(mmap), DeepEquals, testData)
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	c.Assert(s.file.Truncate(int64(2*os.Getpagesize())), IsNil)
+	applied := false
+	mmap, err = MapWith(s.file.Fd(), MapOptions{
+		Mode:     ReadWrite,
+		Offset:   int64(os.Getpagesize()),
+		Length:   4,
+		Populate: true,
+		Options: []MapOption{func(mmap MMap) error {
+			applied = true
+			return nil
+		}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(applied, Equals, true)
+	c.Assert(len(mmap), Equals, 4)
+	mmap[0] = 'X'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+	buf := make([]byte, 1)
+	_, err = s.file.ReadAt(buf, int64(os.Getpagesize()))
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "X")
+
+	mmap, err = MapWith(s.file.Fd(), MapOptions{Prot: PROT_READ | PROT_WRITE, Flags: MAP_PRIVATE, Length: 4})
+	c.Assert(err, IsNil)
+	mmap[0] = 'Y'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+	_, err = s.file.ReadAt(buf, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "0")
+}
+
+func (s *S) TestIndexFrom(c *C) {
+	// Put a separator across the boundary of the first two windows.
+	c.Assert(s.file.Truncate(2*scanWindow+16), IsNil)
+	_, err := s.file.WriteAt([]byte("needle"), scanWindow-3)
+	c.Assert(err, IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	c.Assert(mmap.IndexByteFrom(0, 'A'), Equals, 10)
+	c.Assert(mmap.IndexByteFrom(11, 'n'), Equals, scanWindow-3)
+	c.Assert(mmap.IndexByteFrom(scanWindow, 'A'), Equals, -1)
+	c.Assert(mmap.IndexFrom(0, []byte("needle")), Equals, scanWindow-3)
+	c.Assert(mmap.IndexFrom(scanWindow-2, []byte("needle")), Equals, -1)
+	c.Assert(mmap.IndexFrom(3, []byte("345")), Equals, 3)
+	c.Assert(mmap.IndexFrom(7, nil), Equals, 7)
+	c.Assert(mmap.IndexFrom(len(mmap), []byte("x")), Equals, -1)
+}
+
+func (s *S) TestHashInto(c *C) {
+	c.Assert(s.file.Truncate(scanWindow+10), IsNil)
+	_, err := s.file.WriteAt([]byte("tail"), scanWindow+3)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	for _, evict := range []bool{false, true} {
+		h := crc32.NewIEEE()
+		c.Assert(mmap.HashInto(h, 3, len(mmap)-3, evict), IsNil)
+		c.Assert(h.Sum32(), Equals, crc32.ChecksumIEEE(data[3:]))
+	}
+	c.Assert(mmap.HashInto(crc32.NewIEEE(), 1, len(mmap), false), Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestFirstDiff(c *C) {
+	c.Assert(s.file.Truncate(int64(3*os.Getpagesize())), IsNil)
+	a, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer a.UnsafeUnmap()
+	b, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer b.UnsafeUnmap()
+
+	c.Assert(a.Equal(b), Equals, true)
+	c.Assert(a.FirstDiff(b), Equals, -1)
+	c.Assert(a.FirstDiff(a), Equals, -1)
+	b[2*os.Getpagesize()+13] = 'x'
+	c.Assert(a.Equal(b), Equals, false)
+	c.Assert(a.FirstDiff(b), Equals, 2*os.Getpagesize()+13)
+	c.Assert(a[1:].FirstDiff(b[1:]), Equals, 2*os.Getpagesize()+12)
+	c.Assert(a[:5].FirstDiff(b[:7]), Equals, 5)
+	c.Assert(a[:5].Equal(b[:7]), Equals, false)
+}
+
+func (s *S) TestProfiler(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(4*pageSize), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	p := NewProfiler(mmap, 2*pageSize, 0)
+	c.Assert(p.Sample(), IsNil)
+	mmap[0] = 1
+	mmap[3*pageSize] = 1
+	c.Assert(p.Sample(), IsNil)
+	c.Assert(p.Report(), DeepEquals, []RegionHeat{
+		{Offset: 0, Length: 2 * pageSize, Resident: 0.25},
+		{Offset: 2 * pageSize, Length: 2 * pageSize, Resident: 0.25},
+	})
+	p.Reset()
+	c.Assert(p.Report()[0].Resident, Equals, 0.0)
+	c.Assert(p.Stop(), IsNil)
+
+	p = NewProfiler(mmap[pageSize+1:3*pageSize], 0, time.Millisecond)
+	for p.Report()[0].Resident == 0 {
+		time.Sleep(time.Millisecond)
+		mmap[pageSize+1] = 1
+	}
+	c.Assert(p.Stop(), IsNil)
+	report := p.Report()
+	c.Assert(report, HasLen, 2)
+	c.Assert(report[0].Offset, Equals, 0)
+	c.Assert(report[0].Length, Equals, pageSize-1)
+	c.Assert(report[1].Resident, Equals, 0.0)
+}
+
+func (s *S) TestMapDevice(c *C) {
+	_, err := MapDevice(s.file.Fd(), 0, 0, PROT_READ)
+	c.Assert(err, Equals, ErrSize)
+	_, err = MapDevice(s.file.Fd(), 1, 1, PROT_READ)
+	c.Assert(err, Equals, ErrUnaligned)
+	_, err = MapDevice(s.file.Fd(), 0, int64(len(testData)+1), PROT_READ)
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	mmap, err := MapDevicePath("/dev/zero", 0, 4096, PROT_READ|PROT_WRITE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap, HasLen, 4096)
+	c.Assert(mmap[100], Equals, byte(0))
+}
+
+func (s *S) TestMapLow(c *C) {
+	_, err := MapLow(0, PROT_READ, MAP_PRIVATE, 1<<31)
+	c.Assert(err, Equals, ErrSize)
+
+	mmap, err := MapLow(1<<16, PROT_READ|PROT_WRITE, MAP_PRIVATE, 1<<31)
+	if err == syscall.ENOMEM {
+		c.Skip("no free range in the first 2 GB")
+	}
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap, HasLen, 1<<16)
+	c.Assert(uint64(mmap.addr())+1<<16 <= 1<<31, Equals, true)
+	mmap[0] = 1
+}
+
+func (s *S) TestMapStack(c *C) {
+	stack, err := MapStack(1, true)
+	c.Assert(err, IsNil)
+	pageSize := os.Getpagesize()
+	c.Assert(stack.Bytes(), HasLen, pageSize)
+	c.Assert(stack.Top()-stack.Bottom(), Equals, uintptr(pageSize))
+	c.Assert(stack.Top()%uintptr(pageSize), Equals, uintptr(0))
+	stack.Bytes()[pageSize-1] = 1
+	c.Assert(stack.Close(), IsNil)
+	c.Assert(stack.Close(), Equals, ErrClosed)
+}
+
+func (s *S) TestMapTagged(c *C) {
+	mmap, err := MapTagged(int64(os.Getpagesize()))
+	if err == ErrUnsupported {
+		c.Skip("memory tagging not supported")
+	}
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	_, err = mmap.SetTag(1, TagGranule, 3)
+	c.Assert(err, Equals, ErrUnaligned)
+
+	buf, err := mmap.SetTag(TagGranule, 2*TagGranule, 3)
+	c.Assert(err, IsNil)
+	c.Assert(buf, HasLen, 2*TagGranule)
+	tag, err := mmap.TagAt(TagGranule + 1)
+	c.Assert(err, IsNil)
+	c.Assert(tag, Equals, uint8(3))
+	tag, err = mmap.TagAt(0)
+	c.Assert(err, IsNil)
+	c.Assert(tag, Equals, uint8(0))
+	c.Assert(WithTagChecks(func() {
+		copy(buf, "tagged")
+	}), IsNil)
+	c.Assert(string(mmap[TagGranule:TagGranule+6]), Equals, "tagged")
+}
+
+func (s *S) TestAlign(c *C) {
+	pageSize := int64(os.Getpagesize())
+	c.Assert(PageAlignDown(pageSize+1), Equals, pageSize)
+	c.Assert(PageAlignUp(pageSize+1), Equals, 2*pageSize)
+	c.Assert(PageAlignUp(pageSize), Equals, pageSize)
+	c.Assert(AlignUp(1, 2<<20), Equals, int64(2<<20))
+	start, length := AlignedRange(pageSize-1, 2, pageSize)
+	c.Assert(start, Equals, int64(0))
+	c.Assert(length, Equals, 2*pageSize)
+	c.Assert(func() { AlignDown(1, 3) }, PanicMatches, "gommap: alignment must be a power of two")
+
+	mmap, err := MapAnonymous(2*pageSize, PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	aligned := AlignedSlice(mmap[pageSize-1:pageSize+1], int(pageSize))
+	c.Assert(aligned.addr(), Equals, mmap.addr())
+	c.Assert(len(aligned), Equals, len(mmap))
+	c.Assert(aligned.Advise(MADV_WILLNEED), IsNil)
+}
+
+func (s *S) TestSplit(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(5*pageSize+1), PROT_READ, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	views := mmap.Split(3)
+	c.Assert(views, HasLen, 3)
+	c.Assert(views[0].Offset(), Equals, 0)
+	c.Assert(views[0].Len(), Equals, 2*pageSize)
+	c.Assert(views[1].Offset(), Equals, 2*pageSize)
+	c.Assert(views[2].Offset(), Equals, 4*pageSize)
+	c.Assert(views[2].Len(), Equals, pageSize+1)
+
+	views = mmap.SplitBySize(1)
+	c.Assert(views, HasLen, 6)
+	c.Assert(views[5].Len(), Equals, 1)
+	c.Assert(mmap[:1].Split(4), HasLen, 1)
+	c.Assert(MMap{}.Split(4), HasLen, 0)
+
+	// Views of a root that doesn't start on a page boundary still end on
+	// page boundaries.
+	views = mmap[100:].Split(3)
+	c.Assert(views, HasLen, 3)
+	c.Assert(views[0].Len(), Equals, 2*pageSize-100)
+	c.Assert(views[1].Offset(), Equals, 2*pageSize-100)
+	c.Assert(views[2].Offset()+views[2].Len(), Equals, 5*pageSize+1-100)
+}
+
+func (s *S) TestViewUnalignedRoot(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*pageSize)), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	view := mmap[100:].View(pageSize, 10)
+	copy(view.Bytes(), "view")
+	c.Assert(view.Sync(MS_SYNC), IsNil)
+	c.Assert(view.Advise(MADV_WILLNEED), IsNil)
+	c.Assert(view.Lock(), IsNil)
+	c.Assert(view.Unlock(), IsNil)
+
+	fileData, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(string(fileData[pageSize+100:pageSize+104]), Equals, "view")
+}
+
+func (s *S) TestSyncParallel(c *C) {
+	size := 3*syncChunkSize/2 + 1
+	c.Assert(s.file.Truncate(int64(size)), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mmap[0] = 'x'
+	mmap[size-1] = 'y'
+	c.Assert(mmap.SyncParallel(MS_SYNC, 4), IsNil)
+	buf := make([]byte, 1)
+	_, err = s.file.ReadAt(buf, int64(size-1))
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "y")
+	_, err = s.file.ReadAt(buf, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "x")
+}
+
+func (s *S) TestPrefetcher(c *C) {
+	c.Assert(s.file.Truncate(3*prefetchStep), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	p := NewPrefetcher(0, true, mmap.View(0, prefetchStep+1), mmap.View(2*prefetchStep, 10))
+	<-p.Done()
+	c.Assert(p.Fetched(), Equals, int64(prefetchStep+11))
+	p.Stop()
+
+	// One step per second: the first step is fetched right away, then the
+	// prefetcher waits.
+	p = NewPrefetcher(prefetchStep, false, mmap.View(0, len(mmap)))
+	p.Pause()
+	time.Sleep(10 * time.Millisecond)
+	fetched := p.Fetched()
+	c.Assert(fetched <= prefetchStep, Equals, true)
+	p.Resume()
+	p.Stop()
+	c.Assert(p.Fetched() < int64(len(mmap)), Equals, true)
+}
+
+func (s *S) TestAllocAligned(c *C) {
+	for _, align := range []int{512, os.Getpagesize(), 1 << 20} {
+		buf, err := AllocAligned(4096+1, align)
+		c.Assert(err, IsNil)
+		c.Assert(buf, HasLen, 4096+1)
+		c.Assert(buf.addr()%uintptr(align), Equals, uintptr(0))
+		buf[len(buf)-1] = 1
+		c.Assert(ReleaseAligned(buf), IsNil)
+	}
+	_, err := AllocAligned(0, 512)
+	c.Assert(err, Equals, ErrSize)
+}
+
+func (s *S) TestSharedHeap(c *C) {
+	type node struct {
+		Value uint64
+		Next  Ref[node]
+	}
+	c.Assert(s.file.Truncate(4096), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	heap, err := NewSharedHeap(mmap, []int{16})
+	c.Assert(err, IsNil)
+
+	var head Ref[node]
+	for i := uint64(1); i <= 3; i++ {
+		r, err := AllocRef[node](heap)
+		c.Assert(err, IsNil)
+		n, err := r.Resolve(heap.Base())
+		c.Assert(err, IsNil)
+		n.Value, n.Next = i, head
+		head = r
+	}
+
+	// Another mapping of the file, at another address, follows the same
+	// references.
+	other, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer other.UnsafeUnmap()
+	heap2, err := OpenSharedHeap(other)
+	c.Assert(err, IsNil)
+	var values []uint64
+	for r := head; !r.IsNil(); {
+		n, err := r.Resolve(heap2.Base())
+		c.Assert(err, IsNil)
+		values = append(values, n.Value)
+		r = n.Next
+	}
+	c.Assert(values, DeepEquals, []uint64{3, 2, 1})
+
+	c.Assert(FreeRef(heap2, head), IsNil)
+	r, err := AllocRef[node](heap)
+	c.Assert(err, IsNil)
+	c.Assert(r, Equals, head)
+	_, err = Ref[node](0).Resolve(mmap)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestStats(c *C) {
+	c.Assert(s.file.Truncate(int64(StatsRegionSize(2))), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	stats, err := NewStats(mmap)
+	c.Assert(err, IsNil)
+
+	requests, err := stats.Counter("requests")
+	c.Assert(err, IsNil)
+	inflight, err := stats.Gauge("inflight")
+	c.Assert(err, IsNil)
+	requests.Add(41)
+	requests.Inc()
+	inflight.Add(1)
+	inflight.Add(-3)
+
+	again, err := stats.Counter("requests")
+	c.Assert(err, IsNil)
+	c.Assert(again.Load(), Equals, uint64(42))
+	_, err = stats.Gauge("requests")
+	c.Assert(err, Equals, ErrStatKind)
+	_, err = stats.Counter("errors")
+	c.Assert(err, Equals, ErrFull)
+
+	// A reader maps the region read-only and lists what was published.
+	ro, err := Map(s.file.Fd(), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer ro.UnsafeUnmap()
+	reader, err := OpenStats(ro)
+	c.Assert(err, IsNil)
+	snap := reader.Snapshot()
+	c.Assert(snap, DeepEquals, []Stat{
+		{Name: "requests", Kind: StatCounter, Value: 42},
+		{Name: "inflight", Kind: StatGauge, Value: uint64(1<<64 - 2)},
+	})
+	c.Assert(snap[1].Int(), Equals, int64(-2))
+}
+
+func (s *S) TestEvictor(c *C) {
+	pageSize := os.Getpagesize()
+	mmap, err := MapAnonymous(int64(4*pageSize), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := 0; i < 4; i++ {
+		mmap[i*pageSize] = byte(i + 1)
+	}
+	e, err := NewEvictor(mmap, EvictionPolicy{RegionSize: pageSize, IdleAfter: 50 * time.Millisecond, Interval: time.Hour})
+	c.Assert(err, IsNil)
+	defer e.Stop()
+
+	// The pages mapped in since the evictor started count as accesses.
+	n, err := e.Scan()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	time.Sleep(60 * time.Millisecond)
+	e.Touch(10, 1)
+	n, err = e.Scan()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(e.Evicted(), Equals, int64(3*pageSize))
+
+	// The contents of a shared mapping survive eviction, and reading them
+	// back counts as an access.
+	c.Assert(mmap[pageSize], Equals, byte(2))
+	n, err = e.Scan()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	_, err = NewEvictor(mmap, EvictionPolicy{})
+	c.Assert(err, Equals, ErrSize)
+}
+
+func (s *S) TestMemoryBudget(c *C) {
+	mmap, err := MapAnonymous(int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	mem, err := ReadCgroupMemory()
+	if err == ErrUnsupported || err == nil && mem.Limit == 0 {
+		// Without a limit, every request fits.
+		c.Assert(MemoryBudget{}.Prefault(mmap), IsNil)
+		return
+	}
+	c.Assert(err, IsNil)
+	c.Assert(mem.Usage > 0, Equals, true)
+
+	c.Assert(MemoryBudget{}.Check(mmap), Equals, ErrBudget)
+	var needed int64
+	b := MemoryBudget{OnExceed: func(n, available int64) { needed = n }}
+	c.Assert(b.Prefault(mmap), IsNil)
+	c.Assert(needed, Equals, int64(len(mmap)))
+	c.Assert(MemoryBudget{Fraction: 1}.Check(mmap[:0]), IsNil)
+}
+
+func (s *S) TestMemlockError(c *C) {
+	err := memlockError(syscall.ENOMEM, 1<<20)
+	merr, ok := err.(*MemlockError)
+	c.Assert(ok, Equals, true)
+	c.Assert(errors.Is(err, syscall.ENOMEM), Equals, true)
+	c.Assert(merr.Requested, Equals, int64(1<<20))
+	var rlim syscall.Rlimit
+	c.Assert(syscall.Getrlimit(rlimitMemlock, &rlim), IsNil)
+	c.Assert(merr.Limit, Equals, rlimitValue(uint64(rlim.Cur)))
+	c.Assert(err.Error(), Matches, "gommap: cannot lock 1048576 bytes: .*")
+	c.Assert(memlockError(syscall.EINVAL, 1), Equals, syscall.EINVAL)
+
+	mmap, err := MapAnonymous(int64(os.Getpagesize()), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap.LockRaisingLimit(), IsNil)
+	c.Assert(mmap.Unlock(), IsNil)
+}
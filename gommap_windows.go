@@ -15,9 +15,7 @@ package gommap
 import (
 	"errors"
 	"os"
-	"reflect"
 	"syscall"
-	"unsafe"
 )
 
 // The MMap type represents a memory mapped file or device. The slice offers
@@ -65,14 +63,13 @@ func MapRegion(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags)
 	}
 	/* on windows, use PROT_COPY to do the same thing as linux MAP_PRIVATE flag do */
 	if flags == MAP_PRIVATE {
-		prot = PROT_COPY
+		prot = PROT_COPY | prot&PROT_EXEC
 	}
 	// return mmap(length, uintptr(prot), uintptr(flags), fd, offset)
 
 	/*******************************/
 	m, e := mmap(length, uintptr(prot), uintptr(flags), fd, offset)
-	dh := (*reflect.SliceHeader)(unsafe.Pointer(&m))
-	mmapAttrs[dh.Data] = &struct {
+	mmapAttrs[MMap(m).addr()] = &struct {
 		fd     uintptr
 		offset int64
 		length int64
@@ -82,17 +79,12 @@ func MapRegion(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags)
 	return m, e
 }
 
-func (mmap *MMap) header() *reflect.SliceHeader {
-	return (*reflect.SliceHeader)(unsafe.Pointer(mmap))
-}
-
 // UnsafeUnmap deletes the memory mapped region defined by the mmap slice. This
 // will also flush any remaining changes, if necessary.  Using mmap or any
 // other slices based on it after this method has been called will crash the
 // application.
 func (mmap MMap) UnsafeUnmap() error {
-	dh := mmap.header()
-	return unmap(dh.Data, uintptr(dh.Len))
+	return unmap(mmap.addr(), uintptr(len(mmap)))
 }
 
 // Sync flushes changes made to the region determined by the mmap slice
@@ -101,17 +93,19 @@ func (mmap MMap) UnsafeUnmap() error {
 // flags parameter specifies whether flushing should be done synchronously
 // (before the method returns) with MS_SYNC, or asynchronously (flushing is just
 // scheduled) with MS_ASYNC.
+//
+// FlushViewOfFile only hands the changes to the file system cache, so unless
+// MS_ASYNC is given, the file's buffers are flushed with FlushFileBuffers as
+// well, giving the same crash-safety guarantees as msync does elsewhere.
 func (mmap MMap) Sync(flags SyncFlags) error {
-	dh := mmap.header()
-	return flush(dh.Data, uintptr(dh.Len))
+	return flush(mmap.addr(), uintptr(len(mmap)), flags&MS_ASYNC == 0)
 }
 
 // // Advise advises the kernel about how to handle the mapped memory
 // // region in terms of input/output paging within the memory region
 // // defined by the mmap slice.
 // func (mmap MMap) Advise(advice AdviseFlags) error {
-// 	// rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-// 	// _, _, err := syscall.Syscall(syscall.SYS_MADVISE, uintptr(rh.Data), uintptr(rh.Len), uintptr(advice))
+// 	// _, _, err := syscall.Syscall(syscall.SYS_MADVISE, mmap.addr(), uintptr(len(mmap)), uintptr(advice))
 // 	// if err != 0 {
 // 	// 	return err
 // 	// }
@@ -122,11 +116,11 @@ func (mmap MMap) Sync(flags SyncFlags) error {
 // defined by the mmap slice.
 // We use unmap & map again to implement this on windows. So can only change the protect flags on the whole
 func (mmap *MMap) Protect(prot ProtFlags) (err error) {
-	dh := mmap.header()
+	addr := mmap.addr()
 	var m MMap
 	if err = mmap.UnsafeUnmap(); err == nil {
-		fd, offset, length, flags := mmapAttrs[dh.Data].fd, mmapAttrs[dh.Data].offset, mmapAttrs[dh.Data].length, mmapAttrs[dh.Data].flags
-		mmapAttrs[dh.Data] = nil
+		fd, offset, length, flags := mmapAttrs[addr].fd, mmapAttrs[addr].offset, mmapAttrs[addr].length, mmapAttrs[addr].flags
+		mmapAttrs[addr] = nil
 		if m, err = MapRegion(fd, offset, length, prot, flags); err == nil {
 			mmap = &m
 		}
@@ -137,15 +131,13 @@ func (mmap *MMap) Protect(prot ProtFlags) (err error) {
 // Lock locks the mapped region defined by the mmap slice,
 // preventing it from being swapped out.
 func (mmap MMap) Lock() error {
-	dh := mmap.header()
-	return lock(dh.Data, uintptr(dh.Len))
+	return lock(mmap.addr(), uintptr(len(mmap)))
 }
 
 // Unlock unlocks the mapped region defined by the mmap slice,
 // allowing it to swap out again.
 func (mmap MMap) Unlock() error {
-	dh := mmap.header()
-	return unlock(dh.Data, uintptr(dh.Len))
+	return unlock(mmap.addr(), uintptr(len(mmap)))
 }
 
 // // IsResident returns a slice of booleans informing whether the respective
@@ -153,9 +145,7 @@ func (mmap MMap) Unlock() error {
 // func (mmap MMap) IsResident() ([]bool, error) {
 // 	pageSize := os.Getpagesize()
 // 	result := make([]bool, (len(mmap)+pageSize-1)/pageSize)
-// 	rh := *(*reflect.SliceHeader)(unsafe.Pointer(&mmap))
-// 	resulth := *(*reflect.SliceHeader)(unsafe.Pointer(&result))
-// 	_, _, err := syscall.Syscall(syscall.SYS_MINCORE, uintptr(rh.Data), uintptr(rh.Len), uintptr(resulth.Data))
+// 	_, _, err := syscall.Syscall(syscall.SYS_MINCORE, mmap.addr(), uintptr(len(mmap)), uintptr(unsafe.Pointer(&result[0])))
 // 	for i := range result {
 // 		*(*uint8)(unsafe.Pointer(&result[i])) &= 1
 // 	}
@@ -138,3 +138,44 @@ func (s *S) TestSync(c *C) {
 	err = mmap.Sync(MS_SYNC)
 	c.Assert(err, IsNil)
 }
+
+func (s *S) TestSyncFlags(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	mmap[0] = 'X'
+	c.Assert(mmap.Sync(MS_ASYNC), IsNil)
+	c.Assert(mmap.Sync(MS_SYNC), IsNil)
+	fileData, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(fileData, DeepEquals, []byte("X123456789ABCDEF"))
+}
+
+func (s *S) TestMapMode(c *C) {
+	mmap, err := MapMode(s.file.Fd(), ReadWrite)
+	c.Assert(err, IsNil)
+	mmap[0] = 'X'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	mmap, err = MapRegionMode(s.file.Fd(), 0, 4, CopyOnWrite)
+	c.Assert(err, IsNil)
+	c.Assert(len(mmap), Equals, 4)
+	mmap[1] = 'Y'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+
+	fileData, err := ioutil.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(fileData, DeepEquals, []byte("X123456789ABCDEF"))
+}
+
+func (s *S) TestDescribe(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	regions, err := mmap.Describe()
+	c.Assert(err, IsNil)
+	c.Assert(regions, HasLen, 1)
+	c.Assert(regions[0].Len, Equals, int64(len(mmap)))
+	c.Assert(regions[0].Perms, Equals, "rw-s")
+}
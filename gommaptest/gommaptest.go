@@ -0,0 +1,175 @@
+//go:build !windows
+// +build !windows
+
+// Package gommaptest helps testing the crash recovery of storage engines
+// built on gommap.
+//
+// A File stands for a mapped file whose writes reach the disk in any order
+// until a Sync barrier, as the kernel writes back dirty pages whenever it
+// likes. The engine under test writes to the mapping returned by MMap, and
+// calls Sync where it would call MMap.Sync. The File keeps the image of the
+// file as of the last barriers, and produces crashed images holding that
+// image plus any subset of the writes made since, page by page or in
+// smaller units to model torn sectors, so recovery code can be run over
+// every outcome of a crash, deterministically.
+package gommaptest
+
+import (
+	"math/rand"
+	"os"
+
+	"github.com/tysonmote/gommap"
+)
+
+// The File type simulates a mapped file that can crash.
+type File struct {
+	mmap     gommap.MMap
+	durable  []byte
+	unit     int
+	barriers int
+}
+
+// NewFile returns a zeroed file of size bytes, whose writes reach the disk
+// in units of unit bytes, or of pages if unit is 0.
+func NewFile(size, unit int) (*File, error) {
+	if unit == 0 {
+		unit = os.Getpagesize()
+	}
+	if size <= 0 || unit < 0 {
+		return nil, gommap.ErrSize
+	}
+	mmap, err := gommap.MapAnonymous(int64(size), gommap.PROT_READ|gommap.PROT_WRITE, gommap.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	return &File{mmap: mmap, durable: make([]byte, size), unit: unit}, nil
+}
+
+// NewFileFrom returns a file holding image, as if it had been synced, such
+// as a crashed image to check that recovering from it and crashing again is
+// handled.
+func NewFileFrom(image []byte, unit int) (*File, error) {
+	f, err := NewFile(len(image), unit)
+	if err != nil {
+		return nil, err
+	}
+	copy(f.mmap, image)
+	copy(f.durable, image)
+	return f, nil
+}
+
+// MMap returns the mapping the engine under test writes to.
+func (f *File) MMap() gommap.MMap {
+	return f.mmap
+}
+
+// Sync is a barrier making the writes to the n bytes at off durable, as
+// MMap.Sync on that range would. Whole units are made durable, as the
+// kernel writes back whole pages.
+func (f *File) Sync(off, n int) error {
+	if off < 0 || n < 0 || off > len(f.mmap)-n {
+		return gommap.ErrOutOfBounds
+	}
+	if n > 0 {
+		start := off / f.unit * f.unit
+		end := f.unitEnd((off + n - 1) / f.unit)
+		copy(f.durable[start:end], f.mmap[start:end])
+	}
+	f.barriers++
+	return nil
+}
+
+// SyncAll is a barrier making every write durable.
+func (f *File) SyncAll() error {
+	return f.Sync(0, len(f.mmap))
+}
+
+// Barriers returns the number of Sync barriers so far.
+func (f *File) Barriers() int {
+	return f.barriers
+}
+
+func (f *File) unitEnd(u int) int {
+	end := (u + 1) * f.unit
+	if end > len(f.mmap) {
+		end = len(f.mmap)
+	}
+	return end
+}
+
+// Dirty returns the units written to since they were last made durable, in
+// increasing order. Writes that put back the durable contents don't count.
+func (f *File) Dirty() []int {
+	var dirty []int
+	for u := 0; u*f.unit < len(f.mmap); u++ {
+		start, end := u*f.unit, f.unitEnd(u)
+		if string(f.mmap[start:end]) != string(f.durable[start:end]) {
+			dirty = append(dirty, u)
+		}
+	}
+	return dirty
+}
+
+// Durable returns the image of the file as of the last barriers, which is
+// what a crash leaves when none of the writes made since reached the disk.
+func (f *File) Durable() []byte {
+	return append([]byte(nil), f.durable...)
+}
+
+// CrashWith returns the image a crash leaves when only the given dirty
+// units reached the disk. Units that aren't dirty make no difference.
+func (f *File) CrashWith(units []int) []byte {
+	image := f.Durable()
+	for _, u := range units {
+		if u >= 0 && u*f.unit < len(f.mmap) {
+			copy(image[u*f.unit:f.unitEnd(u)], f.mmap[u*f.unit:])
+		}
+	}
+	return image
+}
+
+// Crash returns the image a crash leaves when each dirty unit reached the
+// disk with a probability of one half, drawn from r.
+func (f *File) Crash(r *rand.Rand) []byte {
+	var units []int
+	for _, u := range f.Dirty() {
+		if r.Intn(2) == 1 {
+			units = append(units, u)
+		}
+	}
+	return f.CrashWith(units)
+}
+
+// EachCrash calls fn with crashed images, and stops at the first error it
+// returns. If there are at most max subsets of the dirty units, fn is called
+// with each of them, from none to all of the units; otherwise it is called
+// with max random ones, which are the same from one run to the next.
+func (f *File) EachCrash(max int, fn func(image []byte) error) error {
+	dirty := f.Dirty()
+	if len(dirty) < 31 && 1<<len(dirty) <= max {
+		for set := 0; set < 1<<len(dirty); set++ {
+			var units []int
+			for i, u := range dirty {
+				if set&(1<<i) != 0 {
+					units = append(units, u)
+				}
+			}
+			if err := fn(f.CrashWith(units)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < max; i++ {
+		if err := fn(f.Crash(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close unmaps the file.
+func (f *File) Close() error {
+	return f.mmap.UnsafeUnmap()
+}
@@ -0,0 +1,95 @@
+//go:build !windows
+// +build !windows
+
+package gommaptest
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestAll(t *testing.T) {
+	TestingT(t)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (s *S) TestCrash(c *C) {
+	f, err := NewFile(2048, 512)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	mmap := f.MMap()
+	copy(mmap[10:], "synced")
+	c.Assert(f.Sync(10, 6), IsNil)
+	c.Assert(f.Dirty(), HasLen, 0)
+
+	copy(mmap[600:], "one")
+	copy(mmap[1800:], "two")
+	c.Assert(f.Dirty(), DeepEquals, []int{1, 3})
+	c.Assert(string(f.Durable()[10:16]), Equals, "synced")
+	c.Assert(f.Durable()[600], Equals, byte(0))
+	image := f.CrashWith([]int{3})
+	c.Assert(string(image[1800:1803]), Equals, "two")
+	c.Assert(image[600], Equals, byte(0))
+
+	seen := map[string]bool{}
+	c.Assert(f.EachCrash(4, func(image []byte) error {
+		seen[string(image[600:603])+string(image[1800:1803])] = true
+		return nil
+	}), IsNil)
+	c.Assert(seen, HasLen, 4)
+	n := 0
+	c.Assert(f.EachCrash(3, func([]byte) error { n++; return nil }), IsNil)
+	c.Assert(n, Equals, 3)
+
+	c.Assert(f.SyncAll(), IsNil)
+	c.Assert(f.Barriers(), Equals, 2)
+	c.Assert(f.Dirty(), HasLen, 0)
+	c.Assert(f.Sync(2000, 100), NotNil)
+	_, err = NewFile(0, 0)
+	c.Assert(err, NotNil)
+}
+
+// A commit record pointing at data written and synced before it: every
+// crash leaves either the old or the new record, and never a record
+// pointing at missing data.
+func (s *S) TestRecovery(c *C) {
+	f, err := NewFile(4096, 512)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	mmap := f.MMap()
+	commit := func(off int, data string) {
+		copy(mmap[off:], data)
+		c.Assert(f.Sync(off, len(data)), IsNil)
+		binary.LittleEndian.PutUint32(mmap[0:], uint32(off))
+		binary.LittleEndian.PutUint32(mmap[4:], uint32(len(data)))
+	}
+	commit(1024, "first")
+	c.Assert(f.SyncAll(), IsNil)
+	commit(2048, "second")
+
+	recovered := map[string]bool{}
+	err = f.EachCrash(16, func(image []byte) error {
+		off := binary.LittleEndian.Uint32(image[0:])
+		n := binary.LittleEndian.Uint32(image[4:])
+		data := string(image[off : off+n])
+		if data != "first" && data != "second" {
+			return errors.New("torn commit: " + data)
+		}
+		recovered[data] = true
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(recovered, HasLen, 2)
+
+	g, err := NewFileFrom(f.CrashWith(nil), 0)
+	c.Assert(err, IsNil)
+	defer g.Close()
+	c.Assert(string(g.MMap()[1024:1029]), Equals, "first")
+	c.Assert(g.Dirty(), HasLen, 0)
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "time"
+
+// Refresh extends the mapping to cover the whole backing file if it grew
+// since the mapping was created or last refreshed, and tells whether it did.
+// The mapping may move in memory when it grows, so slices previously
+// returned by Bytes or MMap must not be used afterwards; readers running
+// concurrently with Refresh should go through SafeReadAt or Acquire instead.
+// While memory obtained with Acquire is in use, the file is mapped anew
+// rather than resized, and the old mapping kept until it's released.
+func (m *Mapping) Refresh() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(); err != nil {
+		return false, err
+	}
+	if m.sums != nil {
+		return false, ErrUnsupported
+	}
+	size, regular, err := fileSize(m.fd)
+	if err != nil || !regular {
+		return false, err
+	}
+	length := size - m.offset
+	if length <= int64(len(m.mmap)) || int64(int(length)) != length {
+		return false, nil
+	}
+	if m.ref.inUse() {
+		mmap, err := MapRegion(m.fd, m.offset, length, m.prot, m.flags)
+		if err != nil {
+			return false, err
+		}
+		return true, m.replace(mmap)
+	}
+	mmap, err := resizeMapping(m.mmap, m.fd, m.offset, int(length), m.prot, m.flags)
+	if err != nil {
+		return false, err
+	}
+	m.mmap, m.ref.h = mmap, handleOf(mmap)
+	return true, nil
+}
+
+// WithFollowGrowth returns an option calling Refresh on the mapping every
+// interval until it is closed, so that a mapping of a file being appended to,
+// such as a log, keeps up with its growth.
+func WithFollowGrowth(interval time.Duration) MappingOption {
+	return every(interval, func(m *Mapping) { m.Refresh() })
+}
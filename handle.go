@@ -0,0 +1,34 @@
+package gommap
+
+import "unsafe"
+
+// The mapHandle type holds the base address and length of a mapping as the
+// system returned them. The types owning a whole mapping keep one, so that
+// the system calls unmapping it work on what was mapped rather than on
+// whatever slice of it is at hand. The base is kept as a pointer, so the
+// memory is never rebuilt from an integer address.
+type mapHandle struct {
+	base   *byte
+	length int
+}
+
+// handleOf returns the handle of the mapping mmap covers entirely.
+func handleOf(mmap MMap) mapHandle {
+	if len(mmap) == 0 {
+		return mapHandle{}
+	}
+	return mapHandle{base: unsafe.SliceData(mmap), length: len(mmap)}
+}
+
+// bytes returns the mapped memory.
+func (h mapHandle) bytes() MMap {
+	if h.length == 0 {
+		return MMap{}
+	}
+	return unsafe.Slice(h.base, h.length)
+}
+
+// unmap deletes the mapping.
+func (h mapHandle) unmap() error {
+	return h.bytes().UnsafeUnmap()
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "hash"
+
+// HashInto feeds the n bytes of mmap starting at off to h, window by window,
+// telling the kernel the mapping is read sequentially and asking it to read
+// each window in while the previous one is hashed.
+//
+// If evict is set, the pages already hashed are released with MADV_DONTNEED
+// as the cursor moves past them, so hashing a file much larger than memory
+// doesn't push everything else out of it. Their contents are read back from
+// the file when next accessed; changes made to a private mapping would be
+// lost, so evict must only be used on shared or unmodified mappings.
+func (mmap MMap) HashInto(h hash.Hash, off, n int, evict bool) error {
+	if n < 0 || !mmap.inBounds(off, n) {
+		return ErrOutOfBounds
+	}
+	data := mmap[off : off+n]
+	// Advice is only a hint, so failures are not worth reporting.
+	pageAligned(data).Advise(MADV_SEQUENTIAL)
+	for pos := 0; pos < len(data); pos += scanWindow {
+		end := pos + scanWindow
+		if end > len(data) {
+			end = len(data)
+		}
+		if next := end + scanWindow; end < len(data) {
+			if next > len(data) {
+				next = len(data)
+			}
+			pageAligned(data[end:next]).Advise(MADV_WILLNEED)
+		}
+		h.Write(data[pos:end])
+		if evict {
+			pageAligned(data[pos:end]).Advise(MADV_DONTNEED)
+		}
+	}
+	return nil
+}
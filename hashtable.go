@@ -0,0 +1,264 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+)
+
+// Layout of a hash table file: a header followed by the buckets. Each bucket
+// is a state byte followed by the key and the value.
+const (
+	htMagic      = 0x48544d47 // "GMTH"
+	htMagicOff   = 0
+	htKeyOff     = 4
+	htValueOff   = 8
+	htBucketsOff = 16
+	htCountOff   = 24
+	htUsedOff    = 32
+	htHeaderSize = 64
+	htMinBuckets = 8
+	htEmpty      = 0
+	htFull       = 1
+	htDeleted    = 2
+	htMaxLoadNum = 3
+	htMaxLoadDen = 4
+)
+
+// The HashTable type is a persistent hash table with fixed-size keys and
+// values, stored in a mapped file. It uses open addressing with linear
+// probing over a power-of-two number of buckets, so a service can reopen it
+// after a restart and serve lookups straight from the mapping instead of
+// rebuilding its index.
+//
+// The table doubles its number of buckets when more than three quarters of
+// them are in use; on Linux the mapping is grown in place with mremap. A
+// HashTable is not safe for concurrent use.
+type HashTable struct {
+	file      *os.File
+	mmap      MMap
+	keySize   int
+	valueSize int
+	stride    int
+	mask      uint64
+}
+
+// OpenHashTable opens the hash table file at path, creating it with the
+// given key and value sizes if it doesn't exist. An existing file must have
+// been created with the same sizes.
+func OpenHashTable(path string, keySize, valueSize int) (*HashTable, error) {
+	if keySize <= 0 || valueSize < 0 {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	stride := 1 + keySize + valueSize
+	if fi.Size() == 0 {
+		if err := file.Truncate(int64(htHeaderSize + htMinBuckets*stride)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	mmap, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	t := &HashTable{file: file, mmap: mmap, keySize: keySize, valueSize: valueSize, stride: stride}
+	if fi.Size() == 0 {
+		binary.LittleEndian.PutUint32(mmap[htKeyOff:], uint32(keySize))
+		binary.LittleEndian.PutUint32(mmap[htValueOff:], uint32(valueSize))
+		t.setHeader(htBucketsOff, htMinBuckets)
+		binary.LittleEndian.PutUint32(mmap[htMagicOff:], htMagic)
+	}
+	if err := t.check(); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	t.mask = t.header(htBucketsOff) - 1
+	return t, nil
+}
+
+// check validates the header of the table against its configuration.
+func (t *HashTable) check() error {
+	if len(t.mmap) < htHeaderSize ||
+		binary.LittleEndian.Uint32(t.mmap[htMagicOff:]) != htMagic ||
+		binary.LittleEndian.Uint32(t.mmap[htKeyOff:]) != uint32(t.keySize) ||
+		binary.LittleEndian.Uint32(t.mmap[htValueOff:]) != uint32(t.valueSize) {
+		return ErrCorrupt
+	}
+	n := t.header(htBucketsOff)
+	if n == 0 || n&(n-1) != 0 || uint64(len(t.mmap)-htHeaderSize)/uint64(t.stride) < n {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+func (t *HashTable) header(off int) uint64 {
+	return binary.LittleEndian.Uint64(t.mmap[off:])
+}
+
+func (t *HashTable) setHeader(off int, v uint64) {
+	binary.LittleEndian.PutUint64(t.mmap[off:], v)
+}
+
+// bucket returns the memory of bucket i.
+func (t *HashTable) bucket(i uint64) []byte {
+	off := htHeaderSize + int(i)*t.stride
+	return t.mmap[off : off+t.stride : off+t.stride]
+}
+
+// find returns the bucket holding key, or the bucket where it should be
+// inserted and false if it's not in the table.
+func (t *HashTable) find(key []byte) (uint64, bool) {
+	insert := int64(-1)
+	for i, n := fnv64a(key)&t.mask, uint64(0); n <= t.mask; i, n = (i+1)&t.mask, n+1 {
+		b := t.bucket(i)
+		switch b[0] {
+		case htEmpty:
+			if insert < 0 {
+				insert = int64(i)
+			}
+			return uint64(insert), false
+		case htDeleted:
+			if insert < 0 {
+				insert = int64(i)
+			}
+		case htFull:
+			if bytes.Equal(b[1:1+t.keySize], key) {
+				return i, true
+			}
+		}
+	}
+	return uint64(insert), false
+}
+
+// Len returns the number of keys in the table.
+func (t *HashTable) Len() int {
+	return int(t.header(htCountOff))
+}
+
+// Get returns the value stored for key. The returned slice points into the
+// mapping and is only valid until the table is modified or closed.
+func (t *HashTable) Get(key []byte) ([]byte, bool) {
+	if len(key) != t.keySize {
+		return nil, false
+	}
+	i, ok := t.find(key)
+	if !ok {
+		return nil, false
+	}
+	return t.bucket(i)[1+t.keySize:], true
+}
+
+// Put stores value for key, replacing any previous value. The key and value
+// must have the sizes the table was created with.
+func (t *HashTable) Put(key, value []byte) error {
+	if len(key) != t.keySize || len(value) != t.valueSize {
+		return ErrSize
+	}
+	i, ok := t.find(key)
+	if !ok {
+		used := t.header(htUsedOff)
+		if t.bucket(i)[0] == htEmpty && (used+1)*htMaxLoadDen > (t.mask+1)*htMaxLoadNum {
+			if err := t.grow(); err != nil {
+				return err
+			}
+			return t.Put(key, value)
+		}
+		if t.bucket(i)[0] == htEmpty {
+			t.setHeader(htUsedOff, used+1)
+		}
+		t.setHeader(htCountOff, t.header(htCountOff)+1)
+	}
+	b := t.bucket(i)
+	copy(b[1:], key)
+	copy(b[1+t.keySize:], value)
+	b[0] = htFull
+	return nil
+}
+
+// Delete removes key from the table and reports whether it was present.
+func (t *HashTable) Delete(key []byte) bool {
+	if len(key) != t.keySize {
+		return false
+	}
+	i, ok := t.find(key)
+	if !ok {
+		return false
+	}
+	t.bucket(i)[0] = htDeleted
+	t.setHeader(htCountOff, t.header(htCountOff)-1)
+	return true
+}
+
+// grow doubles the number of buckets and rehashes every key, dropping
+// tombstones along the way.
+func (t *HashTable) grow() error {
+	old := make([]byte, int(t.mask+1)*t.stride)
+	copy(old, t.mmap[htHeaderSize:])
+	buckets := (t.mask + 1) * 2
+	size := htHeaderSize + int(buckets)*t.stride
+	if err := t.file.Truncate(int64(size)); err != nil {
+		return err
+	}
+	mmap, err := resizeMapping(t.mmap, t.file.Fd(), 0, size, PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	t.mmap = mmap
+	t.mask = buckets - 1
+	for i := range t.mmap[htHeaderSize:] {
+		t.mmap[htHeaderSize+i] = 0
+	}
+	t.setHeader(htBucketsOff, buckets)
+	t.setHeader(htCountOff, 0)
+	t.setHeader(htUsedOff, 0)
+	for ; len(old) > 0; old = old[t.stride:] {
+		if old[0] == htFull {
+			if err := t.Put(old[1:1+t.keySize], old[1+t.keySize:t.stride]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Range calls fn for each key and value in the table, in no particular
+// order, until fn returns false. The table must not be modified during the
+// iteration.
+func (t *HashTable) Range(fn func(key, value []byte) bool) {
+	for i := uint64(0); i <= t.mask; i++ {
+		b := t.bucket(i)
+		if b[0] == htFull && !fn(b[1:1+t.keySize], b[1+t.keySize:]) {
+			return
+		}
+	}
+}
+
+// Sync flushes the table to the file. See MMap.Sync.
+func (t *HashTable) Sync(flags SyncFlags) error {
+	return t.mmap.Sync(flags)
+}
+
+// Close flushes and unmaps the table, and closes its file.
+func (t *HashTable) Close() error {
+	if err := t.mmap.Sync(MS_SYNC); err != nil {
+		return err
+	}
+	if err := t.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return t.file.Close()
+}
@@ -0,0 +1,137 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// Layout of each copy of a header written by Header: a sequence number and
+// the CRC-32C of the sequence number and payload, followed by the payload.
+// Copies are rounded up to whole disk sectors, so a torn sector write damages
+// one copy at most.
+const (
+	headerSeqOff  = 0
+	headerSumOff  = 8
+	headerDataOff = 16
+	headerSector  = 512
+)
+
+// The Header type keeps a small block of metadata, such as the root of an
+// on-disk structure, within a mapping. Two copies are stored side by side,
+// each with a sequence number and a checksum, and Write always overwrites
+// the older one, so a crash halfway through flushing a new version leaves
+// the previous one intact, and OpenHeader picks up whichever copy is the
+// newest valid one.
+type Header struct {
+	mmap    MMap
+	payload int
+	slot    int
+	seq     uint64
+}
+
+func headerSlotSize(payload int) int {
+	return (headerDataOff + payload + headerSector - 1) &^ (headerSector - 1)
+}
+
+// HeaderSize returns the number of bytes needed to store a header holding
+// payload bytes of metadata.
+func HeaderSize(payload int) int {
+	return 2 * headerSlotSize(payload)
+}
+
+// NewHeader initializes a header holding p at the start of mmap, which must
+// be at least HeaderSize(len(p)) bytes long, and flushes it to the device.
+// Opening it later on requires the same payload size.
+func NewHeader(mmap MMap, p []byte) (*Header, error) {
+	if len(p) == 0 || len(mmap) < HeaderSize(len(p)) {
+		return nil, ErrSize
+	}
+	h := &Header{mmap: mmap, payload: len(p), slot: 1}
+	for i := range mmap[:HeaderSize(len(p))] {
+		mmap[i] = 0
+	}
+	if err := h.Write(p); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// OpenHeader attaches to a header holding payload bytes of metadata that
+// was previously initialized with NewHeader at the start of mmap. It returns
+// ErrCorrupt if neither copy is valid.
+func OpenHeader(mmap MMap, payload int) (*Header, error) {
+	if payload <= 0 || len(mmap) < HeaderSize(payload) {
+		return nil, ErrSize
+	}
+	h := &Header{mmap: mmap, payload: payload, slot: -1}
+	for i := 0; i < 2; i++ {
+		seq, ok := h.check(i)
+		if ok && (h.slot < 0 || seq > h.seq) {
+			h.slot, h.seq = i, seq
+		}
+	}
+	if h.slot < 0 {
+		return nil, ErrCorrupt
+	}
+	return h, nil
+}
+
+func (h *Header) copyAt(i int) MMap {
+	size := headerSlotSize(h.payload)
+	return h.mmap[i*size : i*size+headerDataOff+h.payload]
+}
+
+func headerChecksum(b MMap) uint32 {
+	return crc32.Update(crc32.Checksum(b[headerSeqOff:headerSumOff], castagnoli), castagnoli, b[headerDataOff:])
+}
+
+// check returns the sequence number of copy i, and whether it is valid.
+func (h *Header) check(i int) (uint64, bool) {
+	b := h.copyAt(i)
+	seq := binary.LittleEndian.Uint64(b[headerSeqOff:])
+	return seq, seq != 0 && headerChecksum(b) == binary.LittleEndian.Uint32(b[headerSumOff:])
+}
+
+// Bytes returns the current metadata. The slice points into the mapping and
+// is only valid until the next Write.
+func (h *Header) Bytes() []byte {
+	b := h.copyAt(h.slot)
+	return b[headerDataOff:len(b):len(b)]
+}
+
+// Seq returns the sequence number of the current metadata, incremented by
+// each Write.
+func (h *Header) Seq() uint64 {
+	return h.seq
+}
+
+// Write replaces the metadata with p, which must have the size given when
+// the header was created. The older copy is overwritten and flushed with
+// MS_SYNC before becoming the current one, so once Write returns the new
+// metadata is durable.
+//
+// If the flush fails, the overwritten copy gets its old contents back and
+// the previous metadata stays current. The kernel may still have written
+// the new copy back meanwhile, though, so after a crash OpenHeader may find
+// the metadata of a failed Write.
+func (h *Header) Write(p []byte) error {
+	if len(p) != h.payload {
+		return ErrSize
+	}
+	next := 1 - h.slot
+	b := h.copyAt(next)
+	old := append([]byte(nil), b...)
+	copy(b[headerDataOff:], p)
+	binary.LittleEndian.PutUint64(b[headerSeqOff:], h.seq+1)
+	binary.LittleEndian.PutUint32(b[headerSumOff:], headerChecksum(b))
+	size := headerSlotSize(h.payload)
+	if err := h.mmap.View(next*size, len(b)).Sync(MS_SYNC); err != nil {
+		copy(b, old)
+		return err
+	}
+	h.slot, h.seq = next, h.seq+1
+	return nil
+}
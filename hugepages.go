@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// The PageBacking type tells which kind of pages back a mapping.
+type PageBacking int
+
+const (
+	// NormalPages are the base pages of the system.
+	NormalPages PageBacking = iota
+	// TransparentHugePages are huge pages the kernel assembles on its
+	// own, which may back only part of the mapping at any time.
+	TransparentHugePages
+	// HugeTLBPages are huge pages reserved by the system administrator,
+	// backing the whole mapping.
+	HugeTLBPages
+)
+
+func (b PageBacking) String() string {
+	switch b {
+	case TransparentHugePages:
+		return "transparent huge pages"
+	case HugeTLBPages:
+		return "hugetlb pages"
+	}
+	return "normal pages"
+}
+
+// The HugePageSupport type describes the huge pages available on the
+// system, as reported by ProbeHugePages.
+type HugePageSupport struct {
+	// Pools lists the pools of huge pages reserved by the system
+	// administrator, one per huge page size.
+	Pools []HugePagePool
+	// Transparent is the transparent huge page mode: "always",
+	// "madvise", "never", or empty if the kernel doesn't have them.
+	Transparent string
+}
+
+// The HugePagePool type describes a pool of reserved huge pages.
+type HugePagePool struct {
+	// PageSize is the size of the pages in bytes.
+	PageSize int64
+	Total    int
+	Free     int
+}
@@ -0,0 +1,96 @@
+package gommap
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ProbeHugePages reports the huge pages available on the system, read from
+// /sys/kernel/mm.
+func ProbeHugePages() (HugePageSupport, error) {
+	var s HugePageSupport
+	if b, err := os.ReadFile("/sys/kernel/mm/transparent_hugepage/enabled"); err == nil {
+		// The mode in use is the one in brackets.
+		if _, rest, ok := strings.Cut(string(b), "["); ok {
+			s.Transparent, _, _ = strings.Cut(rest, "]")
+		}
+	}
+	dirs, err := filepath.Glob("/sys/kernel/mm/hugepages/hugepages-*kB")
+	if err != nil {
+		return s, err
+	}
+	for _, dir := range dirs {
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(dir), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		pool := HugePagePool{PageSize: kb << 10}
+		pool.Total, _ = readSysInt(filepath.Join(dir, "nr_hugepages"))
+		pool.Free, _ = readSysInt(filepath.Join(dir, "free_hugepages"))
+		s.Pools = append(s.Pools, pool)
+	}
+	return s, nil
+}
+
+func readSysInt(name string) (int, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// hugeFallback reports whether a MAP_HUGETLB mapping failing with err is
+// worth retrying with normal pages, which is the case when no huge page is
+// available or the file can't be mapped with them.
+func hugeFallback(err error) bool {
+	return err == syscall.ENOMEM || err == syscall.EINVAL || err == syscall.EPERM
+}
+
+// adviseHuge asks for transparent huge pages to back mmap where possible.
+func adviseHuge(mmap MMap) {
+	// Advice is only a hint, so failures are not worth reporting.
+	mmap.Advise(MADV_HUGEPAGE)
+}
+
+// Backing reports which kind of pages currently back mmap, as listed by
+// /proc/self/smaps. If any part of mmap is backed by transparent huge
+// pages, TransparentHugePages is returned.
+func (mmap MMap) Backing() (PageBacking, error) {
+	backing := NormalPages
+	err := overlappingVMAs("/proc/self/smaps", mmap, func(v *vma) {
+		for _, f := range v.flags {
+			if f == "ht" {
+				backing = HugeTLBPages
+				return
+			}
+		}
+		if backing == NormalPages && (v.fields["AnonHugePages"] > 0 || v.fields["FilePmdMapped"] > 0 || v.fields["ShmemPmdMapped"] > 0) {
+			backing = TransparentHugePages
+		}
+	})
+	return backing, err
+}
+
+// PageSize returns the size of the pages mmap is made of, which is the
+// granularity of the system calls acting on it: the size of the huge pages
+// for a mapping backed by hugetlbfs or MAP_HUGETLB, and the base page size
+// otherwise, including for transparent huge pages, which can be split.
+func (mmap MMap) PageSize() (int, error) {
+	size := int64(0)
+	err := overlappingVMAs("/proc/self/smaps", mmap, func(v *vma) {
+		if n := v.fields["KernelPageSize"]; n > size {
+			size = n
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 {
+		return os.Getpagesize(), nil
+	}
+	return int(size), nil
+}
@@ -0,0 +1,29 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import "os"
+
+// ProbeHugePages reports that no huge pages are available.
+func ProbeHugePages() (HugePageSupport, error) {
+	return HugePageSupport{}, nil
+}
+
+func hugeFallback(err error) bool {
+	return true
+}
+
+func adviseHuge(mmap MMap) {}
+
+// Backing reports that mmap is backed by normal pages, the only ones
+// supported.
+func (mmap MMap) Backing() (PageBacking, error) {
+	return NormalPages, nil
+}
+
+// PageSize returns the size of the pages mmap is made of, which is always
+// the base page size of the system, such as 16 KB on Apple Silicon.
+func (mmap MMap) PageSize() (int, error) {
+	return os.Getpagesize(), nil
+}
@@ -0,0 +1,133 @@
+package gommap
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// hugetlbfsMagic is the file system type reported by statfs for hugetlbfs.
+const hugetlbfsMagic = 0x958458f6
+
+// HugeTLBFSMounts returns the mount points of hugetlbfs file systems, on
+// which files backed by reserved huge pages can be created with
+// OpenHugeFile.
+func HugeTLBFSMounts() ([]string, error) {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 3 && fields[2] == "hugetlbfs" {
+			mounts = append(mounts, fields[1])
+		}
+	}
+	return mounts, sc.Err()
+}
+
+// The HugeFile type is a file on a hugetlbfs mount, mapped whole. Such files
+// live in huge pages taken from the pool reserved by the system
+// administrator and never reach a disk, so they differ from regular files in
+// a few ways: their size is always a multiple of the huge page size, they
+// can't be written to other than through a mapping, flushing them is
+// meaningless, and their pages are never swapped out.
+type HugeFile struct {
+	file     *os.File
+	mmap     MMap
+	pageSize int64
+}
+
+// OpenHugeFile opens or creates the file at path, which must be on a
+// hugetlbfs mount, grows it to at least size bytes rounded up to the huge
+// page size of the mount, and maps it. It returns ErrUnsupported if path
+// isn't on hugetlbfs, and ENOMEM when the pool doesn't have enough free
+// pages.
+func OpenHugeFile(path string, size int64) (*HugeFile, error) {
+	if size <= 0 {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	h, err := openHugeFile(file, size)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func openHugeFile(file *os.File, size int64) (*HugeFile, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(file.Fd()), &st); err != nil {
+		return nil, err
+	}
+	if uint32(st.Type) != hugetlbfsMagic {
+		return nil, ErrUnsupported
+	}
+	pageSize := int64(st.Bsize)
+	size = (size + pageSize - 1) / pageSize * pageSize
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < size {
+		if err := file.Truncate(size); err != nil {
+			return nil, err
+		}
+	} else {
+		size = fi.Size()
+	}
+	mmap, err := MapRegion(file.Fd(), 0, size, PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &HugeFile{file: file, mmap: mmap, pageSize: pageSize}, nil
+}
+
+// Bytes returns the mapped contents of the file.
+func (h *HugeFile) Bytes() []byte {
+	return h.mmap
+}
+
+// MMap returns the mapped contents of the file as an MMap. Its Sync method
+// does nothing useful, and IsResident reports the pages that were touched,
+// which stay in memory as long as the file exists.
+func (h *HugeFile) MMap() MMap {
+	return h.mmap
+}
+
+// PageSize returns the size of the huge pages backing the file.
+func (h *HugeFile) PageSize() int64 {
+	return h.pageSize
+}
+
+// Len returns the size of the file, which is a multiple of its page size.
+func (h *HugeFile) Len() int {
+	return len(h.mmap)
+}
+
+// Allocated returns the number of bytes of the pool used by the file, which
+// only counts the huge pages touched so far.
+func (h *HugeFile) Allocated() (int64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(h.file.Fd()), &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks) * 512, nil
+}
+
+// Close unmaps and closes the file. Its pages stay allocated to it until the
+// file is removed.
+func (h *HugeFile) Close() error {
+	if err := h.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return h.file.Close()
+}
@@ -0,0 +1,166 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Sizes of the fields of an index entry: a 32-bit offset relative to the
+// start of the segment, the 64-bit position of the record in the store, and
+// the CRC-32C of both.
+const (
+	indexOffWidth = 4
+	indexPosWidth = 8
+	indexSumOff   = indexOffWidth + indexPosWidth
+	indexEntWidth = indexSumOff + 4
+)
+
+// The Index type is a file of fixed-width entries mapping record offsets to
+// their positions in a store, accessed through a mapping. Entries are stored
+// big-endian, as (offset uint32, position uint64, checksum uint32) triples.
+// The file is grown to its maximum size while the index is open and trimmed
+// back to the entries it holds on Close.
+//
+// After a crash the file is left at its full size. OpenIndex then keeps the
+// entries up to the first one whose checksum doesn't match, or whose offset
+// and position aren't both larger than those of the entry before it. The
+// checksum of a zeroed entry never matches, so the zero-filled tail is not
+// taken for entries, even in a file the crash left without any.
+type Index struct {
+	file *os.File
+	mmap MMap
+	size int64
+}
+
+// OpenIndex opens or creates the index file at path, mapping it with room
+// for maxBytes bytes of entries.
+func OpenIndex(path string, maxBytes int64) (*Index, error) {
+	maxBytes -= maxBytes % indexEntWidth
+	if maxBytes <= 0 || int64(int(maxBytes)) != maxBytes {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size := fi.Size() - fi.Size()%indexEntWidth
+	if size > maxBytes {
+		file.Close()
+		return nil, ErrSize
+	}
+	if err := file.Truncate(maxBytes); err != nil {
+		file.Close()
+		return nil, err
+	}
+	mmap, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	idx := &Index{file: file, mmap: mmap, size: size}
+	idx.size = idx.lastValid()
+	return idx, nil
+}
+
+// lastValid returns the end of the last valid entry in the index.
+func (idx *Index) lastValid() int64 {
+	if idx.size == 0 {
+		return 0
+	}
+	if !idx.valid(0) {
+		return 0
+	}
+	prevOff, prevPos := idx.entry(0)
+	for pos := int64(indexEntWidth); pos < idx.size; pos += indexEntWidth {
+		off, p := idx.entry(pos)
+		if !idx.valid(pos) || off <= prevOff || p <= prevPos {
+			return pos
+		}
+		prevOff, prevPos = off, p
+	}
+	return idx.size
+}
+
+// valid reports whether the checksum of the entry at byte position pos
+// matches. The CRC-32C of zeroes isn't zero, so a zeroed entry is invalid.
+func (idx *Index) valid(pos int64) bool {
+	e := idx.mmap[pos : pos+indexEntWidth]
+	return crc32.Checksum(e[:indexSumOff], castagnoli) == binary.BigEndian.Uint32(e[indexSumOff:])
+}
+
+// entry decodes the entry at byte position pos.
+func (idx *Index) entry(pos int64) (uint32, uint64) {
+	off := binary.BigEndian.Uint32(idx.mmap[pos:])
+	p := binary.BigEndian.Uint64(idx.mmap[pos+indexOffWidth:])
+	return off, p
+}
+
+// Read returns the entry at index i, or the last entry if i is -1. It
+// returns io.EOF if there's no such entry.
+func (idx *Index) Read(i int64) (off uint32, pos uint64, err error) {
+	if idx.size == 0 {
+		return 0, 0, io.EOF
+	}
+	if i == -1 {
+		i = idx.size/indexEntWidth - 1
+	}
+	if i < 0 || (i+1)*indexEntWidth > idx.size {
+		return 0, 0, io.EOF
+	}
+	off, pos = idx.entry(i * indexEntWidth)
+	return off, pos, nil
+}
+
+// Write appends the entry (off, pos) to the index. It returns io.EOF if the
+// index is full.
+func (idx *Index) Write(off uint32, pos uint64) error {
+	if idx.size+indexEntWidth > int64(len(idx.mmap)) {
+		return io.EOF
+	}
+	e := idx.mmap[idx.size : idx.size+indexEntWidth]
+	binary.BigEndian.PutUint32(e, off)
+	binary.BigEndian.PutUint64(e[indexOffWidth:], pos)
+	binary.BigEndian.PutUint32(e[indexSumOff:], crc32.Checksum(e[:indexSumOff], castagnoli))
+	idx.size += indexEntWidth
+	return nil
+}
+
+// Len returns the number of entries in the index.
+func (idx *Index) Len() int64 {
+	return idx.size / indexEntWidth
+}
+
+// Name returns the path of the index file.
+func (idx *Index) Name() string {
+	return idx.file.Name()
+}
+
+// Sync flushes the index to the file.
+func (idx *Index) Sync() error {
+	return idx.mmap.Sync(MS_SYNC)
+}
+
+// Close flushes and unmaps the index, and trims the file to the size of the
+// entries it holds.
+func (idx *Index) Close() error {
+	if err := idx.Sync(); err != nil {
+		return err
+	}
+	if err := idx.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	if err := idx.file.Truncate(idx.size); err != nil {
+		return err
+	}
+	return idx.file.Close()
+}
@@ -0,0 +1,34 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package gommap
+
+import "syscall"
+
+type InheritFlags uint
+
+const (
+	INHERIT_SHARE InheritFlags = 0x0
+	INHERIT_COPY  InheritFlags = 0x1
+	INHERIT_NONE  InheritFlags = 0x2
+)
+
+// Inherit sets what child processes created by fork get of the mapping,
+// using minherit: INHERIT_SHARE shares the pages with the child, INHERIT_COPY
+// gives it a copy-on-write copy, and INHERIT_NONE leaves the range unmapped
+// in the child. Without it, the default depends on how the mapping was
+// created.
+//
+// Inherit is only available on darwin and FreeBSD. On Linux, use Advise
+// with MADV_DONTFORK or MADV_WIPEONFORK instead.
+func (mmap MMap) Inherit(mode InheritFlags) error {
+	if len(mmap) == 0 {
+		return nil
+	}
+	aligned := pageAligned(mmap)
+	_, _, err := syscall.Syscall(syscall.SYS_MINHERIT, aligned.addr(), uintptr(len(aligned)), uintptr(mode))
+	if err != 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "bytes"
+
+// The Iterator type walks a mapping token by token without copying. Its
+// usage mirrors bufio.Scanner:
+//
+//	it := mmap.Lines()
+//	for it.Next() {
+//		process(it.Bytes())
+//	}
+//
+// Creating an iterator advises the kernel that the mapping will be read
+// sequentially. If a readahead window is set, the iterator additionally asks
+// the kernel to page in that many bytes ahead of the cursor as it advances.
+type Iterator struct {
+	mmap      MMap
+	split     func(data []byte) (advance, length int)
+	pos       int
+	start     int
+	token     []byte
+	readahead int
+	advised   int
+}
+
+func newIterator(mmap MMap, split func(data []byte) (int, int)) *Iterator {
+	// Advice is only a hint, so failures are not worth reporting.
+	pageAligned(mmap).Advise(MADV_SEQUENTIAL)
+	return &Iterator{mmap: mmap, split: split}
+}
+
+// Lines returns an iterator over the lines of mmap. The end-of-line marker,
+// either "\n" or "\r\n", is not included in the returned tokens. The last line
+// is returned even if it isn't terminated.
+func (mmap MMap) Lines() *Iterator {
+	return newIterator(mmap, func(data []byte) (int, int) {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return len(data), len(data)
+		}
+		if i > 0 && data[i-1] == '\r' {
+			return i + 1, i - 1
+		}
+		return i + 1, i
+	})
+}
+
+// Chunks returns an iterator over consecutive chunks of mmap of size bytes
+// each. The last chunk may be shorter. It panics if size is not positive.
+func (mmap MMap) Chunks(size int) *Iterator {
+	if size <= 0 {
+		panic("gommap: chunk size must be positive")
+	}
+	return newIterator(mmap, func(data []byte) (int, int) {
+		if len(data) < size {
+			return len(data), len(data)
+		}
+		return size, size
+	})
+}
+
+// SetReadahead makes the iterator advise the kernel with MADV_WILLNEED for
+// the n bytes following the cursor each time it moves past the previously
+// advised range. Zero disables readahead, which is the default.
+func (it *Iterator) SetReadahead(n int) {
+	it.readahead = n
+	it.advised = it.pos
+}
+
+// Next advances the iterator to the next token, which will then be available
+// through Bytes. It returns false when the end of the mapping is reached.
+func (it *Iterator) Next() bool {
+	if it.pos >= len(it.mmap) {
+		it.token = nil
+		return false
+	}
+	advance, length := it.split(it.mmap[it.pos:])
+	it.start = it.pos
+	it.token = it.mmap[it.pos : it.pos+length : it.pos+length]
+	it.pos += advance
+	if it.readahead > 0 && it.pos >= it.advised {
+		end := it.pos + it.readahead
+		if end > len(it.mmap) {
+			end = len(it.mmap)
+		}
+		pageAligned(it.mmap[it.pos:end]).Advise(MADV_WILLNEED)
+		it.advised = end
+	}
+	return true
+}
+
+// Bytes returns the current token. The returned slice points straight into
+// the mapping and is only valid while the mapping is.
+func (it *Iterator) Bytes() []byte {
+	return it.token
+}
+
+// Offset returns the position of the current token within the mapping.
+func (it *Iterator) Offset() int {
+	return it.start
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+)
+
+// lowSearchStart is the first address tried by MapLow, above the range
+// mmap_min_addr usually forbids.
+const lowSearchStart = 1 << 20
+
+// MapLow creates a new anonymous mapping of length bytes lying entirely below
+// the address limit, as needed by JIT compilers and trampoline generators
+// whose code must be reachable by 32-bit relative branches. The provided
+// flags must include one of MAP_SHARED or MAP_PRIVATE.
+//
+// On Linux for x86-64, a limit of 2 GB or more is met with MAP_32BIT.
+// Elsewhere, or when that fails, addresses from 1 MB up to the limit are
+// tried as hints in turn, which may take many system calls when the low
+// address space is crowded. It returns ENOMEM when no free range is found.
+func MapLow(length int64, prot ProtFlags, flags MapFlags, limit uintptr) (MMap, error) {
+	if length <= 0 || uint64(length) > uint64(limit) {
+		return nil, ErrSize
+	}
+	below := func(mmap MMap) bool {
+		return mmap.addr()+uintptr(len(mmap)) <= limit
+	}
+	if map32Bit != 0 && uint64(limit) >= 1<<31 {
+		mmap, err := MapAnonymous(length, prot, flags|map32Bit)
+		if err == nil {
+			if below(mmap) {
+				return mmap, nil
+			}
+			mmap.UnsafeUnmap()
+		}
+	}
+	pageSize := uintptr(os.Getpagesize())
+	step := (uintptr(length) + pageSize - 1) &^ (pageSize - 1)
+	for hint := uintptr(lowSearchStart); step <= limit && hint <= limit-step && hint >= lowSearchStart; hint += step {
+		mmap, err := MapAt(hint, ^uintptr(0), 0, length, prot, flags|MAP_ANON)
+		if err != nil {
+			return nil, err
+		}
+		if below(mmap) {
+			return mmap, nil
+		}
+		mmap.UnsafeUnmap()
+	}
+	return nil, syscall.ENOMEM
+}
@@ -0,0 +1,9 @@
+//go:build !windows && (!linux || !amd64)
+// +build !windows
+// +build !linux !amd64
+
+package gommap
+
+// map32Bit is the flag asking the kernel for an address in the first 2 GB,
+// which only exists on Linux for x86-64.
+const map32Bit MapFlags = 0
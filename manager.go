@@ -0,0 +1,121 @@
+package gommap
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The MappingInfo type describes a mapping created through a Manager.
+type MappingInfo struct {
+	Addr    uintptr
+	Len     int
+	Fd      uintptr
+	Offset  int64
+	Prot    ProtFlags
+	Flags   MapFlags
+	Created time.Time
+}
+
+// The Manager type keeps track of every mapping created through it, so they
+// can be listed for debugging and released all at once on shutdown. Mappings
+// are removed from the manager when unmapped with Manager.Unmap.
+//
+// A Manager is safe for concurrent use. The zero value is an empty manager
+// ready to use.
+type Manager struct {
+	mu   sync.Mutex
+	maps map[uintptr]*managed
+}
+
+type managed struct {
+	mmap MMap
+	info MappingInfo
+}
+
+// Map is like the package-level Map, and registers the new mapping with the
+// manager.
+func (m *Manager) Map(fd uintptr, prot ProtFlags, flags MapFlags) (MMap, error) {
+	return m.MapRegion(fd, 0, -1, prot, flags)
+}
+
+// MapRegion is like the package-level MapRegion, and registers the new
+// mapping with the manager.
+func (m *Manager) MapRegion(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (MMap, error) {
+	mmap, err := MapRegion(fd, offset, length, prot, flags)
+	if err != nil {
+		return nil, err
+	}
+	m.Track(mmap, MappingInfo{Fd: fd, Offset: offset, Prot: prot, Flags: flags})
+	return mmap, nil
+}
+
+// Track registers a mapping created by other means with the manager. The
+// address and length in info are filled in from mmap.
+func (m *Manager) Track(mmap MMap, info MappingInfo) {
+	if len(mmap) == 0 {
+		return
+	}
+	info.Addr = mmap.addr()
+	info.Len = len(mmap)
+	if info.Created.IsZero() {
+		info.Created = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.maps == nil {
+		m.maps = make(map[uintptr]*managed)
+	}
+	m.maps[info.Addr] = &managed{mmap: mmap, info: info}
+}
+
+// Unmap unmaps a mapping created through the manager, and stops tracking it.
+// The mapping must be passed whole, as returned when it was created.
+func (m *Manager) Unmap(mmap MMap) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	delete(m.maps, mmap.addr())
+	return nil
+}
+
+// Mappings returns the mappings currently tracked by the manager, sorted by
+// address.
+func (m *Manager) Mappings() []MappingInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	infos := make([]MappingInfo, 0, len(m.maps))
+	for _, mm := range m.maps {
+		infos = append(infos, mm.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Addr < infos[j].Addr })
+	return infos
+}
+
+// Len returns the number of mappings tracked by the manager.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.maps)
+}
+
+// CloseAll unmaps every mapping tracked by the manager. It keeps going when
+// an unmap fails, and returns the first error encountered; mappings that
+// couldn't be unmapped stay tracked.
+func (m *Manager) CloseAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var first error
+	for addr, mm := range m.maps {
+		if err := mm.mmap.UnsafeUnmap(); err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		delete(m.maps, addr)
+	}
+	return first
+}
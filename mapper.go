@@ -0,0 +1,118 @@
+package gommap
+
+import (
+	"sync"
+	"syscall"
+)
+
+// The Region interface is the view of a mapped region needed by code that
+// doesn't care how the mapping is implemented. Code written against Region
+// and Mapper can be tested with MemMapper where mapping real files is not
+// possible or desirable.
+type Region interface {
+	// Bytes returns the contents of the region.
+	Bytes() []byte
+	// Sync flushes changes made to the region back to its file.
+	Sync(flags SyncFlags) error
+	// Advise advises the kernel about how to handle the region.
+	Advise(advice AdviseFlags) error
+	// Close releases the region. The memory returned by Bytes must not be
+	// used afterwards.
+	Close() error
+}
+
+// The Mapper interface creates regions from files. OSMapper creates real
+// memory mappings.
+type Mapper interface {
+	// Map maps length bytes of the file at fd starting at offset. If -1 is
+	// provided as length, the region extends to the end of the file.
+	Map(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (Region, error)
+}
+
+// The MemMapper type is a Mapper that never calls mmap. Files are byte
+// slices registered with SetFile under a made-up descriptor, and regions are
+// plain heap memory: MAP_SHARED regions alias the file contents so writes are
+// visible to every region of the same file, while MAP_PRIVATE regions get a
+// copy. Protection flags are not enforced.
+//
+// A MemMapper is safe for concurrent use, but the regions it returns are not.
+type MemMapper struct {
+	mu    sync.Mutex
+	files map[uintptr][]byte
+}
+
+// NewMemMapper returns an empty MemMapper.
+func NewMemMapper() *MemMapper {
+	return &MemMapper{files: make(map[uintptr][]byte)}
+}
+
+// SetFile sets the contents of the file with descriptor fd. The slice is
+// used as is, so later changes through MAP_SHARED regions are visible in it.
+func (m *MemMapper) SetFile(fd uintptr, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[fd] = data
+}
+
+// File returns the current contents of the file with descriptor fd.
+func (m *MemMapper) File(fd uintptr) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[fd]
+	return data, ok
+}
+
+// Map implements the Mapper interface. It returns ErrOutOfBounds if the
+// region doesn't fit in the file, as mapping past the end of a real file
+// would fault on access.
+func (m *MemMapper) Map(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (Region, error) {
+	m.mu.Lock()
+	data, ok := m.files[fd]
+	m.mu.Unlock()
+	if !ok {
+		return nil, syscall.EBADF
+	}
+	if length == -1 {
+		length = int64(len(data)) - offset
+	}
+	if offset < 0 || length < 0 || offset > int64(len(data)) || length > int64(len(data))-offset {
+		return nil, ErrOutOfBounds
+	}
+	region := data[offset : offset+length : offset+length]
+	if flags&MAP_PRIVATE != 0 {
+		region = append([]byte(nil), region...)
+	}
+	return &memRegion{data: region}, nil
+}
+
+type memRegion struct {
+	data   []byte
+	closed bool
+}
+
+func (r *memRegion) Bytes() []byte {
+	return r.data
+}
+
+func (r *memRegion) Sync(flags SyncFlags) error {
+	if r.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (r *memRegion) Advise(advice AdviseFlags) error {
+	if r.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (r *memRegion) Close() error {
+	if r.closed {
+		return ErrClosed
+	}
+	r.closed = true
+	r.data = nil
+	return nil
+}
@@ -0,0 +1,570 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"syscall"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// exerciseMapper runs the same scenario against any Mapper, using a file
+// holding testData at fd.
+func exerciseMapper(c *C, mapper Mapper, fd uintptr) {
+	shared, err := mapper.Map(fd, 0, 12, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	private, err := mapper.Map(fd, 0, -1, PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	c.Assert(shared.Bytes(), DeepEquals, []byte("0123456789AB"))
+
+	private.Bytes()[6] = 'P'
+	shared.Bytes()[4] = 'S'
+	c.Assert(shared.Sync(MS_SYNC), IsNil)
+	c.Assert(shared.Advise(MADV_NORMAL), IsNil)
+
+	again, err := mapper.Map(fd, 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	c.Assert(string(again.Bytes()), Equals, "0123S56789ABCDEF")
+
+	for _, r := range []Region{shared, private, again} {
+		c.Assert(r.Close(), IsNil)
+	}
+	c.Assert(shared.Close(), Equals, ErrClosed)
+	c.Assert(shared.Sync(MS_SYNC), Equals, ErrClosed)
+}
+
+func (s *S) TestOSMapper(c *C) {
+	exerciseMapper(c, OSMapper{}, s.file.Fd())
+}
+
+func (s *S) TestMemMapper(c *C) {
+	mapper := NewMemMapper()
+	mapper.SetFile(3, append([]byte(nil), testData...))
+	exerciseMapper(c, mapper, 3)
+
+	_, err := mapper.Map(3, 8, 9, PROT_READ, MAP_SHARED)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestMappingStats(c *C) {
+	c.Assert(s.file.Truncate(int64(16*os.Getpagesize())), IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	c.Assert(m.Prefault(), IsNil)
+	stats := m.Stats()
+	// The file was just written so it is in the page cache, and touching it
+	// should take minor faults.
+	c.Assert(stats.MinorFaults > 0, Equals, true)
+	m.MeasureFaults(func() {})
+	c.Assert(m.Stats().MinorFaults >= stats.MinorFaults, Equals, true)
+}
+
+func (s *S) TestGuardFaults(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*pageSize)), IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	var b byte
+	c.Assert(m.Guard(func(mmap MMap) { b = mmap[pageSize+8] }), IsNil)
+	c.Assert(b, Equals, byte(0))
+
+	c.Assert(s.file.Truncate(int64(pageSize)), IsNil)
+	err = m.Guard(func(mmap MMap) { b = mmap[pageSize+8] })
+	fault, ok := err.(*FaultError)
+	c.Assert(ok, Equals, true)
+	c.Assert(fault.Offset, Equals, pageSize+8)
+	c.Assert(fault.Cause, Equals, ErrFileTruncated)
+	c.Assert(errors.Is(err, ErrFileTruncated), Equals, true)
+
+	// Faults in unregistered ranges aren't GuardFaults' to handle.
+	mmap := m.Bytes()
+	func() {
+		defer func() {
+			r := recover()
+			fault, ok := r.(interface{ Addr() uintptr })
+			c.Assert(ok, Equals, true)
+			c.Assert(fault.Addr(), Equals, MMap(mmap).addr()+uintptr(pageSize+8))
+			_, ok = r.(runtime.Error)
+			c.Assert(ok, Equals, true)
+		}()
+		GuardFaults(func() { b = mmap[pageSize+8] })
+	}()
+
+	unregister := RegisterFaultRange(mmap, s.file.Fd(), 0)
+	err = GuardFaults(func() { b = mmap[pageSize+16] })
+	unregister()
+	fault, ok = err.(*FaultError)
+	c.Assert(ok, Equals, true)
+	c.Assert(fault.Offset, Equals, pageSize+16)
+	c.Assert(fault.Cause, Equals, ErrFileTruncated)
+	c.Assert(GuardFaults(func() { b = mmap[0] }), IsNil)
+
+	c.Assert(m.Close(), IsNil)
+	c.Assert(m.Guard(func(MMap) {}), Equals, ErrClosed)
+}
+
+func (s *S) TestSafeReadAt(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*pageSize)), IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	buf := make([]byte, 4)
+	n, err := m.SafeReadAt(buf, 2)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 4)
+	c.Assert(string(buf), Equals, "2345")
+
+	n, err = m.SafeReadAt(buf, int64(2*pageSize-2))
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(n, Equals, 2)
+
+	c.Assert(s.file.Truncate(int64(pageSize)), IsNil)
+	n, err = m.SafeReadAt(buf, int64(pageSize-2))
+	c.Assert(err, Equals, ErrFileTruncated)
+	c.Assert(n, Equals, 2)
+	n, err = m.SafeReadAt(buf, int64(pageSize+8))
+	c.Assert(err, Equals, ErrFileTruncated)
+	c.Assert(n, Equals, 0)
+
+	// Without the size check, the fault itself is caught.
+	n, err = safeCopy(buf, m.Bytes()[pageSize+8:])
+	c.Assert(err, Equals, ErrFileTruncated)
+	c.Assert(n, Equals, 0)
+
+	c.Assert(m.Close(), IsNil)
+	_, err = m.SafeReadAt(buf, 0)
+	c.Assert(err, Equals, ErrClosed)
+}
+
+func (s *S) TestWithFileLock(c *C) {
+	other, err := os.OpenFile(s.file.Name(), os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	defer other.Close()
+
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithFileLock(LockExclusive))
+	c.Assert(err, IsNil)
+	_, err = LockFile(other.Fd(), 0, int64(len(testData)), LockShared|LockNonBlock)
+	c.Assert(err, Equals, ErrLocked)
+	_, err = NewMapping(other.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithFileLock(LockShared|LockNonBlock))
+	c.Assert(err, Equals, ErrLocked)
+
+	c.Assert(m.Close(), IsNil)
+	l, err := LockFile(other.Fd(), 0, int64(len(testData)), LockShared|LockNonBlock)
+	c.Assert(err, IsNil)
+	m, err = NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithFileLock(LockShared|LockNonBlock))
+	c.Assert(err, IsNil)
+	c.Assert(m.Close(), IsNil)
+	c.Assert(l.Unlock(), IsNil)
+}
+
+func (s *S) TestRevalidate(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*pageSize)), IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	c.Assert(m.Revalidate(), IsNil)
+	c.Assert(s.file.Truncate(int64(pageSize)), IsNil)
+	c.Assert(m.Revalidate(), Equals, ErrFileTruncated)
+	c.Assert(m.Bytes(), IsNil)
+	c.Assert(m.Sync(MS_SYNC), Equals, ErrFileTruncated)
+	c.Assert(m.Advise(MADV_NORMAL), Equals, ErrFileTruncated)
+	c.Assert(m.Close(), IsNil)
+	c.Assert(m.Revalidate(), Equals, ErrClosed)
+}
+
+func (s *S) TestWithRevalidate(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*pageSize)), IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithRevalidate(time.Millisecond))
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	c.Assert(s.file.Truncate(int64(pageSize)), IsNil)
+	for i := 0; i < 1000 && m.Bytes() != nil; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(m.Bytes(), IsNil)
+	c.Assert(m.Sync(MS_SYNC), Equals, ErrFileTruncated)
+}
+
+func (s *S) TestRefresh(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	grown, err := m.Refresh()
+	c.Assert(err, IsNil)
+	c.Assert(grown, Equals, false)
+
+	_, err = s.file.WriteAt([]byte("tail"), int64(len(testData)))
+	c.Assert(err, IsNil)
+	grown, err = m.Refresh()
+	c.Assert(err, IsNil)
+	c.Assert(grown, Equals, true)
+	c.Assert(string(m.Bytes()), Equals, string(testData)+"tail")
+}
+
+func (s *S) TestWithFollowGrowth(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithFollowGrowth(time.Millisecond))
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	c.Assert(s.file.Truncate(int64(3*os.Getpagesize())), IsNil)
+	buf := make([]byte, 1)
+	for i := 0; i < 1000; i++ {
+		if _, err = m.SafeReadAt(buf, int64(3*os.Getpagesize()-1)); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(err, IsNil)
+	c.Assert(m.Bytes(), HasLen, 3*os.Getpagesize())
+}
+
+func (s *S) TestWithChecksum(c *C) {
+	c.Assert(AppendChecksum(s.file), IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithChecksum())
+	c.Assert(err, IsNil)
+	n, err := VerifyChecksum(m.MMap())
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, len(testData))
+	c.Assert(m.Close(), IsNil)
+
+	_, err = s.file.WriteAt([]byte("x"), 3)
+	c.Assert(err, IsNil)
+	_, err = NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithChecksum())
+	c.Assert(err, Equals, ErrCorrupt)
+}
+
+func (s *S) TestWithRegionChecksum(c *C) {
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(testData[4:12], crc32.MakeTable(crc32.Castagnoli)))
+	_, err := s.file.WriteAt(sum[:], 0)
+	c.Assert(err, IsNil)
+
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithRegionChecksum(0, 4, 8))
+	c.Assert(err, IsNil)
+	c.Assert(m.Close(), IsNil)
+
+	_, err = NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithRegionChecksum(0, 4, 9))
+	c.Assert(err, Equals, ErrCorrupt)
+	_, err = NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED, WithRegionChecksum(0, 4, 100))
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestSwapTo(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	old, release, err := m.Acquire()
+	c.Assert(err, IsNil)
+	other, err := os.Create(path.Join(c.MkDir(), "compacted"))
+	c.Assert(err, IsNil)
+	defer other.Close()
+	_, err = other.Write([]byte("compacted"))
+	c.Assert(err, IsNil)
+
+	c.Assert(m.SwapTo(other.Fd(), true), IsNil)
+	c.Assert(string(m.Bytes()), Equals, "compacted")
+	// The old mapping stays readable until released.
+	c.Assert(string(old), Equals, string(testData))
+	release()
+
+	cur, release, err := m.Acquire()
+	c.Assert(err, IsNil)
+	c.Assert(m.Close(), IsNil)
+	c.Assert(string(cur), Equals, "compacted")
+	release()
+	_, _, err = m.Acquire()
+	c.Assert(err, Equals, ErrClosed)
+}
+
+func (s *S) TestCopyToFile(c *C) {
+	dir := c.MkDir()
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	c.Assert(m.CopyToFile(path.Join(dir, "shared")), IsNil)
+	data, err := os.ReadFile(path.Join(dir, "shared"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, string(testData))
+
+	p, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	c.Assert(err, IsNil)
+	defer p.Close()
+	p.Bytes()[0] = 'x'
+	c.Assert(p.CopyToFile(path.Join(dir, "private")), IsNil)
+	data, err = os.ReadFile(path.Join(dir, "private"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "x"+string(testData[1:]))
+
+	c.Assert(p.MMap()[2:6].CopyToFile(path.Join(dir, "slice")), IsNil)
+	data, err = os.ReadFile(path.Join(dir, "slice"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "2345")
+
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(2*pageSize)), IsNil)
+	_, err = s.file.WriteAt([]byte("second"), int64(pageSize))
+	c.Assert(err, IsNil)
+	o, err := NewMapping(s.file.Fd(), int64(pageSize), int64(pageSize), PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer o.Close()
+	c.Assert(o.CopyToFile(path.Join(dir, "offset")), IsNil)
+	data, err = os.ReadFile(path.Join(dir, "offset"))
+	c.Assert(err, IsNil)
+	c.Assert(data, HasLen, pageSize)
+	c.Assert(string(data[:6]), Equals, "second")
+}
+
+func (s *S) TestSendTo(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		conn.Close()
+		received <- string(data)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	c.Assert(err, IsNil)
+
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	n, err := m.SendTo(conn, 2, 8)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(8))
+	conn.Close()
+	c.Assert(<-received, Equals, "23456789")
+
+	// Connections without a file descriptor get the mapped bytes written.
+	client, server := net.Pipe()
+	go func() {
+		data, _ := io.ReadAll(server)
+		received <- string(data)
+	}()
+	n, err = m.SendTo(client, 10, 6)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(6))
+	client.Close()
+	c.Assert(<-received, Equals, "ABCDEF")
+
+	_, err = m.SendTo(client, 10, 7)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
+
+func (s *S) TestSyncAsync(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	m.Bytes()[0] = 'x'
+	done := m.SyncAsync(MS_SYNC)
+	c.Assert(m.Close(), IsNil)
+	c.Assert(<-done, IsNil)
+
+	buf := make([]byte, 1)
+	_, err = s.file.ReadAt(buf, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "x")
+	c.Assert(<-m.SyncAsync(MS_SYNC), Equals, ErrClosed)
+}
+
+func (s *S) TestWithProgress(c *C) {
+	size := int64(2*syncChunkSize + os.Getpagesize())
+	c.Assert(s.file.Truncate(size), IsNil)
+	var done []int64
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED, WithProgress(func(n, total int64) {
+		c.Check(total, Equals, size)
+		done = append(done, n)
+	}))
+	c.Assert(err, IsNil)
+	defer m.Close()
+
+	c.Assert(m.Prefault(), IsNil)
+	c.Assert(done, DeepEquals, []int64{syncChunkSize, 2 * syncChunkSize, size})
+	done = nil
+	c.Assert(m.SyncContext(context.Background(), MS_SYNC), IsNil)
+	c.Assert(done, DeepEquals, []int64{syncChunkSize, 2 * syncChunkSize, size})
+}
+
+func (s *S) TestMappingGetPut(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	b, err := m.Get(2, 3)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "234")
+	_, err = m.Get(len(testData)-1, 2)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	_, err = m.Get(1, -1)
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	n, err := m.Put(14, []byte("xy"))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	_, err = m.Put(15, []byte("xy"))
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(string(m.Bytes()), Equals, "0123456789ABCDxy")
+	c.Assert(m.Close(), IsNil)
+	_, err = m.Get(0, 1)
+	c.Assert(err, Equals, ErrClosed)
+	_, err = m.Put(0, []byte("x"))
+	c.Assert(err, Equals, ErrClosed)
+
+	m, err = NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	_, err = m.Put(0, []byte("x"))
+	c.Assert(err, Equals, ErrReadOnly)
+}
+
+func (s *S) TestMappingMetadata(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, 12, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	c.Assert(m.Addr(), Equals, m.MMap().addr())
+	c.Assert(m.Len(), Equals, int64(12))
+	c.Assert(m.Offset(), Equals, int64(0))
+	c.Assert(m.Prot(), Equals, PROT_READ)
+	c.Assert(m.Flags(), Equals, MAP_SHARED)
+	c.Assert(m.Fd(), Equals, s.file.Fd())
+	if p, err := m.Path(); err != ErrUnsupported {
+		c.Assert(err, IsNil)
+		c.Assert(p, Equals, s.file.Name())
+	}
+	c.Assert(m.Close(), IsNil)
+	c.Assert(m.Addr(), Equals, uintptr(0))
+	c.Assert(m.Len(), Equals, int64(0))
+}
+
+func (s *S) TestMappingPageSize(c *C) {
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ, MAP_SHARED)
+	c.Assert(err, IsNil)
+	size, err := m.PageSize()
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, os.Getpagesize())
+	c.Assert(m.Close(), IsNil)
+	_, err = m.PageSize()
+	c.Assert(err, Equals, ErrClosed)
+}
+
+func (s *S) TestReadAtNoFault(c *C) {
+	pageSize := os.Getpagesize()
+	data := make([]byte, 3*pageSize)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	_, err := s.file.WriteAt(data, 0)
+	c.Assert(err, IsNil)
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m.Close()
+	mmap := m.MMap()
+	c.Assert(mmap.Advise(MADV_DONTNEED), IsNil)
+	// Only the middle page is resident, and was modified in memory.
+	mmap[pageSize+1] = 'M'
+	data[pageSize+1] = 'M'
+
+	buf := make([]byte, 2*pageSize)
+	n, err := m.ReadAtNoFault(buf, int64(pageSize/2))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, len(buf))
+	c.Assert(buf, DeepEquals, data[pageSize/2:pageSize/2+len(buf)])
+
+	n, err = m.ReadAtNoFault(buf, int64(2*pageSize))
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(n, Equals, pageSize)
+	c.Assert(buf[:n], DeepEquals, data[2*pageSize:])
+}
+
+func (s *S) TestPreadMapper(c *C) {
+	exerciseMapper(c, PreadMapper{}, s.file.Fd())
+
+	_, err := PreadMapper{}.Map(s.file.Fd(), 8, 9, PROT_READ, MAP_SHARED)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	r, err := PreadMapper{}.Map(s.file.Fd(), 0, 1, PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	r.Bytes()[0] = 'C'
+	c.Assert(r.Close(), IsNil)
+	buf := make([]byte, 1)
+	_, err = s.file.ReadAt(buf, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "C")
+}
+
+func (s *S) TestFallbackMapper(c *C) {
+	exerciseMapper(c, FallbackMapper{}, s.file.Fd())
+	c.Assert(mmapUnavailable(syscall.ENODEV), Equals, true)
+	c.Assert(mmapUnavailable(syscall.EINVAL), Equals, false)
+}
+
+func (s *S) TestWindowedMapper(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(4*pageSize+100)), IsNil)
+	w, err := NewWindowedMapper(s.file.Fd(), PROT_READ|PROT_WRITE, int64(pageSize), 2)
+	c.Assert(err, IsNil)
+	c.Assert(w.Size(), Equals, int64(4*pageSize+100))
+
+	// Spans windows 0 and 1.
+	n, err := w.WriteAt([]byte("across"), int64(pageSize-3))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 6)
+	c.Assert(w.Maps(), Equals, int64(2))
+	// Window 0 is the most recently used, so 1 makes room for 4.
+	p := make([]byte, 4)
+	_, err = w.ReadAt(p, 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(p), Equals, "0123")
+	n, err = w.WriteAt([]byte("tail"), int64(4*pageSize+96))
+	c.Assert(err, IsNil)
+	_, err = w.ReadAt(p, 4)
+	c.Assert(err, IsNil)
+	c.Assert(w.Maps(), Equals, int64(3))
+
+	p = make([]byte, 6)
+	n, err = w.ReadAt(p, int64(pageSize-3))
+	c.Assert(err, IsNil)
+	c.Assert(string(p[:n]), Equals, "across")
+	c.Assert(w.Maps(), Equals, int64(4))
+	n, err = w.ReadAt(p, int64(4*pageSize+96))
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(string(p[:n]), Equals, "tail")
+	_, err = w.WriteAt([]byte("past"), int64(4*pageSize+98))
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(w.Sync(MS_SYNC), IsNil)
+	c.Assert(w.Close(), IsNil)
+	_, err = w.ReadAt(p, 0)
+	c.Assert(err, Equals, ErrClosed)
+
+	data, err := os.ReadFile(s.file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(string(data[pageSize-3:pageSize+3]), Equals, "across")
+	c.Assert(string(data[4*pageSize+96:]), Equals, "tail")
+
+	_, err = NewWindowedMapper(s.file.Fd(), PROT_READ, 100, 2)
+	c.Assert(err, Equals, ErrUnaligned)
+}
@@ -0,0 +1,298 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"sync"
+	"time"
+)
+
+// The Mapping type is a handle to a memory mapped region of a file or
+// device. On top of the MMap slice, it remembers how the region was created
+// and whether it has been closed, so methods on a closed mapping return
+// ErrClosed rather than touching memory that's gone.
+//
+// A Mapping is safe for concurrent use, although the memory returned by
+// Bytes isn't protected by any lock; Acquire holds it mapped while in use.
+type Mapping struct {
+	mu     sync.RWMutex
+	mmap   MMap
+	ref    *mappingRef
+	fd     uintptr
+	offset int64
+	prot   ProtFlags
+	flags  MapFlags
+	closed bool
+	// invalid is set by Revalidate once the backing file no longer covers
+	// the mapping.
+	invalid error
+	faults  *faultCounters
+	// progress is told how far along SyncContext and Prefault are.
+	progress ProgressFunc
+	// release holds the resources acquired by options, released in
+	// reverse order when the mapping is closed.
+	release []func() error
+	// sums holds the checksums kept by WithPageChecksums, used under
+	// sumsMu as PageChecksums isn't safe for concurrent use.
+	sums   *PageChecksums
+	sumsMu sync.Mutex
+}
+
+// A MappingOption configures a Mapping as it is created by NewMapping.
+type MappingOption func(m *Mapping) error
+
+// NewMapping maps length bytes of the file or device at fd starting at
+// offset, and returns a handle to the mapping. If -1 is provided as length,
+// the region extends to the end of the file. The options are applied in
+// order; if one fails, the mapping is closed and its error returned.
+func NewMapping(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags, opts ...MappingOption) (*Mapping, error) {
+	mmap, err := MapRegion(fd, offset, length, prot, flags)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mapping{mmap: mmap, ref: newMappingRef(mmap), fd: fd, offset: offset, prot: prot, flags: flags, faults: new(faultCounters)}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// every returns an option running fn on the mapping every interval, from a
+// goroutine of its own, until the mapping is closed.
+func every(interval time.Duration, fn func(m *Mapping)) MappingOption {
+	return func(m *Mapping) error {
+		done := make(chan struct{})
+		go func() {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-t.C:
+					fn(m)
+				}
+			}
+		}()
+		m.release = append(m.release, func() error {
+			close(done)
+			return nil
+		})
+		return nil
+	}
+}
+
+// WithFileLock returns an option taking an advisory lock of the given mode
+// on the mapped range of the backing file, held until the mapping is closed.
+// Cooperating processes locking the file the same way can't write to it or
+// truncate it while the mapping is alive. See LockFile.
+func WithFileLock(mode LockMode) MappingOption {
+	return func(m *Mapping) error {
+		l, err := LockFile(m.fd, m.offset, int64(len(m.mmap)), mode)
+		if err != nil {
+			return err
+		}
+		m.release = append(m.release, l.Unlock)
+		return nil
+	}
+}
+
+// check returns the error methods on the mapping should fail with, if any.
+// It must be called with m.mu held.
+func (m *Mapping) check() error {
+	if m.closed {
+		return ErrClosed
+	}
+	return m.invalid
+}
+
+// Bytes returns the mapped memory, or nil if the mapping is closed or was
+// invalidated.
+func (m *Mapping) Bytes() []byte {
+	return m.MMap()
+}
+
+// Fd returns the file descriptor the mapping was created from.
+func (m *Mapping) Fd() uintptr {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.fd
+}
+
+// Path returns the path of the file the mapping was created from, as
+// currently known to the system, which may differ from the path it was
+// opened with if it has been renamed since. It returns ErrUnsupported on
+// platforms that can't tell.
+func (m *Mapping) Path() (string, error) {
+	return fdPath(m.Fd())
+}
+
+// Addr returns the address at which the mapping starts, or 0 if it is
+// closed, to be matched against /proc/self/maps or a debugger's output.
+func (m *Mapping) Addr() uintptr {
+	return m.MMap().addr()
+}
+
+// Len returns the length of the mapping in bytes, or 0 if it is closed.
+func (m *Mapping) Len() int64 {
+	return int64(len(m.MMap()))
+}
+
+// Offset returns the position in the file where the mapping starts.
+func (m *Mapping) Offset() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.offset
+}
+
+// PageSize returns the size of the pages the mapping is made of. See
+// MMap.PageSize.
+func (m *Mapping) PageSize() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	return m.mmap.PageSize()
+}
+
+// Prot returns the protection flags the mapping was created with.
+func (m *Mapping) Prot() ProtFlags {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.prot
+}
+
+// Flags returns the flags the mapping was created with.
+func (m *Mapping) Flags() MapFlags {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.flags
+}
+
+// MMap returns the mapped memory as an MMap, or nil if the mapping is closed
+// or was invalidated.
+func (m *Mapping) MMap() MMap {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.invalid != nil {
+		return nil
+	}
+	return m.mmap
+}
+
+// Get returns the n bytes of the mapping starting at off. Unlike slicing
+// the result of Bytes, it returns ErrOutOfBounds for ranges outside of the
+// mapping instead of panicking, and checks that the mapping is still open.
+// The returned slice points into the mapping and is only valid while it is.
+func (m *Mapping) Get(off, n int) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	if n < 0 || !m.mmap.inBounds(off, n) {
+		return nil, ErrOutOfBounds
+	}
+	if m.sums != nil {
+		m.sumsMu.Lock()
+		defer m.sumsMu.Unlock()
+		if _, err := m.sums.Bytes(off, n); err != nil {
+			return nil, err
+		}
+	}
+	return m.mmap[off : off+n : off+n], nil
+}
+
+// Put copies data into the mapping starting at off, and returns the number
+// of bytes copied. It returns ErrOutOfBounds, copying nothing, if data
+// doesn't fit, and ErrReadOnly if the mapping wasn't created writable.
+func (m *Mapping) Put(off int, data []byte) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	if m.prot&PROT_WRITE == 0 {
+		return 0, ErrReadOnly
+	}
+	if !m.mmap.inBounds(off, len(data)) {
+		return 0, ErrOutOfBounds
+	}
+	if m.sums != nil {
+		// Marking the range under the lock keeps a concurrent Sync from
+		// checksumming it halfway through the copy.
+		m.sumsMu.Lock()
+		defer m.sumsMu.Unlock()
+		m.sums.MarkDirty(off, len(data))
+	}
+	return copy(m.mmap[off:], data), nil
+}
+
+// Sync flushes changes made to the mapping back to the device. See
+// MMap.Sync. With WithPageChecksums, the checksums of the regions written
+// to are updated and flushed as well.
+func (m *Mapping) Sync(flags SyncFlags) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	if m.sums != nil {
+		m.sumsMu.Lock()
+		defer m.sumsMu.Unlock()
+		return m.sums.Sync(flags)
+	}
+	return m.mmap.Sync(flags)
+}
+
+// Advise advises the kernel about how to handle the mapping. See
+// MMap.Advise.
+func (m *Mapping) Advise(advice AdviseFlags) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	return m.mmap.Advise(advice)
+}
+
+// Close unmaps the mapping and releases the resources acquired by its
+// options, such as file locks. Closing a mapping twice returns ErrClosed.
+func (m *Mapping) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if err := m.ref.release(); err != nil {
+		return err
+	}
+	m.closed = true
+	m.mmap, m.ref = nil, nil
+	var err error
+	for i := len(m.release) - 1; i >= 0; i-- {
+		if rerr := m.release[i](); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	m.release = nil
+	return err
+}
+
+// The OSMapper type is the Mapper creating real memory mappings, returned as
+// *Mapping values.
+type OSMapper struct{}
+
+// Map implements the Mapper interface.
+func (OSMapper) Map(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (Region, error) {
+	m, err := NewMapping(fd, offset, length, prot, flags)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
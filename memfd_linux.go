@@ -0,0 +1,135 @@
+package gommap
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	_MFD_CLOEXEC       = 0x1
+	_MFD_ALLOW_SEALING = 0x2
+
+	_F_ADD_SEALS = 1033
+	_F_GET_SEALS = 1034
+)
+
+// The SealFlags type holds the seals of a memfd file, each forbidding a kind
+// of change to the file for as long as it exists.
+type SealFlags uint
+
+const (
+	// F_SEAL_SEAL forbids adding seals.
+	F_SEAL_SEAL SealFlags = 0x1
+	// F_SEAL_SHRINK forbids shrinking the file.
+	F_SEAL_SHRINK SealFlags = 0x2
+	// F_SEAL_GROW forbids growing the file.
+	F_SEAL_GROW SealFlags = 0x4
+	// F_SEAL_WRITE forbids writing to the file, through write or a mapping.
+	F_SEAL_WRITE SealFlags = 0x8
+	// F_SEAL_FUTURE_WRITE forbids new writes, while writable mappings that
+	// already exist keep working.
+	F_SEAL_FUTURE_WRITE SealFlags = 0x10
+)
+
+// memfdCreate creates an anonymous file living in memory and returns its
+// file descriptor.
+func memfdCreate(name string, flags int) (int, error) {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := syscall.Syscall(_SYS_MEMFD_CREATE, uintptr(unsafe.Pointer(p)), uintptr(flags), 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// anonymousFile returns the descriptor of a new file of the given size that
+// isn't visible in the file system.
+func anonymousFile(name string, size int64) (int, error) {
+	fd, err := memfdCreate(name, _MFD_CLOEXEC)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.Ftruncate(fd, size); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// MapMemfd creates a memfd file of size bytes named name, which only shows
+// in /proc, and maps it whole with the provided protection and flags. The
+// file accepts seals, so it can be made immutable with Seal before its
+// descriptor, returned by Fd, is handed to another process. The file is
+// closed along with the mapping.
+func MapMemfd(name string, size int64, prot ProtFlags, flags MapFlags, opts ...MappingOption) (*Mapping, error) {
+	fd, err := memfdCreate(name, _MFD_CLOEXEC|_MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Ftruncate(fd, size); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	m, err := NewMapping(uintptr(fd), 0, size, prot, flags, opts...)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// Close the file last, after the resources options acquired on it.
+	m.release = append([]func() error{func() error { return syscall.Close(fd) }}, m.release...)
+	return m, nil
+}
+
+// Seal adds seals to the memfd file backing the mapping. The kernel refuses
+// F_SEAL_WRITE while the file is mapped shared and writable, so when it is
+// requested on such a mapping, the mapping is first replaced in place by a
+// read-only one of the same pages; writing to it afterwards crashes the
+// application, even if sealing failed. Memory obtained through Acquire and
+// not yet released must not be written to either.
+func (m *Mapping) Seal(seals SealFlags) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	if seals&F_SEAL_WRITE != 0 && m.prot&PROT_WRITE != 0 && m.flags&MAP_SHARED != 0 && len(m.mmap) > 0 {
+		// A shared mapping of a descriptor open for writing could be made
+		// writable again, which is enough for the kernel to refuse the seal.
+		// Map the pages through a read-only descriptor of the same file.
+		ro, err := syscall.Open(fmt.Sprintf("/proc/self/fd/%d", m.fd), syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		prot := m.prot &^ PROT_WRITE
+		_, err = mmap_syscall(m.mmap.addr(), uintptr(len(m.mmap)), uintptr(prot), uintptr(m.flags|MAP_FIXED), uintptr(ro), m.offset)
+		syscall.Close(ro)
+		if err != syscall.Errno(0) {
+			return err
+		}
+		m.prot = prot
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, m.fd, _F_ADD_SEALS, uintptr(seals))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// GetSeals returns the seals of the memfd file backing the mapping, so a
+// consumer can check the file it was handed can't change under it.
+func (m *Mapping) GetSeals() (SealFlags, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	seals, _, errno := syscall.Syscall(syscall.SYS_FCNTL, m.fd, _F_GET_SEALS, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return SealFlags(seals), nil
+}
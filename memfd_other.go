@@ -0,0 +1,25 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+)
+
+// anonymousFile returns the descriptor of a new file of the given size that
+// isn't visible in the file system. Without memfd_create, this is a temporary
+// file which is unlinked right away.
+func anonymousFile(name string, size int64) (int, error) {
+	f, err := os.CreateTemp("", name)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+	if err := f.Truncate(size); err != nil {
+		return -1, err
+	}
+	return syscall.Dup(int(f.Fd()))
+}
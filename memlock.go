@@ -0,0 +1,136 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// The MemlockError type is returned by Lock when the kernel refuses to lock
+// memory, explaining the limit that was hit. It wraps the error returned by
+// mlock, so errors.Is(err, syscall.ENOMEM) still works.
+type MemlockError struct {
+	Err error
+	// Requested is the size of the range that couldn't be locked.
+	Requested int64
+	// Limit and Max are the soft and hard RLIMIT_MEMLOCK limits, or -1 if
+	// unlimited.
+	Limit, Max int64
+	// Locked is how much memory the process had locked already, or -1 if
+	// unknown.
+	Locked int64
+	// Privileged is set if the process has CAP_IPC_LOCK, which lifts the
+	// limit. It is never set outside of Linux.
+	Privileged bool
+}
+
+func (e *MemlockError) Error() string {
+	msg := fmt.Sprintf("gommap: cannot lock %d bytes: %v", e.Requested, e.Err)
+	switch {
+	case e.Privileged:
+		return msg + " (the process has CAP_IPC_LOCK, so memory itself is short)"
+	case e.Limit < 0:
+		return msg + " (RLIMIT_MEMLOCK is unlimited)"
+	}
+	msg += fmt.Sprintf(" (RLIMIT_MEMLOCK is %d bytes", e.Limit)
+	if e.Locked >= 0 {
+		msg += fmt.Sprintf(", %d already locked", e.Locked)
+	}
+	if e.Max < 0 || e.Max > e.Limit {
+		msg += "; it can be raised with setrlimit or RaiseMemlockLimit"
+	} else {
+		msg += "; raising it needs privileges or ulimit -l"
+	}
+	return msg + ")"
+}
+
+func (e *MemlockError) Unwrap() error {
+	return e.Err
+}
+
+// rlimitValue converts a limit to an int64, with -1 meaning unlimited.
+func rlimitValue(v uint64) int64 {
+	if v == rlimInfinity || v > uint64(maxInt64) {
+		return -1
+	}
+	return int64(v)
+}
+
+const maxInt64 = 1<<63 - 1
+
+// memlockError explains err, returned when locking n bytes, if it may be
+// due to RLIMIT_MEMLOCK.
+func memlockError(err error, n int) error {
+	if err != syscall.ENOMEM && err != syscall.EPERM && err != syscall.EAGAIN {
+		return err
+	}
+	var rlim syscall.Rlimit
+	if syscall.Getrlimit(rlimitMemlock, &rlim) != nil {
+		return err
+	}
+	locked, privileged := memlockStatus()
+	return &MemlockError{
+		Err:        err,
+		Requested:  int64(n),
+		Limit:      rlimitValue(uint64(rlim.Cur)),
+		Max:        rlimitValue(uint64(rlim.Max)),
+		Locked:     locked,
+		Privileged: privileged,
+	}
+}
+
+// RaiseMemlockLimit raises the soft RLIMIT_MEMLOCK limit of the process so
+// that n more bytes than are locked now fit, as far as the hard limit
+// allows without privileges. It returns the new soft limit, or -1 if
+// unlimited, and ErrBudget if the hard limit is too low.
+func RaiseMemlockLimit(n int64) (int64, error) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(rlimitMemlock, &rlim); err != nil {
+		return 0, err
+	}
+	cur, max := rlimitValue(uint64(rlim.Cur)), rlimitValue(uint64(rlim.Max))
+	if cur < 0 {
+		return -1, nil
+	}
+	locked, _ := memlockStatus()
+	if locked < 0 {
+		// Without knowing what is locked, assume the current limit is
+		// used up.
+		locked = cur
+	}
+	want := locked + n
+	if want <= cur {
+		return cur, nil
+	}
+	if max >= 0 && want > max {
+		return cur, ErrBudget
+	}
+	setRlimit(&rlim.Cur, want)
+	if err := syscall.Setrlimit(rlimitMemlock, &rlim); err != nil {
+		return cur, err
+	}
+	return want, nil
+}
+
+// LockRaisingLimit is like Lock, but if the lock is refused because of
+// RLIMIT_MEMLOCK, the soft limit is raised as far as the hard limit allows
+// and the lock attempted again.
+func (mmap MMap) LockRaisingLimit() error {
+	err := mmap.Lock()
+	merr, ok := err.(*MemlockError)
+	if !ok || merr.Privileged || merr.Limit < 0 {
+		return err
+	}
+	if _, rerr := RaiseMemlockLimit(int64(len(mmap))); rerr != nil {
+		return err
+	}
+	return mmap.Lock()
+}
+
+// setRlimit sets a field of syscall.Rlimit, which is an int64 on some
+// systems, such as FreeBSD, and a uint64 on others.
+func setRlimit[T int64 | uint64](field *T, v int64) {
+	*field = T(v)
+}
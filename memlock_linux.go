@@ -0,0 +1,48 @@
+package gommap
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	rlimitMemlock = 0x8
+	rlimInfinity  = ^uint64(0)
+
+	capIPCLock = 14
+)
+
+// memlockStatus returns how many bytes the process has locked, from the
+// VmLck line of /proc/self/status, and whether it has CAP_IPC_LOCK in its
+// effective capabilities. Locked is -1 if unknown.
+func memlockStatus() (locked int64, privileged bool) {
+	locked = -1
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return locked, false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "VmLck":
+			kb, err := strconv.ParseInt(strings.TrimSuffix(value, " kB"), 10, 64)
+			if err == nil {
+				locked = kb << 10
+			}
+		case "CapEff":
+			caps, err := strconv.ParseUint(value, 16, 64)
+			if err == nil {
+				privileged = caps&(1<<capIPCLock) != 0
+			}
+		}
+	}
+	return locked, privileged
+}
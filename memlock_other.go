@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+const (
+	rlimitMemlock = 0x6
+	rlimInfinity  = 1<<63 - 1
+)
+
+// memlockStatus returns -1, since how much memory the process has locked
+// can't be known, and false, since capabilities only exist on Linux.
+func memlockStatus() (locked int64, privileged bool) {
+	return -1, false
+}
@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// The MetricsSnapshot type holds the values of the package-wide counters
+// maintained for every mapping created and released through this package.
+type MetricsSnapshot struct {
+	// LiveMappings and MappedBytes describe the mappings currently alive.
+	// Unmapping part of a mapping reduces MappedBytes but not LiveMappings,
+	// which counts a mapping until the last of it is unmapped. Pages of a
+	// mapping replaced with MAP_FIXED aren't counted again.
+	LiveMappings int64
+	MappedBytes  int64
+	// Maps and Unmaps count successful map and unmap calls.
+	Maps   uint64
+	Unmaps uint64
+	// SyncCalls, SyncErrors and SyncDuration describe msync calls.
+	SyncCalls    uint64
+	SyncErrors   uint64
+	SyncDuration time.Duration
+	// MinorFaults and MajorFaults are the page faults of the whole process
+	// so far, as reported by getrusage. Most of them come from mapped memory
+	// in mmap-heavy programs; compare two snapshots to get rates.
+	MinorFaults int64
+	MajorFaults int64
+}
+
+var metrics struct {
+	liveMappings int64
+	mappedBytes  int64
+	maps         uint64
+	unmaps       uint64
+	syncCalls    uint64
+	syncErrors   uint64
+	syncNanos    int64
+}
+
+// The liveMapping type is a mapping counted in LiveMappings, along with how
+// many of its bytes are still mapped.
+type liveMapping struct {
+	base   uintptr
+	length int
+	left   int
+}
+
+// liveMappings lists the mappings counted in LiveMappings, sorted by base
+// address, so that unmapping part of one is told apart from unmapping the
+// last of it.
+var liveMappings struct {
+	sync.Mutex
+	list []liveMapping
+}
+
+// findLive returns the index of the live mapping holding addr, or the index
+// where a mapping starting at addr belongs.
+func findLive(addr uintptr) (int, bool) {
+	list := liveMappings.list
+	i := sort.Search(len(list), func(i int) bool { return list[i].base > addr }) - 1
+	if i >= 0 && addr-list[i].base < uintptr(list[i].length) {
+		return i, true
+	}
+	return i + 1, false
+}
+
+// insertLive inserts m at index i of the live mappings.
+func insertLive(i int, m liveMapping) {
+	list := append(liveMappings.list, liveMapping{})
+	copy(list[i+1:], list[i:])
+	list[i] = m
+	liveMappings.list = list
+}
+
+func metricsMapped(mmap MMap) {
+	liveMappings.Lock()
+	defer liveMappings.Unlock()
+	i, ok := findLive(mmap.addr())
+	if ok {
+		// A MAP_FIXED overlay replacing pages of a mapping already
+		// counted, as MapMirror and VectorBuilder make, goes away along
+		// with it.
+		return
+	}
+	insertLive(i, liveMapping{base: mmap.addr(), length: len(mmap), left: len(mmap)})
+	atomic.AddInt64(&metrics.liveMappings, 1)
+	atomic.AddInt64(&metrics.mappedBytes, int64(len(mmap)))
+	atomic.AddUint64(&metrics.maps, 1)
+}
+
+func metricsUnmapped(mmap MMap) {
+	atomic.AddInt64(&metrics.mappedBytes, -int64(len(mmap)))
+	atomic.AddUint64(&metrics.unmaps, 1)
+	liveMappings.Lock()
+	defer liveMappings.Unlock()
+	i, ok := findLive(mmap.addr())
+	if !ok {
+		return
+	}
+	list := liveMappings.list
+	if list[i].left -= len(mmap); list[i].left <= 0 {
+		liveMappings.list = append(list[:i], list[i+1:]...)
+		atomic.AddInt64(&metrics.liveMappings, -1)
+	}
+}
+
+func metricsRemapped(old, mmap MMap) {
+	atomic.AddInt64(&metrics.mappedBytes, int64(len(mmap)-len(old)))
+	liveMappings.Lock()
+	defer liveMappings.Unlock()
+	i, ok := findLive(old.addr())
+	if !ok {
+		return
+	}
+	m := liveMappings.list[i]
+	m.base, m.length, m.left = mmap.addr(), len(mmap), m.left+len(mmap)-len(old)
+	liveMappings.list = append(liveMappings.list[:i], liveMappings.list[i+1:]...)
+	i, _ = findLive(m.base)
+	insertLive(i, m)
+}
+
+func metricsSynced(d time.Duration, failed bool) {
+	atomic.AddUint64(&metrics.syncCalls, 1)
+	atomic.AddInt64(&metrics.syncNanos, int64(d))
+	if failed {
+		atomic.AddUint64(&metrics.syncErrors, 1)
+	}
+}
+
+// Metrics returns the current values of the package-wide counters.
+func Metrics() MetricsSnapshot {
+	s := MetricsSnapshot{
+		LiveMappings: atomic.LoadInt64(&metrics.liveMappings),
+		MappedBytes:  atomic.LoadInt64(&metrics.mappedBytes),
+		Maps:         atomic.LoadUint64(&metrics.maps),
+		Unmaps:       atomic.LoadUint64(&metrics.unmaps),
+		SyncCalls:    atomic.LoadUint64(&metrics.syncCalls),
+		SyncErrors:   atomic.LoadUint64(&metrics.syncErrors),
+		SyncDuration: time.Duration(atomic.LoadInt64(&metrics.syncNanos)),
+	}
+	var ru syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &ru) == nil {
+		s.MinorFaults = int64(ru.Minflt)
+		s.MajorFaults = int64(ru.Majflt)
+	}
+	return s
+}
+
+// PublishMetrics publishes the package-wide counters through expvar under
+// the given name, making them available at /debug/vars along with the other
+// exported variables. Like expvar.Publish, it panics if the name is already
+// in use.
+func PublishMetrics(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return Metrics()
+	}))
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+)
+
+// MapMirror creates a mapping of 2*size bytes in which the second half is the
+// same memory as the first half: writing to mmap[i] also changes
+// mmap[i+size] and vice versa. A circular buffer of size bytes kept in the
+// mirror can then read or write any run of up to size bytes starting at any
+// offset below size as a single contiguous slice, with no special handling
+// for wrap-around.
+//
+// The size must be a multiple of the page size. The whole mapping is
+// released by calling UnsafeUnmap on it.
+func MapMirror(size int) (MMap, error) {
+	if size <= 0 || size%os.Getpagesize() != 0 {
+		return nil, ErrSize
+	}
+	fd, err := anonymousFile("gommap-mirror", int64(size))
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	// Reserve the whole range first so nothing else can be placed between the
+	// two halves, then map the file over each half of the reservation.
+	mmap, err := MapAnonymous(int64(2*size), PROT_NONE, MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	base := mmap.addr()
+	for _, addr := range []uintptr{base, base + uintptr(size)} {
+		if _, err := MapAt(addr, uintptr(fd), 0, int64(size), PROT_READ|PROT_WRITE, MAP_SHARED|MAP_FIXED); err != nil {
+			mmap.UnsafeUnmap()
+			return nil, err
+		}
+	}
+	return mmap, nil
+}
@@ -1,5 +1,4 @@
-// +build linux freebsd
-// +build amd64 arm64
+// +build linux,amd64 linux,arm64 freebsd,arm64
 
 package gommap
 
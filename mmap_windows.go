@@ -71,20 +71,20 @@ func mmap(len int64, prot, flags, hfile uintptr, off int64) ([]byte, error) {
 	fileHandleMap[addr] = fileHandle
 	handleLock.Unlock()
 
-	m := MMap{}
-	dh := m.header()
-	dh.Data = addr
-	dh.Len = int(len)
-	dh.Cap = dh.Len
-
-	return m, nil
+	return sliceAt(addr, int(len)), nil
 }
 
-func flush(addr, len uintptr) error {
+// flush writes the dirty pages of the view at addr to the file. They may
+// linger in the file system cache until durable is set, in which case the
+// file's buffers are flushed to the device as well.
+func flush(addr, len uintptr, durable bool) error {
 	errno := syscall.FlushViewOfFile(addr, len)
 	if errno != nil {
 		return os.NewSyscallError("FlushViewOfFile", errno)
 	}
+	if !durable {
+		return nil
+	}
 
 	handleLock.Lock()
 	defer handleLock.Unlock()
@@ -121,7 +121,7 @@ func unlock(addr, len uintptr) error {
 }
 
 func unmap(addr, len uintptr) error {
-	flush(addr, len)
+	flush(addr, len, true)
 	// Lock the UnmapViewOfFile along with the handleMap deletion.
 	// As soon as we unmap the view, the OS is free to give the
 	// same addr to another new map. We don't want another goroutine
@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "sync/atomic"
+
+// The MMIO type gives access to the registers of a device mapped into
+// memory. Go has no volatile accesses, so registers are read and written
+// with sync/atomic, which the compiler never elides, merges or reorders,
+// and which access memory with a single instruction of the width of the
+// register. Registers are in native byte order, which is what devices use
+// on the little-endian platforms they are found on.
+//
+// 64-bit registers can only be accessed on 64-bit platforms: elsewhere,
+// sync/atomic relies on exclusive accesses, which device memory may not
+// support.
+type MMIO struct {
+	mmap MMap
+	regs MMap
+}
+
+// NewMMIO returns the registers found in mmap, which may have been mapped
+// with MapDevice.
+func NewMMIO(mmap MMap) *MMIO {
+	return &MMIO{mmap: mmap, regs: mmap}
+}
+
+// Len returns the size of the register window.
+func (m *MMIO) Len() int {
+	return len(m.regs)
+}
+
+// Read32 reads the 32-bit register at off, which must be 4-byte aligned.
+func (m *MMIO) Read32(off int) (uint32, error) {
+	p, err := m.regs.uint32Ptr(off)
+	if err != nil {
+		return 0, err
+	}
+	return atomic.LoadUint32(p), nil
+}
+
+// Write32 writes v to the 32-bit register at off, which must be 4-byte
+// aligned.
+func (m *MMIO) Write32(off int, v uint32) error {
+	p, err := m.regs.uint32Ptr(off)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32(p, v)
+	return nil
+}
+
+// Read64 reads the 64-bit register at off, which must be 8-byte aligned.
+func (m *MMIO) Read64(off int) (uint64, error) {
+	p, err := m.regs.uint64Ptr(off)
+	if err != nil {
+		return 0, err
+	}
+	return atomic.LoadUint64(p), nil
+}
+
+// Write64 writes v to the 64-bit register at off, which must be 8-byte
+// aligned.
+func (m *MMIO) Write64(off int, v uint64) error {
+	p, err := m.regs.uint64Ptr(off)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(p, v)
+	return nil
+}
+
+// Unmap unmaps the registers. They must not be accessed afterwards.
+func (m *MMIO) Unmap() error {
+	return m.mmap.UnsafeUnmap()
+}
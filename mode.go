@@ -0,0 +1,32 @@
+package gommap
+
+// The Mode type describes how a file is mapped in terms that mean the same
+// on every platform, leaving the native PROT_ and MAP_ flags, which differ
+// per system, to those who need them.
+type Mode uint
+
+const (
+	// ReadOnly maps the file for reading. Writing to the mapping crashes
+	// the application.
+	ReadOnly Mode = 0
+	// ReadWrite maps the file for reading and writing. Writes are shared
+	// with every other mapping of the file and reach the file itself.
+	ReadWrite Mode = 1 << iota
+	// CopyOnWrite maps the file for reading and writing, but writes are
+	// private to the mapping and never reach the file.
+	CopyOnWrite
+	// Exec additionally makes the mapped memory executable.
+	Exec
+)
+
+// MapMode is like Map, mapping the file with the native flags matching mode.
+func MapMode(fd uintptr, mode Mode) (MMap, error) {
+	return MapRegionMode(fd, 0, -1, mode)
+}
+
+// MapRegionMode is like MapRegion, mapping the region with the native flags
+// matching mode.
+func MapRegionMode(fd uintptr, offset, length int64, mode Mode) (MMap, error) {
+	prot, flags := mode.native()
+	return MapRegion(fd, offset, length, prot, flags)
+}
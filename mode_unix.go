@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// native returns the protection and mapping flags matching mode.
+func (mode Mode) native() (ProtFlags, MapFlags) {
+	prot, flags := PROT_READ, MAP_SHARED
+	if mode&(ReadWrite|CopyOnWrite) != 0 {
+		prot |= PROT_WRITE
+	}
+	if mode&CopyOnWrite != 0 {
+		flags = MAP_PRIVATE
+	}
+	if mode&Exec != 0 {
+		prot |= PROT_EXEC
+	}
+	return prot, flags
+}
@@ -0,0 +1,18 @@
+package gommap
+
+// native returns the protection and mapping flags matching mode. Windows has
+// no private shared-file mappings; copy-on-write views are requested through
+// the protection instead.
+func (mode Mode) native() (ProtFlags, MapFlags) {
+	prot, flags := PROT_READ, MAP_SHARED
+	switch {
+	case mode&CopyOnWrite != 0:
+		prot, flags = PROT_COPY, MAP_PRIVATE
+	case mode&ReadWrite != 0:
+		prot = PROT_WRITE
+	}
+	if mode&Exec != 0 {
+		prot |= PROT_EXEC
+	}
+	return prot, flags
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// TagGranule is the number of bytes covered by a single memory tag, as set
+// by MMap.SetTag. Memory tagging is only supported on Linux for arm64
+// processors having MTE; elsewhere MapTagged returns ErrUnsupported.
+const TagGranule = 16
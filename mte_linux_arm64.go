@@ -0,0 +1,86 @@
+package gommap
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// PROT_MTE enables memory tagging on the pages of an anonymous mapping.
+const PROT_MTE ProtFlags = 0x20
+
+// Definitions from linux/prctl.h.
+const (
+	_PR_SET_TAGGED_ADDR_CTRL = 55
+	_PR_GET_TAGGED_ADDR_CTRL = 56
+	_PR_TAGGED_ADDR_ENABLE   = 0x1
+	_PR_MTE_TCF_SYNC         = 0x2
+)
+
+func storeTags(addr, n uintptr)
+func loadTag(addr uintptr) uintptr
+
+// MapTagged creates a private anonymous mapping of length bytes with memory
+// tagging enabled, all of its granules tagged with 0. It returns
+// ErrUnsupported when the processor or kernel lacks MTE.
+func MapTagged(length int64) (MMap, error) {
+	mmap, err := MapAnonymous(length, PROT_READ|PROT_WRITE|PROT_MTE, MAP_PRIVATE)
+	if err == syscall.EINVAL {
+		return nil, ErrUnsupported
+	}
+	return mmap, err
+}
+
+// SetTag tags the n bytes of mmap starting at off with tag, and returns
+// them through a pointer carrying the same tag. While tag checks are
+// enabled, accessing them through a differently tagged pointer, such as one
+// derived from mmap itself or from a neighbouring range tagged otherwise,
+// faults instead of silently overflowing. Tags apply to whole granules of
+// TagGranule bytes, so off and n must be multiples of it, and tag can't
+// exceed 15. The mapping must have been created by MapTagged.
+func (mmap MMap) SetTag(off, n int, tag uint8) ([]byte, error) {
+	if off%TagGranule != 0 || n%TagGranule != 0 {
+		return nil, ErrUnaligned
+	}
+	if off < 0 || n < 0 || off > len(mmap) || n > len(mmap)-off {
+		return nil, ErrOutOfBounds
+	}
+	if tag > 15 {
+		return nil, ErrSize
+	}
+	if n == 0 {
+		return []byte{}, nil
+	}
+	addr := (mmap.addr()+uintptr(off))&^(0xf<<56) | uintptr(tag)<<56
+	storeTags(addr, uintptr(n))
+	return sliceAt(addr, n), nil
+}
+
+// TagAt returns the tag of the granule holding the byte of mmap at off.
+func (mmap MMap) TagAt(off int) (uint8, error) {
+	if off < 0 || off >= len(mmap) {
+		return 0, ErrOutOfBounds
+	}
+	return uint8(loadTag(mmap.addr()+uintptr(off)) >> 56 & 0xf), nil
+}
+
+// WithTagChecks calls fn with synchronous tag checking enabled for the
+// calling goroutine, which is locked to its thread meanwhile as the setting
+// belongs to threads. Accesses to tagged memory through a pointer with the
+// wrong tag then raise SIGSEGV right at the faulting instruction, which
+// debug.SetPanicOnFault can turn into a panic. Goroutines started by fn
+// don't get checks.
+func WithTagChecks(fn func()) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	old, _, errno := syscall.Syscall6(syscall.SYS_PRCTL, _PR_GET_TAGGED_ADDR_CTRL, 0, 0, 0, 0, 0)
+	if errno != 0 {
+		return ErrUnsupported
+	}
+	_, _, errno = syscall.Syscall6(syscall.SYS_PRCTL, _PR_SET_TAGGED_ADDR_CTRL, _PR_TAGGED_ADDR_ENABLE|_PR_MTE_TCF_SYNC, 0, 0, 0, 0)
+	if errno != 0 {
+		return ErrUnsupported
+	}
+	defer syscall.Syscall6(syscall.SYS_PRCTL, _PR_SET_TAGGED_ADDR_CTRL, old, 0, 0, 0, 0)
+	fn()
+	return nil
+}
@@ -0,0 +1,24 @@
+#include "textflag.h"
+
+// func storeTags(addr, n uintptr)
+TEXT ·storeTags(SB),NOSPLIT,$0-16
+	MOVD addr+0(FP), R3
+	MOVD R3, R2
+	MOVD n+8(FP), R1
+loop:
+	CBZ R1, done
+	// STG R3, [R2]
+	WORD $0xd9200843
+	ADD $16, R2
+	SUB $16, R1
+	B loop
+done:
+	RET
+
+// func loadTag(addr uintptr) uintptr
+TEXT ·loadTag(SB),NOSPLIT,$0-16
+	MOVD addr+0(FP), R0
+	// LDG R0, [R0]
+	WORD $0xd9600000
+	MOVD R0, ret+8(FP)
+	RET
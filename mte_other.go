@@ -0,0 +1,26 @@
+//go:build !windows && (!linux || !arm64)
+// +build !windows
+// +build !linux !arm64
+
+package gommap
+
+// MapTagged returns ErrUnsupported, as memory tagging is only available on
+// Linux for arm64.
+func MapTagged(length int64) (MMap, error) {
+	return nil, ErrUnsupported
+}
+
+// SetTag returns ErrUnsupported.
+func (mmap MMap) SetTag(off, n int, tag uint8) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// TagAt returns ErrUnsupported.
+func (mmap MMap) TagAt(off int) (uint8, error) {
+	return 0, ErrUnsupported
+}
+
+// WithTagChecks returns ErrUnsupported without calling fn.
+func WithTagChecks(fn func()) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,99 @@
+package gommap
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// The MultiReader type presents several mappings, typically the segments of
+// a log, as a single logical stream in which they follow each other. It
+// implements io.ReaderAt, io.Reader and io.Seeker, and reads that cross the
+// boundary between two mappings are served from both without any copy other
+// than the one into the caller's buffer.
+//
+// Only Read and Seek share state; ReadAt may be called concurrently.
+type MultiReader struct {
+	parts  []MMap
+	starts []int64
+	size   int64
+	pos    int64
+}
+
+// NewMultiReader returns a MultiReader over the concatenation of the given
+// mappings. Mappings must stay mapped for as long as the reader is used.
+func NewMultiReader(mmaps ...MMap) *MultiReader {
+	r := &MultiReader{parts: mmaps, starts: make([]int64, len(mmaps))}
+	for i, m := range mmaps {
+		r.starts[i] = r.size
+		r.size += int64(len(m))
+	}
+	return r
+}
+
+// Size returns the total length of the mappings.
+func (r *MultiReader) Size() int64 {
+	return r.size
+}
+
+// Locate translates the logical offset off into the index of the mapping
+// holding it and the offset within that mapping. It returns false if off is
+// out of range.
+func (r *MultiReader) Locate(off int64) (int, int, bool) {
+	if off < 0 || off >= r.size {
+		return 0, 0, false
+	}
+	// Find the last mapping starting at or before off, skipping empty ones.
+	i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > off }) - 1
+	return i, int(off - r.starts[i]), true
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *MultiReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gommap: negative offset")
+	}
+	i, o, ok := r.Locate(off)
+	if !ok {
+		return 0, io.EOF
+	}
+	n := 0
+	for ; i < len(r.parts) && n < len(p); i, o = i+1, 0 {
+		n += copy(p[n:], r.parts[i][o:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (r *MultiReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *MultiReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("gommap: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gommap: negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
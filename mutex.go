@@ -0,0 +1,63 @@
+package gommap
+
+import "sync/atomic"
+
+// ProcessMutexSize is the number of bytes a ProcessMutex occupies in a
+// mapping.
+const ProcessMutexSize = 4
+
+// Mutex states. The scheme is the classic three-state futex mutex, which
+// avoids the wake-up system call entirely when the lock is not contended.
+const (
+	mutexUnlocked  = 0
+	mutexLocked    = 1
+	mutexContended = 2
+)
+
+// The ProcessMutex type is a mutual exclusion lock whose state lives inside
+// a mapping. When the mapping is MAP_SHARED, every process mapping the same
+// file at the same offset shares the lock, which makes it suitable for
+// coordinating writes to mapped data across processes.
+//
+// On Linux, waiting is done with futexes and costs no CPU. Other platforms
+// lack a cross-process equivalent and poll instead.
+//
+// The zero state (all bytes zero) is an unlocked mutex, so a freshly extended
+// file needs no initialization.
+type ProcessMutex struct {
+	state *uint32
+}
+
+// NewProcessMutex returns the ProcessMutex stored at off in mmap. The offset
+// must be 4-byte aligned in memory and leave room for ProcessMutexSize bytes.
+func NewProcessMutex(mmap MMap, off int) (*ProcessMutex, error) {
+	p, err := mmap.uint32Ptr(off)
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessMutex{state: p}, nil
+}
+
+// Lock locks the mutex, blocking until it is available.
+func (m *ProcessMutex) Lock() {
+	if atomic.CompareAndSwapUint32(m.state, mutexUnlocked, mutexLocked) {
+		return
+	}
+	for atomic.SwapUint32(m.state, mutexContended) != mutexUnlocked {
+		futexWait(m.state, mutexContended)
+	}
+}
+
+// TryLock tries to lock the mutex without blocking and reports whether it
+// succeeded.
+func (m *ProcessMutex) TryLock() bool {
+	return atomic.CompareAndSwapUint32(m.state, mutexUnlocked, mutexLocked)
+}
+
+// Unlock unlocks the mutex. Like sync.Mutex, a ProcessMutex is not tied to
+// the goroutine, or even the process, that locked it.
+func (m *ProcessMutex) Unlock() {
+	if atomic.SwapUint32(m.state, mutexUnlocked) == mutexContended {
+		futexWake(m.state, 1)
+	}
+}
@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// ReadAtNoFault reads len(p) bytes of the mapping starting at off into p
+// without taking major page faults, for latency-critical code where a fault
+// inside a copy would stall the goroutine for the whole duration of a disk
+// read. The pages in memory are copied from the mapping, while those that
+// aren't are read from the backing file with pread, which reads only what's
+// needed and leaves the mapping untouched. A page evicted between the check
+// and the copy still faults.
+//
+// For a private mapping, pages not in memory were never written to, so the
+// file holds their contents.
+func (m *Mapping) ReadAtNoFault(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, ErrOutOfBounds
+	}
+	if off >= int64(len(m.mmap)) {
+		return 0, io.EOF
+	}
+	src := m.mmap[off:]
+	if len(src) > len(p) {
+		src = src[:len(p)]
+	}
+	if len(src) == 0 {
+		return 0, nil
+	}
+	aligned := pageAligned(src)
+	resident, err := aligned.IsResident()
+	if err != nil {
+		return 0, err
+	}
+	pageSize := os.Getpagesize()
+	// head is how far into the first page src starts.
+	head := len(aligned) - len(src)
+	n := 0
+	for n < len(src) {
+		page := (head + n) / pageSize
+		end := (page+1)*pageSize - head
+		for end < len(src) && resident[(head+end)/pageSize] == resident[page] {
+			end += pageSize
+		}
+		if end > len(src) {
+			end = len(src)
+		}
+		if resident[page] {
+			copy(p[n:end], src[n:end])
+		} else if err := preadFull(m.fd, p[n:end], m.offset+off+int64(n)); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// preadFull reads len(p) bytes of the file at fd starting at off.
+func preadFull(fd uintptr, p []byte, off int64) error {
+	for len(p) > 0 {
+		n, err := syscall.Pread(int(fd), p, off)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrFileTruncated
+		}
+		p, off = p[n:], off+int64(n)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// MemPolicy is a NUMA memory policy, deciding which nodes the pages of a
+// mapping are allocated from. See mbind(2).
+type MemPolicy uint
+
+const (
+	MPOL_DEFAULT        MemPolicy = 0x0
+	MPOL_PREFERRED      MemPolicy = 0x1
+	MPOL_BIND           MemPolicy = 0x2
+	MPOL_INTERLEAVE     MemPolicy = 0x3
+	MPOL_LOCAL          MemPolicy = 0x4
+	MPOL_PREFERRED_MANY MemPolicy = 0x5
+)
+
+const (
+	_MPOL_MF_MOVE = 0x2
+	_MPOL_F_NODE  = 0x1
+	_MPOL_F_ADDR  = 0x2
+
+	// maxNUMANodes is the number of nodes representable in the node masks
+	// passed to the kernel.
+	maxNUMANodes = 1024
+)
+
+// nodeMask returns the kernel node mask with the given nodes set.
+func nodeMask(nodes []int) ([]uint64, error) {
+	mask := make([]uint64, maxNUMANodes/64)
+	for _, n := range nodes {
+		if n < 0 || n >= maxNUMANodes {
+			return nil, syscall.EINVAL
+		}
+		mask[n/64] |= 1 << (n % 64)
+	}
+	return mask, nil
+}
+
+// mbind applies policy over nodes to the pages covering mmap.
+func mbind(mmap MMap, policy MemPolicy, nodes []int, flags uintptr) error {
+	if len(mmap) == 0 {
+		return nil
+	}
+	// The mask stays an unsafe.Pointer until the call, so that it is kept
+	// alive while the kernel reads it.
+	var maskPtr unsafe.Pointer
+	var maxNode uintptr
+	if len(nodes) > 0 {
+		mask, err := nodeMask(nodes)
+		if err != nil {
+			return err
+		}
+		maskPtr, maxNode = unsafe.Pointer(&mask[0]), maxNUMANodes+1
+	}
+	aligned := pageAligned(mmap)
+	_, _, err := syscall.Syscall6(syscall.SYS_MBIND, aligned.addr(), uintptr(len(aligned)), uintptr(policy), uintptr(maskPtr), maxNode, flags)
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+// BindNUMA sets the NUMA memory policy of the pages covering mmap, so that
+// they are allocated from the given nodes according to policy. Pages already
+// allocated elsewhere are moved when possible; pages also mapped by other
+// processes are left where they are. MPOL_DEFAULT and MPOL_LOCAL take no
+// nodes.
+//
+// BindNUMA is only available on Linux, and fails with ENOSYS on kernels built
+// without NUMA support.
+func (mmap MMap) BindNUMA(nodes []int, policy MemPolicy) error {
+	return mbind(mmap, policy, nodes, _MPOL_MF_MOVE)
+}
+
+// NUMAPolicy returns the NUMA memory policy in effect for the first page of
+// mmap, along with the nodes it applies to.
+func (mmap MMap) NUMAPolicy() (MemPolicy, []int, error) {
+	if len(mmap) == 0 {
+		return 0, nil, ErrOutOfBounds
+	}
+	var policy int32
+	mask := make([]uint64, maxNUMANodes/64)
+	_, _, err := syscall.Syscall6(syscall.SYS_GET_MEMPOLICY, uintptr(unsafe.Pointer(&policy)), uintptr(unsafe.Pointer(&mask[0])), maxNUMANodes+1, pageAligned(mmap).addr(), _MPOL_F_ADDR, 0)
+	if err != 0 {
+		return 0, nil, err
+	}
+	var nodes []int
+	for n := 0; n < maxNUMANodes; n++ {
+		if mask[n/64]&(1<<(n%64)) != 0 {
+			nodes = append(nodes, n)
+		}
+	}
+	return MemPolicy(policy), nodes, nil
+}
+
+// The MigrationReport type summarizes the outcome of MigratePages.
+type MigrationReport struct {
+	// Pages is the number of pages in the range, Moved how many of them
+	// were moved to the target node and AlreadyThere how many needed no
+	// move.
+	Pages        int
+	Moved        int
+	AlreadyThere int
+	// NotPresent counts pages that aren't in memory, which have nothing to
+	// move, and Failed those the kernel refused to move, for instance
+	// because they are busy or mapped by other processes.
+	NotPresent int
+	Failed     int
+}
+
+// migrateBatch is the number of pages handed to move_pages at once.
+const migrateBatch = 1024
+
+// movePages calls move_pages for the given addresses. If nodes is nil, it
+// only reports the node of each page in status.
+func movePages(addrs []uintptr, nodes, status []int32) error {
+	var nodesPtr unsafe.Pointer
+	if nodes != nil {
+		nodesPtr = unsafe.Pointer(&nodes[0])
+	}
+	_, _, err := syscall.Syscall6(syscall.SYS_MOVE_PAGES, 0, uintptr(len(addrs)), uintptr(unsafe.Pointer(&addrs[0])), uintptr(nodesPtr), uintptr(unsafe.Pointer(&status[0])), _MPOL_MF_MOVE)
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+// MigratePages moves the resident pages of mmap covering the length bytes
+// starting at offset to the NUMA node target, and reports what happened to
+// them. Pages are only moved if they belong to this process alone.
+//
+// MigratePages is only available on Linux.
+func (mmap MMap) MigratePages(offset, length, target int) (MigrationReport, error) {
+	var report MigrationReport
+	if offset < 0 || length < 0 || offset+length > len(mmap) {
+		return report, ErrOutOfBounds
+	}
+	if length == 0 {
+		return report, nil
+	}
+	aligned := pageAligned(mmap[offset : offset+length])
+	pageSize := uintptr(os.Getpagesize())
+	pages := int((uintptr(len(aligned)) + pageSize - 1) / pageSize)
+	report.Pages = pages
+
+	addrs := make([]uintptr, 0, migrateBatch)
+	nodes := make([]int32, migrateBatch)
+	status := make([]int32, migrateBatch)
+	for i := range nodes {
+		nodes[i] = int32(target)
+	}
+	for first := 0; first < pages; first += migrateBatch {
+		n := pages - first
+		if n > migrateBatch {
+			n = migrateBatch
+		}
+		// Find where the pages are first, so that only those elsewhere
+		// are handed to the kernel for moving.
+		addrs = addrs[:0]
+		for i := 0; i < n; i++ {
+			addrs = append(addrs, aligned.addr()+uintptr(first+i)*pageSize)
+		}
+		if err := movePages(addrs, nil, status[:n]); err != nil {
+			return report, err
+		}
+		move := addrs[:0]
+		for i := 0; i < n; i++ {
+			switch s := status[i]; {
+			case s == int32(target):
+				report.AlreadyThere++
+			case s == -int32(syscall.ENOENT) || s == -int32(syscall.EFAULT):
+				report.NotPresent++
+			default:
+				move = append(move, addrs[i])
+			}
+		}
+		if len(move) == 0 {
+			continue
+		}
+		if err := movePages(move, nodes[:len(move)], status[:len(move)]); err != nil {
+			return report, err
+		}
+		for _, s := range status[:len(move)] {
+			if s == int32(target) {
+				report.Moved++
+			} else {
+				report.Failed++
+			}
+		}
+	}
+	return report, nil
+}
+
+// WithInterleave returns an option spreading the pages of a new mapping
+// evenly across the given NUMA nodes, page by page, instead of allocating
+// them on the node of the thread touching them first. It is intended for
+// large anonymous or shared memory caches used from every node.
+//
+// WithInterleave is only available on Linux.
+func WithInterleave(nodes []int) MapOption {
+	return func(mmap MMap) error {
+		return mbind(mmap, MPOL_INTERLEAVE, nodes, 0)
+	}
+}
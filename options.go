@@ -0,0 +1,99 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// The MapOptions type describes a mapping created by MapWith. Its zero value
+// maps a whole file read-only, so new fields can be added over time without
+// changing the meaning of existing code.
+type MapOptions struct {
+	// Mode is how the mapping may be accessed. It is ignored when Flags is
+	// set, in which case Prot and Flags are used as they are.
+	Mode  Mode
+	Prot  ProtFlags
+	Flags MapFlags
+	// Offset is where the mapping starts in the file, and must be a
+	// multiple of the page size.
+	Offset int64
+	// Length is how many bytes to map. Zero maps up to the end of the file.
+	Length int64
+	// Addr is a hint of where the mapping should be placed.
+	Addr uintptr
+	// Populate pages the whole mapping in before it is returned.
+	Populate bool
+	// HugePages backs the mapping with huge pages taken from the pool
+	// reserved by the system administrator. If none is available, or the
+	// file can't be mapped with them, normal pages are used instead,
+	// advised to be merged into transparent huge pages where the system
+	// supports them. MMap.Backing tells which kind was obtained.
+	HugePages bool
+	// NoReserve maps with MAP_NORESERVE, so no swap space is set aside for
+	// a private or anonymous mapping. See MapSparse.
+	NoReserve bool
+	// Locked locks the pages of the mapping in memory as they are paged in
+	// by the kernel while the mapping is created, with MAP_LOCKED, so no
+	// page can be swapped out between the mapping and a later Lock call.
+	// Where MAP_LOCKED isn't available, or options are given, the mapping
+	// is locked right after it is created instead.
+	Locked bool
+	// Options adjust the mapping once it is created. See MapAnonymous.
+	Options []MapOption
+}
+
+// MapWith maps the file or device at fd as described by o.
+func MapWith(fd uintptr, o MapOptions) (MMap, error) {
+	prot, flags := o.Prot, o.Flags
+	if flags == 0 {
+		prot, flags = o.Mode.native()
+	}
+	if o.NoReserve {
+		flags |= MAP_NORESERVE
+	}
+	// Options must run before any page is touched, so the mapping can only
+	// be populated by the kernel as it is created if there are none.
+	populated := o.Populate && mapPopulate != 0 && len(o.Options) == 0
+	if populated {
+		flags |= mapPopulate
+	}
+	if o.Locked && mapLocked != 0 && len(o.Options) == 0 {
+		flags |= mapLocked
+	}
+	length := o.Length
+	if length == 0 {
+		length = -1
+	}
+	var mmap MMap
+	var err error
+	if o.HugePages && mapHugeTLB != 0 {
+		mmap, err = MapAt(o.Addr, fd, o.Offset, length, prot, flags|mapHugeTLB)
+		if err != nil && !hugeFallback(err) {
+			return nil, err
+		}
+	}
+	if mmap == nil {
+		if mmap, err = MapAt(o.Addr, fd, o.Offset, length, prot, flags); err != nil {
+			return nil, err
+		}
+		if o.HugePages {
+			adviseHuge(mmap)
+		}
+	}
+	for _, opt := range o.Options {
+		if err := opt(mmap); err != nil {
+			mmap.UnsafeUnmap()
+			return nil, err
+		}
+	}
+	// MAP_LOCKED doesn't fail when the pages can't be locked, so lock them
+	// again, which is cheap once they are, to report the error.
+	if o.Locked {
+		if err := mmap.Lock(); err != nil {
+			mmap.UnsafeUnmap()
+			return nil, err
+		}
+	}
+	if o.Populate && !populated {
+		mmap.Prefault()
+	}
+	return mmap, nil
+}
@@ -0,0 +1,7 @@
+package gommap
+
+const (
+	mapPopulate = MAP_POPULATE
+	mapHugeTLB  = MAP_HUGETLB
+	mapLocked   = MAP_LOCKED
+)
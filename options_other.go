@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// MAP_POPULATE, MAP_HUGETLB and MAP_LOCKED are Linux extensions. Without
+// them mappings are populated by touching their pages, huge pages aren't
+// available, and mappings are locked once created.
+const (
+	mapPopulate MapFlags = 0
+	mapHugeTLB  MapFlags = 0
+	mapLocked   MapFlags = 0
+)
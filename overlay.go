@@ -0,0 +1,231 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// Layout of the header at the start of an overlay delta file. The header is
+// followed by the bitmap of modified pages, and the pages themselves start
+// at the next page boundary.
+const (
+	overlayMagic     = 0x564f4d47 // "GMOV"
+	overlayMagicOff  = 0
+	overlaySizeOff   = 8
+	overlayHeaderLen = 16
+)
+
+// The Overlay type is a writable branch of a read-only base file. Writes
+// made through WriteAt never reach the base: the pages they touch are first
+// copied into a sparse delta file, and that copy is mapped over the base in
+// memory, so the mapping shows the base with the changes applied. The delta
+// file remembers which pages it holds, so the branch persists across
+// restarts, and its disk usage only grows with the pages modified.
+//
+// Opening several deltas over the same base gives cheap, independent
+// branches of a large immutable dataset.
+//
+// An Overlay is not safe for concurrent use.
+type Overlay struct {
+	base     *os.File
+	delta    *os.File
+	mmap     MMap
+	meta     MMap
+	modified *Bitset
+	dataOff  int64
+}
+
+// OpenOverlay opens the delta file at deltaPath over the base file at
+// basePath, creating the delta if it doesn't exist. It returns ErrCorrupt if
+// the delta wasn't created for a base of the same size.
+func OpenOverlay(basePath, deltaPath string) (*Overlay, error) {
+	base, err := os.Open(basePath)
+	if err != nil {
+		return nil, err
+	}
+	o, err := openOverlay(base, deltaPath)
+	if err != nil {
+		base.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+func openOverlay(base *os.File, deltaPath string) (*Overlay, error) {
+	fi, err := base.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 || int64(int(size)) != size {
+		return nil, ErrSize
+	}
+	pageSize := int64(os.Getpagesize())
+	pages := (size + pageSize - 1) / pageSize
+	dataOff := (overlayHeaderLen + (pages+7)/8 + pageSize - 1) / pageSize * pageSize
+
+	delta, err := os.OpenFile(deltaPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	o := &Overlay{base: base, delta: delta, dataOff: dataOff}
+	if err := o.init(size, pages); err != nil {
+		o.release()
+		return nil, err
+	}
+	return o, nil
+}
+
+// init maps the delta's metadata, creating it if the delta is empty, and
+// maps the base with the modified pages of the delta over it.
+func (o *Overlay) init(size, pages int64) error {
+	fi, err := o.delta.Stat()
+	if err != nil {
+		return err
+	}
+	created := fi.Size() == 0
+	if created {
+		if err := o.delta.Truncate(o.dataOff + pages*int64(os.Getpagesize())); err != nil {
+			return err
+		}
+	} else if fi.Size() < o.dataOff {
+		return ErrCorrupt
+	}
+	if o.meta, err = MapRegion(o.delta.Fd(), 0, o.dataOff, PROT_READ|PROT_WRITE, MAP_SHARED); err != nil {
+		return err
+	}
+	if created {
+		binary.LittleEndian.PutUint64(o.meta[overlaySizeOff:], uint64(size))
+		binary.LittleEndian.PutUint32(o.meta[overlayMagicOff:], overlayMagic)
+		if err := o.meta.Sync(MS_SYNC); err != nil {
+			return err
+		}
+	}
+	if binary.LittleEndian.Uint32(o.meta[overlayMagicOff:]) != overlayMagic ||
+		binary.LittleEndian.Uint64(o.meta[overlaySizeOff:]) != uint64(size) {
+		return ErrCorrupt
+	}
+	o.modified = NewBitset(o.meta[overlayHeaderLen : overlayHeaderLen+(pages+7)/8])
+	if o.mmap, err = MapRegion(o.base.Fd(), 0, size, PROT_READ, MAP_SHARED); err != nil {
+		return err
+	}
+	for i := uint64(0); i < uint64(pages); i++ {
+		if o.modified.Test(i) {
+			if err := o.mapPage(int(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mapPage maps the copy of page i held by the delta over the base.
+func (o *Overlay) mapPage(i int) error {
+	pageSize := os.Getpagesize()
+	addr := o.mmap.addr() + uintptr(i*pageSize)
+	_, err := MapAt(addr, o.delta.Fd(), o.dataOff+int64(i*pageSize), int64(pageSize), PROT_READ|PROT_WRITE, MAP_SHARED|MAP_FIXED)
+	return err
+}
+
+// Bytes returns the contents of the branch. The memory must only be read:
+// writing to pages that weren't modified through WriteAt crashes the
+// application.
+func (o *Overlay) Bytes() []byte {
+	return o.mmap
+}
+
+// Len returns the size of the branch, which is the size of its base.
+func (o *Overlay) Len() int {
+	return len(o.mmap)
+}
+
+// WriteAt writes p to the branch at off. The pages touched for the first
+// time are copied to the delta, and the delta is flushed before they are
+// recorded as modified, so a crash never leaves a recorded page without its
+// data. The data written by WriteAt itself is only durable after Sync.
+func (o *Overlay) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(o.mmap)) || int64(len(p)) > int64(len(o.mmap))-off {
+		return 0, ErrOutOfBounds
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	pageSize := int64(os.Getpagesize())
+	first, last := off/pageSize, (off+int64(len(p))-1)/pageSize
+	var fresh []int
+	for i := first; i <= last; i++ {
+		if o.modified.Test(uint64(i)) {
+			continue
+		}
+		end := (i + 1) * pageSize
+		if end > int64(len(o.mmap)) {
+			end = int64(len(o.mmap))
+		}
+		if _, err := o.delta.WriteAt(o.mmap[i*pageSize:end], o.dataOff+i*pageSize); err != nil {
+			return 0, err
+		}
+		fresh = append(fresh, int(i))
+	}
+	if len(fresh) > 0 {
+		if err := o.delta.Sync(); err != nil {
+			return 0, err
+		}
+		for _, i := range fresh {
+			if err := o.mapPage(i); err != nil {
+				return 0, err
+			}
+			o.modified.Set(uint64(i))
+		}
+	}
+	return copy(o.mmap[off:], p), nil
+}
+
+// Modified reports whether the page holding the byte at off was modified.
+func (o *Overlay) Modified(off int64) bool {
+	return o.modified.Test(uint64(off / int64(os.Getpagesize())))
+}
+
+// ModifiedPages returns the number of pages held by the delta.
+func (o *Overlay) ModifiedPages() int {
+	return int(o.modified.Count())
+}
+
+// Sync flushes the modified pages and the record of which pages they are to
+// the delta file.
+func (o *Overlay) Sync() error {
+	if err := o.mmap.Sync(MS_SYNC); err != nil {
+		return err
+	}
+	return o.meta.Sync(MS_SYNC)
+}
+
+func (o *Overlay) release() error {
+	var err error
+	for _, m := range []MMap{o.mmap, o.meta} {
+		if m != nil {
+			if e := m.UnsafeUnmap(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	if e := o.delta.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Close flushes the branch, unmaps it and closes its files. The base is left
+// untouched.
+func (o *Overlay) Close() error {
+	err := o.Sync()
+	if e := o.release(); e != nil && err == nil {
+		err = e
+	}
+	if e := o.base.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
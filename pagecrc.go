@@ -0,0 +1,267 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+)
+
+// Layout of a page checksum file: a header followed by the CRC-32C of each
+// page of the data, as little-endian uint32 values.
+const (
+	pcMagic      = 0x43504d47 // "GMPC"
+	pcMagicOff   = 0
+	pcPageOff    = 4
+	pcPagesOff   = 8
+	pcHeaderSize = 16
+)
+
+// The PageChecksums type keeps a CRC-32C of every page of a mapping in a
+// sidecar file, to detect pages torn by a crash or damaged at rest. Checksums
+// are updated when the pages are synced, and checked lazily, the first time
+// each page is read through Bytes after the checksums were opened.
+//
+// Writes made straight to the mapping must be reported with MarkDirty so
+// that Sync updates their checksums. A PageChecksums is not safe for
+// concurrent use.
+type PageChecksums struct {
+	data MMap
+	file *os.File
+	sums MMap
+	// pageSize is the size of the regions checksummed, the page size
+	// unless opened with OpenRegionChecksums.
+	pageSize int
+	verified *Bitset
+	dirty    *Bitset
+}
+
+// OpenPageChecksums opens the checksum file at path for data, which must be
+// the mapping it was created for. If the file doesn't exist, it is created
+// with the checksums of the current content of data.
+func OpenPageChecksums(data MMap, path string) (*PageChecksums, error) {
+	return OpenRegionChecksums(data, path, os.Getpagesize())
+}
+
+// OpenRegionChecksums is like OpenPageChecksums, but keeps a checksum per
+// region of regionSize bytes instead of per page. Larger regions make the
+// checksum file smaller, at the cost of checksumming more data on Sync
+// for each region written to. The file must be opened with the region size
+// it was created with; the methods of PageChecksums then count regions
+// where they count pages.
+func OpenRegionChecksums(data MMap, path string, regionSize int) (*PageChecksums, error) {
+	if regionSize <= 0 || uint64(regionSize) > 1<<32-1 {
+		return nil, ErrSize
+	}
+	pageSize := regionSize
+	pages := (len(data) + pageSize - 1) / pageSize
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size := int64(pcHeaderSize + 4*pages)
+	if fi.Size() == 0 {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if fi.Size() != size {
+		file.Close()
+		return nil, ErrCorrupt
+	}
+	sums, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	p := &PageChecksums{
+		data:     data,
+		file:     file,
+		sums:     sums,
+		pageSize: pageSize,
+		verified: NewBitset(make(MMap, (pages+7)/8)),
+		dirty:    NewBitset(make(MMap, (pages+7)/8)),
+	}
+	if fi.Size() == 0 {
+		binary.LittleEndian.PutUint32(sums[pcPageOff:], uint32(pageSize))
+		binary.LittleEndian.PutUint64(sums[pcPagesOff:], uint64(pages))
+		for i := 0; i < pages; i++ {
+			p.dirty.Set(uint64(i))
+		}
+		binary.LittleEndian.PutUint32(sums[pcMagicOff:], pcMagic)
+		if err := p.Sync(MS_SYNC); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	if binary.LittleEndian.Uint32(sums[pcMagicOff:]) != pcMagic ||
+		binary.LittleEndian.Uint32(sums[pcPageOff:]) != uint32(pageSize) ||
+		binary.LittleEndian.Uint64(sums[pcPagesOff:]) != uint64(pages) {
+		p.Close()
+		return nil, ErrCorrupt
+	}
+	return p, nil
+}
+
+// Pages returns the number of pages covered by the checksums.
+func (p *PageChecksums) Pages() int {
+	return (len(p.sums) - pcHeaderSize) / 4
+}
+
+func (p *PageChecksums) page(i int) []byte {
+	end := (i + 1) * p.pageSize
+	if end > len(p.data) {
+		end = len(p.data)
+	}
+	return p.data[i*p.pageSize : end]
+}
+
+func (p *PageChecksums) sum(i int) []byte {
+	return p.sums[pcHeaderSize+4*i:]
+}
+
+// Verify checks page i against its checksum, and returns ErrCorrupt if it
+// doesn't match. Pages written since the last Sync are not checked.
+func (p *PageChecksums) Verify(i int) error {
+	if i < 0 || i >= p.Pages() {
+		return ErrOutOfBounds
+	}
+	if p.verified.Test(uint64(i)) || p.dirty.Test(uint64(i)) {
+		return nil
+	}
+	if crc32.Checksum(p.page(i), castagnoli) != binary.LittleEndian.Uint32(p.sum(i)) {
+		return ErrCorrupt
+	}
+	p.verified.Set(uint64(i))
+	return nil
+}
+
+// VerifyAll checks every page not verified yet, and returns the index of the
+// first one found corrupt along with ErrCorrupt.
+func (p *PageChecksums) VerifyAll() (int, error) {
+	data := pageAligned(p.data)
+	data.Advise(MADV_SEQUENTIAL)
+	defer data.Advise(MADV_NORMAL)
+	for i := 0; i < p.Pages(); i++ {
+		if err := p.Verify(i); err != nil {
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+// pages returns the range of pages covering n bytes of data at off.
+func (p *PageChecksums) pages(off, n int) (first, last int, err error) {
+	if n < 0 || !p.data.inBounds(off, n) {
+		return 0, 0, ErrOutOfBounds
+	}
+	if n == 0 {
+		return 0, -1, nil
+	}
+	return off / p.pageSize, (off + n - 1) / p.pageSize, nil
+}
+
+// Bytes returns the n bytes of data at off, after checking the pages they
+// lie in. It returns ErrCorrupt if any of them doesn't match its checksum.
+func (p *PageChecksums) Bytes(off, n int) ([]byte, error) {
+	first, last, err := p.pages(off, n)
+	if err != nil {
+		return nil, err
+	}
+	for i := first; i <= last; i++ {
+		if err := p.Verify(i); err != nil {
+			return nil, err
+		}
+	}
+	return p.data[off : off+n], nil
+}
+
+// MarkDirty records that the n bytes of data at off were modified, so that
+// their checksums get updated on the next Sync.
+func (p *PageChecksums) MarkDirty(off, n int) error {
+	first, last, err := p.pages(off, n)
+	if err != nil {
+		return err
+	}
+	for i := first; i <= last; i++ {
+		p.dirty.Set(uint64(i))
+	}
+	return nil
+}
+
+// Sync updates the checksums of the pages marked dirty and flushes both the
+// data and the checksums. The data is flushed first, so that a crash in
+// between leaves the new pages with outdated checksums, which is reported
+// as corruption rather than going unnoticed.
+func (p *PageChecksums) Sync(flags SyncFlags) error {
+	if len(p.data) > 0 {
+		if err := pageAligned(p.data).Sync(flags); err != nil {
+			return err
+		}
+	}
+	for i, ok := p.dirty.NextSet(0); ok; i, ok = p.dirty.NextSet(i + 1) {
+		binary.LittleEndian.PutUint32(p.sum(int(i)), crc32.Checksum(p.page(int(i)), castagnoli))
+		p.dirty.Clear(i)
+		p.verified.Set(i)
+	}
+	return p.sums.Sync(flags)
+}
+
+// Close unmaps the checksums and closes their file. Checksums of pages
+// marked dirty since the last Sync are not updated.
+func (p *PageChecksums) Close() error {
+	if err := p.sums.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return p.file.Close()
+}
+
+// WithPageChecksums returns an option keeping the checksums of the mapping
+// in the sidecar file at path, as OpenRegionChecksums does, with a checksum
+// per region of regionSize bytes, or per page if regionSize is 0. Writes
+// made with Put are then tracked, and Sync recomputes the checksums of the
+// regions written to before flushing, so a long-lived file is covered for
+// the cost of checksumming what changed. Get returns ErrCorrupt for ranges
+// that don't match their checksums. Writes made through Bytes must be
+// reported with MarkDirty.
+//
+// The mapping can't be grown by Refresh or switched to another file by
+// SwapTo while its checksums are kept; both return ErrUnsupported.
+func WithPageChecksums(path string, regionSize int) MappingOption {
+	return func(m *Mapping) error {
+		if regionSize == 0 {
+			regionSize = os.Getpagesize()
+		}
+		sums, err := OpenRegionChecksums(m.mmap, path, regionSize)
+		if err != nil {
+			return err
+		}
+		m.sums = sums
+		m.release = append(m.release, sums.Close)
+		return nil
+	}
+}
+
+// MarkDirty records that the n bytes of the mapping at off were written
+// through Bytes, so that the next Sync updates their checksums. It does
+// nothing unless the mapping was created with WithPageChecksums.
+func (m *Mapping) MarkDirty(off, n int) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	if m.sums == nil {
+		return nil
+	}
+	m.sumsMu.Lock()
+	defer m.sumsMu.Unlock()
+	return m.sums.MarkDirty(off, n)
+}
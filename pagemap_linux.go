@@ -0,0 +1,112 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// Bits of the /proc/self/pagemap entries, see the kernel's
+// Documentation/admin-guide/mm/pagemap.rst.
+const (
+	pmPFNMask       = 1<<55 - 1
+	pmSwapTypeMask  = 1<<5 - 1
+	pmSoftDirty     = 1 << 55
+	pmExclusive     = 1 << 56
+	pmFileOrShared  = 1 << 61
+	pmSwapped       = 1 << 62
+	pmPresent       = 1 << 63
+	kpfHuge         = 1 << 17
+	kpfTransparent  = 1 << 22
+	pagemapEntryLen = 8
+)
+
+// The PageInfo type describes the state of one page of a mapping, as
+// reported by /proc/self/pagemap and, when readable, /proc/kpageflags.
+type PageInfo struct {
+	// Present is set if the page is in memory, and Swapped if it was
+	// swapped out. A page that is neither was never touched or was
+	// dropped from the page cache.
+	Present bool
+	Swapped bool
+	// FileBacked is set for pages of the page cache and shared anonymous
+	// pages.
+	FileBacked bool
+	// Exclusive is set if the page is mapped by this process only.
+	Exclusive bool
+	SoftDirty bool
+	// PFN is the page frame number of present pages. The kernel reports
+	// zero unless the process has CAP_SYS_ADMIN.
+	PFN uint64
+	// SwapType and SwapOffset locate swapped pages in swap.
+	SwapType   uint64
+	SwapOffset uint64
+	// KernelFlags holds the /proc/kpageflags entry of the page frame, and
+	// HasKernelFlags tells whether it could be read, which requires the
+	// frame number and read access to /proc/kpageflags.
+	KernelFlags    uint64
+	HasKernelFlags bool
+	// Huge is set if the page is part of a huge or transparent huge page.
+	// It can only be known when HasKernelFlags is set.
+	Huge bool
+}
+
+// PageFlags returns the state of the pages of mmap covering the length bytes
+// starting at offset, one entry per page. Reading the frame numbers and the
+// kernel page flags requires privileges; without them, only the
+// presence, swap and mapping bits are available.
+func (mmap MMap) PageFlags(offset, length int) ([]PageInfo, error) {
+	if offset < 0 || length < 0 || offset+length > len(mmap) {
+		return nil, ErrOutOfBounds
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	pageSize := uintptr(os.Getpagesize())
+	first := (mmap.addr() + uintptr(offset)) / pageSize
+	last := (mmap.addr() + uintptr(offset+length) - 1) / pageSize
+	n := int(last - first + 1)
+
+	f, err := os.Open("/proc/self/pagemap")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, n*pagemapEntryLen)
+	if _, err := f.ReadAt(buf, int64(first)*pagemapEntryLen); err != nil {
+		return nil, err
+	}
+
+	// kpageflags is only readable by root; its absence isn't an error.
+	kf, _ := os.Open("/proc/kpageflags")
+	if kf != nil {
+		defer kf.Close()
+	}
+	result := make([]PageInfo, n)
+	var flags [8]byte
+	for i := range result {
+		e := binary.LittleEndian.Uint64(buf[i*pagemapEntryLen:])
+		p := &result[i]
+		p.Present = e&pmPresent != 0
+		p.Swapped = e&pmSwapped != 0
+		p.FileBacked = e&pmFileOrShared != 0
+		p.Exclusive = e&pmExclusive != 0
+		p.SoftDirty = e&pmSoftDirty != 0
+		switch {
+		case p.Present:
+			p.PFN = e & pmPFNMask
+		case p.Swapped:
+			p.SwapType = e & pmSwapTypeMask
+			p.SwapOffset = (e & pmPFNMask) >> 5
+		}
+		if kf == nil || p.PFN == 0 {
+			continue
+		}
+		if _, err := kf.ReadAt(flags[:], int64(p.PFN)*8); err != nil {
+			continue
+		}
+		p.KernelFlags = binary.LittleEndian.Uint64(flags[:])
+		p.HasKernelFlags = true
+		p.Huge = p.KernelFlags&(kpfHuge|kpfTransparent) != 0
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package gommap
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OpenRemoteFd returns a duplicate of the file descriptor fd of the process
+// pid, obtained with pidfd_open and pidfd_getfd, so the file it refers to
+// can be inspected without the process handing it over. The caller needs
+// the permission to ptrace the process, and the duplicate is owned by the
+// returned file. It requires Linux 5.6 or later.
+func OpenRemoteFd(pid, fd int) (*os.File, error) {
+	pidfd, _, errno := syscall.Syscall(_SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	defer syscall.Close(int(pidfd))
+	local, _, errno := syscall.Syscall(_SYS_PIDFD_GETFD, pidfd, uintptr(fd), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	syscall.CloseOnExec(int(local))
+	return os.NewFile(local, fmt.Sprintf("/proc/%d/fd/%d", pid, fd)), nil
+}
+
+// MapRemoteFd maps length bytes starting at offset of the file open as fd
+// in the process pid, such as a memfd or a shared memory object, as
+// MapRegion does. The duplicated descriptor is closed once mapped, as the
+// mapping keeps the file alive on its own.
+func MapRemoteFd(pid, fd int, offset, length int64, prot ProtFlags, flags MapFlags) (MMap, error) {
+	file, err := OpenRemoteFd(pid, fd)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return MapRegion(file.Fd(), offset, length, prot, flags)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// The ProtectionKey type is a memory protection key, which tags pages so that
+// access to them can be switched on and off per thread without a system
+// call. Pages tagged with a key allocated by NewProtectionKey can't be read
+// or written by default; WithAccess grants access to the calling goroutine
+// for the duration of a function. This keeps secrets held in a mapping out of
+// reach of unrelated code, even if it runs in the same process.
+//
+// Protection keys are only supported on Linux for x86-64 processors having
+// them. Elsewhere, NewProtectionKey returns ErrUnsupported.
+type ProtectionKey int
@@ -0,0 +1,62 @@
+package gommap
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// Access rights of protection keys, from linux/mman.h.
+const (
+	_PKEY_DISABLE_ACCESS = 0x1
+	_PKEY_DISABLE_WRITE  = 0x2
+)
+
+func rdpkru() uint32
+func wrpkru(pkru uint32)
+
+// NewProtectionKey allocates a protection key, with access to the pages it
+// tags disabled on every thread. It returns ErrUnsupported when the
+// processor or kernel lacks support, and ENOSPC when every key is in use.
+func NewProtectionKey() (ProtectionKey, error) {
+	key, _, errno := syscall.Syscall(_SYS_PKEY_ALLOC, 0, _PKEY_DISABLE_ACCESS, 0)
+	if errno == syscall.EINVAL || errno == syscall.ENOSYS {
+		return 0, ErrUnsupported
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return ProtectionKey(key), nil
+}
+
+// Free releases the key. The pages it tags must be tagged with another key,
+// or unmapped, first.
+func (key ProtectionKey) Free() error {
+	_, _, errno := syscall.Syscall(_SYS_PKEY_FREE, uintptr(key), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ProtectKey changes the protection flags of the mapped region, as Protect
+// does, and tags its pages with key.
+func (mmap MMap) ProtectKey(prot ProtFlags, key ProtectionKey) error {
+	_, _, errno := syscall.Syscall6(_SYS_PKEY_MPROTECT, mmap.addr(), uintptr(len(mmap)), uintptr(prot), uintptr(key), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// WithAccess calls fn with the pages tagged with key accessible from the
+// calling goroutine only. The goroutine is locked to its thread while fn
+// runs, as access rights belong to threads, and rights are restored once fn
+// returns, even if it panics. Goroutines started by fn don't get access.
+func WithAccess(key ProtectionKey, fn func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	old := rdpkru()
+	wrpkru(old &^ (3 << (2 * uint(key))))
+	defer wrpkru(old)
+	fn()
+}
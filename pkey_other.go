@@ -0,0 +1,26 @@
+//go:build !windows && (!linux || !amd64)
+// +build !windows
+// +build !linux !amd64
+
+package gommap
+
+// NewProtectionKey returns ErrUnsupported, as protection keys are only
+// available on Linux for x86-64.
+func NewProtectionKey() (ProtectionKey, error) {
+	return 0, ErrUnsupported
+}
+
+// Free returns ErrUnsupported, as no key can be allocated.
+func (key ProtectionKey) Free() error {
+	return ErrUnsupported
+}
+
+// ProtectKey returns ErrUnsupported.
+func (mmap MMap) ProtectKey(prot ProtFlags, key ProtectionKey) error {
+	return ErrUnsupported
+}
+
+// WithAccess calls fn, as no page can be protected by a key.
+func WithAccess(key ProtectionKey, fn func()) {
+	fn()
+}
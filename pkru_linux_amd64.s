@@ -0,0 +1,18 @@
+#include "textflag.h"
+
+// func rdpkru() uint32
+TEXT ·rdpkru(SB),NOSPLIT,$0-4
+	XORL CX, CX
+	// RDPKRU
+	BYTE $0x0f; BYTE $0x01; BYTE $0xee
+	MOVL AX, ret+0(FP)
+	RET
+
+// func wrpkru(pkru uint32)
+TEXT ·wrpkru(SB),NOSPLIT,$0-4
+	MOVL pkru+0(FP), AX
+	XORL CX, CX
+	XORL DX, DX
+	// WRPKRU
+	BYTE $0x0f; BYTE $0x01; BYTE $0xef
+	RET
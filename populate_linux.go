@@ -0,0 +1,41 @@
+package gommap
+
+import "syscall"
+
+// PopulateRead prefaults every page of mmap for reading with
+// MADV_POPULATE_READ, in chunks, so that later reads take no page faults.
+// Unlike Prefault, it fails with EFAULT rather than raising SIGBUS when the
+// mapping runs past the end of its file, and unlike MAP_POPULATE it can be
+// done after the mapping is created, on part of it. On kernels older than
+// Linux 5.14 it falls back to Prefault.
+func (mmap MMap) PopulateRead() error {
+	err := mmap.populate(MADV_POPULATE_READ)
+	if err == syscall.EINVAL {
+		mmap.Prefault()
+		return nil
+	}
+	return err
+}
+
+// PopulateWrite prefaults every page of mmap for writing with
+// MADV_POPULATE_WRITE, in chunks, so that later writes take no page faults,
+// without changing the data: pages of private mappings are copied, and
+// those of shared file mappings are allocated in the file, as writing to
+// them would do. It returns ErrUnsupported on kernels older than Linux
+// 5.14, as touching the pages with writes would race with other writers.
+func (mmap MMap) PopulateWrite() error {
+	err := mmap.populate(MADV_POPULATE_WRITE)
+	if err == syscall.EINVAL {
+		return ErrUnsupported
+	}
+	return err
+}
+
+func (mmap MMap) populate(advice AdviseFlags) error {
+	if len(mmap) == 0 {
+		return nil
+	}
+	return mmap.inChunks(nil, func(chunk MMap) error {
+		return chunk.Advise(advice)
+	})
+}
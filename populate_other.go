@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// PopulateRead prefaults every page of mmap for reading. Only Linux has an
+// advice for it, so elsewhere the pages are touched as Prefault does.
+func (mmap MMap) PopulateRead() error {
+	mmap.Prefault()
+	return nil
+}
+
+// PopulateWrite returns ErrUnsupported, as prefaulting pages for writing
+// takes MADV_POPULATE_WRITE, which only Linux has.
+func (mmap MMap) PopulateWrite() error {
+	return ErrUnsupported
+}
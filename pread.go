@@ -0,0 +1,122 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "syscall"
+
+// The PreadMapper type is a Mapper for files that can't be memory mapped,
+// as happens on some network and FUSE file systems or in sandboxes
+// forbidding mmap. Regions are heap buffers filled with pread when created,
+// so they take as much memory as their length, and changes to MAP_SHARED
+// writable regions are written back with pwrite by Sync and Close. Unlike
+// with real mappings, changes made through one region are not visible
+// through other regions of the same file until written back and mapped
+// again, and changes made to the file by others are never seen.
+type PreadMapper struct{}
+
+// Map implements the Mapper interface. It returns ErrOutOfBounds if the
+// region doesn't fit in the file, as mapping past the end of a real file
+// would fault on access.
+func (PreadMapper) Map(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (Region, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &stat); err != nil {
+		return nil, err
+	}
+	if length == -1 {
+		length = stat.Size - offset
+	}
+	if offset < 0 || length < 0 || offset > stat.Size || length > stat.Size-offset {
+		return nil, ErrOutOfBounds
+	}
+	if uint64(length) > uint64(maxInt) {
+		return nil, ErrSize
+	}
+	r := &preadRegion{
+		fd:        fd,
+		offset:    offset,
+		data:      make([]byte, length),
+		writeBack: prot&PROT_WRITE != 0 && flags&MAP_SHARED != 0,
+	}
+	if err := preadFull(fd, r.data, offset); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type preadRegion struct {
+	fd        uintptr
+	offset    int64
+	data      []byte
+	writeBack bool
+	closed    bool
+}
+
+func (r *preadRegion) Bytes() []byte {
+	return r.data
+}
+
+// Sync writes the whole region back to the file, since changed pages
+// aren't tracked. MS_SYNC additionally waits for the file to reach
+// its device.
+func (r *preadRegion) Sync(flags SyncFlags) error {
+	if r.closed {
+		return ErrClosed
+	}
+	if !r.writeBack {
+		return nil
+	}
+	for p, off := r.data, r.offset; len(p) > 0; {
+		n, err := syscall.Pwrite(int(r.fd), p, off)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		p, off = p[n:], off+int64(n)
+	}
+	if flags&MS_SYNC != 0 {
+		return syscall.Fsync(int(r.fd))
+	}
+	return nil
+}
+
+func (r *preadRegion) Advise(advice AdviseFlags) error {
+	if r.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (r *preadRegion) Close() error {
+	if r.closed {
+		return ErrClosed
+	}
+	err := r.Sync(MS_ASYNC)
+	r.closed = true
+	r.data = nil
+	return err
+}
+
+// The FallbackMapper type is a Mapper creating real memory mappings, like
+// OSMapper, and falling back to PreadMapper for files the system refuses to
+// map, so programs degrade gracefully instead of failing to start.
+type FallbackMapper struct{}
+
+// Map implements the Mapper interface.
+func (FallbackMapper) Map(fd uintptr, offset, length int64, prot ProtFlags, flags MapFlags) (Region, error) {
+	r, err := OSMapper{}.Map(fd, offset, length, prot, flags)
+	if mmapUnavailable(err) {
+		return PreadMapper{}.Map(fd, offset, length, prot, flags)
+	}
+	return r, err
+}
+
+// mmapUnavailable reports whether mmap failing with err means the file
+// can't be mapped at all, rather than that the request was wrong: ENODEV is
+// returned by file systems without mmap support, and EPERM or ENOSYS by
+// sandboxes forbidding it.
+func mmapUnavailable(err error) bool {
+	return err == syscall.ENODEV || err == syscall.EPERM || err == syscall.ENOSYS
+}
@@ -0,0 +1,157 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// prefetchStep is how many bytes a Prefetcher pages in at once, between
+// checks of its rate and state.
+const prefetchStep = 1 << 20
+
+// The Prefetcher type warms up the page cache for ranges of mappings in the
+// background, at a bounded rate, so that warming up a cache after a restart
+// doesn't starve the I/O of the work being served meanwhile. The ranges are
+// walked in order, in steps of 1 MiB.
+type Prefetcher struct {
+	views    []View
+	rate     int64
+	populate bool
+	fetched  int64
+
+	mu     sync.Mutex
+	paused bool
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewPrefetcher starts prefetching the given views at up to bytesPerSecond
+// bytes per second, with no limit if it is not positive. If populate is
+// false, pages are requested with MADV_WILLNEED, which starts reading them
+// without waiting; otherwise each page is touched, so it is also mapped in
+// and later accesses don't even take a minor fault.
+func NewPrefetcher(bytesPerSecond int64, populate bool, views ...View) *Prefetcher {
+	p := &Prefetcher{
+		views:    views,
+		rate:     bytesPerSecond,
+		populate: populate,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *Prefetcher) run() {
+	defer close(p.done)
+	start, budget := time.Now(), int64(0)
+	for _, v := range p.views {
+		for off := 0; off < v.Len(); off += prefetchStep {
+			resumed, ok := p.waitResumed()
+			if !ok {
+				return
+			}
+			if resumed {
+				start, budget = time.Now(), 0
+			}
+			n := prefetchStep
+			if n > v.Len()-off {
+				n = v.Len() - off
+			}
+			step := v.View(off, n)
+			if p.populate {
+				MMap(step.Bytes()).Prefault()
+			} else {
+				step.Advise(MADV_WILLNEED)
+			}
+			atomic.AddInt64(&p.fetched, int64(n))
+			budget += int64(n)
+			if p.rate > 0 {
+				due := start.Add(time.Duration(budget * int64(time.Second) / p.rate))
+				if wait := time.Until(due); wait > 0 {
+					t := time.NewTimer(wait)
+					select {
+					case <-t.C:
+					case <-p.stop:
+						t.Stop()
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// waitResumed blocks while the prefetcher is paused. It reports whether it
+// had to wait, and false once the prefetcher is stopped.
+func (p *Prefetcher) waitResumed() (resumed, ok bool) {
+	for {
+		p.mu.Lock()
+		paused := p.paused
+		p.mu.Unlock()
+		if !paused {
+			select {
+			case <-p.stop:
+				return resumed, false
+			default:
+				return resumed, true
+			}
+		}
+		resumed = true
+		select {
+		case <-p.wake:
+		case <-p.stop:
+			return resumed, false
+		}
+	}
+}
+
+// Pause suspends prefetching once the current step is done, until Resume is
+// called.
+func (p *Prefetcher) Pause() {
+	p.mu.Lock()
+	p.paused = true
+	p.mu.Unlock()
+}
+
+// Resume restarts prefetching after Pause. The rate is measured afresh, so
+// the time spent paused doesn't allow a burst.
+func (p *Prefetcher) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Fetched returns how many bytes have been prefetched so far.
+func (p *Prefetcher) Fetched() int64 {
+	return atomic.LoadInt64(&p.fetched)
+}
+
+// Done returns a channel closed once every range has been prefetched, or
+// the prefetcher stopped.
+func (p *Prefetcher) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stop ends prefetching and waits for the current step to complete. The
+// views must stay mapped until Stop returns or Done is closed.
+func (p *Prefetcher) Stop() {
+	p.mu.Lock()
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
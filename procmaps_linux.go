@@ -0,0 +1,136 @@
+package gommap
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The vma type is an entry of /proc/self/maps or /proc/self/smaps, which
+// describes one of the virtual memory areas of the process.
+type vma struct {
+	start, end uintptr
+	perms      string
+	offset     int64
+	dev        string
+	inode      uint64
+	path       string
+	// fields holds the per-area counters of smaps, converted to bytes for
+	// those given in kB, and flags lists its VmFlags.
+	fields map[string]int64
+	flags  []string
+}
+
+// parseVMAHeader parses the line introducing an area, as found in both maps
+// and smaps.
+func parseVMAHeader(line string) (*vma, bool) {
+	f := strings.Fields(line)
+	if len(f) < 5 {
+		return nil, false
+	}
+	bounds := strings.SplitN(f[0], "-", 2)
+	if len(bounds) != 2 {
+		return nil, false
+	}
+	start, err1 := strconv.ParseUint(bounds[0], 16, 64)
+	end, err2 := strconv.ParseUint(bounds[1], 16, 64)
+	offset, err3 := strconv.ParseUint(f[2], 16, 64)
+	inode, err4 := strconv.ParseUint(f[4], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return nil, false
+	}
+	v := &vma{
+		start:  uintptr(start),
+		end:    uintptr(end),
+		perms:  f[1],
+		offset: int64(offset),
+		dev:    f[3],
+		inode:  inode,
+	}
+	if len(f) > 5 {
+		v.path = strings.Join(f[5:], " ")
+	}
+	return v, true
+}
+
+// scanVMAs calls fn for every area listed in the given proc file, until fn
+// returns false.
+func scanVMAs(name string, fn func(v *vma) bool) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var cur *vma
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		key, value, isField := strings.Cut(line, ":")
+		if isField && !strings.Contains(key, " ") {
+			if cur == nil {
+				continue
+			}
+			if key == "VmFlags" {
+				cur.flags = strings.Fields(value)
+				continue
+			}
+			f := strings.Fields(value)
+			if len(f) == 0 {
+				continue
+			}
+			n, err := strconv.ParseInt(f[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			if len(f) > 1 && f[1] == "kB" {
+				n *= 1024
+			}
+			cur.fields[key] = n
+			continue
+		}
+		v, ok := parseVMAHeader(line)
+		if !ok {
+			continue
+		}
+		if cur != nil && !fn(cur) {
+			return nil
+		}
+		v.fields = make(map[string]int64)
+		cur = v
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if cur != nil {
+		fn(cur)
+	}
+	return nil
+}
+
+// overlappingVMAs calls fn for every area of the process overlapping mmap,
+// as listed in the given proc file. It returns ErrNotMapped if there's none.
+func overlappingVMAs(name string, mmap MMap, fn func(v *vma)) error {
+	if len(mmap) == 0 {
+		return ErrNotMapped
+	}
+	start, end := mmap.addr(), mmap.addr()+uintptr(len(mmap))
+	found := false
+	err := scanVMAs(name, func(v *vma) bool {
+		if v.start >= end {
+			return false
+		}
+		if v.end > start {
+			found = true
+			fn(v)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotMapped
+	}
+	return nil
+}
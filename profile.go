@@ -0,0 +1,167 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// The RegionHeat type reports how much of a region of a mapping was found
+// resident by a Profiler.
+type RegionHeat struct {
+	Offset int
+	Length int
+	// Resident is the fraction of the region's pages that were resident,
+	// averaged over the samples taken, from 0 for a region never found in
+	// memory to 1 for one always fully resident.
+	Resident float64
+}
+
+// The Profiler type samples the residency of a mapping over time, region by
+// region, to tell the hot parts of a mapping, which stay in memory, from the
+// cold ones the kernel keeps evicting or never reads in. That shows where
+// MADV_WILLNEED or Lock would pay off, and what could be released.
+//
+// Residency is sampled with mincore, which is cheap and needs no privilege,
+// but only sees whether pages are in memory, not whether they were accessed
+// since the last sample.
+//
+// A Profiler is safe for concurrent use.
+type Profiler struct {
+	mmap       MMap
+	regionSize int
+
+	mu       sync.Mutex
+	resident []int64
+	samples  int
+	err      error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewProfiler returns a profiler splitting mmap into regions of regionSize
+// bytes, rounded up to a multiple of the page size, and sampling it every
+// interval until Stop is called. With a zero interval, samples are only
+// taken by calling Sample.
+func NewProfiler(mmap MMap, regionSize int, interval time.Duration) *Profiler {
+	pageSize := os.Getpagesize()
+	if regionSize < pageSize {
+		regionSize = pageSize
+	}
+	regionSize = (regionSize + pageSize - 1) &^ (pageSize - 1)
+	p := &Profiler{
+		mmap:       mmap,
+		regionSize: regionSize,
+		resident:   make([]int64, (len(pageAligned(mmap))+regionSize-1)/regionSize),
+	}
+	if interval > 0 {
+		p.stop, p.done = make(chan struct{}), make(chan struct{})
+		go p.run(interval)
+	}
+	return p
+}
+
+func (p *Profiler) run(interval time.Duration) {
+	defer close(p.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			if err := p.Sample(); err != nil {
+				p.mu.Lock()
+				p.err = err
+				p.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// Sample records the current residency of every region.
+func (p *Profiler) Sample() error {
+	pageSize := os.Getpagesize()
+	perRegion := p.regionSize / pageSize
+	counts := make([]int64, len(p.resident))
+	page := 0
+	err := p.mmap.scanResidency(0, func(offset int, vec []byte) bool {
+		for _, v := range vec {
+			if v&1 != 0 {
+				counts[page/perRegion]++
+			}
+			page++
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, n := range counts {
+		p.resident[i] += n
+	}
+	p.samples++
+	return nil
+}
+
+// Report returns the heat of every region over the samples taken since the
+// profiler was created or last reset, in order. The first and last regions
+// are clipped to the mapping.
+func (p *Profiler) Report() []RegionHeat {
+	pageSize := os.Getpagesize()
+	delta := len(pageAligned(p.mmap)) - len(p.mmap)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	report := make([]RegionHeat, len(p.resident))
+	for i := range report {
+		start, end := i*p.regionSize-delta, (i+1)*p.regionSize-delta
+		pages := p.regionSize / pageSize
+		if i == len(report)-1 {
+			pages = (len(p.mmap) + delta - i*p.regionSize + pageSize - 1) / pageSize
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > len(p.mmap) {
+			end = len(p.mmap)
+		}
+		report[i] = RegionHeat{Offset: start, Length: end - start}
+		if p.samples > 0 {
+			report[i].Resident = float64(p.resident[i]) / float64(p.samples*pages)
+		}
+	}
+	return report
+}
+
+// Reset discards the samples taken so far, starting a new period.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.resident {
+		p.resident[i] = 0
+	}
+	p.samples = 0
+}
+
+// Stop stops periodic sampling, and returns the error that interrupted it,
+// if any. The samples already taken can still be reported.
+func (p *Profiler) Stop() error {
+	if p.stop != nil {
+		select {
+		case <-p.stop:
+		default:
+			close(p.stop)
+		}
+		<-p.done
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
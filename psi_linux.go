@@ -0,0 +1,233 @@
+package gommap
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	psiMemoryPath = "/proc/pressure/memory"
+
+	_POLLIN  = 0x1
+	_POLLPRI = 0x2
+	_POLLERR = 0x8
+)
+
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// The PressureStats type holds the memory pressure of the system, as the
+// share of time, in percent, some or all tasks were stalled waiting for
+// memory over the last 10, 60 and 300 seconds, and the total stall time.
+type PressureStats struct {
+	Some, Full PressureAverages
+}
+
+// The PressureAverages type holds one line of /proc/pressure/memory.
+type PressureAverages struct {
+	Avg10, Avg60, Avg300 float64
+	Total                time.Duration
+}
+
+// ReadMemoryPressure returns the current memory pressure of the system, as
+// reported by the kernel's pressure stall information. It returns
+// ErrUnsupported if the kernel doesn't provide it.
+func ReadMemoryPressure() (PressureStats, error) {
+	var stats PressureStats
+	f, err := os.Open(psiMemoryPath)
+	if os.IsNotExist(err) {
+		return stats, ErrUnsupported
+	}
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 5 {
+			return stats, ErrCorrupt
+		}
+		var avg *PressureAverages
+		switch fields[0] {
+		case "some":
+			avg = &stats.Some
+		case "full":
+			avg = &stats.Full
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return stats, ErrCorrupt
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return stats, ErrCorrupt
+			}
+			switch key {
+			case "avg10":
+				avg.Avg10 = v
+			case "avg60":
+				avg.Avg60 = v
+			case "avg300":
+				avg.Avg300 = v
+			case "total":
+				avg.Total = time.Duration(v) * time.Microsecond
+			}
+		}
+	}
+	return stats, s.Err()
+}
+
+// The PressureTrigger type tells when a PressureMonitor fires: when tasks
+// were stalled waiting for memory for at least Stall over a Window. If Full
+// is set, only the time every task was stalled at once counts.
+//
+// Unprivileged processes may only use windows that are a multiple of two
+// seconds.
+type PressureTrigger struct {
+	Full   bool
+	Stall  time.Duration
+	Window time.Duration
+}
+
+// DefaultPressureTrigger fires when some task was stalled for 150ms over two
+// seconds.
+var DefaultPressureTrigger = PressureTrigger{Stall: 150 * time.Millisecond, Window: 2 * time.Second}
+
+// The PressureMonitor type runs handlers when the system, or the cgroup of
+// the process, comes under memory pressure, so that mappings can shed the
+// pages they can do without before the process is killed for lack of
+// memory. The kernel notifies the monitor at most once per window of its
+// trigger, as long as the pressure lasts.
+type PressureMonitor struct {
+	psi  *os.File
+	stop *Doorbell
+	done chan struct{}
+
+	mu       sync.Mutex
+	handlers map[int]func()
+	next     int
+	closed   bool
+}
+
+// NewPressureMonitor starts monitoring memory pressure with the given
+// trigger. It returns ErrUnsupported if the kernel doesn't provide pressure
+// stall information.
+func NewPressureMonitor(trigger PressureTrigger) (*PressureMonitor, error) {
+	psi, err := os.OpenFile(psiMemoryPath, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	kind := "some"
+	if trigger.Full {
+		kind = "full"
+	}
+	spec := fmt.Sprintf("%s %d %d\x00", kind, trigger.Stall.Microseconds(), trigger.Window.Microseconds())
+	if _, err := psi.Write([]byte(spec)); err != nil {
+		psi.Close()
+		return nil, err
+	}
+	stop, err := NewDoorbell()
+	if err != nil {
+		psi.Close()
+		return nil, err
+	}
+	p := &PressureMonitor{psi: psi, stop: stop, done: make(chan struct{}), handlers: make(map[int]func())}
+	go p.run()
+	return p, nil
+}
+
+func (p *PressureMonitor) run() {
+	defer close(p.done)
+	fds := []pollFd{
+		{fd: int32(p.psi.Fd()), events: _POLLPRI},
+		{fd: int32(p.stop.Fd()), events: _POLLIN},
+	}
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), 0, 0, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 || fds[1].revents != 0 || fds[0].revents&_POLLERR != 0 {
+			// POLLERR means the monitored cgroup went away.
+			return
+		}
+		if fds[0].revents&_POLLPRI != 0 {
+			p.fire()
+		}
+	}
+}
+
+// fire runs every handler, one after the other.
+func (p *PressureMonitor) fire() {
+	p.mu.Lock()
+	handlers := make([]func(), 0, len(p.handlers))
+	for _, fn := range p.handlers {
+		handlers = append(handlers, fn)
+	}
+	p.mu.Unlock()
+	for _, fn := range handlers {
+		fn()
+	}
+}
+
+// Handle registers fn to be called each time memory pressure is reported.
+// Handlers run one after the other on the goroutine of the monitor, so a
+// slow one delays the others. The returned function unregisters fn.
+func (p *PressureMonitor) Handle(fn func()) (remove func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.next
+	p.next++
+	p.handlers[id] = fn
+	return func() {
+		p.mu.Lock()
+		delete(p.handlers, id)
+		p.mu.Unlock()
+	}
+}
+
+// Relieve registers a handler shedding the pages of mmap under pressure:
+// its dirty pages are written back with MS_SYNC, so they can be reclaimed
+// like clean ones, and then all of them are reclaimed with MADV_PAGEOUT,
+// which keeps their contents, in the file or in swap. The returned function
+// unregisters the handler, and must be called before mmap is unmapped.
+func (p *PressureMonitor) Relieve(mmap MMap) (remove func()) {
+	return p.Handle(func() {
+		// Failures can't be reported from the monitor, and the next
+		// notification will try again.
+		mmap.Sync(MS_SYNC)
+		mmap.Advise(MADV_PAGEOUT)
+	})
+}
+
+// Close stops the monitor, waiting for the handlers running to return.
+func (p *PressureMonitor) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+	p.stop.Ring()
+	<-p.done
+	p.stop.Close()
+	return p.psi.Close()
+}
@@ -0,0 +1,19 @@
+package gommap
+
+import "syscall"
+
+const (
+	_FALLOC_FL_KEEP_SIZE  = 0x1
+	_FALLOC_FL_PUNCH_HOLE = 0x2
+)
+
+// punchHole deallocates length bytes of the file at fd starting at offset,
+// which then read as zeros, including through existing mappings. It returns
+// ErrUnsupported if the file system can't punch holes.
+func punchHole(fd uintptr, offset, length int64) error {
+	err := syscall.Fallocate(int(fd), _FALLOC_FL_PUNCH_HOLE|_FALLOC_FL_KEEP_SIZE, offset, length)
+	if err == syscall.EOPNOTSUPP {
+		return ErrUnsupported
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// punchHole reports that holes can't be punched into files.
+func punchHole(fd uintptr, offset, length int64) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// The Range type is a span of Len bytes starting at Off within a mapping.
+type Range struct {
+	Off, Len int
+}
+
+// AdviseRanges gives advice about many ranges of the mapping at once, as
+// an evictor dropping thousands of small cold regions does. On Linux the
+// ranges are passed to the kernel in batches with a single process_madvise
+// call on the process itself, and elsewhere, or when the kernel refuses the
+// advice for process_madvise, one madvise call is made per range. Ranges
+// must start on a page boundary. It stops at the first range the kernel
+// refuses, and returns ErrOutOfBounds, before advising anything, if a range
+// doesn't fit within the mapping.
+func (mmap MMap) AdviseRanges(ranges []Range, advice AdviseFlags) error {
+	for _, r := range ranges {
+		if r.Len < 0 || !mmap.inBounds(r.Off, r.Len) {
+			return ErrOutOfBounds
+		}
+	}
+	return adviseRanges(mmap, ranges, advice)
+}
+
+// adviseEach advises the ranges one at a time.
+func adviseEach(mmap MMap, ranges []Range, advice AdviseFlags) error {
+	for _, r := range ranges {
+		if r.Len == 0 {
+			continue
+		}
+		if err := mmap[r.Off : r.Off+r.Len].Advise(advice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package gommap
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// maxIovecs is the most iovecs the kernel accepts in one call, UIO_MAXIOV.
+const maxIovecs = 1024
+
+var selfPidfd struct {
+	once sync.Once
+	fd   int
+	err  error
+}
+
+// openSelfPidfd returns a pidfd referring to the process itself, opened
+// once and kept for the life of the process.
+func openSelfPidfd() (int, error) {
+	selfPidfd.once.Do(func() {
+		fd, _, errno := syscall.Syscall(_SYS_PIDFD_OPEN, uintptr(syscall.Getpid()), 0, 0)
+		if errno != 0 {
+			selfPidfd.err = errno
+			return
+		}
+		selfPidfd.fd = int(fd)
+	})
+	return selfPidfd.fd, selfPidfd.err
+}
+
+// rangeIovecs returns the iovecs describing ranges, whose Off fields are
+// addresses once base is added.
+func rangeIovecs(base uintptr, ranges []Range) []iovec {
+	iovs := make([]iovec, len(ranges))
+	for i, r := range ranges {
+		iovs[i] = iovec{base + uintptr(r.Off), uintptr(r.Len)}
+	}
+	return iovs
+}
+
+// processMadvise advises the ranges of iovs in the process referred to by
+// pidfd with process_madvise, up to maxIovecs at a time. The kernel stops at
+// the first range it fails to advise, and reports the bytes advised before
+// it, so a short count is followed by another call from that point, which
+// returns the error. On failure it returns the ranges not advised yet.
+func processMadvise(pidfd uintptr, iovs []iovec, advice AdviseFlags) ([]iovec, error) {
+	for len(iovs) > 0 {
+		batch := iovs
+		if len(batch) > maxIovecs {
+			batch = batch[:maxIovecs]
+		}
+		n, _, errno := syscall.Syscall6(_SYS_PROCESS_MADVISE, pidfd,
+			uintptr(unsafe.Pointer(&batch[0])), uintptr(len(batch)), uintptr(advice), 0, 0)
+		if errno != 0 {
+			return iovs, errno
+		}
+		for len(iovs) > 0 && n >= iovs[0].len {
+			n -= iovs[0].len
+			iovs = iovs[1:]
+		}
+		if n > 0 {
+			iovs[0].base += n
+			iovs[0].len -= n
+		}
+	}
+	return nil, nil
+}
+
+// adviseRanges advises the ranges with process_madvise. Before Linux 6.13,
+// process_madvise only accepted the advice that doesn't destroy data, such
+// as MADV_COLD, MADV_PAGEOUT and MADV_WILLNEED, so it falls back to one
+// madvise per range when the kernel refuses the advice, or has no
+// process_madvise at all. Falling back also tells which range failed.
+func adviseRanges(mmap MMap, ranges []Range, advice AdviseFlags) error {
+	pidfd, err := openSelfPidfd()
+	if err != nil {
+		return adviseEach(mmap, ranges, advice)
+	}
+	left, err := processMadvise(uintptr(pidfd), rangeIovecs(mmap.addr(), ranges), advice)
+	if err != nil {
+		return adviseEach(mmap, ranges[len(ranges)-len(left):], advice)
+	}
+	return nil
+}
+
+// AdviseProcess gives advice about ranges of the address space of the
+// process referred to by pidfd, as returned by pidfd_open, with Off being
+// an address in that process, as for RemoteReader. It lets a daemon
+// supervising cooperating workers make them give up memory, typically with
+// MADV_COLD or MADV_PAGEOUT, the only advice the kernel takes for another
+// process along with MADV_WILLNEED and MADV_COLLAPSE. The caller needs the
+// permission to ptrace the process and CAP_SYS_NICE. It requires Linux 5.10
+// or later, and returns the error of the first range the kernel refuses.
+func AdviseProcess(pidfd uintptr, ranges []Range, advice AdviseFlags) error {
+	for _, r := range ranges {
+		if r.Len < 0 {
+			return ErrSize
+		}
+	}
+	_, err := processMadvise(pidfd, rangeIovecs(0, ranges), advice)
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// adviseRanges advises the ranges one at a time, as there is no system call
+// batching them.
+func adviseRanges(mmap MMap, ranges []Range, advice AdviseFlags) error {
+	return adviseEach(mmap, ranges, advice)
+}
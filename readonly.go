@@ -0,0 +1,104 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// The ReadOnlyMMap type is a mapping that can only be read. Writing to a
+// mapping created with PROT_READ kills the program with SIGSEGV; a
+// ReadOnlyMMap holds its memory out of reach and only has methods reading
+// it, so such writes don't compile, and it can't be passed where an MMap,
+// or any []byte, is expected.
+type ReadOnlyMMap struct {
+	mmap MMap
+}
+
+// MapReadOnly maps the whole file at fd with PROT_READ, as Map does.
+func MapReadOnly(fd uintptr, flags MapFlags) (ReadOnlyMMap, error) {
+	mmap, err := Map(fd, PROT_READ, flags)
+	return ReadOnlyMMap{mmap}, err
+}
+
+// MapRegionReadOnly maps length bytes of the file at fd starting at offset
+// with PROT_READ, as MapRegion does.
+func MapRegionReadOnly(fd uintptr, offset, length int64, flags MapFlags) (ReadOnlyMMap, error) {
+	mmap, err := MapRegion(fd, offset, length, PROT_READ, flags)
+	return ReadOnlyMMap{mmap}, err
+}
+
+// ReadOnly returns mmap as a ReadOnlyMMap, for handing a writable mapping
+// to code that must only read it. Unmapping either unmaps both.
+func (mmap MMap) ReadOnly() ReadOnlyMMap {
+	return ReadOnlyMMap{mmap}
+}
+
+// Len returns the size of the mapping.
+func (m ReadOnlyMMap) Len() int {
+	return len(m.mmap)
+}
+
+// ByteAt returns the byte at off.
+func (m ReadOnlyMMap) ByteAt(off int) (byte, error) {
+	if !m.mmap.inBounds(off, 1) {
+		return 0, ErrOutOfBounds
+	}
+	return m.mmap[off], nil
+}
+
+// ReadAt copies the bytes of the mapping at off into p, implementing
+// io.ReaderAt.
+func (m ReadOnlyMMap) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrOutOfBounds
+	}
+	if off >= int64(len(m.mmap)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.mmap[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// StringAt returns the n bytes at off as a string, without copying them.
+// See MMap.StringAt.
+func (m ReadOnlyMMap) StringAt(off, n int) (string, error) {
+	return m.mmap.StringAt(off, n)
+}
+
+// CopyStringAt returns a copy of the n bytes at off as a string.
+func (m ReadOnlyMMap) CopyStringAt(off, n int) (string, error) {
+	return m.mmap.CopyStringAt(off, n)
+}
+
+// Uint16At decodes the uint16 stored at off using the given byte order.
+func (m ReadOnlyMMap) Uint16At(off int, order binary.ByteOrder) (uint16, error) {
+	return m.mmap.Uint16At(off, order)
+}
+
+// Uint32At decodes the uint32 stored at off using the given byte order.
+func (m ReadOnlyMMap) Uint32At(off int, order binary.ByteOrder) (uint32, error) {
+	return m.mmap.Uint32At(off, order)
+}
+
+// Uint64At decodes the uint64 stored at off using the given byte order.
+func (m ReadOnlyMMap) Uint64At(off int, order binary.ByteOrder) (uint64, error) {
+	return m.mmap.Uint64At(off, order)
+}
+
+// Lock locks the mapping in memory. See MMap.Lock.
+func (m ReadOnlyMMap) Lock() error {
+	return m.mmap.Lock()
+}
+
+// Unlock unlocks the mapping. See MMap.Unlock.
+func (m ReadOnlyMMap) Unlock() error {
+	return m.mmap.Unlock()
+}
+
+// UnsafeUnmap unmaps the mapping. See MMap.UnsafeUnmap.
+func (m ReadOnlyMMap) UnsafeUnmap() error {
+	return m.mmap.UnsafeUnmap()
+}
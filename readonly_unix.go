@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// Advise advises the kernel about how to handle the mapping. See
+// MMap.Advise.
+func (m ReadOnlyMMap) Advise(advice AdviseFlags) error {
+	return m.mmap.Advise(advice)
+}
+
+// IsResident tells which pages of the mapping are in memory. See
+// MMap.IsResident.
+func (m ReadOnlyMMap) IsResident() ([]bool, error) {
+	return m.mmap.IsResident()
+}
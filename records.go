@@ -0,0 +1,124 @@
+package gommap
+
+import "encoding/binary"
+
+// The RecordFormat type says how the length of each record is encoded by
+// the records an iterator walks.
+type RecordFormat uint
+
+const (
+	// PrefixUvarint records are prefixed with their length as a uvarint,
+	// as encoded by binary.PutUvarint.
+	PrefixUvarint RecordFormat = iota
+	// PrefixUint32 records are prefixed with their length as a
+	// little-endian 32-bit integer.
+	PrefixUint32
+)
+
+// The RecordIterator type walks length-prefixed records stored back to back
+// in a mapping, without copying them. Its usage mirrors bufio.Scanner:
+//
+//	it := mmap.Records(0, PrefixUvarint)
+//	for it.Next() {
+//		process(it.Bytes())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// A zero length ends the iteration, as files preallocated for records are
+// zero-filled past the last one. A length reaching past the end of the
+// mapping, left by a torn write or a corrupt file, stops the iteration with
+// ErrCorrupt.
+type RecordIterator struct {
+	mmap   MMap
+	format RecordFormat
+	pos    int
+	start  int
+	record []byte
+	err    error
+}
+
+// Records returns an iterator over the records of mmap starting at off,
+// whose lengths are encoded according to format.
+func (mmap MMap) Records(off int, format RecordFormat) *RecordIterator {
+	it := &RecordIterator{mmap: mmap, format: format, pos: off}
+	if off < 0 || off > len(mmap) {
+		it.err = ErrOutOfBounds
+	}
+	return it
+}
+
+// Next advances the iterator to the next record, which will then be
+// available through Bytes. It returns false at the end of the records or
+// once an error was found, which Err then returns.
+func (it *RecordIterator) Next() bool {
+	it.record = nil
+	if it.err != nil || it.pos >= len(it.mmap) {
+		return false
+	}
+	data := it.mmap[it.pos:]
+	var n uint64
+	var width int
+	switch it.format {
+	case PrefixUint32:
+		if len(data) < 4 {
+			// Too short for a prefix: only zero padding may be left.
+			if !allZero(data) {
+				it.err = ErrCorrupt
+			}
+			return false
+		}
+		n, width = uint64(binary.LittleEndian.Uint32(data)), 4
+	default:
+		n, width = binary.Uvarint(data)
+		if width <= 0 {
+			it.err = ErrCorrupt
+			return false
+		}
+	}
+	if n == 0 {
+		return false
+	}
+	if n > uint64(len(data)-width) {
+		it.err = ErrCorrupt
+		return false
+	}
+	it.start = it.pos + width
+	end := it.start + int(n)
+	it.record = it.mmap[it.start:end:end]
+	it.pos = end
+	return true
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Bytes returns the current record. The returned slice points straight into
+// the mapping and is only valid while the mapping is.
+func (it *RecordIterator) Bytes() []byte {
+	return it.record
+}
+
+// Offset returns the position of the current record's data within the
+// mapping, past its length prefix.
+func (it *RecordIterator) Offset() int {
+	return it.start
+}
+
+// End returns the position following the last record returned, where the
+// next one would be appended.
+func (it *RecordIterator) End() int {
+	return it.pos
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *RecordIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,135 @@
+package gommap
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The Reloader type maps a file and maps it again whenever the path is
+// replaced by another file, as done by tools updating configuration files,
+// dictionaries and the like atomically: writing a temporary file and then
+// renaming it over the old one. Writes made in place to the mapped file are
+// visible through the mapping anyway, and don't trigger a reload.
+type Reloader struct {
+	path  string
+	prot  ProtFlags
+	flags MapFlags
+	fn    func(mmap MMap)
+
+	mu   sync.Mutex
+	file *os.File
+	info os.FileInfo
+	mmap MMap
+	err  error
+
+	w    *dirWatcher
+	done chan struct{}
+}
+
+// WatchFile maps the file at path and starts watching its directory. Each
+// time path is found to refer to a different file, the new file is mapped
+// and fn is called with the fresh mapping, from a goroutine of the Reloader.
+// The previous mapping is unmapped once fn returns, so fn must make sure
+// nothing uses it anymore by then.
+//
+// Changes are detected with inotify on Linux, kqueue on BSD systems and
+// directory change notifications on Windows.
+func WatchFile(path string, prot ProtFlags, flags MapFlags, fn func(mmap MMap)) (*Reloader, error) {
+	r := &Reloader{path: path, prot: prot, flags: flags, fn: fn, done: make(chan struct{})}
+	if _, _, err := r.load(); err != nil {
+		return nil, err
+	}
+	w, err := newDirWatcher(filepath.Dir(path))
+	if err != nil {
+		r.mmap.UnsafeUnmap()
+		r.file.Close()
+		return nil, err
+	}
+	r.w = w
+	go r.watch()
+	return r, nil
+}
+
+// load maps the file at r.path unless it's the one already mapped. When it
+// maps a new file, it returns the mapping and file it replaced.
+func (r *Reloader) load() (MMap, *os.File, error) {
+	mode := os.O_RDONLY
+	if r.prot&PROT_WRITE != 0 && r.flags&MAP_PRIVATE == 0 {
+		mode = os.O_RDWR
+	}
+	file, err := os.OpenFile(r.path, mode, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	r.mu.Lock()
+	same := r.info != nil && os.SameFile(info, r.info)
+	r.mu.Unlock()
+	if same {
+		file.Close()
+		return nil, nil, nil
+	}
+	mmap, err := Map(file.Fd(), r.prot, r.flags)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	oldMMap, oldFile := r.mmap, r.file
+	r.file, r.info, r.mmap = file, info, mmap
+	return oldMMap, oldFile, nil
+}
+
+func (r *Reloader) watch() {
+	defer close(r.done)
+	defer r.w.release()
+	for r.w.wait() {
+		old, oldFile, err := r.load()
+		r.mu.Lock()
+		r.err = err
+		mmap := r.mmap
+		r.mu.Unlock()
+		if oldFile == nil {
+			continue
+		}
+		if r.fn != nil {
+			r.fn(mmap)
+		}
+		old.UnsafeUnmap()
+		oldFile.Close()
+	}
+}
+
+// MMap returns the current mapping.
+func (r *Reloader) MMap() MMap {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mmap
+}
+
+// Err returns the error the last reload attempt failed with, if any. After
+// a failure, the previous mapping is kept, and the reload is attempted again
+// on the next change.
+func (r *Reloader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close stops watching the file and unmaps the current mapping.
+func (r *Reloader) Close() error {
+	r.w.stop()
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.mmap.UnsafeUnmap()
+	r.file.Close()
+	r.mmap, r.file = nil, nil
+	return err
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestWatchFile(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "dict")
+	c.Assert(ioutil.WriteFile(path, []byte("first"), 0644), IsNil)
+
+	reloaded := make(chan string, 1)
+	r, err := WatchFile(path, PROT_READ, MAP_SHARED, func(mmap MMap) {
+		reloaded <- string(mmap)
+	})
+	c.Assert(err, IsNil)
+	defer r.Close()
+	c.Assert(string(r.MMap()), Equals, "first")
+
+	tmp := filepath.Join(dir, "dict.tmp")
+	c.Assert(ioutil.WriteFile(tmp, []byte("second"), 0644), IsNil)
+	c.Assert(os.Rename(tmp, path), IsNil)
+	select {
+	case data := <-reloaded:
+		c.Assert(data, Equals, "second")
+	case <-time.After(5 * time.Second):
+		c.Fatal("file replacement not detected")
+	}
+	c.Assert(string(r.MMap()), Equals, "second")
+	c.Assert(r.Err(), IsNil)
+}
@@ -0,0 +1,64 @@
+package gommap
+
+import "syscall"
+
+// RemapFlags selects how Remap may resize a mapping.
+type RemapFlags uint
+
+const (
+	// MREMAP_MAYMOVE lets the mapping move to another address when it
+	// can't be resized where it is.
+	MREMAP_MAYMOVE RemapFlags = 0x1
+	// MREMAP_FIXED moves the mapping to a given address, replacing what's
+	// mapped there. It requires MREMAP_MAYMOVE.
+	MREMAP_FIXED RemapFlags = 0x2
+)
+
+// Remap grows or shrinks the mapping to length bytes using mremap. Unless
+// MREMAP_MAYMOVE is set, the mapping must be resized where it is, which fails
+// if the address space following it is not free. When the mapping moves, the
+// old slice and any slices taken from it must no longer be used.
+//
+// Remap is only available on Linux.
+func (mmap MMap) Remap(length int, flags RemapFlags) (MMap, error) {
+	addr, _, err := syscall.Syscall6(syscall.SYS_MREMAP, mmap.addr(), uintptr(len(mmap)), uintptr(length), uintptr(flags), 0, 0)
+	if err != 0 {
+		return nil, err
+	}
+	m := sliceAt(addr, length)
+	debugRemapped(mmap, m)
+	metricsRemapped(mmap, m)
+	return m, nil
+}
+
+// resizeMapping grows or shrinks the mapping of fd at offset in place if
+// possible, moving it otherwise. The old region is left untouched on failure.
+func resizeMapping(mmap MMap, fd uintptr, offset int64, length int, prot ProtFlags, flags MapFlags) (MMap, error) {
+	return mmap.Remap(length, MREMAP_MAYMOVE)
+}
+
+// AliasAt maps the pages of mmap a second time, so that the same memory is
+// visible at two ranges of addresses, and returns the new range. Writes
+// through either range are seen through the other. The alias is placed at
+// addr, replacing anything mapped there, or wherever the kernel sees fit if
+// addr is zero. It only works on shared mappings, including anonymous ones
+// created with MAP_SHARED, and must be unmapped on its own.
+//
+// AliasAt is only available on Linux. MapMirror builds the same kind of
+// double mapping portably for new memory.
+func (mmap MMap) AliasAt(addr uintptr) (MMap, error) {
+	flags := MREMAP_MAYMOVE
+	if addr != 0 {
+		flags |= MREMAP_FIXED
+	}
+	// With an old size of zero, mremap leaves the old mapping in place and
+	// creates a new one of the same pages.
+	alias, _, err := syscall.Syscall6(syscall.SYS_MREMAP, mmap.addr(), 0, uintptr(len(mmap)), uintptr(flags), addr, 0)
+	if err != 0 {
+		return nil, err
+	}
+	m := sliceAt(alias, len(mmap))
+	debugMapped(m)
+	metricsMapped(m)
+	return m, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// resizeMapping replaces the mapping of fd at offset with one of the given
+// length. Without mremap, this means mapping the file again and unmapping the
+// old region, which is left untouched if the new mapping fails.
+func resizeMapping(mmap MMap, fd uintptr, offset int64, length int, prot ProtFlags, flags MapFlags) (MMap, error) {
+	resized, err := MapRegion(fd, offset, int64(length), prot, flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := mmap.UnsafeUnmap(); err != nil {
+		resized.UnsafeUnmap()
+		return nil, err
+	}
+	return resized, nil
+}
@@ -0,0 +1,229 @@
+package gommap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The RemoteReader type reads the memory of another process, as debuggers
+// and forensics tools do. Reads go through process_vm_readv, which copies
+// straight between the address spaces, and fall back to reading
+// /proc/<pid>/mem when the system call isn't available. Either way, the
+// caller needs the permission to ptrace the process.
+//
+// A RemoteReader implements io.ReaderAt, with offsets being addresses in the
+// remote process. It is safe for concurrent use.
+type RemoteReader struct {
+	pid int
+
+	mu  sync.Mutex
+	mem *os.File
+	// noVM is set once process_vm_readv has been found unavailable.
+	noVM bool
+}
+
+// NewRemoteReader returns a reader over the memory of the process pid.
+func NewRemoteReader(pid int) *RemoteReader {
+	return &RemoteReader{pid: pid}
+}
+
+// NewRemoteReaderPidfd returns a reader over the memory of the process
+// referred to by pidfd, as returned by pidfd_open.
+func NewRemoteReaderPidfd(pidfd uintptr) (*RemoteReader, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/self/fdinfo/%d", pidfd))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := sc.Text(); strings.HasPrefix(line, "Pid:") {
+			pid, err := strconv.Atoi(strings.TrimSpace(line[len("Pid:"):]))
+			if err != nil || pid <= 0 {
+				// The process is gone.
+				return nil, syscall.ESRCH
+			}
+			return NewRemoteReader(pid), nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, syscall.EBADF
+}
+
+// Pid returns the process the reader reads from.
+func (r *RemoteReader) Pid() int {
+	return r.pid
+}
+
+// ReadAt reads len(p) bytes of the remote process memory starting at
+// address addr into p, which may itself be a mapping. It returns io.EOF
+// when the range runs into memory the process hasn't mapped.
+func (r *RemoteReader) ReadAt(p []byte, addr int64) (int, error) {
+	if addr < 0 {
+		return 0, ErrOutOfBounds
+	}
+	r.mu.Lock()
+	noVM := r.noVM
+	r.mu.Unlock()
+	if !noVM {
+		n, err := processVM(_SYS_PROCESS_VM_READV, r.pid, p, addr)
+		if err != syscall.ENOSYS {
+			return n, err
+		}
+		r.mu.Lock()
+		r.noVM = true
+		r.mu.Unlock()
+	}
+	mem, err := r.memFile()
+	if err != nil {
+		return 0, err
+	}
+	n, err := mem.ReadAt(p, addr)
+	if n < len(p) && err != nil {
+		if perr, ok := err.(*os.PathError); ok && perr.Err == syscall.EIO {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+// iovec is struct iovec, with the address held as an integer as it may
+// belong to another process.
+type iovec struct {
+	base, len uintptr
+}
+
+// processVM copies between p and the memory of the process pid at addr
+// with the process_vm_readv or process_vm_writev system call trap. It
+// returns io.EOF when the remote range runs into unmapped memory.
+func processVM(trap uintptr, pid int, p []byte, addr int64) (int, error) {
+	done := 0
+	for done < len(p) {
+		local := iovec{uintptr(unsafe.Pointer(&p[done])), uintptr(len(p) - done)}
+		remote := iovec{uintptr(addr) + uintptr(done), uintptr(len(p) - done)}
+		n, _, errno := syscall.Syscall6(trap, uintptr(pid),
+			uintptr(unsafe.Pointer(&local)), 1, uintptr(unsafe.Pointer(&remote)), 1, 0)
+		if errno == syscall.EFAULT || errno == 0 && n == 0 {
+			return done, io.EOF
+		}
+		if errno != 0 {
+			return done, errno
+		}
+		done += int(n)
+	}
+	return done, nil
+}
+
+func (r *RemoteReader) memFile() (*os.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mem == nil {
+		mem, err := os.Open(fmt.Sprintf("/proc/%d/mem", r.pid))
+		if err != nil {
+			return nil, err
+		}
+		r.mem = mem
+	}
+	return r.mem, nil
+}
+
+// Close releases the resources held by the reader.
+func (r *RemoteReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mem == nil {
+		return nil
+	}
+	err := r.mem.Close()
+	r.mem = nil
+	return err
+}
+
+// The RemoteWriter type copies data into a range of the memory of another
+// process, as checkpoint/restore tools do, using process_vm_writev and
+// falling back to writing /proc/<pid>/mem. Writes are confined to the range
+// given when the writer was created, so a bad address can't corrupt
+// unrelated memory of the remote process.
+//
+// A RemoteWriter implements io.WriterAt, with offsets being addresses in
+// the remote process. It is safe for concurrent use.
+type RemoteWriter struct {
+	pid          int
+	start, limit int64
+
+	mu   sync.Mutex
+	mem  *os.File
+	noVM bool
+}
+
+// NewRemoteWriter returns a writer to the length bytes of the memory of the
+// process pid starting at address addr.
+func NewRemoteWriter(pid int, addr, length int64) (*RemoteWriter, error) {
+	if addr < 0 || length < 0 || addr+length < addr {
+		return nil, ErrOutOfBounds
+	}
+	return &RemoteWriter{pid: pid, start: addr, limit: addr + length}, nil
+}
+
+// WriteAt copies p to the remote process memory at address addr, which must
+// lie with p in the range of the writer. p may itself be a mapping, such as
+// one holding a checkpoint, in which case its pages are read straight into
+// the remote process without an intermediate copy. It returns io.EOF when
+// the range runs into memory the process hasn't mapped, or, with
+// process_vm_writev, memory it didn't map writable.
+func (w *RemoteWriter) WriteAt(p []byte, addr int64) (int, error) {
+	if addr < w.start || int64(len(p)) > w.limit-addr {
+		return 0, ErrOutOfBounds
+	}
+	w.mu.Lock()
+	noVM := w.noVM
+	w.mu.Unlock()
+	if !noVM {
+		n, err := processVM(_SYS_PROCESS_VM_WRITEV, w.pid, p, addr)
+		if err != syscall.ENOSYS {
+			return n, err
+		}
+		w.mu.Lock()
+		w.noVM = true
+		w.mu.Unlock()
+	}
+	w.mu.Lock()
+	if w.mem == nil {
+		mem, err := os.OpenFile(fmt.Sprintf("/proc/%d/mem", w.pid), os.O_WRONLY, 0)
+		if err != nil {
+			w.mu.Unlock()
+			return 0, err
+		}
+		w.mem = mem
+	}
+	mem := w.mem
+	w.mu.Unlock()
+	n, err := mem.WriteAt(p, addr)
+	if n < len(p) && err != nil {
+		if perr, ok := err.(*os.PathError); ok && perr.Err == syscall.EIO {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+// Close releases the resources held by the writer.
+func (w *RemoteWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.mem == nil {
+		return nil
+	}
+	err := w.mem.Close()
+	w.mem = nil
+	return err
+}
@@ -0,0 +1,31 @@
+package gommap
+
+import "os"
+
+// RemoveRange frees the pages lying entirely within the n bytes of mmap
+// starting at off, with MADV_REMOVE: unlike MADV_DONTNEED, which only drops
+// them from the mapping, this releases the backing memory of a shared
+// mapping of tmpfs, shmem or a memfd, as a hole punched in the file would,
+// so a consumed segment of a shared ring buffer stops taking memory. The
+// range reads back as zeros afterwards, in every mapping of the file. Pages
+// only partly covered by the range are left alone, so neighbouring data
+// survives. It returns the number of bytes freed.
+//
+// The mapping must be shared and writable; file systems that can't punch
+// holes fail with EOPNOTSUPP.
+func (mmap MMap) RemoveRange(off, n int) (int, error) {
+	if !mmap.inBounds(off, n) {
+		return 0, ErrOutOfBounds
+	}
+	pageSize := int64(os.Getpagesize())
+	base := int64(mmap.addr())
+	start := AlignUp(base+int64(off), pageSize) - base
+	end := AlignDown(base+int64(off+n), pageSize) - base
+	if start >= end {
+		return 0, nil
+	}
+	if err := mmap[start:end].Advise(MADV_REMOVE); err != nil {
+		return 0, err
+	}
+	return int(end - start), nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// RemoveRange returns ErrUnsupported, as MADV_REMOVE only exists on Linux.
+func (mmap MMap) RemoveRange(off, n int) (int, error) {
+	return 0, ErrUnsupported
+}
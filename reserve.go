@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+// MapSparse maps length bytes of private anonymous memory with
+// MAP_NORESERVE, for sparse data structures reserving far more address
+// space than they will ever touch, possibly terabytes of it. Only the pages
+// written to take memory.
+//
+// Without MAP_NORESERVE, such a mapping is charged in full against the
+// commit limit of the system, and fails with ENOMEM when the limit is
+// exceeded. With it, the charge is skipped, but then writing to a page
+// when memory and swap are exhausted gets the process killed instead of
+// failing the mapping. On Linux, the flag is ignored in strict overcommit
+// mode, where every mapping is charged; see OvercommitPolicy.
+func MapSparse(length int64, prot ProtFlags) (MMap, error) {
+	return MapAnonymous(length, prot, MAP_PRIVATE|MAP_NORESERVE)
+}
@@ -0,0 +1,23 @@
+package gommap
+
+// The OvercommitMode type is the policy of the kernel for granting memory
+// beyond what it can back, as set by the vm.overcommit_memory sysctl.
+type OvercommitMode int
+
+const (
+	// OvercommitHeuristic refuses mappings obviously too large to ever be
+	// backed, unless they are made with MAP_NORESERVE.
+	OvercommitHeuristic OvercommitMode = 0
+	// OvercommitAlways never refuses a mapping.
+	OvercommitAlways OvercommitMode = 1
+	// OvercommitNever charges every mapping against the commit limit,
+	// regardless of MAP_NORESERVE.
+	OvercommitNever OvercommitMode = 2
+)
+
+// OvercommitPolicy returns the overcommit mode of the kernel, telling
+// whether MapSparse can reserve more memory than the system has.
+func OvercommitPolicy() (OvercommitMode, error) {
+	n, err := readSysInt("/proc/sys/vm/overcommit_memory")
+	return OvercommitMode(n), err
+}
@@ -0,0 +1,174 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// DefaultResidencyWindow is the amount of address space queried per mincore
+// call by the chunked residency methods when no window is given. With 4 KiB
+// pages, it bounds the working buffer to 64 KiB.
+const DefaultResidencyWindow = 256 << 20
+
+// mincore fills vec with the residency of the pages starting at the page
+// aligned address addr.
+func mincore(addr uintptr, vec []byte) error {
+	length := uintptr(len(vec)) * uintptr(os.Getpagesize())
+	_, _, err := syscall.Syscall(syscall.SYS_MINCORE, addr, length, uintptr(unsafe.Pointer(&vec[0])))
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+// scanResidency queries the residency of mmap window bytes at a time,
+// calling fn with the offset within mmap of the first page of each window
+// and the raw residency vector of its pages. The first page may start
+// before mmap if mmap isn't page aligned, in which case its offset is
+// clipped to zero. Scanning stops early if fn returns false.
+func (mmap MMap) scanResidency(window int, fn func(offset int, vec []byte) bool) error {
+	if len(mmap) == 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = DefaultResidencyWindow
+	}
+	pageSize := os.Getpagesize()
+	base := pageAligned(mmap)
+	delta := len(base) - len(mmap)
+	pages := (len(base) + pageSize - 1) / pageSize
+	perWindow := (window + pageSize - 1) / pageSize
+	if perWindow > pages {
+		perWindow = pages
+	}
+	vec := make([]byte, perWindow)
+	for page := 0; page < pages; page += perWindow {
+		n := perWindow
+		if page+n > pages {
+			n = pages - page
+		}
+		if err := mincore(base.addr()+uintptr(page*pageSize), vec[:n]); err != nil {
+			return err
+		}
+		offset := page*pageSize - delta
+		if offset < 0 {
+			offset = 0
+		}
+		if !fn(offset, vec[:n]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// IsResidentChunked is like IsResident, but queries the kernel about window
+// bytes of mmap at a time rather than all of it at once, so that the memory
+// needed stays bounded even for huge mappings. For each window, fn is called
+// with the offset in mmap of the first page of the window and the residency
+// of its pages. The resident slice is reused between calls and must not be
+// retained. Iteration stops if fn returns false. A window of zero or less
+// selects DefaultResidencyWindow.
+func (mmap MMap) IsResidentChunked(window int, fn func(offset int, resident []bool) bool) error {
+	var resident []bool
+	return mmap.scanResidency(window, func(offset int, vec []byte) bool {
+		if cap(resident) < len(vec) {
+			resident = make([]bool, len(vec))
+		}
+		resident = resident[:len(vec)]
+		for i, v := range vec {
+			resident[i] = v&1 != 0
+		}
+		return fn(offset, resident)
+	})
+}
+
+// ResidentBytes returns how many bytes of mmap are resident in memory. Pages
+// only partially covered by mmap count for the part they overlap.
+func (mmap MMap) ResidentBytes() (int64, error) {
+	pageSize := os.Getpagesize()
+	delta := len(pageAligned(mmap)) - len(mmap)
+	var total int64
+	err := mmap.scanResidency(0, func(offset int, vec []byte) bool {
+		// Only the first window can start with a partial page.
+		start := offset
+		if offset == 0 {
+			start = -delta
+		}
+		for i, v := range vec {
+			if v&1 == 0 {
+				continue
+			}
+			lo, hi := start+i*pageSize, start+(i+1)*pageSize
+			if lo < 0 {
+				lo = 0
+			}
+			if hi > len(mmap) {
+				hi = len(mmap)
+			}
+			total += int64(hi - lo)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// ResidentRatio returns the fraction of mmap resident in memory, between 0
+// and 1. An empty mapping has a ratio of 0.
+func (mmap MMap) ResidentRatio() (float64, error) {
+	if len(mmap) == 0 {
+		return 0, nil
+	}
+	n, err := mmap.ResidentBytes()
+	if err != nil {
+		return 0, err
+	}
+	return float64(n) / float64(len(mmap)), nil
+}
+
+// ForEachResidentRun calls fn for each maximal run of consecutive pages of
+// mmap that are all resident, or all not resident, in order. Runs are given
+// as an offset and length within mmap, so the first and last ones are
+// clipped to mmap when it doesn't start or end on a page boundary. The
+// kernel is queried one window at a time, so memory use doesn't depend on
+// the size of mmap. Iteration stops if fn returns false.
+func (mmap MMap) ForEachResidentRun(fn func(offset, length int, resident bool) bool) error {
+	pageSize := os.Getpagesize()
+	delta := len(pageAligned(mmap)) - len(mmap)
+	runStart, runResident, started := 0, false, false
+	stopped := false
+	err := mmap.scanResidency(0, func(offset int, vec []byte) bool {
+		start := offset
+		if offset == 0 {
+			start = -delta
+		}
+		for i, v := range vec {
+			resident := v&1 != 0
+			if !started {
+				runResident, started = resident, true
+				continue
+			}
+			if resident == runResident {
+				continue
+			}
+			end := start + i*pageSize
+			if !fn(runStart, end-runStart, runResident) {
+				stopped = true
+				return false
+			}
+			runStart, runResident = end, resident
+		}
+		return true
+	})
+	if err != nil || stopped || !started {
+		return err
+	}
+	fn(runStart, len(mmap)-runStart, runResident)
+	return nil
+}
@@ -0,0 +1,256 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Layout of the header of a ring stored in a mapping. The producer and
+// consumer positions sit on their own cache lines to avoid false sharing.
+const (
+	ringMagic      = 0x474d5247 // "GRMG"
+	ringMagicOff   = 0
+	ringSlotOff    = 4
+	ringCapOff     = 8
+	ringNotEmpty   = 16
+	ringNotFull    = 24
+	ringTailOff    = 64
+	ringHeadOff    = 128
+	ringHeaderSize = 192
+
+	// Each slot starts with a 64-bit sequence number and a 32-bit length.
+	ringSlotHeader = 16
+)
+
+// The Ring type is a bounded queue of messages stored entirely inside a
+// mapping. When the mapping is MAP_SHARED, processes mapping the same file
+// exchange messages through it without system calls on the fast path, which
+// makes it a low-latency IPC channel between Go processes.
+//
+// Messages are copied into fixed-size slots, so each one can be at most the
+// slot size given at creation. The ring is safe for any number of producers
+// and consumers, in any number of processes.
+type Ring struct {
+	mmap     MMap
+	slotSize int
+	stride   int
+	mask     uint64
+	tail     *uint64
+	head     *uint64
+	notEmpty waitQueue
+	notFull  waitQueue
+	doorbell *Doorbell
+}
+
+// ringStride returns the distance between consecutive slots.
+func ringStride(slotSize int) int {
+	return ringSlotHeader + (slotSize+7)&^7
+}
+
+// RingSize returns the number of bytes needed to store a ring of capacity
+// slots of slotSize bytes each.
+func RingSize(capacity, slotSize int) int {
+	return ringHeaderSize + capacity*ringStride(slotSize)
+}
+
+// NewRing initializes an empty ring with room for capacity messages of up to
+// slotSize bytes each at the start of mmap, which must be 8-byte aligned and
+// at least RingSize(capacity, slotSize) bytes long. Capacity must be a power
+// of two.
+//
+// Only the process creating the ring calls NewRing; everyone else attaches
+// to it with OpenRing.
+func NewRing(mmap MMap, capacity, slotSize int) (*Ring, error) {
+	if capacity <= 0 || capacity&(capacity-1) != 0 || slotSize <= 0 || int64(slotSize) > 1<<31 {
+		return nil, ErrSize
+	}
+	if len(mmap) < RingSize(capacity, slotSize) {
+		return nil, ErrSize
+	}
+	if uintptr(unsafe.Pointer(&mmap[0]))%8 != 0 {
+		return nil, ErrUnaligned
+	}
+	for i := range mmap[:ringHeaderSize] {
+		mmap[i] = 0
+	}
+	binary.LittleEndian.PutUint32(mmap[ringSlotOff:], uint32(slotSize))
+	binary.LittleEndian.PutUint64(mmap[ringCapOff:], uint64(capacity))
+	r := newRing(mmap, capacity, slotSize)
+	for i := 0; i < capacity; i++ {
+		atomic.StoreUint64(r.seq(uint64(i)), uint64(i))
+	}
+	// Publishing the magic last keeps OpenRing from attaching to a ring
+	// that's only partially initialized.
+	p, _ := mmap.uint32Ptr(ringMagicOff)
+	atomic.StoreUint32(p, ringMagic)
+	return r, nil
+}
+
+// OpenRing attaches to a ring previously initialized with NewRing at the
+// start of mmap. It returns ErrCorrupt if mmap doesn't hold a valid ring.
+func OpenRing(mmap MMap) (*Ring, error) {
+	if len(mmap) < ringHeaderSize {
+		return nil, ErrCorrupt
+	}
+	p, err := mmap.uint32Ptr(ringMagicOff)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadUint32(p) != ringMagic {
+		return nil, ErrCorrupt
+	}
+	slotSize := int(binary.LittleEndian.Uint32(mmap[ringSlotOff:]))
+	capacity := binary.LittleEndian.Uint64(mmap[ringCapOff:])
+	if capacity == 0 || capacity&(capacity-1) != 0 || capacity > uint64(len(mmap)) ||
+		len(mmap) < RingSize(int(capacity), slotSize) {
+		return nil, ErrCorrupt
+	}
+	return newRing(mmap, int(capacity), slotSize), nil
+}
+
+func newRing(mmap MMap, capacity, slotSize int) *Ring {
+	tail, _ := mmap.uint64Ptr(ringTailOff)
+	head, _ := mmap.uint64Ptr(ringHeadOff)
+	return &Ring{
+		mmap:     mmap,
+		slotSize: slotSize,
+		stride:   ringStride(slotSize),
+		mask:     uint64(capacity - 1),
+		tail:     tail,
+		head:     head,
+		notEmpty: newWaitQueue(mmap, ringNotEmpty),
+		notFull:  newWaitQueue(mmap, ringNotFull),
+	}
+}
+
+// slot returns the offset of the slot used by position pos.
+func (r *Ring) slot(pos uint64) int {
+	return ringHeaderSize + int(pos&r.mask)*r.stride
+}
+
+// seq returns the sequence number of the slot used by position pos. A slot
+// whose sequence equals the position is free for a producer; one whose
+// sequence is one past the position holds a message for a consumer.
+func (r *Ring) seq(pos uint64) *uint64 {
+	p, _ := r.mmap.uint64Ptr(r.slot(pos))
+	return p
+}
+
+// Cap returns the number of messages the ring can hold.
+func (r *Ring) Cap() int {
+	return int(r.mask + 1)
+}
+
+// SlotSize returns the maximum size of a message.
+func (r *Ring) SlotSize() int {
+	return r.slotSize
+}
+
+// Len returns the number of messages currently queued. With concurrent
+// producers or consumers it is only an estimate.
+func (r *Ring) Len() int {
+	n := int64(atomic.LoadUint64(r.tail) - atomic.LoadUint64(r.head))
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// SetDoorbell makes this process ring d after each message it pushes, for
+// consumers that wait for messages with poll or select rather than Pop. It
+// costs a system call per message, and must be called before the ring is
+// used.
+func (r *Ring) SetDoorbell(d *Doorbell) {
+	r.doorbell = d
+}
+
+// TryPush copies p into the ring without blocking. It returns ErrFull if
+// there's no free slot, and ErrSize if p is larger than the slot size.
+func (r *Ring) TryPush(p []byte) error {
+	if len(p) > r.slotSize {
+		return ErrSize
+	}
+	pos := atomic.LoadUint64(r.tail)
+	for {
+		seq := atomic.LoadUint64(r.seq(pos))
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if !atomic.CompareAndSwapUint64(r.tail, pos, pos+1) {
+				pos = atomic.LoadUint64(r.tail)
+				continue
+			}
+			off := r.slot(pos)
+			binary.LittleEndian.PutUint32(r.mmap[off+8:], uint32(len(p)))
+			copy(r.mmap[off+ringSlotHeader:], p)
+			atomic.StoreUint64(r.seq(pos), pos+1)
+			r.notEmpty.wake()
+			if r.doorbell != nil {
+				r.doorbell.Ring()
+			}
+			return nil
+		case dif < 0:
+			return ErrFull
+		default:
+			pos = atomic.LoadUint64(r.tail)
+		}
+	}
+}
+
+// Push copies p into the ring, blocking until a slot is free.
+func (r *Ring) Push(p []byte) error {
+	for {
+		e := r.notFull.seq()
+		err := r.TryPush(p)
+		if err != ErrFull {
+			return err
+		}
+		r.notFull.wait(e)
+	}
+}
+
+// TryPop copies the oldest message into buf without blocking and returns its
+// length. It returns ErrEmpty if there's no message, and ErrSize if buf is
+// shorter than the slot size.
+func (r *Ring) TryPop(buf []byte) (int, error) {
+	if len(buf) < r.slotSize {
+		return 0, ErrSize
+	}
+	pos := atomic.LoadUint64(r.head)
+	for {
+		seq := atomic.LoadUint64(r.seq(pos))
+		switch dif := int64(seq - (pos + 1)); {
+		case dif == 0:
+			if !atomic.CompareAndSwapUint64(r.head, pos, pos+1) {
+				pos = atomic.LoadUint64(r.head)
+				continue
+			}
+			off := r.slot(pos)
+			n := int(binary.LittleEndian.Uint32(r.mmap[off+8:]))
+			if n > r.slotSize {
+				n = r.slotSize
+			}
+			copy(buf, r.mmap[off+ringSlotHeader:off+ringSlotHeader+n])
+			atomic.StoreUint64(r.seq(pos), pos+r.mask+1)
+			r.notFull.wake()
+			return n, nil
+		case dif < 0:
+			return 0, ErrEmpty
+		default:
+			pos = atomic.LoadUint64(r.head)
+		}
+	}
+}
+
+// Pop copies the oldest message into buf and returns its length, blocking
+// until a message is available.
+func (r *Ring) Pop(buf []byte) (int, error) {
+	for {
+		e := r.notEmpty.seq()
+		n, err := r.TryPop(buf)
+		if err != ErrEmpty {
+			return n, err
+		}
+		r.notEmpty.wait(e)
+	}
+}
@@ -0,0 +1,219 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) mapSize(c *C, size int) MMap {
+	c.Assert(s.file.Truncate(int64(size)), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	return mmap
+}
+
+func (s *S) TestRing(c *C) {
+	mmap := s.mapSize(c, RingSize(4, 10))
+	defer mmap.UnsafeUnmap()
+
+	_, err := OpenRing(mmap)
+	c.Assert(err, Equals, ErrCorrupt)
+
+	r, err := NewRing(mmap, 4, 10)
+	c.Assert(err, IsNil)
+	for i := 0; i < 4; i++ {
+		c.Assert(r.TryPush([]byte(fmt.Sprint("msg", i))), IsNil)
+	}
+	c.Assert(r.TryPush([]byte("x")), Equals, ErrFull)
+	c.Assert(r.TryPush(make([]byte, 11)), Equals, ErrSize)
+	c.Assert(r.Len(), Equals, 4)
+
+	other, err := OpenRing(mmap)
+	c.Assert(err, IsNil)
+	buf := make([]byte, other.SlotSize())
+	for i := 0; i < 4; i++ {
+		n, err := other.TryPop(buf)
+		c.Assert(err, IsNil)
+		c.Assert(string(buf[:n]), Equals, fmt.Sprint("msg", i))
+	}
+	_, err = other.TryPop(buf)
+	c.Assert(err, Equals, ErrEmpty)
+}
+
+func (s *S) TestRingBlocking(c *C) {
+	mmap := s.mapSize(c, RingSize(8, 8))
+	defer mmap.UnsafeUnmap()
+	r, err := NewRing(mmap, 8, 8)
+	c.Assert(err, IsNil)
+
+	const producers, count = 3, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				r.Push([]byte{byte(p), byte(i)})
+			}
+		}(p)
+	}
+
+	last := make([]int, producers)
+	for p := range last {
+		last[p] = -1
+	}
+	buf := make([]byte, 8)
+	for i := 0; i < producers*count; i++ {
+		n, err := r.Pop(buf)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, 2)
+		// Messages from each producer must arrive in order.
+		p := int(buf[0])
+		c.Assert(int(buf[1]), Equals, (last[p]+1)%256)
+		last[p] = int(buf[1])
+	}
+	wg.Wait()
+}
+
+func (s *S) TestRingDoorbell(c *C) {
+	mmap := s.mapSize(c, RingSize(8, 8))
+	defer mmap.UnsafeUnmap()
+	producer, err := NewRing(mmap, 8, 8)
+	c.Assert(err, IsNil)
+	d, err := NewDoorbell()
+	c.Assert(err, IsNil)
+	defer d.Close()
+	producer.SetDoorbell(d)
+
+	// The consumer holds its own copy of the file descriptor, as it would
+	// after inheriting it.
+	fd, err := syscall.Dup(int(d.Fd()))
+	c.Assert(err, IsNil)
+	peer := DoorbellFile(os.NewFile(uintptr(fd), "doorbell"))
+	defer peer.Close()
+	consumer, err := OpenRing(mmap)
+	c.Assert(err, IsNil)
+
+	done := make(chan []string)
+	go func() {
+		var got []string
+		buf := make([]byte, 8)
+		for len(got) < 3 {
+			c.Check(peer.Wait(), IsNil)
+			for {
+				n, err := consumer.TryPop(buf)
+				if err == ErrEmpty {
+					break
+				}
+				c.Check(err, IsNil)
+				got = append(got, string(buf[:n]))
+			}
+		}
+		done <- got
+	}()
+	for _, msg := range []string{"a", "b", "c"} {
+		c.Assert(producer.TryPush([]byte(msg)), IsNil)
+	}
+	c.Assert(<-done, DeepEquals, []string{"a", "b", "c"})
+
+	c.Assert(d.Ring(), IsNil)
+	c.Assert(d.Ring(), IsNil)
+	c.Assert(peer.Wait(), IsNil)
+}
+
+func (s *S) TestMapMirror(c *C) {
+	size := os.Getpagesize()
+	mmap, err := MapMirror(size)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	c.Assert(mmap, HasLen, 2*size)
+
+	copy(mmap[size-2:], "wrap")
+	c.Assert(string(mmap[:2]), Equals, "ap")
+	c.Assert(string(mmap[2*size-2:]), Equals, "wr")
+
+	_, err = MapMirror(size + 1)
+	c.Assert(err, Equals, ErrSize)
+}
+
+func (s *S) TestFrameQueue(c *C) {
+	mmap := s.mapSize(c, FrameQueueSize(64))
+	defer mmap.UnsafeUnmap()
+
+	q, err := NewFrameQueue(mmap, 64)
+	c.Assert(err, IsNil)
+	c.Assert(q.TrySend(make([]byte, 61)), Equals, ErrSize)
+	c.Assert(q.TrySend([]byte("hello")), IsNil)
+	c.Assert(q.TrySend([]byte("")), IsNil)
+	c.Assert(q.TrySend(make([]byte, 50)), Equals, ErrFull)
+
+	other, err := OpenFrameQueue(mmap)
+	c.Assert(err, IsNil)
+	buf := make([]byte, 64)
+	_, err = other.TryReceive(buf[:3])
+	c.Assert(err, Equals, ErrSize)
+	n, err := other.TryReceive(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "hello")
+	n, err = other.TryReceive(buf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	_, err = other.TryReceive(buf)
+	c.Assert(err, Equals, ErrEmpty)
+}
+
+func (s *S) TestFrameQueueBlocking(c *C) {
+	mmap := s.mapSize(c, FrameQueueSize(128))
+	defer mmap.UnsafeUnmap()
+	q, err := NewFrameQueue(mmap, 128)
+	c.Assert(err, IsNil)
+
+	const count = 2000
+	go func() {
+		for i := 0; i < count; i++ {
+			q.Send([]byte(fmt.Sprint(i)))
+		}
+	}()
+	buf := make([]byte, 16)
+	for i := 0; i < count; i++ {
+		n, err := q.Receive(buf)
+		c.Assert(err, IsNil)
+		c.Assert(string(buf[:n]), Equals, fmt.Sprint(i))
+	}
+}
+
+func (s *S) TestVectorBuilder(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(4*pageSize)), IsNil)
+	for i := 0; i < 4; i++ {
+		_, err := s.file.WriteAt([]byte{'a' + byte(i)}, int64(i*pageSize))
+		c.Assert(err, IsNil)
+	}
+
+	mmap, err := NewVectorBuilder(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED).
+		Add(int64(3*pageSize), int64(pageSize)).
+		Add(int64(pageSize), 10).
+		Map()
+	c.Assert(err, IsNil)
+	c.Assert(mmap, HasLen, pageSize+10)
+	c.Assert(mmap[0], Equals, byte('d'))
+	c.Assert(mmap[pageSize], Equals, byte('b'))
+	mmap[pageSize+1] = 'x'
+	c.Assert(mmap.UnsafeUnmap(), IsNil)
+	b := make([]byte, 2)
+	_, err = s.file.ReadAt(b, int64(pageSize))
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "bx")
+
+	_, err = NewVectorBuilder(s.file.Fd(), PROT_READ, MAP_SHARED).Add(0, 10).Add(int64(pageSize), 10).Map()
+	c.Assert(err, Equals, ErrUnaligned)
+	_, err = NewVectorBuilder(s.file.Fd(), PROT_READ, MAP_SHARED).Map()
+	c.Assert(err, Equals, ErrSize)
+}
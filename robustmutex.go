@@ -0,0 +1,150 @@
+package gommap
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// RobustMutexSize is the number of bytes a RobustMutex occupies in a
+// mapping.
+const RobustMutexSize = 8
+
+// The owner word of a RobustMutex holds the PID of the owning process, or
+// zero when unlocked, along with a flag telling that processes may be
+// waiting. The second word holds the state of the protected data.
+const (
+	robustWaiters      = 1 << 31
+	robustInconsistent = 1
+
+	// robustPollInterval bounds how long a waiter sleeps before checking
+	// again whether the owner is still alive.
+	robustPollInterval = 10 * time.Millisecond
+)
+
+// The RobustMutex type is a ProcessMutex that survives the death of its
+// owner. The lock records the PID of the process holding it, and waiters
+// periodically check that this process still exists. When it doesn't, the
+// next process to lock the mutex takes it over, and the data it protects is
+// marked as possibly inconsistent, since the owner may have died in the
+// middle of updating it.
+//
+// Locking a mutex marked inconsistent succeeds but returns ErrOwnerDead,
+// until the holder repairs the data and calls MarkConsistent. A holder that
+// can't repair the data may just unlock the mutex, leaving the next holder
+// to get ErrOwnerDead in turn.
+//
+// Ownership belongs to a process rather than a goroutine or thread, so a
+// process never recovers a lock from itself, and every process sharing the
+// mutex must be in the same PID namespace. A dead owner is only detected
+// once it has been reaped, and a PID reused in the meantime keeps the lock
+// held.
+//
+// The zero state is an unlocked, consistent mutex.
+type RobustMutex struct {
+	owner *uint32
+	state *uint32
+	pid   uint32
+}
+
+// NewRobustMutex returns the RobustMutex stored at off in mmap. The offset
+// must be 4-byte aligned in memory and leave room for RobustMutexSize bytes.
+func NewRobustMutex(mmap MMap, off int) (*RobustMutex, error) {
+	if !mmap.inBounds(off, RobustMutexSize) {
+		return nil, ErrOutOfBounds
+	}
+	owner, err := mmap.uint32Ptr(off)
+	if err != nil {
+		return nil, err
+	}
+	state, _ := mmap.uint32Ptr(off + 4)
+	return &RobustMutex{owner: owner, state: state, pid: uint32(os.Getpid())}, nil
+}
+
+// acquired returns the error to report once the lock is held.
+func (m *RobustMutex) acquired() error {
+	if atomic.LoadUint32(m.state)&robustInconsistent != 0 {
+		return ErrOwnerDead
+	}
+	return nil
+}
+
+// tryLock makes a single attempt at taking the lock, recovering it from a
+// dead owner. It returns the owner word seen if the lock is held by a live
+// process. Once a process has waited, it keeps the waiters flag set when
+// taking the lock, since others may still be sleeping.
+func (m *RobustMutex) tryLock(waited bool) (locked bool, cur uint32, err error) {
+	want := m.pid
+	if waited {
+		want |= robustWaiters
+	}
+	for {
+		cur = atomic.LoadUint32(m.owner)
+		if cur == 0 {
+			if atomic.CompareAndSwapUint32(m.owner, 0, want) {
+				return true, 0, m.acquired()
+			}
+			continue
+		}
+		owner := cur &^ robustWaiters
+		if owner == m.pid || processAlive(int(owner)) {
+			return false, cur, nil
+		}
+		if atomic.CompareAndSwapUint32(m.owner, cur, want|cur&robustWaiters) {
+			atomic.StoreUint32(m.state, robustInconsistent)
+			return true, 0, ErrOwnerDead
+		}
+	}
+}
+
+// Lock locks the mutex, blocking until it is available. If the previous
+// owner died while holding it, or the data was already marked inconsistent,
+// the mutex is locked all the same and ErrOwnerDead is returned.
+func (m *RobustMutex) Lock() error {
+	waited := false
+	for {
+		locked, cur, err := m.tryLock(waited)
+		if locked {
+			return err
+		}
+		if cur&robustWaiters == 0 && !atomic.CompareAndSwapUint32(m.owner, cur, cur|robustWaiters) {
+			continue
+		}
+		futexWaitTimeout(m.owner, cur|robustWaiters, robustPollInterval)
+		waited = true
+	}
+}
+
+// TryLock tries to lock the mutex without blocking and reports whether it
+// succeeded. Like Lock, it returns ErrOwnerDead along with true if the data
+// protected may be inconsistent.
+func (m *RobustMutex) TryLock() (bool, error) {
+	locked, _, err := m.tryLock(false)
+	return locked, err
+}
+
+// Unlock unlocks the mutex.
+func (m *RobustMutex) Unlock() {
+	if atomic.SwapUint32(m.owner, 0)&robustWaiters != 0 {
+		futexWake(m.owner, 1)
+	}
+}
+
+// MarkConsistent records that the data protected by the mutex was repaired
+// after an owner died. It must be called with the mutex held.
+func (m *RobustMutex) MarkConsistent() {
+	atomic.StoreUint32(m.state, 0)
+}
+
+// Consistent reports whether the data protected by the mutex is known to be
+// consistent, that is no owner died holding the lock since MarkConsistent
+// was last called.
+func (m *RobustMutex) Consistent() bool {
+	return atomic.LoadUint32(m.state)&robustInconsistent == 0
+}
+
+// Owner returns the PID of the process holding the mutex, or zero if it is
+// unlocked.
+func (m *RobustMutex) Owner() int {
+	return int(atomic.LoadUint32(m.owner) &^ robustWaiters)
+}
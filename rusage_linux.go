@@ -0,0 +1,16 @@
+package gommap
+
+import "syscall"
+
+// _RUSAGE_THREAD limits getrusage to the calling thread.
+const _RUSAGE_THREAD = 1
+
+// threadFaults returns the minor and major page faults taken so far by the
+// calling thread, which must be locked to its goroutine.
+func threadFaults() (minor, major int64) {
+	var ru syscall.Rusage
+	if syscall.Getrusage(_RUSAGE_THREAD, &ru) != nil {
+		return 0, 0
+	}
+	return int64(ru.Minflt), int64(ru.Majflt)
+}
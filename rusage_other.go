@@ -0,0 +1,17 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import "syscall"
+
+// threadFaults returns the minor and major page faults taken so far. Without
+// per-thread accounting these are the faults of the whole process, so faults
+// from other threads may be attributed to the mapping being measured.
+func threadFaults() (minor, major int64) {
+	var ru syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &ru) != nil {
+		return 0, 0
+	}
+	return int64(ru.Minflt), int64(ru.Majflt)
+}
@@ -0,0 +1,89 @@
+package gommap
+
+import "sync/atomic"
+
+// ProcessRWMutexSize is the number of bytes a ProcessRWMutex occupies in a
+// mapping.
+const ProcessRWMutexSize = 12
+
+// Layout of the state word of a ProcessRWMutex. The low bits count the
+// readers holding the lock.
+const (
+	rwWriter  = 1 << 31
+	rwPending = 1 << 30
+	rwReaders = rwPending - 1
+)
+
+// The ProcessRWMutex type is a reader/writer lock whose state lives inside a
+// mapping, so processes sharing the mapping can share the lock. Any number of
+// readers or a single writer may hold it. A writer waiting for the lock keeps
+// new readers out, so writers are not starved.
+//
+// The lock is made of three 32-bit words: the lock state followed by a wait
+// queue. All bytes zero is an unlocked lock.
+type ProcessRWMutex struct {
+	state *uint32
+	queue waitQueue
+}
+
+// NewProcessRWMutex returns the ProcessRWMutex stored at off in mmap. The
+// offset must be 4-byte aligned in memory and leave room for
+// ProcessRWMutexSize bytes.
+func NewProcessRWMutex(mmap MMap, off int) (*ProcessRWMutex, error) {
+	if !mmap.inBounds(off, ProcessRWMutexSize) {
+		return nil, ErrOutOfBounds
+	}
+	state, err := mmap.uint32Ptr(off)
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessRWMutex{state: state, queue: newWaitQueue(mmap, off+4)}, nil
+}
+
+// RLock locks rw for reading.
+func (rw *ProcessRWMutex) RLock() {
+	for {
+		e := rw.queue.seq()
+		s := atomic.LoadUint32(rw.state)
+		if s&(rwWriter|rwPending) == 0 {
+			if atomic.CompareAndSwapUint32(rw.state, s, s+1) {
+				return
+			}
+			continue
+		}
+		rw.queue.wait(e)
+	}
+}
+
+// RUnlock undoes a single RLock call.
+func (rw *ProcessRWMutex) RUnlock() {
+	s := atomic.AddUint32(rw.state, ^uint32(0))
+	if s&rwReaders == 0 && s&rwPending != 0 {
+		rw.queue.wake()
+	}
+}
+
+// Lock locks rw for writing, waiting for active readers to leave.
+func (rw *ProcessRWMutex) Lock() {
+	for {
+		e := rw.queue.seq()
+		s := atomic.LoadUint32(rw.state)
+		switch {
+		case s&(rwWriter|rwReaders) == 0:
+			if atomic.CompareAndSwapUint32(rw.state, s, rwWriter) {
+				return
+			}
+		case s&rwPending == 0:
+			atomic.CompareAndSwapUint32(rw.state, s, s|rwPending)
+		default:
+			rw.queue.wait(e)
+		}
+	}
+}
+
+// Unlock unlocks rw for writing. Writers still waiting will flag themselves
+// as pending again once woken.
+func (rw *ProcessRWMutex) Unlock() {
+	atomic.StoreUint32(rw.state, 0)
+	rw.queue.wake()
+}
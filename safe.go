@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"io"
+	"syscall"
+	"time"
+)
+
+// safeCopy copies src into dst like copy, but turns the fault taken when src
+// is no longer backed by its file into ErrFileTruncated instead of crashing
+// the process with SIGBUS.
+func safeCopy(dst, src []byte) (n int, err error) {
+	if fault, _ := catchFault(func() { n = copy(dst, src) }); fault != nil {
+		return 0, ErrFileTruncated
+	}
+	return n, nil
+}
+
+// fileSize returns the size of the regular file at fd, and false if fd
+// isn't a regular file, in which case its size says nothing about what can
+// be mapped.
+func fileSize(fd uintptr) (int64, bool, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &st); err != nil {
+		return 0, false, err
+	}
+	if uint32(st.Mode)&syscall.S_IFMT != syscall.S_IFREG {
+		return 0, false, nil
+	}
+	return st.Size, true, nil
+}
+
+// SafeReadAt reads len(p) bytes from the mapping starting at off, relative
+// to the start of the mapping, following the io.ReaderAt contract. Unlike
+// reading the mapped memory directly, it checks the current size of the
+// backing file first, and returns ErrFileTruncated for the parts of the
+// mapping past its end rather than letting the access kill the process with
+// SIGBUS. The fault is also caught should the file be truncated while the
+// copy is in progress.
+func (m *Mapping) SafeReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+	if off < 0 {
+		return 0, ErrOutOfBounds
+	}
+	if off >= int64(len(m.mmap)) {
+		return 0, io.EOF
+	}
+	src := m.mmap[off:]
+	if len(src) > len(p) {
+		src = src[:len(p)]
+	}
+	var truncated bool
+	size, regular, err := fileSize(m.fd)
+	if err != nil {
+		return 0, err
+	}
+	if avail := size - m.offset - off; regular && avail < int64(len(src)) {
+		if avail < 0 {
+			avail = 0
+		}
+		src, truncated = src[:avail], true
+	}
+	n, err := safeCopy(p, src)
+	if err != nil {
+		return 0, err
+	}
+	if truncated {
+		return n, ErrFileTruncated
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Revalidate checks that the backing file still covers the whole mapping.
+// If it was truncated underneath, the mapping is marked invalid: Bytes and
+// MMap return nil and other methods fail with ErrFileTruncated from then on,
+// rather than handing out memory whose access would raise SIGBUS. The
+// mapping still has to be closed.
+func (m *Mapping) Revalidate() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(); err != nil {
+		return err
+	}
+	size, regular, err := fileSize(m.fd)
+	if err != nil {
+		return err
+	}
+	if regular && size < m.offset+int64(len(m.mmap)) {
+		m.invalid = ErrFileTruncated
+		return m.invalid
+	}
+	return nil
+}
+
+// WithRevalidate returns an option calling Revalidate on the mapping every
+// interval until it is closed.
+func WithRevalidate(interval time.Duration) MappingOption {
+	return every(interval, func(m *Mapping) { m.Revalidate() })
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "bytes"
+
+// scanWindow is how many bytes the scans over a mapping go through before
+// asking the kernel to read the next window in.
+const scanWindow = 4 << 20
+
+// scan runs find over consecutive windows of mmap starting at from, the
+// windows overlapping by overlap bytes so matches spanning two of them are
+// found. The kernel is told the scan is sequential, and each window is
+// advised with MADV_WILLNEED while the one before it is searched. It returns
+// the offset of the first match within mmap, or -1.
+func (mmap MMap) scan(from, overlap int, find func(window []byte) int) int {
+	data := mmap[from:]
+	// Advice is only a hint, so failures are not worth reporting.
+	pageAligned(data).Advise(MADV_SEQUENTIAL)
+	for off := 0; off < len(data); off += scanWindow {
+		end := off + scanWindow + overlap
+		if end > len(data) {
+			end = len(data)
+		}
+		if next := end + scanWindow; end < len(data) {
+			if next > len(data) {
+				next = len(data)
+			}
+			pageAligned(data[end:next]).Advise(MADV_WILLNEED)
+		}
+		if i := find(data[off:end]); i >= 0 {
+			return from + off + i
+		}
+	}
+	return -1
+}
+
+// IndexByteFrom returns the offset of the first instance of c in mmap at or
+// after from, or -1 if c isn't present. Unlike bytes.IndexByte over the
+// whole mapping, it reads the mapping in window by window, keeping the
+// kernel reading ahead of the scan. It panics if from is outside of mmap.
+func (mmap MMap) IndexByteFrom(from int, c byte) int {
+	return mmap.scan(from, 0, func(window []byte) int {
+		return bytes.IndexByte(window, c)
+	})
+}
+
+// IndexFrom returns the offset of the first instance of sep in mmap at or
+// after from, or -1 if sep isn't present. See IndexByteFrom.
+func (mmap MMap) IndexFrom(from int, sep []byte) int {
+	if len(sep) == 0 {
+		if from > len(mmap) {
+			panic("gommap: offset out of range")
+		}
+		return from
+	}
+	return mmap.scan(from, len(sep)-1, func(window []byte) int {
+		return bytes.Index(window, sep)
+	})
+}
@@ -0,0 +1,86 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "runtime"
+
+// The Secure type is a region of memory meant to hold secrets such as keys
+// and credentials. It is an anonymous mapping locked in memory, so it's never
+// written to swap, and on Linux it is excluded from core dumps and wiped in
+// child processes after fork. Its content is zeroed when it is closed.
+//
+// A Secure region is not safe for concurrent use.
+type Secure struct {
+	mmap MMap
+}
+
+// NewSecure returns a zeroed Secure region of size bytes. It fails if the
+// memory can't be locked, as may happen when RLIMIT_MEMLOCK is too low.
+func NewSecure(size int) (*Secure, error) {
+	if size <= 0 {
+		return nil, ErrSize
+	}
+	mmap, err := MapAnonymous(int64(size), PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := mmap.Lock(); err != nil {
+		mmap.UnsafeUnmap()
+		return nil, err
+	}
+	if err := secureAdvise(mmap); err != nil {
+		mmap.Unlock()
+		mmap.UnsafeUnmap()
+		return nil, err
+	}
+	return &Secure{mmap: mmap}, nil
+}
+
+// Bytes returns the memory of the region, or nil once it is closed.
+func (s *Secure) Bytes() []byte {
+	return s.mmap
+}
+
+// Len returns the size of the region in bytes.
+func (s *Secure) Len() int {
+	return len(s.mmap)
+}
+
+// wipe zeroes b. It is kept out of line, and b alive past it, so the
+// compiler can't drop the stores as dead even though b is never read again.
+//
+//go:noinline
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// SecureUnmap overwrites mmap with zeroes before unmapping it, for mappings
+// that held key material or credentials. The pages are made writable first
+// if needed. Note that zeroing a shared mapping of a file zeroes the file as
+// well; it's meant for anonymous and private mappings.
+func (mmap MMap) SecureUnmap() error {
+	if len(mmap) > 0 {
+		if err := pageAligned(mmap).Protect(PROT_READ | PROT_WRITE); err != nil {
+			return err
+		}
+		wipe(mmap)
+	}
+	return mmap.UnsafeUnmap()
+}
+
+// Close zeroes and unmaps the region, which also unlocks it. Closing a
+// region twice returns ErrClosed.
+func (s *Secure) Close() error {
+	if s.mmap == nil {
+		return ErrClosed
+	}
+	if err := s.mmap.SecureUnmap(); err != nil {
+		return err
+	}
+	s.mmap = nil
+	return nil
+}
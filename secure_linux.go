@@ -0,0 +1,10 @@
+package gommap
+
+// secureAdvise keeps the region out of core dumps, and makes children
+// created by fork see it zeroed rather than copied.
+func secureAdvise(mmap MMap) error {
+	if err := mmap.Advise(MADV_DONTDUMP); err != nil {
+		return err
+	}
+	return mmap.Advise(MADV_WIPEONFORK)
+}
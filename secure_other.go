@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// secureAdvise does nothing: there's no portable way to keep memory out of
+// core dumps or away from children outside of Linux.
+func secureAdvise(mmap MMap) error {
+	return nil
+}
@@ -0,0 +1,156 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// segmentLenWidth is the size of the length prefixed to each record.
+const segmentLenWidth = 8
+
+// The Segment type is an append-only log file accessed through a mapping.
+// Records are stored back to back, each prefixed with its length as a
+// big-endian 64-bit integer. The file is grown to its maximum size while the
+// segment is open and trimmed back to the data it holds on Close.
+//
+// Empty records are not allowed, which lets OpenSegment find the end of the
+// data after a crash left the file at its full size: the first zero length
+// marks the end of the log.
+type Segment struct {
+	file          *os.File
+	mmap          MMap
+	size          int64
+	synced        int64
+	syncThreshold int64
+}
+
+// OpenSegment opens or creates the segment file at path, mapping it with
+// room for maxBytes bytes of records and length prefixes.
+func OpenSegment(path string, maxBytes int64) (*Segment, error) {
+	if maxBytes <= segmentLenWidth || int64(int(maxBytes)) != maxBytes {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fi.Size() > maxBytes {
+		file.Close()
+		return nil, ErrSize
+	}
+	if err := file.Truncate(maxBytes); err != nil {
+		file.Close()
+		return nil, err
+	}
+	mmap, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &Segment{file: file, mmap: mmap}
+	s.size = s.recover(fi.Size())
+	s.synced = s.size
+	return s, nil
+}
+
+// recover returns the end of the last complete record within the first limit
+// bytes of the segment.
+func (s *Segment) recover(limit int64) int64 {
+	var pos int64
+	for pos+segmentLenWidth <= limit {
+		n := binary.BigEndian.Uint64(s.mmap[pos:])
+		if n == 0 || n > uint64(limit-pos-segmentLenWidth) {
+			break
+		}
+		pos += segmentLenWidth + int64(n)
+	}
+	return pos
+}
+
+// SetSyncThreshold makes Append flush the segment with MS_SYNC whenever at
+// least n bytes were appended since the last flush. Zero, the default,
+// leaves flushing to explicit Sync calls.
+func (s *Segment) SetSyncThreshold(n int64) {
+	s.syncThreshold = n
+}
+
+// Append writes p as a new record and returns its position in the segment.
+// It returns ErrFull if the segment doesn't have room for the record, and
+// ErrSize if p is empty.
+func (s *Segment) Append(p []byte) (int64, error) {
+	if len(p) == 0 {
+		return 0, ErrSize
+	}
+	pos := s.size
+	if int64(len(p)) > int64(len(s.mmap))-pos-segmentLenWidth {
+		return 0, ErrFull
+	}
+	copy(s.mmap[pos+segmentLenWidth:], p)
+	binary.BigEndian.PutUint64(s.mmap[pos:], uint64(len(p)))
+	s.size += segmentLenWidth + int64(len(p))
+	if s.syncThreshold > 0 && s.size-s.synced >= s.syncThreshold {
+		if err := s.Sync(); err != nil {
+			return pos, err
+		}
+	}
+	return pos, nil
+}
+
+// ReadAt returns the record stored at pos, as returned by Append. The slice
+// points into the mapping and is only valid until the segment is closed.
+func (s *Segment) ReadAt(pos int64) ([]byte, error) {
+	if pos < 0 || pos+segmentLenWidth > s.size {
+		return nil, ErrOutOfBounds
+	}
+	n := binary.BigEndian.Uint64(s.mmap[pos:])
+	if n == 0 || n > uint64(s.size-pos-segmentLenWidth) {
+		return nil, ErrCorrupt
+	}
+	start := pos + segmentLenWidth
+	return s.mmap[start : start+int64(n) : start+int64(n)], nil
+}
+
+// Size returns the number of bytes used by the records in the segment.
+func (s *Segment) Size() int64 {
+	return s.size
+}
+
+// Name returns the path of the segment file.
+func (s *Segment) Name() string {
+	return s.file.Name()
+}
+
+// Sync flushes the records appended since the last flush to the file.
+func (s *Segment) Sync() error {
+	if s.size == s.synced {
+		return nil
+	}
+	if err := s.mmap.View(int(s.synced), int(s.size-s.synced)).Sync(MS_SYNC); err != nil {
+		return err
+	}
+	s.synced = s.size
+	return nil
+}
+
+// Close flushes and unmaps the segment, and trims the file to the size of the
+// records it holds.
+func (s *Segment) Close() error {
+	if err := s.Sync(); err != nil {
+		return err
+	}
+	if err := s.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	if err := s.file.Truncate(s.size); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
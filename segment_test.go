@@ -0,0 +1,667 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestSegment(c *C) {
+	segPath := path.Join(c.MkDir(), "00000.log")
+	seg, err := OpenSegment(segPath, 64)
+	c.Assert(err, IsNil)
+	seg.SetSyncThreshold(1)
+
+	pos1, err := seg.Append([]byte("first"))
+	c.Assert(err, IsNil)
+	pos2, err := seg.Append([]byte("second"))
+	c.Assert(err, IsNil)
+	c.Assert(pos2, Equals, int64(13))
+	_, err = seg.Append(make([]byte, 40))
+	c.Assert(err, Equals, ErrFull)
+	_, err = seg.Append(nil)
+	c.Assert(err, Equals, ErrSize)
+
+	rec, err := seg.ReadAt(pos1)
+	c.Assert(err, IsNil)
+	c.Assert(string(rec), Equals, "first")
+	_, err = seg.ReadAt(seg.Size())
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(seg.Close(), IsNil)
+
+	fi, err := os.Stat(segPath)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(27))
+
+	seg, err = OpenSegment(segPath, 64)
+	c.Assert(err, IsNil)
+	defer seg.Close()
+	c.Assert(seg.Size(), Equals, int64(27))
+	rec, err = seg.ReadAt(pos2)
+	c.Assert(err, IsNil)
+	c.Assert(string(rec), Equals, "second")
+}
+
+func (s *S) TestSegmentRecovery(c *C) {
+	segPath := path.Join(c.MkDir(), "00000.log")
+	seg, err := OpenSegment(segPath, 64)
+	c.Assert(err, IsNil)
+	seg.Append([]byte("kept"))
+	seg.Sync()
+
+	// Reopening without Close leaves the file at its full size, as a crash
+	// would.
+	again, err := OpenSegment(segPath, 64)
+	c.Assert(err, IsNil)
+	c.Assert(again.Size(), Equals, int64(12))
+	c.Assert(again.Close(), IsNil)
+	seg.mmap.UnsafeUnmap()
+	seg.file.Close()
+}
+
+func (s *S) TestIndex(c *C) {
+	idxPath := path.Join(c.MkDir(), "00000.index")
+	idx, err := OpenIndex(idxPath, 1024)
+	c.Assert(err, IsNil)
+	_, _, err = idx.Read(-1)
+	c.Assert(err, Equals, io.EOF)
+
+	for i := 0; i < 3; i++ {
+		c.Assert(idx.Write(uint32(i), uint64(i*10)), IsNil)
+	}
+	off, pos, err := idx.Read(-1)
+	c.Assert(err, IsNil)
+	c.Assert(off, Equals, uint32(2))
+	c.Assert(pos, Equals, uint64(20))
+	_, _, err = idx.Read(3)
+	c.Assert(err, Equals, io.EOF)
+
+	// Reopen without closing, as after a crash.
+	idx.Sync()
+	crashed, err := OpenIndex(idxPath, 1024)
+	c.Assert(err, IsNil)
+	c.Assert(crashed.Len(), Equals, int64(3))
+	c.Assert(crashed.Close(), IsNil)
+	idx.mmap.UnsafeUnmap()
+	idx.file.Close()
+
+	fi, err := os.Stat(idxPath)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(48))
+
+	idx, err = OpenIndex(idxPath, 48)
+	c.Assert(err, IsNil)
+	defer idx.Close()
+	off, pos, err = idx.Read(1)
+	c.Assert(err, IsNil)
+	c.Assert(off, Equals, uint32(1))
+	c.Assert(pos, Equals, uint64(10))
+	c.Assert(idx.Write(3, 30), Equals, io.EOF)
+
+	// A crash right after the file was preallocated leaves it all zeroes,
+	// which holds no entries.
+	zeroPath := path.Join(c.MkDir(), "00000.index")
+	c.Assert(os.WriteFile(zeroPath, make([]byte, 1024), 0644), IsNil)
+	empty, err := OpenIndex(zeroPath, 1024)
+	c.Assert(err, IsNil)
+	c.Assert(empty.Len(), Equals, int64(0))
+	c.Assert(empty.Write(0, 0), IsNil)
+	c.Assert(empty.Sync(), IsNil)
+	reopened, err := OpenIndex(zeroPath, 1024)
+	c.Assert(err, IsNil)
+	c.Assert(reopened.Len(), Equals, int64(1))
+	c.Assert(reopened.Close(), IsNil)
+	c.Assert(empty.Close(), IsNil)
+}
+
+func (s *S) TestHashTable(c *C) {
+	tablePath := path.Join(c.MkDir(), "table")
+	t, err := OpenHashTable(tablePath, 4, 8)
+	c.Assert(err, IsNil)
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+	value := func(i int) []byte { return []byte(fmt.Sprintf("%08d", i*i)) }
+	for i := 0; i < 100; i++ {
+		c.Assert(t.Put(key(i), value(i)), IsNil)
+	}
+	c.Assert(t.Put(key(1), value(2)), IsNil)
+	c.Assert(t.Delete(key(3)), Equals, true)
+	c.Assert(t.Delete(key(3)), Equals, false)
+	c.Assert(t.Put([]byte("x"), value(0)), Equals, ErrSize)
+	c.Assert(t.Len(), Equals, 99)
+	c.Assert(t.Close(), IsNil)
+
+	_, err = OpenHashTable(tablePath, 4, 4)
+	c.Assert(err, Equals, ErrCorrupt)
+
+	t, err = OpenHashTable(tablePath, 4, 8)
+	c.Assert(err, IsNil)
+	defer t.Close()
+	c.Assert(t.Len(), Equals, 99)
+	for i := 0; i < 100; i++ {
+		v, ok := t.Get(key(i))
+		switch i {
+		case 1:
+			c.Assert(string(v), Equals, string(value(2)))
+		case 3:
+			c.Assert(ok, Equals, false)
+		default:
+			c.Assert(string(v), Equals, string(value(i)))
+		}
+	}
+	n := 0
+	t.Range(func(key, value []byte) bool {
+		n++
+		return true
+	})
+	c.Assert(n, Equals, 99)
+}
+
+func (s *S) TestPageChecksums(c *C) {
+	pageSize := os.Getpagesize()
+	c.Assert(s.file.Truncate(int64(3*pageSize)), IsNil)
+	data, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer data.UnsafeUnmap()
+
+	sumsPath := path.Join(c.MkDir(), "data.crc")
+	sums, err := OpenPageChecksums(data, sumsPath)
+	c.Assert(err, IsNil)
+	c.Assert(sums.Pages(), Equals, 3)
+	copy(data[pageSize:], "updated")
+	c.Assert(sums.MarkDirty(pageSize, 7), IsNil)
+	c.Assert(sums.Sync(MS_SYNC), IsNil)
+	c.Assert(sums.Close(), IsNil)
+
+	sums, err = OpenPageChecksums(data, sumsPath)
+	c.Assert(err, IsNil)
+	b, err := sums.Bytes(pageSize, 7)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "updated")
+	i, err := sums.VerifyAll()
+	c.Assert(err, IsNil)
+	c.Assert(i, Equals, -1)
+	c.Assert(sums.Close(), IsNil)
+
+	// A write without a checksum update, as left by a crash.
+	data[2*pageSize+5] = 'x'
+	sums, err = OpenPageChecksums(data, sumsPath)
+	c.Assert(err, IsNil)
+	defer sums.Close()
+	_, err = sums.Bytes(0, pageSize)
+	c.Assert(err, IsNil)
+	_, err = sums.Bytes(2*pageSize, 10)
+	c.Assert(err, Equals, ErrCorrupt)
+	i, err = sums.VerifyAll()
+	c.Assert(err, Equals, ErrCorrupt)
+	c.Assert(i, Equals, 2)
+	_, err = sums.Bytes(3*pageSize-1, 2)
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	_, err = OpenPageChecksums(data[:pageSize], sumsPath)
+	c.Assert(err, Equals, ErrCorrupt)
+}
+
+func (s *S) TestMappingPageChecksums(c *C) {
+	c.Assert(s.file.Truncate(4096), IsNil)
+	sumsPath := path.Join(c.MkDir(), "data.crc")
+	m, err := NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED, WithPageChecksums(sumsPath, 1024))
+	c.Assert(err, IsNil)
+	_, err = m.Put(1500, []byte("put"))
+	c.Assert(err, IsNil)
+	copy(m.Bytes()[3000:], "direct")
+	c.Assert(m.MarkDirty(3000, 6), IsNil)
+	c.Assert(m.Sync(MS_SYNC), IsNil)
+	_, err = m.Refresh()
+	c.Assert(err, Equals, ErrUnsupported)
+	c.Assert(m.Close(), IsNil)
+
+	sums, err := OpenRegionChecksums(make(MMap, 4096), sumsPath, 1024)
+	c.Assert(err, IsNil)
+	c.Assert(sums.Pages(), Equals, 4)
+	c.Assert(sums.Close(), IsNil)
+	_, err = OpenPageChecksums(make(MMap, 4096), sumsPath)
+	c.Assert(err, Equals, ErrCorrupt)
+
+	// A write that bypasses the checksums is caught by Get.
+	m, err = NewMapping(s.file.Fd(), 0, -1, PROT_READ|PROT_WRITE, MAP_SHARED, WithPageChecksums(sumsPath, 1024))
+	c.Assert(err, IsNil)
+	defer m.Close()
+	b, err := m.Get(1500, 3)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "put")
+	b, err = m.Get(3000, 6)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "direct")
+	m.Bytes()[100] = 'x'
+	_, err = m.Get(0, 1)
+	c.Assert(err, Equals, ErrCorrupt)
+}
+
+func (s *S) TestEncryptedMapping(c *C) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encPath := path.Join(c.MkDir(), "secret")
+	e, err := OpenEncrypted(encPath, key, 3*os.Getpagesize())
+	c.Assert(err, IsNil)
+	c.Assert(e.Len(), Equals, 3*os.Getpagesize())
+	off := int64(os.Getpagesize() - 3)
+	_, err = e.WriteAt([]byte("plaintext"), off)
+	c.Assert(err, IsNil)
+	c.Assert(e.Sync(MS_SYNC), IsNil)
+	c.Assert(e.Close(), IsNil)
+
+	raw, err := os.ReadFile(encPath)
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Contains(raw, []byte("plain")), Equals, false)
+
+	e, err = OpenEncrypted(encPath, key, 0)
+	c.Assert(err, IsNil)
+	b, err := e.Bytes(int(off), 9)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "plaintext")
+	b, err = e.Bytes(2*os.Getpagesize(), 4)
+	c.Assert(err, IsNil)
+	c.Assert(b, DeepEquals, []byte{0, 0, 0, 0})
+	c.Assert(e.Close(), IsNil)
+
+	// A record wiped to zeroes is as corrupt as any other.
+	record := encNonceSize + os.Getpagesize() + encTagSize
+	f, err := os.OpenFile(encPath, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteAt(make([]byte, record), int64(encHeaderSize+2*record))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	e, err = OpenEncrypted(encPath, key, 0)
+	c.Assert(err, IsNil)
+	_, err = e.Bytes(int(off), 9)
+	c.Assert(err, IsNil)
+	_, err = e.Bytes(2*os.Getpagesize(), 4)
+	c.Assert(err, Equals, ErrCorrupt)
+	c.Assert(e.Close(), IsNil)
+
+	e, err = OpenEncrypted(encPath, []byte("another key of 32 bytes........."), 0)
+	c.Assert(err, IsNil)
+	_, err = e.Bytes(0, 1)
+	c.Assert(err, Equals, ErrCorrupt)
+	c.Assert(e.Close(), IsNil)
+}
+
+func (s *S) TestMultiReader(c *C) {
+	r := NewMultiReader(MMap("abc"), MMap(""), MMap("defg"), MMap("h"))
+	c.Assert(r.Size(), Equals, int64(8))
+	i, off, ok := r.Locate(3)
+	c.Assert(ok, Equals, true)
+	c.Assert(i, Equals, 2)
+	c.Assert(off, Equals, 0)
+	_, _, ok = r.Locate(8)
+	c.Assert(ok, Equals, false)
+
+	buf := make([]byte, 4)
+	n, err := r.ReadAt(buf, 1)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "bcde")
+	n, err = r.ReadAt(buf, 6)
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(string(buf[:n]), Equals, "gh")
+
+	pos, err := r.Seek(-3, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(pos, Equals, int64(5))
+	data, err := io.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "fgh")
+	r.Seek(0, io.SeekStart)
+	data, err = io.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "abcdefgh")
+}
+
+func (s *S) TestSegmentSet(c *C) {
+	dir := c.MkDir()
+	size := int64(os.Getpagesize())
+	set, err := OpenSegmentSet(dir, size)
+	c.Assert(err, IsNil)
+	c.Assert(set.First(), Equals, int64(0))
+	n, err := set.Roll()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(1))
+	n, err = set.Roll()
+	c.Assert(err, IsNil)
+	c.Assert(set.End(), Equals, 3*size)
+
+	seg, off, err := set.Translate(size + 5)
+	c.Assert(err, IsNil)
+	c.Assert(seg, Equals, int64(1))
+	c.Assert(off, Equals, 5)
+	b, err := set.Slice(size+5, 3)
+	c.Assert(err, IsNil)
+	copy(b, "abc")
+	_, err = set.Slice(size-1, 2)
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	removed, err := set.Retire(size + 5)
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 1)
+	c.Assert(set.Start(), Equals, size)
+	_, _, err = set.Translate(0)
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(set.Close(), IsNil)
+
+	set, err = OpenSegmentSet(dir, size)
+	c.Assert(err, IsNil)
+	defer set.Close()
+	c.Assert(set.First(), Equals, int64(1))
+	c.Assert(set.Last(), Equals, int64(2))
+	b, err = set.Slice(size+5, 3)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "abc")
+}
+
+func (s *S) TestWAL(c *C) {
+	walPath := path.Join(c.MkDir(), "wal")
+	w, err := OpenWAL(walPath, 4096)
+	c.Assert(err, IsNil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := w.Append([]byte(fmt.Sprintf("record %d", i)))
+			c.Check(err, IsNil)
+			c.Check(w.Commit(), IsNil)
+		}(i)
+	}
+	wg.Wait()
+	_, err = w.Append(nil)
+	c.Assert(err, Equals, ErrSize)
+	_, err = w.Append(make([]byte, 4096))
+	c.Assert(err, Equals, ErrFull)
+	last, err := w.Append([]byte("last"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	c.Assert(w.Close(), Equals, ErrClosed)
+
+	// Tear the last record.
+	f, err := os.OpenFile(walPath, os.O_RDWR, 0)
+	c.Assert(err, IsNil)
+	_, err = f.WriteAt([]byte("X"), last+walFrameHeader+1)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	w, err = OpenWAL(walPath, 64)
+	c.Assert(err, IsNil)
+	defer w.Close()
+	c.Assert(w.Size(), Equals, last)
+	var records []string
+	c.Assert(w.Replay(func(pos int64, p []byte) bool {
+		records = append(records, string(p))
+		return true
+	}), IsNil)
+	sort.Strings(records)
+	c.Assert(records, HasLen, 8)
+	for i := 0; i < 8; i++ {
+		c.Assert(records[i], Equals, fmt.Sprintf("record %d", i))
+	}
+	pos, err := w.Append([]byte("again"))
+	c.Assert(err, IsNil)
+	c.Assert(pos, Equals, last)
+	p, err := w.ReadAt(pos)
+	c.Assert(err, IsNil)
+	c.Assert(string(p), Equals, "again")
+	_, err = w.ReadAt(pos + 1)
+	c.Assert(err, Equals, ErrCorrupt)
+}
+
+func (s *S) TestHeader(c *C) {
+	c.Assert(HeaderSize(8), Equals, 1024)
+	c.Assert(s.file.Truncate(int64(HeaderSize(8))), IsNil)
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+
+	_, err = OpenHeader(mmap, 8)
+	c.Assert(err, Equals, ErrCorrupt)
+	h, err := NewHeader(mmap, []byte("version1"))
+	c.Assert(err, IsNil)
+	c.Assert(h.Write([]byte("version2")), IsNil)
+	c.Assert(h.Write([]byte("short")), Equals, ErrSize)
+	c.Assert(h.Seq(), Equals, uint64(2))
+
+	h, err = OpenHeader(mmap, 8)
+	c.Assert(err, IsNil)
+	c.Assert(string(h.Bytes()), Equals, "version2")
+	c.Assert(h.Seq(), Equals, uint64(2))
+
+	// A torn write of the third version leaves the second one current.
+	c.Assert(h.Write([]byte("version3")), IsNil)
+	mmap[headerDataOff] ^= 0xff
+	h, err = OpenHeader(mmap, 8)
+	c.Assert(err, IsNil)
+	c.Assert(string(h.Bytes()), Equals, "version2")
+	c.Assert(h.Write([]byte("version4")), IsNil)
+	c.Assert(h.Seq(), Equals, uint64(3))
+	h, err = OpenHeader(mmap, 8)
+	c.Assert(err, IsNil)
+	c.Assert(string(h.Bytes()), Equals, "version4")
+}
+
+func (s *S) TestOverlay(c *C) {
+	pageSize := os.Getpagesize()
+	base := bytes.Repeat([]byte("b"), 3*pageSize+10)
+	basePath := path.Join(c.MkDir(), "base")
+	c.Assert(os.WriteFile(basePath, base, 0644), IsNil)
+	deltaPath := path.Join(c.MkDir(), "delta")
+
+	o, err := OpenOverlay(basePath, deltaPath)
+	c.Assert(err, IsNil)
+	c.Assert(o.Len(), Equals, len(base))
+	n, err := o.WriteAt([]byte("xyz"), int64(pageSize-1))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	_, err = o.WriteAt([]byte("end"), int64(len(base)-3))
+	c.Assert(err, IsNil)
+	_, err = o.WriteAt([]byte("x"), int64(len(base)))
+	c.Assert(err, Equals, ErrOutOfBounds)
+	c.Assert(o.ModifiedPages(), Equals, 3)
+	c.Assert(o.Modified(int64(2*pageSize)), Equals, false)
+	want := append([]byte(nil), base...)
+	copy(want[pageSize-1:], "xyz")
+	copy(want[len(want)-3:], "end")
+	c.Assert(o.Bytes(), DeepEquals, want)
+	c.Assert(o.Close(), IsNil)
+
+	data, err := os.ReadFile(basePath)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, base)
+	o, err = OpenOverlay(basePath, deltaPath)
+	c.Assert(err, IsNil)
+	c.Assert(o.Bytes(), DeepEquals, want)
+	c.Assert(o.ModifiedPages(), Equals, 3)
+	c.Assert(o.Close(), IsNil)
+
+	c.Assert(os.WriteFile(basePath, base[:10], 0644), IsNil)
+	_, err = OpenOverlay(basePath, deltaPath)
+	c.Assert(err, Equals, ErrCorrupt)
+}
+
+func (s *S) TestSparseArray(c *C) {
+	pageSize := os.Getpagesize()
+	arrPath := path.Join(c.MkDir(), "array")
+	a, err := OpenSparseArray[uint64](arrPath, 4*pageSize)
+	c.Assert(err, IsNil)
+	c.Assert(a.Len(), Equals, 4*pageSize)
+	empty, err := a.DiskUsage()
+	c.Assert(err, IsNil)
+	c.Assert(a.Get(10), Equals, uint64(0))
+
+	// Fill the second to fourth pages of the file.
+	for i := pageSize / 8; i < 4*pageSize/8; i++ {
+		a.Set(i, uint64(i))
+	}
+	c.Assert(a.Sync(), IsNil)
+	full, err := a.DiskUsage()
+	c.Assert(err, IsNil)
+	c.Assert(full > empty, Equals, true)
+
+	// Drop the third page and the values of the second past its start.
+	c.Assert(a.Drop(pageSize/8+1, 3*pageSize/8), IsNil)
+	c.Assert(a.Get(pageSize/8), Equals, uint64(pageSize/8))
+	c.Assert(a.Get(pageSize/8+1), Equals, uint64(0))
+	c.Assert(a.Get(2*pageSize/8+5), Equals, uint64(0))
+	c.Assert(a.Get(3*pageSize/8), Equals, uint64(3*pageSize/8))
+	c.Assert(a.Drop(1, 0), Equals, ErrOutOfBounds)
+	dropped, err := a.DiskUsage()
+	c.Assert(err, IsNil)
+	c.Assert(dropped < full, Equals, true)
+	c.Assert(a.Close(), IsNil)
+
+	a, err = OpenSparseArray[uint64](arrPath, 4*pageSize)
+	c.Assert(err, IsNil)
+	defer a.Close()
+	c.Assert(a.Get(2*pageSize/8), Equals, uint64(0))
+	c.Assert(a.Values()[4*pageSize/8-1], Equals, uint64(4*pageSize/8-1))
+}
+
+func (s *S) TestDurableQueue(c *C) {
+	dir := c.MkDir()
+	size := int64(os.Getpagesize())
+	q, err := OpenDurableQueue(dir, size)
+	c.Assert(err, IsNil)
+	for i := 0; i < 3; i++ {
+		_, err := q.Append([]byte(fmt.Sprint("msg", i)))
+		c.Assert(err, IsNil)
+	}
+	_, err = q.Append(make([]byte, size))
+	c.Assert(err, Equals, ErrSize)
+
+	fast, err := q.Consumer("fast")
+	c.Assert(err, IsNil)
+	slow, err := q.Consumer("slow")
+	c.Assert(err, IsNil)
+	next := func(qc *QueueConsumer) string {
+		_, p, err := qc.Next()
+		if err != nil {
+			return err.Error()
+		}
+		return string(p)
+	}
+	c.Assert(next(fast), Equals, "msg0")
+	c.Assert(next(fast), Equals, "msg1")
+	fast.Ack()
+	c.Assert(next(fast), Equals, "msg2")
+	c.Assert(next(slow), Equals, "msg0")
+	c.Assert(q.Close(), IsNil)
+
+	// After a restart, each consumer gets the records it hadn't
+	// acknowledged again.
+	q, err = OpenDurableQueue(dir, size)
+	c.Assert(err, IsNil)
+	fast, err = q.Consumer("fast")
+	c.Assert(err, IsNil)
+	slow, err = q.Consumer("slow")
+	c.Assert(err, IsNil)
+	c.Assert(next(fast), Equals, "msg2")
+	c.Assert(next(fast), Equals, ErrEmpty.Error())
+	fast.Ack()
+	c.Assert(fast.Committed(), Equals, q.End())
+	c.Assert(next(slow), Equals, "msg0")
+	slow.Rewind()
+	c.Assert(next(slow), Equals, "msg0")
+
+	// Records that don't fit in the current segment start a new one. The
+	// first segment is kept until the slow consumer is done with it.
+	big := make([]byte, size/2)
+	for i := 0; i < 4; i++ {
+		_, err := q.Append(big)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(q.segs.Last(), Equals, int64(3))
+	c.Assert(q.segs.First(), Equals, int64(0))
+	for _, qc := range []*QueueConsumer{fast, slow} {
+		for {
+			_, _, err := qc.Next()
+			if err == ErrEmpty {
+				break
+			}
+			c.Assert(err, IsNil)
+		}
+		qc.Ack()
+	}
+	_, err = q.Append(big)
+	c.Assert(err, IsNil)
+	c.Assert(q.segs.First(), Equals, int64(3))
+
+	// A record torn by a crash is dropped.
+	end := q.End()
+	seg := q.segs.Segment(q.segs.Last())
+	copy(seg[end%size:], []byte{4, 0, 0, 0, 1, 2, 3, 4, 't', 'o', 'r', 'n'})
+	c.Assert(q.Close(), IsNil)
+	q, err = OpenDurableQueue(dir, size)
+	c.Assert(err, IsNil)
+	defer q.Close()
+	c.Assert(q.End(), Equals, end)
+	slow, err = q.Consumer("slow")
+	c.Assert(err, IsNil)
+	_, p, err := slow.Next()
+	c.Assert(err, IsNil)
+	c.Assert(len(p), Equals, len(big))
+	c.Assert(next(slow), Equals, ErrEmpty.Error())
+}
+
+func (s *S) TestStringTable(c *C) {
+	tablePath := path.Join(c.MkDir(), "strings")
+	t, err := OpenStringTable(tablePath, 64)
+	c.Assert(err, IsNil)
+
+	foo, err := t.Intern("foo")
+	c.Assert(err, IsNil)
+	bar, err := t.Intern("bar")
+	c.Assert(err, IsNil)
+	again, err := t.Intern(string([]byte("foo")))
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, foo)
+	c.Assert(foo, Not(Equals), bar)
+	empty, err := t.Intern("")
+	c.Assert(err, IsNil)
+	c.Assert(empty, Equals, StringRef{})
+	c.Assert(t.Len(), Equals, 2)
+
+	str, err := t.String(bar)
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "bar")
+	_, err = t.String(StringRef{foo.Off + 1, 2})
+	c.Assert(err, Equals, ErrOutOfBounds)
+	_, err = t.String(StringRef{1 << 20, 2})
+	c.Assert(err, Equals, ErrOutOfBounds)
+
+	// 16 header bytes and 14 for the strings leave 34 bytes.
+	_, err = t.Intern(string(make([]byte, 31)))
+	c.Assert(err, Equals, ErrFull)
+	long, err := t.Intern(string(bytes.Repeat([]byte("x"), 30)))
+	c.Assert(err, IsNil)
+	c.Assert(t.Close(), IsNil)
+	_, err = t.Intern("baz")
+	c.Assert(err, Equals, ErrClosed)
+
+	t, err = OpenStringTable(tablePath, 64)
+	c.Assert(err, IsNil)
+	defer t.Close()
+	c.Assert(t.Len(), Equals, 3)
+	ref, ok := t.Lookup("foo")
+	c.Assert(ok, Equals, true)
+	c.Assert(ref, Equals, foo)
+	_, ok = t.Lookup("baz")
+	c.Assert(ok, Equals, false)
+	str, err = t.String(long)
+	c.Assert(err, IsNil)
+	c.Assert(str, HasLen, 30)
+}
@@ -0,0 +1,213 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentSetExt is the extension of the files of a SegmentSet.
+const segmentSetExt = ".seg"
+
+// The SegmentSet type manages a directory of fixed-size mapped files, the
+// segments, which together hold a range of a large logical address space
+// such as the data of a log or time-series store. Segment n covers the
+// global offsets from n*size to (n+1)*size, and is stored in a file named
+// after n. New segments are added at the end with Roll and old ones removed
+// from the start with Retire.
+//
+// A SegmentSet is not safe for concurrent use.
+type SegmentSet struct {
+	dir   string
+	size  int64
+	first int64
+	segs  []segmentFile
+}
+
+type segmentFile struct {
+	file *os.File
+	mmap MMap
+}
+
+// OpenSegmentSet opens the segments stored in dir, each size bytes long,
+// creating segment 0 if there's none. The size must be a positive multiple
+// of the page size.
+func OpenSegmentSet(dir string, size int64) (*SegmentSet, error) {
+	if size <= 0 || size%int64(os.Getpagesize()) != 0 || int64(int(size)) != size {
+		return nil, ErrSize
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentSetExt))
+	if err != nil {
+		return nil, err
+	}
+	var nums []int64
+	for _, name := range names {
+		n, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), segmentSetExt), 10, 64)
+		if err == nil && n >= 0 {
+			nums = append(nums, n)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	for i := 1; i < len(nums); i++ {
+		if nums[i] != nums[i-1]+1 {
+			return nil, ErrCorrupt
+		}
+	}
+	s := &SegmentSet{dir: dir, size: size}
+	if len(nums) > 0 {
+		s.first = nums[0]
+	}
+	for _, n := range nums {
+		if err := s.open(n); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if len(s.segs) == 0 {
+		if err := s.open(0); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *SegmentSet) path(n int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", n, segmentSetExt))
+}
+
+// open maps segment n, creating it if needed, and appends it to the set.
+func (s *SegmentSet) open(n int64) error {
+	file, err := os.OpenFile(s.path(n), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(s.size); err != nil {
+		file.Close()
+		return err
+	}
+	mmap, err := MapRegion(file.Fd(), 0, s.size, PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.segs = append(s.segs, segmentFile{file: file, mmap: mmap})
+	return nil
+}
+
+// SegmentSize returns the size of each segment.
+func (s *SegmentSet) SegmentSize() int64 {
+	return s.size
+}
+
+// First and Last return the numbers of the first and last segments of the
+// set.
+func (s *SegmentSet) First() int64 {
+	return s.first
+}
+
+func (s *SegmentSet) Last() int64 {
+	return s.first + int64(len(s.segs)) - 1
+}
+
+// Start and End return the range of global offsets held by the set.
+func (s *SegmentSet) Start() int64 {
+	return s.first * s.size
+}
+
+func (s *SegmentSet) End() int64 {
+	return (s.Last() + 1) * s.size
+}
+
+// Translate returns the segment holding the global offset off, and the
+// offset within that segment. It returns ErrOutOfBounds if off isn't held by
+// the set.
+func (s *SegmentSet) Translate(off int64) (segment int64, offset int, err error) {
+	if off < s.Start() || off >= s.End() {
+		return 0, 0, ErrOutOfBounds
+	}
+	return off / s.size, int(off % s.size), nil
+}
+
+// Segment returns the mapping of segment n, or nil if it isn't in the set.
+func (s *SegmentSet) Segment(n int64) MMap {
+	if n < s.first || n > s.Last() {
+		return nil
+	}
+	return s.segs[n-s.first].mmap
+}
+
+// Slice returns the n bytes at the global offset off. The range must not
+// cross a segment boundary.
+func (s *SegmentSet) Slice(off int64, n int) ([]byte, error) {
+	seg, o, err := s.Translate(off)
+	if err != nil {
+		return nil, err
+	}
+	mmap := s.Segment(seg)
+	if n < 0 || !mmap.inBounds(o, n) {
+		return nil, ErrOutOfBounds
+	}
+	return mmap[o : o+n], nil
+}
+
+// Roll adds a new segment after the last one, and returns its number.
+func (s *SegmentSet) Roll() (int64, error) {
+	n := s.Last() + 1
+	if err := s.open(n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Retire unmaps and deletes the segments lying entirely below the global
+// offset off, and returns how many were removed. The last segment is always
+// kept.
+func (s *SegmentSet) Retire(off int64) (int, error) {
+	removed := 0
+	for len(s.segs) > 1 && (s.first+1)*s.size <= off {
+		seg := s.segs[0]
+		if err := seg.mmap.UnsafeUnmap(); err != nil {
+			return removed, err
+		}
+		seg.file.Close()
+		if err := os.Remove(s.path(s.first)); err != nil {
+			return removed, err
+		}
+		s.segs = s.segs[1:]
+		s.first++
+		removed++
+	}
+	return removed, nil
+}
+
+// Sync flushes every segment back to its file. See MMap.Sync.
+func (s *SegmentSet) Sync(flags SyncFlags) error {
+	for _, seg := range s.segs {
+		if err := seg.mmap.Sync(flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close unmaps the segments and closes their files, returning the first
+// error met.
+func (s *SegmentSet) Close() error {
+	var err error
+	for _, seg := range s.segs {
+		if uerr := seg.mmap.UnsafeUnmap(); uerr != nil && err == nil {
+			err = uerr
+		}
+		if cerr := seg.file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	s.segs = nil
+	return err
+}
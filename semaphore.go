@@ -0,0 +1,96 @@
+package gommap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ProcessSemaphoreSize is the number of bytes a ProcessSemaphore occupies in
+// a mapping.
+const ProcessSemaphoreSize = 8
+
+// The ProcessSemaphore type is a counting semaphore whose state lives inside
+// a mapping, for producer and consumer processes sharing a MAP_SHARED
+// mapping of the same file. It is made of two 32-bit words: the count of
+// available units, and the number of processes sleeping until one is
+// released, which lets Release skip the wake-up system call when nobody is
+// waiting.
+//
+// As with ProcessMutex, waiting is done with futexes on Linux, and by
+// polling elsewhere.
+//
+// The zero state is a semaphore with no units available.
+type ProcessSemaphore struct {
+	count   *uint32
+	waiters *uint32
+}
+
+// NewProcessSemaphore returns the ProcessSemaphore stored at off in mmap.
+// The offset must be 4-byte aligned in memory and leave room for
+// ProcessSemaphoreSize bytes.
+func NewProcessSemaphore(mmap MMap, off int) (*ProcessSemaphore, error) {
+	if !mmap.inBounds(off, ProcessSemaphoreSize) {
+		return nil, ErrOutOfBounds
+	}
+	count, err := mmap.uint32Ptr(off)
+	if err != nil {
+		return nil, err
+	}
+	waiters, _ := mmap.uint32Ptr(off + 4)
+	return &ProcessSemaphore{count: count, waiters: waiters}, nil
+}
+
+// TryAcquire takes a unit if one is available, without blocking, and
+// reports whether it did.
+func (s *ProcessSemaphore) TryAcquire() bool {
+	for {
+		v := atomic.LoadUint32(s.count)
+		if v == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(s.count, v, v-1) {
+			return true
+		}
+	}
+}
+
+// Acquire takes a unit, blocking until one is available.
+func (s *ProcessSemaphore) Acquire() {
+	for !s.TryAcquire() {
+		atomic.AddUint32(s.waiters, 1)
+		futexWait(s.count, 0)
+		atomic.AddUint32(s.waiters, ^uint32(0))
+	}
+}
+
+// AcquireTimeout is like Acquire, but gives up after d and reports whether a
+// unit was taken.
+func (s *ProcessSemaphore) AcquireTimeout(d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for !s.TryAcquire() {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return false
+		}
+		atomic.AddUint32(s.waiters, 1)
+		futexWaitTimeout(s.count, 0, left)
+		atomic.AddUint32(s.waiters, ^uint32(0))
+	}
+	return true
+}
+
+// Release makes n more units available, waking up to n waiters.
+func (s *ProcessSemaphore) Release(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddUint32(s.count, uint32(n))
+	if atomic.LoadUint32(s.waiters) > 0 {
+		futexWake(s.count, n)
+	}
+}
+
+// Value returns the number of units currently available.
+func (s *ProcessSemaphore) Value() int {
+	return int(atomic.LoadUint32(s.count))
+}
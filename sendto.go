@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"net"
+	"syscall"
+)
+
+// SendTo writes n bytes of the mapping starting at off, relative to the
+// start of the mapping, to conn. For shared mappings written to a socket the
+// data is sent by the kernel straight from the backing file with sendfile
+// where available, so it's never copied through user space; otherwise the
+// mapped bytes are written as they are. The mapping can't be closed or
+// swapped until SendTo returns.
+func (m *Mapping) SendTo(conn net.Conn, off, n int64) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	if off < 0 || n < 0 || off > int64(len(m.mmap)) || n > int64(len(m.mmap))-off {
+		return 0, ErrOutOfBounds
+	}
+	var sent int64
+	if sc, ok := conn.(syscall.Conn); ok && m.flags&MAP_SHARED != 0 {
+		rc, err := sc.SyscallConn()
+		if err != nil {
+			return 0, err
+		}
+		var handled bool
+		sent, handled, err = sendFile(rc, m.fd, m.offset+off, n)
+		if handled || err != nil {
+			return sent, err
+		}
+	}
+	buffers := net.Buffers{m.mmap[off+sent : off+n]}
+	written, err := buffers.WriteTo(conn)
+	return sent + written, err
+}
@@ -0,0 +1,44 @@
+package gommap
+
+import "syscall"
+
+// sendFile sends n bytes of the file at src starting at offset to the
+// socket behind rc with sendfile. It returns false without an error if
+// sendfile can't be used with this socket, before anything was sent.
+func sendFile(rc syscall.RawConn, src uintptr, offset, n int64) (int64, bool, error) {
+	var sent int64
+	var serr error
+	err := rc.Write(func(fd uintptr) bool {
+		for sent < n {
+			chunk := n - sent
+			if chunk > 1<<30 {
+				chunk = 1 << 30
+			}
+			w, err := syscall.Sendfile(int(fd), int(src), &offset, int(chunk))
+			if w > 0 {
+				sent += int64(w)
+			}
+			switch {
+			case err == syscall.EINTR:
+				continue
+			case err == syscall.EAGAIN:
+				// Wait for the socket to be writable again.
+				return false
+			case err != nil:
+				serr = err
+				return true
+			case w == 0:
+				serr = ErrFileTruncated
+				return true
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return sent, true, err
+	}
+	if serr != nil && sent == 0 && (serr == syscall.EINVAL || serr == syscall.ENOSYS) {
+		return 0, false, nil
+	}
+	return sent, true, serr
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+import "syscall"
+
+// sendFile reports that sendfile isn't used outside of Linux, where its
+// signature differs between systems.
+func sendFile(rc syscall.RawConn, src uintptr, offset, n int64) (int64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,74 @@
+package gommap
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// SeqLockSize is the number of bytes a SeqLock occupies in a mapping.
+const SeqLockSize = 8
+
+// The SeqLock type is a sequence lock whose counter lives inside a mapping.
+// It lets a single writer update a mapped structure while any number of
+// readers, possibly in other processes, take consistent snapshots of it
+// without ever blocking the writer.
+//
+// The writer brackets each update with BeginWrite and EndWrite. Readers copy
+// the data out between ReadBegin and ReadRetry, and start over if ReadRetry
+// reports that a write overlapped. If there might be several writers, they
+// must be serialized with some other lock, such as a ProcessMutex.
+type SeqLock struct {
+	seq *uint64
+}
+
+// NewSeqLock returns the SeqLock stored at off in mmap. The offset must be
+// 8-byte aligned in memory.
+func NewSeqLock(mmap MMap, off int) (*SeqLock, error) {
+	p, err := mmap.uint64Ptr(off)
+	if err != nil {
+		return nil, err
+	}
+	return &SeqLock{seq: p}, nil
+}
+
+// BeginWrite marks the start of an update. The sequence becomes odd, which
+// makes concurrent readers retry.
+func (l *SeqLock) BeginWrite() {
+	atomic.AddUint64(l.seq, 1)
+}
+
+// EndWrite marks the end of an update started with BeginWrite.
+func (l *SeqLock) EndWrite() {
+	atomic.AddUint64(l.seq, 1)
+}
+
+// ReadBegin waits until no write is in progress and returns the sequence to
+// be passed to ReadRetry once the data has been read.
+func (l *SeqLock) ReadBegin() uint64 {
+	for {
+		seq := atomic.LoadUint64(l.seq)
+		if seq&1 == 0 {
+			return seq
+		}
+		runtime.Gosched()
+	}
+}
+
+// ReadRetry reports whether a write happened since ReadBegin returned seq,
+// in which case the data read in between may be torn and must be discarded.
+func (l *SeqLock) ReadRetry(seq uint64) bool {
+	return atomic.LoadUint64(l.seq) != seq
+}
+
+// Read calls fn repeatedly until it runs without overlapping a write. fn
+// should only copy data out of the mapping, since it may see torn values in
+// the attempts that get discarded.
+func (l *SeqLock) Read(fn func()) {
+	for {
+		seq := l.ReadBegin()
+		fn()
+		if !l.ReadRetry(seq) {
+			return
+		}
+	}
+}
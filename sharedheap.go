@@ -0,0 +1,154 @@
+package gommap
+
+import (
+	"reflect"
+)
+
+// sharedHeapPrefix is the space reserved at the start of a SharedHeap for
+// its lock, ahead of the slab header.
+const sharedHeapPrefix = 8
+
+// The SharedHeap type is a Slab made safe for concurrent use by every
+// process mapping the same file, by guarding it with a ProcessMutex stored
+// in the mapping. Allocations are identified by their offset from the start
+// of the mapping, so data structures linking them with offsets, such as with
+// Ref, work in every process regardless of where each maps the file.
+type SharedHeap struct {
+	mmap MMap
+	mu   *ProcessMutex
+	slab *Slab
+}
+
+// SharedHeapHeaderSize returns the size of the header of a shared heap with
+// n size classes.
+func SharedHeapHeaderSize(n int) int {
+	return sharedHeapPrefix + SlabHeaderSize(n)
+}
+
+// NewSharedHeap initializes an empty shared heap over mmap, with blocks of
+// the given sizes. See NewSlab. It must be called by a single process,
+// before any other opens the heap.
+func NewSharedHeap(mmap MMap, sizes []int) (*SharedHeap, error) {
+	if len(mmap) < sharedHeapPrefix {
+		return nil, ErrSize
+	}
+	mu, err := NewProcessMutex(mmap, 0)
+	if err != nil {
+		return nil, err
+	}
+	slab, err := NewSlab(mmap[sharedHeapPrefix:], sizes)
+	if err != nil {
+		return nil, err
+	}
+	// Start unlocked, whatever the file held before.
+	copy(mmap[:sharedHeapPrefix], make([]byte, sharedHeapPrefix))
+	return &SharedHeap{mmap: mmap, mu: mu, slab: slab}, nil
+}
+
+// OpenSharedHeap returns the shared heap previously initialized with
+// NewSharedHeap over mmap, possibly by another process. It returns
+// ErrCorrupt if the header is invalid.
+func OpenSharedHeap(mmap MMap) (*SharedHeap, error) {
+	if len(mmap) < sharedHeapPrefix {
+		return nil, ErrCorrupt
+	}
+	mu, err := NewProcessMutex(mmap, 0)
+	if err != nil {
+		return nil, err
+	}
+	slab, err := OpenSlab(mmap[sharedHeapPrefix:])
+	if err != nil {
+		return nil, err
+	}
+	return &SharedHeap{mmap: mmap, mu: mu, slab: slab}, nil
+}
+
+// Alloc returns the offset from the start of the mapping of a zeroed block
+// of at least n bytes. See Slab.Alloc.
+func (h *SharedHeap) Alloc(n int) (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	off, err := h.slab.Alloc(n)
+	if err != nil {
+		return 0, err
+	}
+	return off + sharedHeapPrefix, nil
+}
+
+// Free returns the block at off, allocated with Alloc(n), to the heap.
+func (h *SharedHeap) Free(off uint64, n int) error {
+	if off < sharedHeapPrefix {
+		return ErrOutOfBounds
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.slab.Free(off-sharedHeapPrefix, n)
+}
+
+// Bytes returns the n bytes of the block at off.
+func (h *SharedHeap) Bytes(off uint64, n int) []byte {
+	return h.mmap[off : off+uint64(n) : off+uint64(n)]
+}
+
+// Base returns the mapping the heap lives in, against which offsets and
+// references are resolved.
+func (h *SharedHeap) Base() MMap {
+	return h.mmap
+}
+
+// Sync flushes the heap to the backing file. See MMap.Sync.
+func (h *SharedHeap) Sync(flags SyncFlags) error {
+	return h.mmap.Sync(flags)
+}
+
+// The Ref type is a reference to a T stored in a mapping, held as its offset
+// from the start of the mapping instead of a pointer, so it can itself be
+// stored in the mapping and followed from any process. The zero Ref is nil.
+// A T may hold Refs, which are plain integers as far as StructAt is
+// concerned.
+type Ref[T any] uint64
+
+// IsNil reports whether the reference is nil.
+func (r Ref[T]) IsNil() bool {
+	return r == 0
+}
+
+// Resolve returns a pointer to the referenced value within base, the local
+// mapping of the file holding it. It returns an error if the reference is
+// nil, out of base, or T can't live in mapped memory; see StructAt.
+func (r Ref[T]) Resolve(base MMap) (*T, error) {
+	if r.IsNil() || uint64(r) > uint64(len(base)) {
+		return nil, ErrOutOfBounds
+	}
+	return StructAt[T](base, int(r))
+}
+
+// sizeOf returns the size of T, after checking it can live in mapped memory.
+func sizeOf[T any]() (int, error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if err := checkLayout(t); err != nil {
+		return 0, err
+	}
+	return int(t.Size()), nil
+}
+
+// AllocRef allocates a zeroed T in h and returns a reference to it. The heap
+// must have a size class holding a T.
+func AllocRef[T any](h *SharedHeap) (Ref[T], error) {
+	size, err := sizeOf[T]()
+	if err != nil {
+		return 0, err
+	}
+	off, err := h.Alloc(size)
+	return Ref[T](off), err
+}
+
+// FreeRef returns the T referenced by r, allocated with AllocRef, to h.
+func FreeRef[T any](h *SharedHeap, r Ref[T]) error {
+	size, err := sizeOf[T]()
+	if err != nil {
+		return err
+	}
+	return h.Free(uint64(r), size)
+}
@@ -0,0 +1,174 @@
+package gommap
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Layout of the header of a slab allocator stored in a mapping. The header
+// is followed by one (size, free list head) pair per size class.
+const (
+	slabMagic      = 0x424c5347 // "GSLB"
+	slabMagicOff   = 0
+	slabClassesOff = 4
+	slabCursorOff  = 8
+	slabClassOff   = 16
+	slabClassWidth = 16
+	slabMinClass   = 8
+)
+
+// The Slab type manages the space of a mapping as blocks of a fixed set of
+// size classes, for storing fixed-size records in a mapped file. Blocks are
+// carved from the free space by bumping a cursor, as with an Arena, and
+// freed blocks are kept on a per-class free list for reuse. The cursor and
+// free lists live in a header at the start of the mapping, so allocation
+// state survives restarts along with the data.
+//
+// Blocks are identified by their offset in the mapping rather than by
+// pointers, so they remain valid wherever the file is mapped. Offset zero is
+// never handed out and can be used as a nil reference.
+//
+// A Slab is not safe for concurrent use.
+type Slab struct {
+	mmap    MMap
+	classes []uint64
+}
+
+// SlabHeaderSize returns the size of the header of a slab with n size
+// classes.
+func SlabHeaderSize(n int) int {
+	return slabClassOff + n*slabClassWidth
+}
+
+// NewSlab initializes an empty slab allocator over mmap, with blocks of the
+// given sizes. Sizes are rounded up to a multiple of 8 bytes, which is also
+// the alignment of every block relative to the start of the mapping, and
+// sizes rounding up to the same class make a single class.
+func NewSlab(mmap MMap, sizes []int) (*Slab, error) {
+	classes := make([]uint64, 0, len(sizes))
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, ErrSize
+		}
+		classes = append(classes, uint64(size+slabMinClass-1)&^(slabMinClass-1))
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+	// Sizes rounding up to the same class share it, as OpenSlab expects
+	// classes to grow strictly.
+	n := 0
+	for i, size := range classes {
+		if i == 0 || size != classes[n-1] {
+			classes[n] = size
+			n++
+		}
+	}
+	classes = classes[:n]
+	if len(classes) == 0 || len(mmap) < SlabHeaderSize(len(classes)) {
+		return nil, ErrSize
+	}
+	binary.LittleEndian.PutUint32(mmap[slabClassesOff:], uint32(len(classes)))
+	binary.LittleEndian.PutUint64(mmap[slabCursorOff:], uint64(SlabHeaderSize(len(classes))))
+	for i, size := range classes {
+		off := slabClassOff + i*slabClassWidth
+		binary.LittleEndian.PutUint64(mmap[off:], size)
+		binary.LittleEndian.PutUint64(mmap[off+8:], 0)
+	}
+	binary.LittleEndian.PutUint32(mmap[slabMagicOff:], slabMagic)
+	return &Slab{mmap: mmap, classes: classes}, nil
+}
+
+// OpenSlab returns the slab allocator previously initialized with NewSlab
+// over mmap. It returns ErrCorrupt if the header is invalid.
+func OpenSlab(mmap MMap) (*Slab, error) {
+	if len(mmap) < slabClassOff || binary.LittleEndian.Uint32(mmap[slabMagicOff:]) != slabMagic {
+		return nil, ErrCorrupt
+	}
+	n := int(binary.LittleEndian.Uint32(mmap[slabClassesOff:]))
+	if n == 0 || n > (len(mmap)-slabClassOff)/slabClassWidth {
+		return nil, ErrCorrupt
+	}
+	s := &Slab{mmap: mmap, classes: make([]uint64, n)}
+	for i := range s.classes {
+		s.classes[i] = binary.LittleEndian.Uint64(mmap[slabClassOff+i*slabClassWidth:])
+		if s.classes[i] == 0 || (i > 0 && s.classes[i] <= s.classes[i-1]) {
+			return nil, ErrCorrupt
+		}
+	}
+	if cursor := s.cursor(); cursor < uint64(SlabHeaderSize(n)) || cursor > uint64(len(mmap)) {
+		return nil, ErrCorrupt
+	}
+	return s, nil
+}
+
+func (s *Slab) cursor() uint64 {
+	return binary.LittleEndian.Uint64(s.mmap[slabCursorOff:])
+}
+
+// class returns the index of the smallest class holding n bytes.
+func (s *Slab) class(n int) (int, error) {
+	i := sort.Search(len(s.classes), func(i int) bool { return s.classes[i] >= uint64(n) })
+	if n <= 0 || i == len(s.classes) {
+		return 0, ErrSize
+	}
+	return i, nil
+}
+
+// freeHead returns the offset of the head of the free list of class i within
+// the header.
+func freeHead(i int) int {
+	return slabClassOff + i*slabClassWidth + 8
+}
+
+// Alloc returns the offset of a zeroed block of at least n bytes. It returns
+// ErrSize if n is larger than the largest class, and ErrFull if the mapping
+// has no space left for such a block.
+func (s *Slab) Alloc(n int) (uint64, error) {
+	i, err := s.class(n)
+	if err != nil {
+		return 0, err
+	}
+	size := s.classes[i]
+	off := binary.LittleEndian.Uint64(s.mmap[freeHead(i):])
+	if off != 0 {
+		if off > uint64(len(s.mmap))-size {
+			return 0, ErrCorrupt
+		}
+		next := binary.LittleEndian.Uint64(s.mmap[off:])
+		binary.LittleEndian.PutUint64(s.mmap[freeHead(i):], next)
+	} else {
+		off = s.cursor()
+		if size > uint64(len(s.mmap))-off {
+			return 0, ErrFull
+		}
+		binary.LittleEndian.PutUint64(s.mmap[slabCursorOff:], off+size)
+	}
+	block := s.mmap[off : off+size]
+	for j := range block {
+		block[j] = 0
+	}
+	return off, nil
+}
+
+// Free returns the block at off, allocated with Alloc(n), to its free list.
+func (s *Slab) Free(off uint64, n int) error {
+	i, err := s.class(n)
+	if err != nil {
+		return err
+	}
+	if off < uint64(SlabHeaderSize(len(s.classes))) || off+s.classes[i] > s.cursor() || off%slabMinClass != 0 {
+		return ErrOutOfBounds
+	}
+	binary.LittleEndian.PutUint64(s.mmap[off:], binary.LittleEndian.Uint64(s.mmap[freeHead(i):]))
+	binary.LittleEndian.PutUint64(s.mmap[freeHead(i):], off)
+	return nil
+}
+
+// Bytes returns the n bytes of the block at off.
+func (s *Slab) Bytes(off uint64, n int) []byte {
+	return s.mmap[off : off+uint64(n) : off+uint64(n)]
+}
+
+// Sync flushes the slab to the backing file. See MMap.Sync.
+func (s *Slab) Sync(flags SyncFlags) error {
+	return s.mmap.Sync(flags)
+}
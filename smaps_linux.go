@@ -0,0 +1,47 @@
+package gommap
+
+// The Smaps type holds the memory usage of a mapping, as reported by the
+// kernel in /proc/self/smaps. All values are in bytes.
+type Smaps struct {
+	// Size is the size of the areas covering the mapping, and Rss the part
+	// of it currently resident in memory.
+	Size int64
+	Rss  int64
+	// Pss is the proportional set size: resident memory, with pages shared
+	// with other processes divided by the number of processes sharing them.
+	Pss          int64
+	SharedClean  int64
+	SharedDirty  int64
+	PrivateClean int64
+	PrivateDirty int64
+	Anonymous    int64
+	Swap         int64
+	Locked       int64
+	// Areas is the number of kernel memory areas the mapping is made of.
+	// Changing the protection or advice of part of a mapping splits it.
+	Areas int
+}
+
+// SmapsInfo finds the memory areas covering mmap in /proc/self/smaps and
+// returns their combined memory usage. Areas that extend past mmap, as when
+// mmap is a slice of a larger mapping, are counted whole.
+//
+// Reading smaps walks the page tables of the areas, so it is not free on
+// large mappings.
+func (mmap MMap) SmapsInfo() (Smaps, error) {
+	var s Smaps
+	err := overlappingVMAs("/proc/self/smaps", mmap, func(v *vma) {
+		s.Size += v.fields["Size"]
+		s.Rss += v.fields["Rss"]
+		s.Pss += v.fields["Pss"]
+		s.SharedClean += v.fields["Shared_Clean"]
+		s.SharedDirty += v.fields["Shared_Dirty"]
+		s.PrivateClean += v.fields["Private_Clean"]
+		s.PrivateDirty += v.fields["Private_Dirty"]
+		s.Anonymous += v.fields["Anonymous"]
+		s.Swap += v.fields["Swap"]
+		s.Locked += v.fields["Locked"]
+		s.Areas++
+	})
+	return s, err
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "os"
+
+// Snapshot returns a private, read-only copy of the given region of the file
+// or device, as it is at the time of the call. Changes made afterwards
+// through shared mappings of the same file, by this or other processes, are
+// not visible in the snapshot, so a background checksummer or backup can read
+// a consistent image while writers carry on. If -1 is provided as length, the
+// snapshot extends to the end of the file.
+//
+// A MAP_PRIVATE mapping alone doesn't give that guarantee: pages that were
+// never written still reflect the file. Snapshot writes to every page once to
+// force the kernel to give the mapping its own copy, which means the snapshot
+// uses as much memory as the region it covers. Writes that happen while the
+// snapshot is being taken may or may not be part of it.
+func Snapshot(fd uintptr, offset, length int64) (MMap, error) {
+	mmap, err := MapRegion(fd, offset, length, PROT_READ|PROT_WRITE, MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	pageSize := os.Getpagesize()
+	for i := 0; i < len(mmap); i += pageSize {
+		storeByte(&mmap[i], mmap[i])
+	}
+	if err := mmap.Protect(PROT_READ); err != nil {
+		mmap.UnsafeUnmap()
+		return nil, err
+	}
+	return mmap, nil
+}
+
+// storeByte stores v at p. It isn't inlined, so the compiler can't tell that
+// v is already there and drop the write.
+//
+//go:noinline
+func storeByte(p *byte, v byte) {
+	*p = v
+}
@@ -0,0 +1,146 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The SparseArray type is an array of fixed-size values stored in a mapped
+// sparse file. The file starts out as one big hole, which reads as zero
+// values without taking disk space, and blocks are only allocated as pages
+// are written to. Drop gives the space of ranges no longer needed back to
+// the file system.
+//
+// A SparseArray is not safe for concurrent use.
+type SparseArray[T Fixed] struct {
+	file  *os.File
+	mmap  MMap
+	elems []T
+}
+
+// OpenSparseArray opens or creates the file at path and maps it as an array
+// of n values of type T, growing the file as needed. Values past the end of
+// a smaller existing file read as zero.
+func OpenSparseArray[T Fixed](path string, n int) (*SparseArray[T], error) {
+	var zero T
+	size := int64(n) * int64(unsafe.Sizeof(zero))
+	if n <= 0 || size/int64(unsafe.Sizeof(zero)) != int64(n) || int64(int(size)) != size {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fi.Size() < size {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	mmap, err := MapRegion(file.Fd(), 0, size, PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	elems, err := ViewAs[T](mmap)
+	if err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	return &SparseArray[T]{file: file, mmap: mmap, elems: elems}, nil
+}
+
+// Len returns the number of values in the array.
+func (a *SparseArray[T]) Len() int {
+	return len(a.elems)
+}
+
+// Get returns value i. It panics if i is out of range.
+func (a *SparseArray[T]) Get(i int) T {
+	return a.elems[i]
+}
+
+// Set sets value i to v. It panics if i is out of range.
+func (a *SparseArray[T]) Set(i int, v T) {
+	a.elems[i] = v
+}
+
+// Values returns the array as a slice aliasing the mapping, which is only
+// valid until the array is closed.
+func (a *SparseArray[T]) Values() []T {
+	return a.elems
+}
+
+// Drop resets values from to to-1 to zero, punching a hole in the file over
+// the whole pages they cover so their disk space is released. Where holes
+// can't be punched, the values are only zeroed.
+func (a *SparseArray[T]) Drop(from, to int) error {
+	if from < 0 || to > len(a.elems) || from > to {
+		return ErrOutOfBounds
+	}
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	start, end := from*size, to*size
+	pageSize := os.Getpagesize()
+	holeStart := (start + pageSize - 1) &^ (pageSize - 1)
+	holeEnd := end &^ (pageSize - 1)
+	if end == len(a.mmap) {
+		// The file ends here, so the hole may cover the last partial page.
+		holeEnd = end
+	}
+	reset := func(i, j int) {
+		for ; i < j; i++ {
+			a.elems[i] = zero
+		}
+	}
+	if holeStart < holeEnd {
+		err := punchHole(a.file.Fd(), int64(holeStart), int64(holeEnd-holeStart))
+		if err == nil {
+			// Only the values on the partial pages around the hole remain.
+			reset(from, holeStart/size)
+			reset(holeEnd/size, to)
+			return nil
+		}
+		if err != ErrUnsupported {
+			return err
+		}
+	}
+	reset(from, to)
+	return nil
+}
+
+// DiskUsage returns the number of bytes of disk space allocated to the
+// array's file.
+func (a *SparseArray[T]) DiskUsage() (int64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(a.file.Fd()), &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks) * 512, nil
+}
+
+// Sync flushes the array to its file.
+func (a *SparseArray[T]) Sync() error {
+	return a.mmap.Sync(MS_SYNC)
+}
+
+// Close flushes and unmaps the array, and closes its file.
+func (a *SparseArray[T]) Close() error {
+	if err := a.Sync(); err != nil {
+		return err
+	}
+	if err := a.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "os"
+
+// The Stack type is an anonymous mapping meant to be used as the stack of a
+// thread created outside of the Go runtime, such as by cgo code or a green
+// thread scheduler. Stacks grow down, so the usable memory ends at Top, and
+// an optional guard page below it turns an overflow into a crash instead of
+// silent corruption of the neighbouring mapping.
+type Stack struct {
+	mmap  MMap
+	guard int
+}
+
+// MapStack maps a stack of size usable bytes, rounded up to whole pages,
+// below which a PROT_NONE guard page is placed if guard is set. On Linux,
+// the mapping is flagged with MAP_STACK.
+func MapStack(size int64, guard bool) (*Stack, error) {
+	if size <= 0 {
+		return nil, ErrSize
+	}
+	pageSize := int64(os.Getpagesize())
+	size = (size + pageSize - 1) / pageSize * pageSize
+	s := &Stack{}
+	if guard {
+		s.guard = int(pageSize)
+	}
+	mmap, err := MapAnonymous(size+int64(s.guard), PROT_READ|PROT_WRITE, MAP_PRIVATE|mapStack)
+	if err != nil {
+		return nil, err
+	}
+	if guard {
+		if err := mmap[:s.guard].Protect(PROT_NONE); err != nil {
+			mmap.UnsafeUnmap()
+			return nil, err
+		}
+	}
+	s.mmap = mmap
+	return s, nil
+}
+
+// Bytes returns the usable memory of the stack, without its guard page.
+func (s *Stack) Bytes() []byte {
+	return s.mmap[s.guard:]
+}
+
+// Top returns the address just past the end of the stack, where a stack
+// pointer starts. It is page aligned, so it meets the alignment every ABI
+// requires.
+func (s *Stack) Top() uintptr {
+	return s.mmap.addr() + uintptr(len(s.mmap))
+}
+
+// Bottom returns the lowest usable address of the stack, right above the
+// guard page if there is one.
+func (s *Stack) Bottom() uintptr {
+	return s.mmap.addr() + uintptr(s.guard)
+}
+
+// Close unmaps the stack, which must no longer be in use by any thread.
+func (s *Stack) Close() error {
+	if s.mmap == nil {
+		return ErrClosed
+	}
+	err := s.mmap.UnsafeUnmap()
+	s.mmap = nil
+	return err
+}
@@ -0,0 +1,13 @@
+package gommap
+
+// mapStack is the flag marking a mapping as a thread stack.
+const mapStack = MAP_STACK
+
+// MapGrowsDown maps size bytes of anonymous memory with MAP_GROWSDOWN, so
+// that, like the stack of the main thread, it is extended downwards by the
+// kernel when a fault hits the page below it, up to the stack size limit.
+// The kernel keeps a gap below such mappings, so the mapping must be
+// touched downwards from its end, not at an arbitrary lower address.
+func MapGrowsDown(size int64) (MMap, error) {
+	return MapAnonymous(size, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_GROWSDOWN|MAP_STACK)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gommap
+
+// mapStack is the flag marking a mapping as a thread stack, which only
+// Linux has a use for.
+const mapStack MapFlags = 0
@@ -0,0 +1,253 @@
+package gommap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// Layout of a statistics region. The header is followed by a directory of
+// fixed-size entries, each holding a name, a kind and a 64-bit value.
+const (
+	statsMagic      = 0x54534d47 // "GMST"
+	statsMagicOff   = 0
+	statsCapOff     = 4
+	statsLockOff    = 8
+	statsCountOff   = 12
+	statsEntriesOff = 16
+
+	statsEntryWidth = 64
+	statsNameLen    = 48
+	statsKindOff    = 48
+	statsValueOff   = 56
+)
+
+// StatKind tells how the value of a statistic is meant to be read.
+type StatKind uint32
+
+const (
+	// A StatCounter only ever grows, and is read as a uint64.
+	StatCounter StatKind = 1
+	// A StatGauge goes up and down, and is read as an int64.
+	StatGauge StatKind = 2
+)
+
+// The Stats type lays out named counters and gauges in a shared mapping, so
+// that the processes mapping it read-write can publish metrics that others,
+// such as a sidecar mapping it read-only, scrape with plain memory loads.
+// Values are updated with atomic operations, and a directory at the start
+// of the region names them, so readers need no prior knowledge of what is
+// published.
+//
+// Statistics are registered by name under a ProcessMutex stored in the
+// region, and can't be removed. Registering a name again returns the
+// existing statistic, so every worker can register the statistics it uses
+// at startup.
+type Stats struct {
+	mmap  MMap
+	mu    *ProcessMutex
+	count *uint32
+	cap   int
+}
+
+// The Stat type is a statistic as listed by Stats.Snapshot.
+type Stat struct {
+	Name string
+	Kind StatKind
+	// Value holds the bits of the value; gauges should be read with Int.
+	Value uint64
+}
+
+// Int returns the value of a gauge.
+func (s Stat) Int() int64 {
+	return int64(s.Value)
+}
+
+// StatsRegionSize returns the size of a statistics region holding up to n
+// statistics.
+func StatsRegionSize(n int) int {
+	return statsEntriesOff + n*statsEntryWidth
+}
+
+func newStats(mmap MMap, n int) (*Stats, error) {
+	// Entries are a multiple of 8 bytes wide, so checking the first value
+	// is enough for all of them to be usable with sync/atomic.
+	if _, err := mmap.uint64Ptr(statsEntriesOff + statsValueOff); err != nil {
+		return nil, err
+	}
+	mu, err := NewProcessMutex(mmap, statsLockOff)
+	if err != nil {
+		return nil, err
+	}
+	count, err := mmap.uint32Ptr(statsCountOff)
+	if err != nil {
+		return nil, err
+	}
+	return &Stats{mmap: mmap, mu: mu, count: count, cap: n}, nil
+}
+
+// NewStats initializes an empty statistics region over mmap, with room for
+// as many statistics as fit. It must be called by a single process, before
+// any other opens the region.
+func NewStats(mmap MMap) (*Stats, error) {
+	if len(mmap) < StatsRegionSize(1) {
+		return nil, ErrSize
+	}
+	n := (len(mmap) - statsEntriesOff) / statsEntryWidth
+	s, err := newStats(mmap, n)
+	if err != nil {
+		return nil, err
+	}
+	copy(mmap[:statsEntriesOff], make([]byte, statsEntriesOff))
+	binary.LittleEndian.PutUint32(mmap[statsCapOff:], uint32(n))
+	binary.LittleEndian.PutUint32(mmap[statsMagicOff:], statsMagic)
+	return s, nil
+}
+
+// OpenStats returns the statistics region previously initialized with
+// NewStats over mmap, possibly by another process. The mapping may be
+// read-only, in which case statistics can be listed with Snapshot but not
+// registered. It returns ErrCorrupt if the header is invalid.
+func OpenStats(mmap MMap) (*Stats, error) {
+	if len(mmap) < statsEntriesOff || binary.LittleEndian.Uint32(mmap[statsMagicOff:]) != statsMagic {
+		return nil, ErrCorrupt
+	}
+	n := int(binary.LittleEndian.Uint32(mmap[statsCapOff:]))
+	if n == 0 || n > (len(mmap)-statsEntriesOff)/statsEntryWidth {
+		return nil, ErrCorrupt
+	}
+	return newStats(mmap, n)
+}
+
+// published returns the number of entries visible to readers.
+func (s *Stats) published() int {
+	n := int(atomic.LoadUint32(s.count))
+	if n > s.cap {
+		n = s.cap
+	}
+	return n
+}
+
+func (s *Stats) entry(i int) MMap {
+	off := statsEntriesOff + i*statsEntryWidth
+	return s.mmap[off : off+statsEntryWidth]
+}
+
+func (s *Stats) value(i int) *uint64 {
+	p, _ := s.mmap.uint64Ptr(statsEntriesOff + i*statsEntryWidth + statsValueOff)
+	return p
+}
+
+// entryName returns the name stored in a fixed-size field, padded with
+// zeros.
+func entryName(field []byte) []byte {
+	if i := bytes.IndexByte(field, 0); i >= 0 {
+		return field[:i]
+	}
+	return field
+}
+
+// register returns the value of the statistic named name, adding it to the
+// directory if needed.
+func (s *Stats) register(name string, kind StatKind) (*uint64, error) {
+	if len(name) == 0 || len(name) > statsNameLen {
+		return nil, ErrSize
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.published()
+	for i := 0; i < n; i++ {
+		e := s.entry(i)
+		if string(entryName(e[:statsNameLen])) != name {
+			continue
+		}
+		if StatKind(binary.LittleEndian.Uint32(e[statsKindOff:])) != kind {
+			return nil, ErrStatKind
+		}
+		return s.value(i), nil
+	}
+	if n == s.cap {
+		return nil, ErrFull
+	}
+	e := s.entry(n)
+	copy(e, make([]byte, statsEntryWidth))
+	copy(e, name)
+	binary.LittleEndian.PutUint32(e[statsKindOff:], uint32(kind))
+	// Publishing the entry last lets readers scan the directory without
+	// taking the lock.
+	atomic.StoreUint32(s.count, uint32(n+1))
+	return s.value(n), nil
+}
+
+// The Counter type is a statistic that only grows.
+type Counter struct {
+	p *uint64
+}
+
+// Counter returns the counter named name, registering it if needed. Names
+// are at most 48 bytes long. It returns ErrFull if the directory is full,
+// and ErrStatKind if name is registered as a gauge.
+func (s *Stats) Counter(name string) (Counter, error) {
+	p, err := s.register(name, StatCounter)
+	return Counter{p}, err
+}
+
+// Add atomically adds delta to the counter.
+func (c Counter) Add(delta uint64) {
+	atomic.AddUint64(c.p, delta)
+}
+
+// Inc atomically adds one to the counter.
+func (c Counter) Inc() {
+	atomic.AddUint64(c.p, 1)
+}
+
+// Load atomically loads the value of the counter.
+func (c Counter) Load() uint64 {
+	return atomic.LoadUint64(c.p)
+}
+
+// The Gauge type is a statistic that goes up and down.
+type Gauge struct {
+	p *uint64
+}
+
+// Gauge returns the gauge named name, registering it if needed. See
+// Stats.Counter.
+func (s *Stats) Gauge(name string) (Gauge, error) {
+	p, err := s.register(name, StatGauge)
+	return Gauge{p}, err
+}
+
+// Set atomically sets the value of the gauge.
+func (g Gauge) Set(v int64) {
+	atomic.StoreUint64(g.p, uint64(v))
+}
+
+// Add atomically adds delta, which may be negative, to the gauge.
+func (g Gauge) Add(delta int64) {
+	atomic.AddUint64(g.p, uint64(delta))
+}
+
+// Load atomically loads the value of the gauge.
+func (g Gauge) Load() int64 {
+	return int64(atomic.LoadUint64(g.p))
+}
+
+// Snapshot returns every statistic published so far, in registration order.
+// It takes no lock and only reads the mapping, so it works on a read-only
+// mapping. Each value is loaded atomically, but the values aren't read at a
+// single instant.
+func (s *Stats) Snapshot() []Stat {
+	n := s.published()
+	stats := make([]Stat, n)
+	for i := range stats {
+		e := s.entry(i)
+		stats[i] = Stat{
+			Name:  string(entryName(e[:statsNameLen])),
+			Kind:  StatKind(binary.LittleEndian.Uint32(e[statsKindOff:])),
+			Value: atomic.LoadUint64(s.value(i)),
+		}
+	}
+	return stats
+}
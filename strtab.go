@@ -0,0 +1,233 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Layout of a string table file: a header holding the end of the strings
+// appended so far, followed by the strings, each preceded by its length.
+const (
+	stMagic      = 0x42534d47 // "GMSB"
+	stMagicOff   = 0
+	stEndOff     = 8
+	stHeaderSize = 16
+	stLenSize    = 4
+)
+
+// The StringRef type is a handle on a string of a StringTable: the offset of
+// its bytes in the table and their length. Handles are 8 bytes, so they can
+// be stored in other mapped structures, and stay valid across restarts. The
+// zero StringRef is the empty string.
+type StringRef struct {
+	Off, Len uint32
+}
+
+// The StringTable type interns strings in a preallocated, mapped file, as
+// symbol tables and log dictionaries do: each distinct string is stored
+// once, and referred to by a StringRef. Strings are read in place, without
+// copying, and stay valid until the table is closed.
+//
+// The index deduplicating strings is kept in memory, and rebuilt by scanning
+// the file when it is opened. A StringTable is safe for concurrent use
+// within one process.
+type StringTable struct {
+	file *os.File
+	mmap MMap
+	end  *uint64
+
+	mu     sync.RWMutex
+	index  map[string]StringRef
+	closed bool
+}
+
+// OpenStringTable opens or creates the string table file at path, growing
+// it to size bytes if it is smaller. Tables must be smaller than 4 GB, as
+// handles hold 32-bit offsets.
+func OpenStringTable(path string, size int64) (*StringTable, error) {
+	if size <= stHeaderSize || size >= 1<<32 {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fi.Size() < size {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	mmap, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	t := &StringTable{file: file, mmap: mmap, index: make(map[string]StringRef)}
+	if err := t.load(); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// load initializes a new table, or indexes the strings of an existing one.
+func (t *StringTable) load() error {
+	if uint64(len(t.mmap)) >= 1<<32 {
+		return ErrCorrupt
+	}
+	t.end, _ = t.mmap.uint64Ptr(stEndOff)
+	switch binary.LittleEndian.Uint32(t.mmap[stMagicOff:]) {
+	case 0:
+		atomic.StoreUint64(t.end, stHeaderSize)
+		binary.LittleEndian.PutUint32(t.mmap[stMagicOff:], stMagic)
+		return nil
+	case stMagic:
+	default:
+		return ErrCorrupt
+	}
+	end := atomic.LoadUint64(t.end)
+	if end < stHeaderSize || end > uint64(len(t.mmap)) {
+		return ErrCorrupt
+	}
+	for off := uint64(stHeaderSize); off < end; {
+		if end-off < stLenSize {
+			return ErrCorrupt
+		}
+		n := uint64(binary.LittleEndian.Uint32(t.mmap[off:]))
+		off += stLenSize
+		if n > end-off {
+			return ErrCorrupt
+		}
+		ref := StringRef{uint32(off), uint32(n)}
+		t.index[t.view(ref)] = ref
+		off += n
+	}
+	return nil
+}
+
+// view returns the string ref refers to, without copying it.
+func (t *StringTable) view(ref StringRef) string {
+	b := t.mmap[ref.Off : ref.Off+ref.Len]
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// Intern returns the handle on s, appending it to the table if it isn't
+// there yet. It returns ErrFull if the table has no room left for s.
+func (t *StringTable) Intern(s string) (StringRef, error) {
+	if len(s) == 0 {
+		return StringRef{}, nil
+	}
+	t.mu.RLock()
+	ref, ok := t.index[s]
+	closed := t.closed
+	t.mu.RUnlock()
+	if closed {
+		return StringRef{}, ErrClosed
+	}
+	if ok {
+		return ref, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return StringRef{}, ErrClosed
+	}
+	if ref, ok := t.index[s]; ok {
+		return ref, nil
+	}
+	end := atomic.LoadUint64(t.end)
+	if room := uint64(len(t.mmap)) - end; room < stLenSize || uint64(len(s)) > room-stLenSize {
+		return StringRef{}, ErrFull
+	}
+	binary.LittleEndian.PutUint32(t.mmap[end:], uint32(len(s)))
+	copy(t.mmap[end+stLenSize:], s)
+	ref = StringRef{uint32(end + stLenSize), uint32(len(s))}
+	// The end is moved once the string is in place, so a crash never
+	// leaves the table pointing past what was written.
+	atomic.StoreUint64(t.end, end+stLenSize+uint64(len(s)))
+	t.index[t.view(ref)] = ref
+	return ref, nil
+}
+
+// Lookup returns the handle on s, if it has been interned.
+func (t *StringTable) Lookup(s string) (StringRef, bool) {
+	if len(s) == 0 {
+		return StringRef{}, true
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ref, ok := t.index[s]
+	return ref, ok
+}
+
+// String returns the string ref refers to, pointing into the mapping
+// without copying it. It is only valid until the table is closed, and must
+// be copied to outlive it. It returns ErrOutOfBounds if ref doesn't refer
+// to a string of the table.
+func (t *StringTable) String(ref StringRef) (string, error) {
+	if ref.Len == 0 {
+		return "", nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return "", ErrClosed
+	}
+	off, n := uint64(ref.Off), uint64(ref.Len)
+	if off < stHeaderSize+stLenSize || off+n > atomic.LoadUint64(t.end) ||
+		binary.LittleEndian.Uint32(t.mmap[off-stLenSize:]) != ref.Len {
+		return "", ErrOutOfBounds
+	}
+	return t.view(ref), nil
+}
+
+// Len returns the number of distinct strings in the table.
+func (t *StringTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.index)
+}
+
+// Sync flushes the strings interned so far to the file.
+func (t *StringTable) Sync() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return ErrClosed
+	}
+	return t.mmap.Sync(MS_SYNC)
+}
+
+// Close syncs the table, and unmaps and closes its file. The strings
+// returned by String become invalid.
+func (t *StringTable) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	t.closed = true
+	t.index = nil
+	err := t.mmap.Sync(MS_SYNC)
+	if uerr := t.mmap.UnsafeUnmap(); uerr != nil && err == nil {
+		err = uerr
+	}
+	if cerr := t.file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
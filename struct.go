@@ -0,0 +1,106 @@
+package gommap
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// checkLayout verifies that values of type t can live in mapped memory: they
+// must not contain pointers, and their layout must not depend on the
+// platform.
+func checkLayout(t reflect.Type) error {
+	if t == nil {
+		return fmt.Errorf("%w: interface types have no layout", ErrLayout)
+	}
+	_, err := portableAlign(t)
+	return err
+}
+
+// portableAlign returns the alignment of t on 64-bit platforms, checking its
+// layout on the way. Some 32-bit platforms align 64-bit fields to 4 bytes
+// only, so the padding the compiler inserts differs between platforms;
+// structs must therefore have no implicit padding at all, with every field
+// aligned to its size, and any padding spelled out as blank fields.
+func portableAlign(t reflect.Type) (uintptr, error) {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t.Size(), nil
+	case reflect.Complex64, reflect.Complex128:
+		return t.Size() / 2, nil
+	case reflect.Array:
+		return portableAlign(t.Elem())
+	case reflect.Struct:
+		align, end := uintptr(1), uintptr(0)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			a, err := portableAlign(f.Type)
+			if err != nil {
+				return 0, err
+			}
+			if f.Offset != end || f.Offset%a != 0 {
+				return 0, fmt.Errorf("%w: field %s of %s needs explicit padding before it", ErrLayout, f.Name, t)
+			}
+			end += f.Type.Size()
+			if a > align {
+				align = a
+			}
+		}
+		if t.Size() != end || end%align != 0 {
+			return 0, fmt.Errorf("%w: %s needs explicit padding at its end", ErrLayout, t)
+		}
+		return align, nil
+	}
+	return 0, fmt.Errorf("%w: %s has kind %s", ErrLayout, t, t.Kind())
+}
+
+// StructAt returns a pointer to a T laid over m at the given offset. T must
+// not contain pointers, slices, strings, maps or platform-sized integers, nor
+// padding left for the compiler to insert, and the offset must be suitably
+// aligned for T within the mapping.
+//
+// The returned pointer aliases m and follows the same lifetime rules; see the
+// package documentation.
+func StructAt[T any](m MMap, offset int) (*T, error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if err := checkLayout(t); err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset+int(t.Size()) > len(m) {
+		return nil, ErrSize
+	}
+	if t.Size() == 0 {
+		return &zero, nil
+	}
+	p := unsafe.Pointer(&m[offset])
+	if uintptr(p)%uintptr(t.Align()) != 0 {
+		return nil, ErrUnaligned
+	}
+	return (*T)(p), nil
+}
+
+// MapStruct maps the region of the provided file or device that starts at
+// offset and spans the size of T, and returns it as a *T. The mapping backing
+// the value is returned as well, so it can be synced and eventually unmapped.
+// See StructAt for the restrictions on T.
+func MapStruct[T any](fd uintptr, offset int64, prot ProtFlags, flags MapFlags) (*T, MMap, error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if err := checkLayout(t); err != nil {
+		return nil, nil, err
+	}
+	mmap, err := MapRegion(fd, offset, int64(t.Size()), prot, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := StructAt[T](mmap, 0)
+	if err != nil {
+		mmap.UnsafeUnmap()
+		return nil, nil, err
+	}
+	return v, mmap, nil
+}
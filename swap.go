@@ -0,0 +1,97 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "sync/atomic"
+
+// The mappingRef type counts the users of a mapping held by a Mapping: the
+// Mapping itself while the mapping is current, and readers that called
+// Acquire. The mapping is unmapped when the count drops to zero.
+type mappingRef struct {
+	// refs comes first to be 64-bit aligned for sync/atomic on 32-bit
+	// platforms.
+	refs int64
+	h    mapHandle
+}
+
+func newMappingRef(mmap MMap) *mappingRef {
+	return &mappingRef{refs: 1, h: handleOf(mmap)}
+}
+
+// inUse reports whether readers hold the mapping besides the Mapping.
+func (r *mappingRef) inUse() bool {
+	return atomic.LoadInt64(&r.refs) > 1
+}
+
+func (r *mappingRef) acquire() {
+	atomic.AddInt64(&r.refs, 1)
+}
+
+func (r *mappingRef) release() error {
+	if atomic.AddInt64(&r.refs, -1) == 0 {
+		return r.h.unmap()
+	}
+	return nil
+}
+
+// replace makes mmap the current mapping, and lets go of the previous one,
+// which is unmapped once the readers still using it are done. It must be
+// called with m.mu held for writing.
+func (m *Mapping) replace(mmap MMap) error {
+	old := m.ref
+	m.mmap, m.ref = mmap, newMappingRef(mmap)
+	return old.release()
+}
+
+// Acquire returns the current mapped memory and a function releasing it.
+// Unlike with Bytes, the memory stays mapped until released even if the
+// mapping is switched to another file by SwapTo, grown by Refresh, or
+// closed meanwhile. The release function must be called exactly once.
+func (m *Mapping) Acquire() (MMap, func(), error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err := m.check(); err != nil {
+		return nil, nil, err
+	}
+	ref := m.ref
+	ref.acquire()
+	return ref.h.bytes(), func() { ref.release() }, nil
+}
+
+// SwapTo maps the whole file at fd with the protection and flags of the
+// mapping, and atomically makes the new mapping the one exposed by the
+// handle, as done when a compaction has rewritten the data to a new file.
+// If prefault is set, the new mapping is paged in before the switch, so
+// readers don't take faults right after it. The previous mapping is
+// unmapped once the readers that acquired it are done.
+//
+// File locks and other resources acquired by options keep applying to the
+// original file until the mapping is closed.
+func (m *Mapping) SwapTo(fd uintptr, prefault bool) error {
+	m.mu.RLock()
+	err := m.check()
+	prot, flags, sums := m.prot, m.flags, m.sums
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if sums != nil {
+		return ErrUnsupported
+	}
+	mmap, err := MapRegion(fd, 0, -1, prot, flags)
+	if err != nil {
+		return err
+	}
+	if prefault {
+		mmap.Prefault()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(); err != nil && err != ErrFileTruncated {
+		mmap.UnsafeUnmap()
+		return err
+	}
+	m.fd, m.offset, m.invalid = fd, 0, nil
+	return m.replace(mmap)
+}
@@ -0,0 +1,223 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"os/exec"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestProcessMutex(c *C) {
+	// Two separate mappings of the same file stand in for two processes.
+	m1, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m1.UnsafeUnmap()
+	m2, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m2.UnsafeUnmap()
+	for i := range m1 {
+		m1[i] = 0
+	}
+
+	var wg sync.WaitGroup
+	for _, m := range []MMap{m1, m2} {
+		mu, err := NewProcessMutex(m, 0)
+		c.Assert(err, IsNil)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(m MMap) {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					mu.Lock()
+					m[8]++
+					mu.Unlock()
+				}
+			}(m)
+		}
+	}
+	wg.Wait()
+	c.Assert(m1[8], Equals, byte(8000%256))
+
+	mu, err := NewProcessMutex(m1, 0)
+	c.Assert(err, IsNil)
+	c.Assert(mu.TryLock(), Equals, true)
+	c.Assert(mu.TryLock(), Equals, false)
+	mu.Unlock()
+
+	_, err = NewProcessMutex(m1, 2)
+	c.Assert(err, Equals, ErrUnaligned)
+}
+
+func (s *S) TestProcessRWMutex(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := range mmap {
+		mmap[i] = 0
+	}
+
+	rw, err := NewProcessRWMutex(mmap, 0)
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	var torn bool
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				rw.Lock()
+				mmap[12]++
+				mmap[13] = mmap[12]
+				rw.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				rw.RLock()
+				if mmap[12] != mmap[13] {
+					torn = true
+				}
+				rw.RUnlock()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Assert(torn, Equals, false)
+	c.Assert(mmap[12], Equals, byte(2000%256))
+}
+
+func (s *S) TestSeqLock(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := range mmap {
+		mmap[i] = 0
+	}
+
+	l, err := NewSeqLock(mmap, 0)
+	c.Assert(err, IsNil)
+
+	done := make(chan bool)
+	go func() {
+		for j := 1; j <= 1000; j++ {
+			l.BeginWrite()
+			mmap[8] = byte(j)
+			mmap[9] = byte(j)
+			l.EndWrite()
+		}
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		var a, b byte
+		l.Read(func() {
+			a, b = mmap[8], mmap[9]
+		})
+		c.Assert(a, Equals, b)
+	}
+
+	_, err = NewSeqLock(mmap, 4)
+	c.Assert(err, Equals, ErrUnaligned)
+}
+
+func (s *S) TestRobustMutex(c *C) {
+	mmap, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer mmap.UnsafeUnmap()
+	for i := range mmap {
+		mmap[i] = 0
+	}
+	mu, err := NewRobustMutex(mmap, 0)
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Check(mu.Lock(), IsNil)
+				mmap[8]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Assert(mmap[8], Equals, byte(4000%256))
+
+	// A process that has exited and been reaped stands in for an owner
+	// that crashed while holding the lock.
+	cmd := exec.Command("true")
+	c.Assert(cmd.Run(), IsNil)
+	binary.LittleEndian.PutUint32(mmap, uint32(cmd.Process.Pid))
+	c.Assert(mu.Owner(), Equals, cmd.Process.Pid)
+	c.Assert(mu.Lock(), Equals, ErrOwnerDead)
+	c.Assert(mu.Consistent(), Equals, false)
+	mu.Unlock()
+
+	// Until the data is repaired, every holder is told about it.
+	locked, err := mu.TryLock()
+	c.Assert(locked, Equals, true)
+	c.Assert(err, Equals, ErrOwnerDead)
+	mu.MarkConsistent()
+	mu.Unlock()
+	c.Assert(mu.Lock(), IsNil)
+	locked, err = mu.TryLock()
+	c.Assert(locked, Equals, false)
+	c.Assert(err, IsNil)
+	mu.Unlock()
+	c.Assert(mu.Owner(), Equals, 0)
+}
+
+func (s *S) TestProcessSemaphore(c *C) {
+	m1, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m1.UnsafeUnmap()
+	m2, err := Map(s.file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	c.Assert(err, IsNil)
+	defer m2.UnsafeUnmap()
+	for i := range m1 {
+		m1[i] = 0
+	}
+	producer, err := NewProcessSemaphore(m1, 0)
+	c.Assert(err, IsNil)
+	consumer, err := NewProcessSemaphore(m2, 0)
+	c.Assert(err, IsNil)
+
+	c.Assert(consumer.TryAcquire(), Equals, false)
+	c.Assert(consumer.AcquireTimeout(time.Millisecond), Equals, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				consumer.Acquire()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		producer.Release(4)
+	}
+	wg.Wait()
+	c.Assert(producer.Value(), Equals, 0)
+
+	producer.Release(2)
+	c.Assert(consumer.Value(), Equals, 2)
+	c.Assert(consumer.AcquireTimeout(time.Second), Equals, true)
+
+	_, err = NewProcessSemaphore(m1, len(m1)-4)
+	c.Assert(err, Equals, ErrOutOfBounds)
+}
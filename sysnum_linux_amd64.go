@@ -0,0 +1,19 @@
+package gommap
+
+// System calls missing from the syscall package.
+const (
+	_SYS_MEMFD_CREATE      = 319
+	_SYS_COPY_FILE_RANGE   = 326
+	_SYS_IO_URING_SETUP    = 425
+	_SYS_IO_URING_ENTER    = 426
+	_SYS_PIDFD_OPEN        = 434
+	_SYS_PIDFD_GETFD       = 438
+	_SYS_PROCESS_MADVISE   = 440
+	_SYS_PROCESS_VM_READV  = 310
+	_SYS_PROCESS_VM_WRITEV = 311
+	_SYS_PKEY_MPROTECT     = 329
+	_SYS_PKEY_ALLOC        = 330
+	_SYS_PKEY_FREE         = 331
+	_SYS_STATX             = 332
+	_SYS_VMSPLICE          = 278
+)
@@ -0,0 +1,16 @@
+package gommap
+
+// System calls missing from the syscall package.
+const (
+	_SYS_MEMFD_CREATE      = 385
+	_SYS_COPY_FILE_RANGE   = 391
+	_SYS_IO_URING_SETUP    = 425
+	_SYS_IO_URING_ENTER    = 426
+	_SYS_PIDFD_OPEN        = 434
+	_SYS_PIDFD_GETFD       = 438
+	_SYS_PROCESS_MADVISE   = 440
+	_SYS_PROCESS_VM_READV  = 376
+	_SYS_PROCESS_VM_WRITEV = 377
+	_SYS_STATX             = 397
+	_SYS_VMSPLICE          = 343
+)
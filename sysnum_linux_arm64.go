@@ -0,0 +1,16 @@
+package gommap
+
+// System calls missing from the syscall package.
+const (
+	_SYS_MEMFD_CREATE      = 279
+	_SYS_COPY_FILE_RANGE   = 285
+	_SYS_IO_URING_SETUP    = 425
+	_SYS_IO_URING_ENTER    = 426
+	_SYS_PIDFD_OPEN        = 434
+	_SYS_PIDFD_GETFD       = 438
+	_SYS_PROCESS_MADVISE   = 440
+	_SYS_PROCESS_VM_READV  = 270
+	_SYS_PROCESS_VM_WRITEV = 271
+	_SYS_STATX             = 291
+	_SYS_VMSPLICE          = 75
+)
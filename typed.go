@@ -0,0 +1,33 @@
+package gommap
+
+import "unsafe"
+
+// Fixed is the set of types with a fixed size and no pointers that can be
+// laid over mapped memory directly.
+type Fixed interface {
+	~int8 | ~int16 | ~int32 | ~int64 |
+		~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64 | ~complex64 | ~complex128
+}
+
+// ViewAs reinterprets the mapped memory in m as a slice of T without copying.
+// It returns ErrUnaligned if m doesn't start on a boundary suitable for T, and
+// ErrSize if the length of m is not a multiple of the size of T.
+//
+// The returned slice aliases m and follows the same lifetime rules; see the
+// package documentation.
+func ViewAs[T Fixed](m MMap) ([]T, error) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	if len(m)%size != 0 {
+		return nil, ErrSize
+	}
+	if len(m) == 0 {
+		return []T{}, nil
+	}
+	p := unsafe.Pointer(&m[0])
+	if uintptr(p)%unsafe.Alignof(zero) != 0 {
+		return nil, ErrUnaligned
+	}
+	return unsafe.Slice((*T)(p), len(m)/size), nil
+}
@@ -0,0 +1,129 @@
+package gommap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	uioClassDir = "/sys/class/uio"
+	pciDevsDir  = "/sys/bus/pci/devices"
+)
+
+// The UIOMap type describes one memory region of a UIO device, as listed
+// in sysfs.
+type UIOMap struct {
+	Name string
+	// Addr is the physical address of the region.
+	Addr uint64
+	Size int64
+	// Offset is where the region starts within the mapped pages.
+	Offset int64
+}
+
+// The UIODevice type is a device driven from user space through the
+// Userspace I/O framework, whose memory regions are mapped from
+// /dev/uioN.
+type UIODevice struct {
+	Name string
+	Maps []UIOMap
+	dev  string
+}
+
+// OpenUIO returns the UIO device named name, such as "uio0", with the
+// memory regions listed under /sys/class/uio.
+func OpenUIO(name string) (*UIODevice, error) {
+	return openUIO(filepath.Join(uioClassDir, name), filepath.Join("/dev", name))
+}
+
+func openUIO(sysDir, dev string) (*UIODevice, error) {
+	driver, err := readSysfs(filepath.Join(sysDir, "name"))
+	if err != nil {
+		return nil, err
+	}
+	d := &UIODevice{Name: driver, dev: dev}
+	for i := 0; ; i++ {
+		dir := filepath.Join(sysDir, "maps", fmt.Sprintf("map%d", i))
+		size, err := readSysfs(filepath.Join(dir, "size"))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		addr, err := readSysfs(filepath.Join(dir, "addr"))
+		if err != nil {
+			return nil, err
+		}
+		m := UIOMap{}
+		if m.Size, err = strconv.ParseInt(size, 0, 64); err != nil {
+			return nil, ErrCorrupt
+		}
+		if m.Addr, err = strconv.ParseUint(addr, 0, 64); err != nil {
+			return nil, ErrCorrupt
+		}
+		m.Offset = int64(m.Addr % uint64(os.Getpagesize()))
+		if offset, err := readSysfs(filepath.Join(dir, "offset")); err == nil {
+			if m.Offset, err = strconv.ParseInt(offset, 0, 64); err != nil {
+				return nil, ErrCorrupt
+			}
+		}
+		// Only recent kernels name the regions.
+		m.Name, _ = readSysfs(filepath.Join(dir, "name"))
+		d.Maps = append(d.Maps, m)
+	}
+	return d, nil
+}
+
+// readSysfs returns the contents of a sysfs attribute, without the trailing
+// newline.
+func readSysfs(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Map maps the memory region i of the device read-write. The kernel maps
+// region i at offset i pages of the device file, starting at the page that
+// holds its physical address, so the registers are found Offset bytes into
+// the mapping.
+func (d *UIODevice) Map(i int) (*MMIO, error) {
+	if i < 0 || i >= len(d.Maps) {
+		return nil, ErrOutOfBounds
+	}
+	m := d.Maps[i]
+	if m.Offset < 0 || m.Size <= 0 {
+		return nil, ErrCorrupt
+	}
+	length := PageAlignUp(m.Offset + m.Size)
+	mmap, err := MapDevicePath(d.dev, int64(i)*int64(os.Getpagesize()), length, PROT_READ|PROT_WRITE)
+	if err != nil {
+		return nil, err
+	}
+	return &MMIO{mmap: mmap, regs: mmap[m.Offset : m.Offset+m.Size]}, nil
+}
+
+// MapPCIResource maps the base address register bar of the PCI device at
+// address addr, such as "0000:01:00.0", through its sysfs resource file.
+// It needs root privileges, and the BAR must be a memory one, not an I/O
+// port one.
+func MapPCIResource(addr string, bar int) (*MMIO, error) {
+	return mapPCIResource(filepath.Join(pciDevsDir, addr, fmt.Sprintf("resource%d", bar)))
+}
+
+func mapPCIResource(path string) (*MMIO, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	mmap, err := MapDevicePath(path, 0, info.Size(), PROT_READ|PROT_WRITE)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMIO(mmap), nil
+}
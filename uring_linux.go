@@ -0,0 +1,337 @@
+package gommap
+
+import (
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Definitions from linux/io_uring.h.
+const (
+	_IORING_OFF_SQ_RING = 0x0
+	_IORING_OFF_CQ_RING = 0x8000000
+	_IORING_OFF_SQES    = 0x10000000
+
+	_IORING_ENTER_GETEVENTS = 0x1
+
+	_IORING_OP_NOP             = 0
+	_IORING_OP_FSYNC           = 3
+	_IORING_OP_SYNC_FILE_RANGE = 8
+	_IORING_OP_MADVISE         = 25
+
+	_IORING_FSYNC_DATASYNC = 0x1
+
+	_SYNC_FILE_RANGE_WAIT_BEFORE = 0x1
+	_SYNC_FILE_RANGE_WRITE       = 0x2
+	_SYNC_FILE_RANGE_WAIT_AFTER  = 0x4
+
+	uringSQESize = 64
+	uringCQESize = 16
+)
+
+// uringCloseTag is the tag of the request waking up the completion reaper
+// when the ring is closed.
+const uringCloseTag = ^uint64(0)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	pad         [2]uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// The Completion type reports the outcome of a request queued on an IOUring.
+type Completion struct {
+	// Tag is the value given when queuing the request.
+	Tag uint64
+	Err error
+}
+
+// The IOUring type batches flushes and readahead requests for many ranges
+// through io_uring, so that thousands of them cost a single system call
+// instead of one blocking call each. Requests are queued with Sync, Fsync
+// and Readahead, handed to the kernel with Submit, and their completions
+// delivered on the channel returned by Completions, in no particular order.
+//
+// An IOUring is safe for concurrent use. It is only available on Linux 5.6
+// and later, and may be disabled by the system administrator.
+type IOUring struct {
+	fd      int
+	entries uint32
+	sqRing  MMap
+	cqRing  MMap
+	sqes    MMap
+	params  uringParams
+
+	mu      sync.Mutex
+	pending uint32
+	closed  bool
+
+	c    chan Completion
+	done chan struct{}
+}
+
+// NewIOUring creates an io_uring able to hold entries requests queued but
+// not yet submitted. The kernel may round entries up.
+func NewIOUring(entries int) (*IOUring, error) {
+	r := &IOUring{}
+	fd, _, errno := syscall.Syscall(_SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&r.params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	r.fd = int(fd)
+	p := &r.params
+	r.entries = p.sqEntries
+	var err error
+	if r.sqRing, err = MapRegion(fd, _IORING_OFF_SQ_RING, int64(p.sqOff.array+p.sqEntries*4), PROT_READ|PROT_WRITE, MAP_SHARED|MAP_POPULATE); err == nil {
+		if r.cqRing, err = MapRegion(fd, _IORING_OFF_CQ_RING, int64(p.cqOff.cqes+p.cqEntries*uringCQESize), PROT_READ|PROT_WRITE, MAP_SHARED|MAP_POPULATE); err == nil {
+			r.sqes, err = MapRegion(fd, _IORING_OFF_SQES, int64(p.sqEntries*uringSQESize), PROT_READ|PROT_WRITE, MAP_SHARED|MAP_POPULATE)
+		}
+	}
+	if err != nil {
+		r.release()
+		return nil, err
+	}
+	r.c = make(chan Completion, p.cqEntries)
+	r.done = make(chan struct{})
+	go r.reap()
+	return r, nil
+}
+
+func (r *IOUring) release() {
+	for _, m := range []MMap{r.sqRing, r.cqRing, r.sqes} {
+		if m != nil {
+			m.UnsafeUnmap()
+		}
+	}
+	syscall.Close(r.fd)
+}
+
+func ringWord(ring MMap, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[off]))
+}
+
+func (r *IOUring) enter(submit, wait uint32, flags uintptr) (uint32, error) {
+	n, _, errno := syscall.Syscall6(_SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(submit), uintptr(wait), flags, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return uint32(n), nil
+}
+
+// push queues a request filled in by fill. It must be called with r.mu held.
+func (r *IOUring) push(fill func(sqe *uringSQE)) error {
+	head := atomic.LoadUint32(ringWord(r.sqRing, r.params.sqOff.head))
+	tail := *ringWord(r.sqRing, r.params.sqOff.tail)
+	if tail-head >= r.entries {
+		return ErrFull
+	}
+	idx := tail & *ringWord(r.sqRing, r.params.sqOff.ringMask)
+	sqe := (*uringSQE)(unsafe.Pointer(&r.sqes[idx*uringSQESize]))
+	*sqe = uringSQE{}
+	fill(sqe)
+	*ringWord(r.sqRing, r.params.sqOff.array+4*idx) = idx
+	atomic.StoreUint32(ringWord(r.sqRing, r.params.sqOff.tail), tail+1)
+	r.pending++
+	return nil
+}
+
+// queue queues a request, submitting the pending ones first if the
+// submission queue is full.
+func (r *IOUring) queue(tag uint64, fill func(sqe *uringSQE)) error {
+	if tag == uringCloseTag {
+		return ErrSize
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	fillTagged := func(sqe *uringSQE) {
+		fill(sqe)
+		sqe.userData = tag
+	}
+	if err := r.push(fillTagged); err != ErrFull {
+		return err
+	}
+	if _, err := r.submit(); err != nil {
+		return err
+	}
+	return r.push(fillTagged)
+}
+
+// Sync queues a request flushing n bytes of m starting at off, relative to
+// the start of the mapping, to the backing file, like MMap.Sync with
+// MS_SYNC does. The mapping must be a shared one and must not be closed
+// before the completion is received.
+func (r *IOUring) Sync(m *Mapping, off, n int64, tag uint64) error {
+	m.mu.RLock()
+	fd, offset, length, err := m.fd, m.offset, int64(len(m.mmap)), m.check()
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if off < 0 || n < 0 || off > length || n > length-off || n > 1<<32-1 {
+		return ErrOutOfBounds
+	}
+	return r.queue(tag, func(sqe *uringSQE) {
+		sqe.opcode = _IORING_OP_SYNC_FILE_RANGE
+		sqe.fd = int32(fd)
+		sqe.off = uint64(offset + off)
+		sqe.len = uint32(n)
+		sqe.opFlags = _SYNC_FILE_RANGE_WAIT_BEFORE | _SYNC_FILE_RANGE_WRITE | _SYNC_FILE_RANGE_WAIT_AFTER
+	})
+}
+
+// Fsync queues a request flushing the file at fd to its device, including
+// its metadata unless datasync is set, like fsync and fdatasync do.
+func (r *IOUring) Fsync(fd uintptr, datasync bool, tag uint64) error {
+	return r.queue(tag, func(sqe *uringSQE) {
+		sqe.opcode = _IORING_OP_FSYNC
+		sqe.fd = int32(fd)
+		if datasync {
+			sqe.opFlags = _IORING_FSYNC_DATASYNC
+		}
+	})
+}
+
+// Readahead queues a request asking the kernel to page in mmap, like
+// advising it with MADV_WILLNEED does.
+func (r *IOUring) Readahead(mmap MMap, tag uint64) error {
+	aligned := pageAligned(mmap)
+	if uint64(len(aligned)) > 1<<32-1 {
+		return ErrSize
+	}
+	return r.queue(tag, func(sqe *uringSQE) {
+		sqe.opcode = _IORING_OP_MADVISE
+		if len(aligned) > 0 {
+			sqe.addr = uint64(aligned.addr())
+		}
+		sqe.len = uint32(len(aligned))
+		sqe.opFlags = uint32(MADV_WILLNEED)
+	})
+}
+
+func (r *IOUring) submit() (int, error) {
+	if r.pending == 0 {
+		return 0, nil
+	}
+	n, err := r.enter(r.pending, 0, 0)
+	r.pending -= n
+	return int(n), err
+}
+
+// Submit hands the queued requests to the kernel, and returns how many were
+// submitted.
+func (r *IOUring) Submit() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, ErrClosed
+	}
+	return r.submit()
+}
+
+// Completions returns the channel on which the outcome of each submitted
+// request is delivered. It is closed when the ring is. The channel must be
+// drained, or the kernel eventually stops accepting requests.
+func (r *IOUring) Completions() <-chan Completion {
+	return r.c
+}
+
+// reap delivers completions until the wake-up request sent by Close is
+// received.
+func (r *IOUring) reap() {
+	defer close(r.done)
+	defer close(r.c)
+	cqHead := ringWord(r.cqRing, r.params.cqOff.head)
+	cqTail := ringWord(r.cqRing, r.params.cqOff.tail)
+	mask := *ringWord(r.cqRing, r.params.cqOff.ringMask)
+	closing := false
+	for {
+		for head := *cqHead; head != atomic.LoadUint32(cqTail); head++ {
+			cqe := *(*uringCQE)(unsafe.Pointer(&r.cqRing[r.params.cqOff.cqes+(head&mask)*uringCQESize]))
+			atomic.StoreUint32(cqHead, head+1)
+			if cqe.userData == uringCloseTag {
+				closing = true
+				continue
+			}
+			c := Completion{Tag: cqe.userData}
+			if cqe.res < 0 {
+				c.Err = syscall.Errno(-cqe.res)
+			}
+			r.c <- c
+		}
+		if closing {
+			return
+		}
+		if _, err := r.enter(0, 1, _IORING_ENTER_GETEVENTS); err != nil && err != syscall.EINTR {
+			return
+		}
+	}
+}
+
+// Close waits for the requests already submitted to complete, and releases
+// the ring. Completions not yet received are dropped. Requests queued but not
+// submitted are discarded.
+func (r *IOUring) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	r.closed = true
+	// Discard the requests never submitted, then wake the reaper up.
+	tail := ringWord(r.sqRing, r.params.sqOff.tail)
+	atomic.StoreUint32(tail, *tail-r.pending)
+	r.pending = 0
+	err := r.push(func(sqe *uringSQE) {
+		sqe.opcode = _IORING_OP_NOP
+		sqe.userData = uringCloseTag
+	})
+	if err == nil {
+		_, err = r.submit()
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for range r.c {
+	}
+	<-r.done
+	r.release()
+	return nil
+}
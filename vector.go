@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "os"
+
+// The VectorBuilder type maps several regions of a file next to each other
+// in memory, so that they can be accessed as a single slice even though they
+// aren't contiguous in the file; for instance to skip headers interleaved
+// with the data:
+//
+//	mmap, err := gommap.NewVectorBuilder(fd, gommap.PROT_READ, gommap.MAP_SHARED).
+//		Add(4096, 1<<20).
+//		Add(4096+1<<20+4096, 1<<20).
+//		Map()
+//
+// Regions must start at an offset that is a multiple of the page size, and
+// all but the last must have a length that is a multiple of the page size,
+// so that each region ends where the next one starts in memory.
+type VectorBuilder struct {
+	fd      uintptr
+	prot    ProtFlags
+	flags   MapFlags
+	regions [][2]int64
+}
+
+// NewVectorBuilder returns a builder mapping regions of the file at fd with
+// the given protection and flags.
+func NewVectorBuilder(fd uintptr, prot ProtFlags, flags MapFlags) *VectorBuilder {
+	return &VectorBuilder{fd: fd, prot: prot, flags: flags}
+}
+
+// Add appends length bytes of the file starting at offset to the mapping.
+func (b *VectorBuilder) Add(offset, length int64) *VectorBuilder {
+	b.regions = append(b.regions, [2]int64{offset, length})
+	return b
+}
+
+// Map maps the regions added so far, in order, into a single range of
+// memory. It returns ErrUnaligned if a region doesn't meet the alignment
+// rules, and ErrSize if there's no region or one of them is empty. The whole
+// mapping is released by calling UnsafeUnmap on it.
+func (b *VectorBuilder) Map() (MMap, error) {
+	pageSize := int64(os.Getpagesize())
+	var total int64
+	for i, r := range b.regions {
+		if r[1] <= 0 {
+			return nil, ErrSize
+		}
+		if r[0]%pageSize != 0 || (i < len(b.regions)-1 && r[1]%pageSize != 0) {
+			return nil, ErrUnaligned
+		}
+		total += r[1]
+	}
+	if total == 0 {
+		return nil, ErrSize
+	}
+
+	// Reserve the whole range first so nothing else can be placed between the
+	// regions, then map each region over its part of the reservation.
+	mmap, err := MapAnonymous(total, PROT_NONE, MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	addr := mmap.addr()
+	for _, r := range b.regions {
+		if _, err := MapAt(addr, b.fd, r[0], r[1], b.prot, b.flags|MAP_FIXED); err != nil {
+			mmap.UnsafeUnmap()
+			return nil, err
+		}
+		addr += uintptr(r[1])
+	}
+	return mmap, nil
+}
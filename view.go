@@ -0,0 +1,190 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import "os"
+
+// The View type is a window over a sub-range of a root MMap. Unlike a plain
+// slice of the mapping, a View remembers where it sits within its parent, so
+// operations that the kernel only accepts on page boundaries (Sync, Advise,
+// Lock, ...) can be widened to the enclosing pages before being issued.
+//
+// A View can't be unmapped; only the root MMap it was taken from can.
+type View struct {
+	root   MMap
+	offset int
+	length int
+}
+
+// View returns a View over length bytes of mmap starting at offset. It panics
+// if the range doesn't fit in mmap, just like slicing would.
+func (mmap MMap) View(offset, length int) View {
+	if offset < 0 || length < 0 || offset+length > len(mmap) {
+		panic("gommap: view out of range")
+	}
+	return View{root: mmap, offset: offset, length: length}
+}
+
+// Split cuts mmap into at most n views of about the same size, for handing
+// out to a pool of workers. Views end on page boundaries, so operations on
+// one view never touch the pages of another, and all but the first and last
+// are the same size; fewer than n views are returned when mmap spans fewer
+// than n pages. Unlike Chunks, which walks mmap sequentially, the views are
+// meant to be processed concurrently. It panics if n is not positive.
+func (mmap MMap) Split(n int) []View {
+	if n <= 0 {
+		panic("gommap: split count must be positive")
+	}
+	size := (pageSkew(mmap) + len(mmap) + n - 1) / n
+	if size == 0 {
+		return nil
+	}
+	return mmap.SplitBySize(size)
+}
+
+// SplitBySize cuts mmap into consecutive views of size bytes, rounded up to a
+// multiple of the page size, the last one being shorter if needed. When mmap
+// doesn't start on a page boundary, such as a slice of a mapping, the first
+// view is shorter too, so that every view ends on a page boundary. It panics
+// if size is not positive.
+func (mmap MMap) SplitBySize(size int) []View {
+	if size <= 0 {
+		panic("gommap: split size must be positive")
+	}
+	size = int(PageAlignUp(int64(size)))
+	skew := pageSkew(mmap)
+	views := make([]View, 0, (skew+len(mmap)+size-1)/size)
+	for off := 0; off < len(mmap); {
+		end := off + size
+		if off == 0 {
+			end -= skew
+		}
+		if end > len(mmap) {
+			end = len(mmap)
+		}
+		views = append(views, mmap.View(off, end-off))
+		off = end
+	}
+	return views
+}
+
+// pageSkew returns how far into its first page mmap starts.
+func pageSkew(mmap MMap) int {
+	return int(mmap.addr() & uintptr(os.Getpagesize()-1))
+}
+
+// View returns a View over length bytes of v starting at offset, relative to
+// the start of v. The returned view shares the same root as v.
+func (v View) View(offset, length int) View {
+	if offset < 0 || length < 0 || offset+length > v.length {
+		panic("gommap: view out of range")
+	}
+	return View{root: v.root, offset: v.offset + offset, length: length}
+}
+
+// Bytes returns the memory covered by the view.
+func (v View) Bytes() []byte {
+	return v.root[v.offset : v.offset+v.length : v.offset+v.length]
+}
+
+// Offset returns the position of the view within its root mapping.
+func (v View) Offset() int {
+	return v.offset
+}
+
+// Len returns the length of the view in bytes.
+func (v View) Len() int {
+	return v.length
+}
+
+// Root returns the mapping the view was taken from.
+func (v View) Root() MMap {
+	return v.root
+}
+
+// aligned returns the memory covering every page touched by the view. The
+// root needn't start on a page boundary, so the address itself is rounded
+// down.
+func (v View) aligned() MMap {
+	return pageAligned(v.Bytes())
+}
+
+// Sync flushes changes made to the pages covered by the view back to the
+// device. See MMap.Sync for the meaning of flags.
+func (v View) Sync(flags SyncFlags) error {
+	if v.length == 0 {
+		return nil
+	}
+	return v.aligned().Sync(flags)
+}
+
+// Advise advises the kernel about how to handle the pages covered by the
+// view. See MMap.Advise.
+func (v View) Advise(advice AdviseFlags) error {
+	if v.length == 0 {
+		return nil
+	}
+	return v.aligned().Advise(advice)
+}
+
+// Lock locks the pages covered by the view, preventing them from being
+// swapped out.
+func (v View) Lock() error {
+	if v.length == 0 {
+		return nil
+	}
+	return v.aligned().Lock()
+}
+
+// Unlock unlocks the pages covered by the view, allowing them to swap out
+// again.
+func (v View) Unlock() error {
+	if v.length == 0 {
+		return nil
+	}
+	return v.aligned().Unlock()
+}
+
+// The AdvisedView type is a View whose pages were given an access pattern
+// hint that only lasts until the view is closed, so the hint is scoped to
+// the code reading through the view rather than set for good on the whole
+// mapping.
+//
+// The hint applies to whole pages, so views sharing a page override each
+// other's hints. Readahead driven by the file descriptor, as set by fadvise,
+// is shared by every mapping of the file and isn't changed.
+type AdvisedView struct {
+	View
+	closed bool
+}
+
+func (v View) advised(advice AdviseFlags) (*AdvisedView, error) {
+	if err := v.Advise(advice); err != nil {
+		return nil, err
+	}
+	return &AdvisedView{View: v}, nil
+}
+
+// SequentialReader returns the view with its pages advised with
+// MADV_SEQUENTIAL, so the kernel reads aggressively ahead and drops pages
+// soon after they were read.
+func (v View) SequentialReader() (*AdvisedView, error) {
+	return v.advised(MADV_SEQUENTIAL)
+}
+
+// RandomAccessor returns the view with its pages advised with MADV_RANDOM,
+// so the kernel doesn't read ahead of the pages accessed.
+func (v View) RandomAccessor() (*AdvisedView, error) {
+	return v.advised(MADV_RANDOM)
+}
+
+// Close resets the pages of the view to MADV_NORMAL. Closing a view twice
+// returns ErrClosed.
+func (v *AdvisedView) Close() error {
+	if v.closed {
+		return ErrClosed
+	}
+	v.closed = true
+	return v.Advise(MADV_NORMAL)
+}
@@ -0,0 +1,55 @@
+package gommap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// _SPLICE_F_GIFT is from linux/splice.h.
+const _SPLICE_F_GIFT = 0x8
+
+// SpliceTo hands the pages of mmap to the write end of pipe with vmsplice,
+// without copying them, so a large buffer can be fed to another process
+// reading the pipe, such as a compressor. It blocks until the whole of
+// mmap went into the pipe and returns how many bytes did.
+//
+// The pipe refers to the pages and doesn't copy them, so they must not be
+// modified, and mmap not unmapped, until the reader consumed them. If gift
+// is set, the pages are given away with SPLICE_F_GIFT, allowing the reader
+// to move them out of the pipe with splice rather than copy them; mmap must
+// then be page aligned and never used again, other than to unmap it.
+func (mmap MMap) SpliceTo(pipe *os.File, gift bool) (int, error) {
+	rc, err := pipe.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var flags uintptr
+	if gift {
+		flags = _SPLICE_F_GIFT
+	}
+	var sent int
+	var serr error
+	err = rc.Write(func(fd uintptr) bool {
+		for sent < len(mmap) {
+			iov := iovec{uintptr(unsafe.Pointer(&mmap[sent])), uintptr(len(mmap) - sent)}
+			n, _, errno := syscall.Syscall6(_SYS_VMSPLICE, fd, uintptr(unsafe.Pointer(&iov)), 1, flags, 0, 0)
+			switch {
+			case errno == syscall.EINTR:
+				continue
+			case errno == syscall.EAGAIN:
+				// Wait for the reader to make room in the pipe.
+				return false
+			case errno != 0:
+				serr = errno
+				return true
+			}
+			sent += int(n)
+		}
+		return true
+	})
+	if err == nil {
+		err = serr
+	}
+	return sent, err
+}
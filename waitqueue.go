@@ -0,0 +1,44 @@
+package gommap
+
+import "sync/atomic"
+
+// The waitQueue type lets processes sleep until some condition on shared
+// memory may have changed. It is made of two 32-bit words in a mapping: a
+// wake-up epoch that waiters sleep on, and a count of sleeping waiters which
+// lets wake skip the system call when nobody is waiting.
+//
+// To wait, read the epoch with seq, check the condition, and if it doesn't
+// hold call wait with the epoch read. Whoever changes the condition must do
+// so before calling wake, so the wake-up can't be missed.
+type waitQueue struct {
+	epoch   *uint32
+	waiters *uint32
+}
+
+// newWaitQueue returns the waitQueue stored in the 8 bytes at off in mmap,
+// which must have been validated by the caller.
+func newWaitQueue(mmap MMap, off int) waitQueue {
+	epoch, _ := mmap.uint32Ptr(off)
+	waiters, _ := mmap.uint32Ptr(off + 4)
+	return waitQueue{epoch: epoch, waiters: waiters}
+}
+
+// seq returns the current epoch.
+func (q waitQueue) seq() uint32 {
+	return atomic.LoadUint32(q.epoch)
+}
+
+// wait sleeps until the epoch moves past e.
+func (q waitQueue) wait(e uint32) {
+	atomic.AddUint32(q.waiters, 1)
+	futexWait(q.epoch, e)
+	atomic.AddUint32(q.waiters, ^uint32(0))
+}
+
+// wake wakes every waiter.
+func (q waitQueue) wake() {
+	atomic.AddUint32(q.epoch, 1)
+	if atomic.LoadUint32(q.waiters) > 0 {
+		futexWake(q.epoch, int(^uint32(0)>>1))
+	}
+}
@@ -0,0 +1,264 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+// walFrameHeader is the size of the header framing each WAL record: its
+// length and the CRC-32C of the length and payload, both little-endian
+// 32-bit integers.
+const walFrameHeader = 8
+
+// The WAL type is a write-ahead log stored in a preallocated, mapped file.
+// Records are appended by copying them into the mapping, and made durable by
+// Commit, which flushes everything appended so far with MS_SYNC. Concurrent
+// Commit calls are grouped: while one flush is in progress, the others wait
+// for it and share the next one, so many writers pay for few flushes.
+//
+// Each record is framed with its length and a checksum. When the log is
+// opened, it is scanned up to the last record whose checksum is valid, so a
+// record torn by a crash and everything after it are dropped. A zero length
+// frame always follows the last record, terminating the scan.
+//
+// A WAL is safe for concurrent use.
+type WAL struct {
+	file *os.File
+	mmap MMap
+
+	mu      sync.Mutex
+	flushed *sync.Cond
+	size    int64
+	synced  int64
+	syncing bool
+	closed  bool
+}
+
+// OpenWAL opens or creates the log file at path, growing it to size bytes
+// if it is smaller, and recovers the records it holds.
+func OpenWAL(path string, size int64) (*WAL, error) {
+	if size <= walFrameHeader || int64(int(size)) != size {
+		return nil, ErrSize
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if fi.Size() < size {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else {
+		size = fi.Size()
+	}
+	mmap, err := Map(file.Fd(), PROT_READ|PROT_WRITE, MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &WAL{file: file, mmap: mmap}
+	w.flushed = sync.NewCond(&w.mu)
+	w.size = w.recover()
+	// Whatever follows the last valid record is garbage, so it must be
+	// terminated for good before new records are appended and flushed.
+	w.terminate(w.size)
+	if err := w.mmap.View(int(w.size), w.frameEnd(w.size)-int(w.size)).Sync(MS_SYNC); err != nil {
+		mmap.UnsafeUnmap()
+		file.Close()
+		return nil, err
+	}
+	w.synced = w.size
+	return w, nil
+}
+
+// frame returns the payload of the record at pos, or false if there's no
+// valid record there.
+func (w *WAL) frame(pos int64) ([]byte, bool) {
+	return walFrame(w.mmap, pos)
+}
+
+// walFrame returns the payload of the WAL frame at pos in mmap, or false if
+// there's no valid frame there.
+func walFrame(mmap MMap, pos int64) ([]byte, bool) {
+	if pos+walFrameHeader > int64(len(mmap)) {
+		return nil, false
+	}
+	n := binary.LittleEndian.Uint32(mmap[pos:])
+	if n == 0 || int64(n) > int64(len(mmap))-pos-walFrameHeader {
+		return nil, false
+	}
+	start := pos + walFrameHeader
+	p := mmap[start : start+int64(n) : start+int64(n)]
+	if walChecksum(mmap[pos:pos+4], p) != binary.LittleEndian.Uint32(mmap[pos+4:]) {
+		return nil, false
+	}
+	return p, true
+}
+
+func walChecksum(length, p []byte) uint32 {
+	return crc32.Update(crc32.Checksum(length, castagnoli), castagnoli, p)
+}
+
+// recover returns the end of the last valid record.
+func (w *WAL) recover() int64 {
+	var pos int64
+	for {
+		p, ok := w.frame(pos)
+		if !ok {
+			return pos
+		}
+		pos += walFrameHeader + int64(len(p))
+	}
+}
+
+// terminate writes a zero length at pos, if there's room for a frame.
+func (w *WAL) terminate(pos int64) {
+	if pos+walFrameHeader <= int64(len(w.mmap)) {
+		binary.LittleEndian.PutUint32(w.mmap[pos:], 0)
+	}
+}
+
+// frameEnd returns the end of the terminator written at pos.
+func (w *WAL) frameEnd(pos int64) int {
+	if pos+walFrameHeader <= int64(len(w.mmap)) {
+		return int(pos) + 4
+	}
+	return int(pos)
+}
+
+// Append copies p into the log as a new record and returns its position,
+// to be given to ReadAt. The record isn't durable until Commit returns. It
+// returns ErrFull if the log doesn't have room for the record, and ErrSize
+// if p is empty or longer than 4 GB.
+func (w *WAL) Append(p []byte) (int64, error) {
+	if len(p) == 0 || uint64(len(p)) > 1<<32-1 {
+		return 0, ErrSize
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	pos := w.size
+	if int64(len(p)) > int64(len(w.mmap))-pos-walFrameHeader {
+		return 0, ErrFull
+	}
+	end := pos + walFrameHeader + int64(len(p))
+	copy(w.mmap[pos+walFrameHeader:], p)
+	w.terminate(end)
+	binary.LittleEndian.PutUint32(w.mmap[pos:], uint32(len(p)))
+	binary.LittleEndian.PutUint32(w.mmap[pos+4:], walChecksum(w.mmap[pos:pos+4], p))
+	w.size = end
+	return pos, nil
+}
+
+// Commit makes every record appended before the call durable, flushing them
+// with MS_SYNC unless a flush that covers them is already in progress.
+func (w *WAL) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	target := w.size
+	for w.synced < target {
+		if w.syncing {
+			w.flushed.Wait()
+			continue
+		}
+		if w.closed {
+			return ErrClosed
+		}
+		start, end := w.synced, w.size
+		w.syncing = true
+		w.mu.Unlock()
+		// The terminator is flushed too: without it, stale frames past the
+		// new records could pass for valid ones after a crash.
+		err := w.mmap.View(int(start), w.frameEnd(end)-int(start)).Sync(MS_SYNC)
+		w.mu.Lock()
+		w.syncing = false
+		w.flushed.Broadcast()
+		if err != nil {
+			return err
+		}
+		w.synced = end
+	}
+	return nil
+}
+
+// ReadAt returns the record stored at pos, as returned by Append. The slice
+// points into the mapping and is only valid until the log is closed.
+func (w *WAL) ReadAt(pos int64) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, ErrClosed
+	}
+	if pos < 0 || pos >= w.size {
+		return nil, ErrOutOfBounds
+	}
+	p, ok := w.frame(pos)
+	if !ok {
+		return nil, ErrCorrupt
+	}
+	return p, nil
+}
+
+// Replay calls fn with the position and payload of each record in the log,
+// in order, including those not committed yet. Iteration stops if fn
+// returns false. The payloads point into the mapping and are only valid
+// until the log is closed.
+func (w *WAL) Replay(fn func(pos int64, p []byte) bool) error {
+	w.mu.Lock()
+	size, closed := w.size, w.closed
+	w.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	for pos := int64(0); pos < size; {
+		p, ok := w.frame(pos)
+		if !ok {
+			return ErrCorrupt
+		}
+		if !fn(pos, p) {
+			return nil
+		}
+		pos += walFrameHeader + int64(len(p))
+	}
+	return nil
+}
+
+// Size returns the number of bytes used by the records in the log.
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Close commits the records appended so far, and unmaps and closes the log.
+func (w *WAL) Close() error {
+	if err := w.Commit(); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	for w.syncing {
+		w.flushed.Wait()
+	}
+	w.closed = true
+	if err := w.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
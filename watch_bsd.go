@@ -0,0 +1,70 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package gommap
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// watchPoll bounds how long wait takes to notice that the watcher was
+// stopped, as a kevent call can't be interrupted from another thread.
+const watchPoll = 100 * time.Millisecond
+
+// The dirWatcher type waits for changes to the entries of a directory.
+type dirWatcher struct {
+	kq, dir int
+	stopped int32
+}
+
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	dfd, err := syscall.Open(dir, syscall.O_RDONLY, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		syscall.Close(dfd)
+		return nil, os.NewSyscallError("kqueue", err)
+	}
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, dfd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	ev.Fflags = syscall.NOTE_WRITE
+	if _, err := syscall.Kevent(kq, []syscall.Kevent_t{ev}, nil, nil); err != nil {
+		syscall.Close(kq)
+		syscall.Close(dfd)
+		return nil, os.NewSyscallError("kevent", err)
+	}
+	return &dirWatcher{kq: kq, dir: dfd}, nil
+}
+
+// wait blocks until something changed in the directory, and returns false
+// once the watcher is stopped.
+func (w *dirWatcher) wait() bool {
+	events := make([]syscall.Kevent_t, 1)
+	timeout := syscall.NsecToTimespec(int64(watchPoll))
+	for atomic.LoadInt32(&w.stopped) == 0 {
+		n, err := syscall.Kevent(w.kq, nil, events, &timeout)
+		if err != nil && err != syscall.EINTR {
+			return false
+		}
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// stop makes wait return false.
+func (w *dirWatcher) stop() {
+	atomic.StoreInt32(&w.stopped, 1)
+}
+
+// release frees the watcher once wait has returned false.
+func (w *dirWatcher) release() {
+	syscall.Close(w.kq)
+	syscall.Close(w.dir)
+}
@@ -0,0 +1,42 @@
+package gommap
+
+import (
+	"os"
+	"syscall"
+)
+
+// The dirWatcher type waits for changes to the entries of a directory.
+type dirWatcher struct {
+	f *os.File
+}
+
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	mask := uint32(syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE)
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// The descriptor is non-blocking, so reads go through the runtime
+	// poller and closing the file interrupts them.
+	return &dirWatcher{f: os.NewFile(uintptr(fd), "inotify")}, nil
+}
+
+// wait blocks until something changed in the directory, and returns false
+// once the watcher is stopped.
+func (w *dirWatcher) wait() bool {
+	var buf [4096]byte
+	_, err := w.f.Read(buf[:])
+	return err == nil
+}
+
+// stop makes wait return false.
+func (w *dirWatcher) stop() {
+	w.f.Close()
+}
+
+// release frees the watcher once wait has returned false.
+func (w *dirWatcher) release() {}
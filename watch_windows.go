@@ -0,0 +1,67 @@
+package gommap
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procFindFirstChangeNotificationW = modkernel32.NewProc("FindFirstChangeNotificationW")
+	procFindNextChangeNotification   = modkernel32.NewProc("FindNextChangeNotification")
+	procFindCloseChangeNotification  = modkernel32.NewProc("FindCloseChangeNotification")
+)
+
+const (
+	_FILE_NOTIFY_CHANGE_FILE_NAME  = 0x1
+	_FILE_NOTIFY_CHANGE_LAST_WRITE = 0x10
+
+	// watchPollMillis bounds how long wait takes to notice that the
+	// watcher was stopped.
+	watchPollMillis = 100
+)
+
+// The dirWatcher type waits for changes to the entries of a directory.
+type dirWatcher struct {
+	h       syscall.Handle
+	stopped int32
+}
+
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	p, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := procFindFirstChangeNotificationW.Call(uintptr(unsafe.Pointer(p)), 0, _FILE_NOTIFY_CHANGE_FILE_NAME|_FILE_NOTIFY_CHANGE_LAST_WRITE)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return nil, os.NewSyscallError("FindFirstChangeNotification", err)
+	}
+	return &dirWatcher{h: syscall.Handle(h)}, nil
+}
+
+// wait blocks until something changed in the directory, and returns false
+// once the watcher is stopped.
+func (w *dirWatcher) wait() bool {
+	for atomic.LoadInt32(&w.stopped) == 0 {
+		ev, err := syscall.WaitForSingleObject(w.h, watchPollMillis)
+		if err != nil {
+			return false
+		}
+		if ev == syscall.WAIT_OBJECT_0 {
+			procFindNextChangeNotification.Call(uintptr(w.h))
+			return true
+		}
+	}
+	return false
+}
+
+// stop makes wait return false.
+func (w *dirWatcher) stop() {
+	atomic.StoreInt32(&w.stopped, 1)
+}
+
+// release frees the watcher once wait has returned false.
+func (w *dirWatcher) release() {
+	procFindCloseChangeNotification.Call(uintptr(w.h))
+}
@@ -0,0 +1,237 @@
+//go:build !windows
+// +build !windows
+
+package gommap
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"syscall"
+)
+
+// Defaults of a WindowedMapper.
+const (
+	defaultWindowSize = 16 << 20
+	defaultMaxWindows = 16
+)
+
+// The WindowedMapper type reads and writes a file through memory mappings
+// of windows of it, keeping at most a given number of them mapped and
+// unmapping the least recently used one to make room for another. It lets
+// files far larger than the address space, as found on 32-bit platforms or
+// in processes whose address space is constrained, be accessed through
+// mappings: the address space taken is bounded by the window size times the
+// number of windows.
+//
+// Windows are mapped with MAP_SHARED, so writes reach the file whether the
+// window they went through is still mapped or not. The size of the file is
+// taken when the mapper is created. A WindowedMapper implements
+// io.ReaderAt and io.WriterAt, and is safe for concurrent use, though
+// accesses are serialized.
+type WindowedMapper struct {
+	fd         uintptr
+	prot       ProtFlags
+	size       int64
+	windowSize int64
+	max        int
+
+	mu      sync.Mutex
+	lru     *list.List
+	windows map[int64]*list.Element
+	maps    int64
+	closed  bool
+}
+
+type mappedWindow struct {
+	index int64
+	mmap  MMap
+}
+
+// NewWindowedMapper returns a mapper over the file at fd, mapping windows
+// of windowSize bytes, which must be a multiple of the page size, with prot,
+// and keeping up to maxWindows of them mapped. Zero values select windows
+// of 16 MiB and up to 16 of them.
+func NewWindowedMapper(fd uintptr, prot ProtFlags, windowSize int64, maxWindows int) (*WindowedMapper, error) {
+	if windowSize == 0 {
+		windowSize = defaultWindowSize
+	}
+	if maxWindows == 0 {
+		maxWindows = defaultMaxWindows
+	}
+	if windowSize < 0 || maxWindows < 0 || uint64(windowSize) > uint64(maxInt) {
+		return nil, ErrSize
+	}
+	if windowSize != PageAlignUp(windowSize) {
+		return nil, ErrUnaligned
+	}
+	size, regular, err := fileSize(fd)
+	if err != nil {
+		return nil, err
+	}
+	if !regular {
+		return nil, ErrLengthRequired
+	}
+	return &WindowedMapper{
+		fd:         fd,
+		prot:       prot,
+		size:       size,
+		windowSize: windowSize,
+		max:        maxWindows,
+		lru:        list.New(),
+		windows:    make(map[int64]*list.Element),
+	}, nil
+}
+
+// Size returns the size of the file.
+func (w *WindowedMapper) Size() int64 {
+	return w.size
+}
+
+// Maps returns how many windows have been mapped so far, a measure of how
+// well accesses fit in the windows kept mapped.
+func (w *WindowedMapper) Maps() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.maps
+}
+
+// window returns the mapping of window i, mapping it if needed. It must be
+// called with w.mu held.
+func (w *WindowedMapper) window(i int64) (MMap, error) {
+	if e, ok := w.windows[i]; ok {
+		w.lru.MoveToFront(e)
+		return e.Value.(*mappedWindow).mmap, nil
+	}
+	if w.lru.Len() >= w.max {
+		if err := w.evict(w.lru.Back()); err != nil {
+			return nil, err
+		}
+	}
+	start := i * w.windowSize
+	length := w.windowSize
+	if length > w.size-start {
+		length = w.size - start
+	}
+	mmap, err := MapRegion(w.fd, start, length, w.prot, MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	w.windows[i] = w.lru.PushFront(&mappedWindow{index: i, mmap: mmap})
+	w.maps++
+	return mmap, nil
+}
+
+func (w *WindowedMapper) evict(e *list.Element) error {
+	win := e.Value.(*mappedWindow)
+	if err := win.mmap.UnsafeUnmap(); err != nil {
+		return err
+	}
+	w.lru.Remove(e)
+	delete(w.windows, win.index)
+	return nil
+}
+
+// access calls fn on the parts of the file covering the n bytes at off, in
+// order, through their windows.
+func (w *WindowedMapper) access(off int64, n int, fn func(b []byte, done int)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	for done := 0; done < n; {
+		pos := off + int64(done)
+		mmap, err := w.window(pos / w.windowSize)
+		if err != nil {
+			return err
+		}
+		b := mmap[pos%w.windowSize:]
+		if len(b) > n-done {
+			b = b[:n-done]
+		}
+		fn(b, done)
+		done += len(b)
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes of the file starting at off into p, following
+// the io.ReaderAt contract.
+func (w *WindowedMapper) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrOutOfBounds
+	}
+	if off >= w.size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if int64(n) > w.size-off {
+		n = int(w.size - off)
+	}
+	err := w.access(off, n, func(b []byte, done int) {
+		copy(p[done:], b)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes p to the file starting at off, following the io.WriterAt
+// contract. The file isn't grown: writes past its end return
+// ErrOutOfBounds, writing nothing, as would writing to a mapping past the
+// end of its file. It returns ErrReadOnly if the windows aren't writable.
+func (w *WindowedMapper) WriteAt(p []byte, off int64) (int, error) {
+	if w.prot&PROT_WRITE == 0 {
+		return 0, ErrReadOnly
+	}
+	if off < 0 || int64(len(p)) > w.size-off {
+		return 0, ErrOutOfBounds
+	}
+	err := w.access(off, len(p), func(b []byte, done int) {
+		copy(b, p[done:])
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync flushes the windows currently mapped. With MS_SYNC, the file is also
+// synced, which covers the writes made through windows unmapped since.
+func (w *WindowedMapper) Sync(flags SyncFlags) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	for e := w.lru.Front(); e != nil; e = e.Next() {
+		if err := e.Value.(*mappedWindow).mmap.Sync(flags); err != nil {
+			return err
+		}
+	}
+	if flags&MS_SYNC != 0 {
+		return syscall.Fsync(int(w.fd))
+	}
+	return nil
+}
+
+// Close unmaps every window. The file is left open.
+func (w *WindowedMapper) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	for e := w.lru.Back(); e != nil; e = w.lru.Back() {
+		if err := w.evict(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}